@@ -31,6 +31,10 @@ var (
 	// ImageSuccessActionsCounter the number of image success operations.
 	ImageSuccessActionsCounter = metrics.NewLabelCounter(subsystemPouch, "image_success_actions_counter", "The number of image success operations", "action")
 
+	// ImageInfoCacheCounter records the number of hits and misses of the
+	// image information cache.
+	ImageInfoCacheCounter = metrics.NewLabelCounter(subsystemPouch, "image_info_cache", "The number of hits and misses of the image information cache", "result")
+
 	// ContainerActionsTimer records the time cost of each container action.
 	ContainerActionsTimer = metrics.NewLabelTimer(subsystemPouch, "container_actions", "The number of seconds it takes to process each container action", "action")
 
@@ -55,6 +59,7 @@ func Register() {
 		registry.MustRegister(ContainerSuccessActionsCounter)
 		registry.MustRegister(ImageActionsCounter)
 		registry.MustRegister(ImageSuccessActionsCounter)
+		registry.MustRegister(ImageInfoCacheCounter)
 		registry.MustRegister(ContainerActionsTimer)
 		registry.MustRegister(ImageActionsTimer)
 	})
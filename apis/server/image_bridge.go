@@ -7,15 +7,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alibaba/pouch/apis/filters"
 	"github.com/alibaba/pouch/apis/metrics"
 	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/ctrd"
 	"github.com/alibaba/pouch/daemon/mgr"
 	"github.com/alibaba/pouch/pkg/errtypes"
 	"github.com/alibaba/pouch/pkg/httputils"
+	"github.com/alibaba/pouch/pkg/jsonstream"
 	util_metrics "github.com/alibaba/pouch/pkg/utils/metrics"
 
 	"github.com/go-openapi/strfmt"
@@ -24,8 +29,27 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// pullImage will pull an image from a specified registry.
+// queuedHeader is set in response if the save/load operation has been
+// queued because of the concurrency limitation.
+const queuedHeader = "X-Pouch-Queued"
+
+// imageIDHeader is set to the ID of image by the HEAD request of image.
+const imageIDHeader = "X-Pouch-Image-Id"
+
+// The rate limit headers are set in the response of pull if the registry
+// tells the rate limit before the progress is streamed.
+const (
+	rateLimitLimitHeader     = "X-Pouch-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-Pouch-RateLimit-Remaining"
+)
+
+// pullImage will pull an image from a specified registry, or import the
+// image from the rootfs tarball in request body if fromSrc is "-".
 func (s *Server) pullImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	if fromSrc := req.FormValue("fromSrc"); fromSrc != "" {
+		return s.importImage(ctx, rw, req, fromSrc)
+	}
+
 	image := req.FormValue("fromImage")
 	tag := req.FormValue("tag")
 
@@ -56,18 +80,85 @@ func (s *Server) pullImage(ctx context.Context, rw http.ResponseWriter, req *htt
 			return err
 		}
 	}
+
+	var acceptMediaTypes []string
+	for _, mediaType := range strings.Split(req.FormValue("acceptMediaTypes"), ",") {
+		if mediaType = strings.TrimSpace(mediaType); mediaType != "" {
+			acceptMediaTypes = append(acceptMediaTypes, mediaType)
+		}
+	}
+
+	var maxImageSize int64
+	if v := req.FormValue("maxImageSize"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size < 0 {
+			return httputils.NewHTTPError(fmt.Errorf("invalid maxImageSize %q", v), http.StatusBadRequest)
+		}
+		maxImageSize = size
+	}
+
+	out := &rateLimitHeaderWriter{rw: rw}
+
 	// Error information has be sent to client, so no need call resp.Write
-	if err := s.ImageMgr.PullImage(ctx, image, &authConfig, newWriteFlusher(rw)); err != nil {
+	if err := s.ImageMgr.PullImage(ctx, image, &authConfig, newWriteFlusher(out), &mgr.ImagePullOption{
+		AcceptMediaTypes:  acceptMediaTypes,
+		IndexOnly:         httputils.BoolValue(req, "indexOnly"),
+		BestEffort:        httputils.BoolValue(req, "bestEffort"),
+		Lazy:              httputils.BoolValue(req, "lazy"),
+		MaxImageSize:      maxImageSize,
+		Proxy:             req.Header.Get("X-Registry-Proxy"),
+		Snapshotter:       req.Header.Get("X-Pouch-Snapshotter"),
+		RateLimitNotifier: out.setRateLimit,
+	}); err != nil {
 		logrus.Errorf("failed to pull image %s: %v", image, err)
-		if err == errtypes.ErrNotfound {
-			return httputils.NewHTTPError(err, http.StatusNotFound)
-		}
 		return err
 	}
 	metrics.ImageSuccessActionsCounter.WithLabelValues(label).Inc()
 	return nil
 }
 
+// rateLimitHeaderWriter sets the rate limit headers before the response is
+// written, and the rate limit told after that is only in the progress.
+type rateLimitHeaderWriter struct {
+	mu      sync.Mutex
+	rw      http.ResponseWriter
+	written bool
+}
+
+// setRateLimit implements ctrd.RateLimitNotifier.
+func (w *rateLimitHeaderWriter) setRateLimit(host string, limit ctrd.RegistryRateLimit) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.written {
+		return
+	}
+
+	window := ""
+	if limit.Window > 0 {
+		window = fmt.Sprintf(";w=%d", int64(limit.Window/time.Second))
+	}
+	if limit.Limit > 0 {
+		w.rw.Header().Set(rateLimitLimitHeader, strconv.Itoa(limit.Limit)+window)
+	}
+	w.rw.Header().Set(rateLimitRemainingHeader, strconv.Itoa(limit.Remaining)+window)
+}
+
+// Write implements io.Writer.
+func (w *rateLimitHeaderWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.written = true
+	w.mu.Unlock()
+	return w.rw.Write(p)
+}
+
+// Flush implements flusher.
+func (w *rateLimitHeaderWriter) Flush() {
+	if f, ok := w.rw.(flusher); ok {
+		f.Flush()
+	}
+}
+
 func (s *Server) getImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	idOrRef := mux.Vars(req)["name"]
 
@@ -77,27 +168,111 @@ func (s *Server) getImage(ctx context.Context, rw http.ResponseWriter, req *http
 		return err
 	}
 
+	// NOTE: the containers are counted on demand because it scans all the
+	// containers.
+	if httputils.BoolValue(req, "containers") {
+		containers, err := s.containersUsingImage(ctx, imageInfo.ID)
+		if err != nil {
+			return err
+		}
+		count := int64(len(containers))
+		imageInfo.Containers = &count
+	}
+
 	return EncodeResponse(rw, http.StatusOK, imageInfo)
 }
 
+// headImage checks the existence of image without inspecting it, and the ID
+// of image is returned in the header.
+func (s *Server) headImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	idOrRef := mux.Vars(req)["name"]
+
+	exist, id, err := s.ImageMgr.HasImage(ctx, idOrRef)
+	if err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	if !exist {
+		rw.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	rw.Header().Set(imageIDHeader, id.String())
+	rw.WriteHeader(http.StatusOK)
+	return nil
+}
+
 func (s *Server) listImages(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	filter, err := filters.FromParam(req.FormValue("filters"))
 	if err != nil {
 		return err
 	}
 
-	imageList, err := s.ImageMgr.ListImages(ctx, filter)
+	var limit int
+	if v := req.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 0 {
+			return httputils.NewHTTPError(fmt.Errorf("invalid limit %q", v), http.StatusBadRequest)
+		}
+		limit = l
+	}
+
+	opt := &mgr.ImageListOption{
+		All:   httputils.BoolValue(req, "all"),
+		Sort:  req.FormValue("sort"),
+		Order: req.FormValue("order"),
+		Limit: limit,
+		Since: req.FormValue("since"),
+	}
+
+	// the warnings are returned only if they are asked, so that the shape of
+	// response is unchanged for the old clients. They are the IDs of images
+	// which can't be read, and the errors are logged by the image manager.
+	withWarnings := httputils.BoolValue(req, "warnings")
+	warnings := []string{}
+	if withWarnings {
+		opt.Warn = func(id digest.Digest, err error) {
+			warnings = append(warnings, id.String())
+		}
+	}
+
+	imageList, next, err := s.ImageMgr.ListImages(ctx, filter, opt)
 	if err != nil {
 		logrus.Errorf("failed to list images: %v", err)
 		return err
 	}
-	return EncodeResponse(rw, http.StatusOK, imageList)
+
+	if next != "" {
+		rw.Header().Set("X-Next-Cursor", next)
+	}
+
+	if !withWarnings {
+		return EncodeResponse(rw, http.StatusOK, imageList)
+	}
+
+	images := make([]*types.ImageInfo, 0, len(imageList))
+	for i := range imageList {
+		images = append(images, &imageList[i])
+	}
+	return EncodeResponse(rw, http.StatusOK, &types.ImageListResp{
+		Images:   images,
+		Warnings: warnings,
+	})
 }
 
 func (s *Server) searchImages(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	searchPattern := req.FormValue("term")
 	registry := req.FormValue("registry")
 
+	var limit int
+	if v := req.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 0 {
+			return httputils.NewHTTPError(fmt.Errorf("invalid limit %q", v), http.StatusBadRequest)
+		}
+		limit = l
+	}
+
 	// get registry auth from Request header
 	authStr := req.Header.Get("X-Registry-Auth")
 	authConfig := types.AuthConfig{}
@@ -111,7 +286,7 @@ func (s *Server) searchImages(ctx context.Context, rw http.ResponseWriter, req *
 		}
 	}
 
-	searchResultItem, err := s.ImageMgr.SearchImages(ctx, searchPattern, registry, &authConfig)
+	searchResultItem, err := s.ImageMgr.SearchImages(ctx, searchPattern, registry, limit, &authConfig)
 	if err != nil {
 		logrus.Errorf("failed to search images from registry: %v", err)
 		return err
@@ -119,6 +294,57 @@ func (s *Server) searchImages(ctx context.Context, rw http.ResponseWriter, req *
 	return EncodeResponse(rw, http.StatusOK, searchResultItem)
 }
 
+// listRemoteTags lists the tags of repository in the registry.
+func (s *Server) listRemoteTags(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	repo := req.FormValue("repo")
+	if repo == "" {
+		return httputils.NewHTTPError(fmt.Errorf("repo is required"), http.StatusBadRequest)
+	}
+
+	// get registry auth from Request header
+	authStr := req.Header.Get("X-Registry-Auth")
+	authConfig := types.AuthConfig{}
+	if authStr != "" {
+		data := base64.NewDecoder(base64.URLEncoding, strings.NewReader(authStr))
+		if err := json.NewDecoder(data).Decode(&authConfig); err != nil {
+			return err
+		}
+	}
+
+	tags, err := s.ImageMgr.ListRemoteTags(ctx, repo, &authConfig)
+	if err != nil {
+		logrus.Errorf("failed to list tags of %s: %v", repo, err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, tags)
+}
+
+// importImage imports the image from the rootfs tarball in request body.
+func (s *Server) importImage(ctx context.Context, rw http.ResponseWriter, req *http.Request, fromSrc string) error {
+	if fromSrc != "-" {
+		err := fmt.Errorf("only fromSrc=- is supported to import image from request body")
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	ref := req.FormValue("repo")
+	if ref == "" {
+		err := fmt.Errorf("repo cannot be empty")
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+	if tag := req.FormValue("tag"); tag != "" {
+		ref = ref + ":" + tag
+	}
+
+	if err := s.ImageMgr.ImportImage(ctx, ref, req.Form["changes"], req.Body); err != nil {
+		logrus.Errorf("failed to import image %s: %v", ref, err)
+		return err
+	}
+
+	return EncodeResponse(rw, http.StatusOK, jsonstream.JSONMessage{
+		Status: fmt.Sprintf("Imported image: %s", ref),
+	})
+}
+
 // removeImage deletes an image by reference.
 func (s *Server) removeImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	name := mux.Vars(req)["name"]
@@ -140,6 +366,12 @@ func (s *Server) removeImage(ctx context.Context, rw http.ResponseWriter, req *h
 	}(time.Now())
 
 	isForce := httputils.BoolValue(req, "force")
+	// refuseIfReferenced blocks the deletion even with force if the image
+	// is referenced by any container, running or stopped.
+	refuseIfReferenced := httputils.BoolValue(req, "refuse-if-referenced")
+	// pruneDigest removes the orphaned digest references with the tag,
+	// which may remove the image.
+	pruneDigest := httputils.BoolValue(req, "prune-digest")
 
 	isImageIDPrefix := func(imageID string, name string) bool {
 		if strings.HasPrefix(imageID, name) || strings.HasPrefix(digest.Digest(imageID).Hex(), name) {
@@ -149,23 +381,34 @@ func (s *Server) removeImage(ctx context.Context, rw http.ResponseWriter, req *h
 	}
 
 	// We should check the image whether used by container when there is only one primary reference
-	// or the image is removed by image ID.
-	if len(refs) == 1 || isImageIDPrefix(image.ID, name) {
-		containers, err := s.ContainerMgr.List(ctx, &mgr.ContainerListOption{
-			All: true,
-			FilterFunc: func(c *mgr.Container) bool {
-				return c.Image == image.ID
-			}})
+	// or the image is removed by image ID or will be removed with the digest references.
+	removesImage := len(refs) == 1 || isImageIDPrefix(image.ID, name)
+	if !removesImage && pruneDigest {
+		removesImage, err = s.ImageMgr.PruneDigestRemovesImage(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if removesImage {
+		containers, err := s.containersUsingImage(ctx, image.ID)
 		if err != nil {
 			return err
 		}
 
+		if refuseIfReferenced && len(containers) > 0 {
+			return httputils.NewHTTPError(referencedImageError(image.ID, containers), http.StatusConflict)
+		}
+
 		if !isForce && len(containers) > 0 {
 			return fmt.Errorf("Unable to remove the image %q (must force) - container (%s, %s) is using this image", image.ID, containers[0].ID, containers[0].Name)
 		}
 	}
 
-	if err := s.ImageMgr.RemoveImage(ctx, name, isForce); err != nil {
+	if err := s.ImageMgr.RemoveImage(ctx, name, &mgr.ImageRemoveOption{
+		Force:       isForce,
+		PruneDigest: pruneDigest,
+	}); err != nil {
 		return err
 	}
 
@@ -174,16 +417,301 @@ func (s *Server) removeImage(ctx context.Context, rw http.ResponseWriter, req *h
 	return nil
 }
 
+// removeImages deletes a batch of images.
+func (s *Server) removeImages(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	var names []string
+	if err := json.NewDecoder(req.Body).Decode(&names); err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	label := util_metrics.ActionDeleteLabel
+	defer func(start time.Time) {
+		metrics.ImageActionsCounter.WithLabelValues(label).Inc()
+		metrics.ImageActionsTimer.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	result, err := s.ImageMgr.RemoveImages(ctx, names, httputils.BoolValue(req, "force"), s.isImageUsed(ctx))
+	if err != nil {
+		return err
+	}
+
+	metrics.ImageSuccessActionsCounter.WithLabelValues(label).Inc()
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// relabelNamespace moves the local images from one namespace to another.
+func (s *Server) relabelNamespace(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	result, err := s.ImageMgr.RelabelNamespace(ctx, req.FormValue("from"), req.FormValue("to"))
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// removeRepository deletes all the references of the repository.
+func (s *Server) removeRepository(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	repo := mux.Vars(req)["repo"]
+
+	label := util_metrics.ActionDeleteLabel
+	defer func(start time.Time) {
+		metrics.ImageActionsCounter.WithLabelValues(label).Inc()
+		metrics.ImageActionsTimer.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	result, err := s.ImageMgr.RemoveRepository(ctx, repo, httputils.BoolValue(req, "force"), s.isImageUsed(ctx))
+	if err != nil {
+		return err
+	}
+
+	metrics.ImageSuccessActionsCounter.WithLabelValues(label).Inc()
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// isImageUsed returns the mgr.ImageUsedFunc which checks the containers. The
+// containers are listed once for all the images checked by the request, like
+// the batch removal.
+func (s *Server) isImageUsed(ctx context.Context) mgr.ImageUsedFunc {
+	var (
+		once sync.Once
+		used map[string]struct{}
+		err  error
+	)
+	return func(imageID digest.Digest) (bool, error) {
+		once.Do(func() {
+			used, err = s.usedImages(ctx)
+		})
+		if err != nil {
+			return false, err
+		}
+
+		_, ok := used[imageID.String()]
+		return ok, nil
+	}
+}
+
+// usedImages returns the IDs of images which are used by any container.
+func (s *Server) usedImages(ctx context.Context) (map[string]struct{}, error) {
+	containers, err := s.ContainerMgr.List(ctx, &mgr.ContainerListOption{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]struct{}, len(containers))
+	for _, c := range containers {
+		used[c.Image] = struct{}{}
+	}
+	return used, nil
+}
+
+// referencedImageError lists all the containers referencing the image.
+func referencedImageError(imageID string, containers []*mgr.Container) error {
+	details := make([]string, 0, len(containers))
+	for _, c := range containers {
+		status := "unknown"
+		if c.State != nil {
+			status = string(c.State.Status)
+		}
+		details = append(details, fmt.Sprintf("%s (%s, %s)", c.ID, c.Name, status))
+	}
+	return fmt.Errorf("Unable to remove the image %q - referenced by %d container(s): %s", imageID, len(containers), strings.Join(details, ", "))
+}
+
+// containersUsingImage returns the containers which are using the image.
+func (s *Server) containersUsingImage(ctx context.Context, imageID string) ([]*mgr.Container, error) {
+	return s.ContainerMgr.List(ctx, &mgr.ContainerListOption{
+		All: true,
+		FilterFunc: func(c *mgr.Container) bool {
+			return c.Image == imageID
+		}})
+}
+
+// pruneImages removes the images which are not used by any container.
+func (s *Server) pruneImages(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	filter, err := filters.FromParam(req.FormValue("filters"))
+	if err != nil {
+		return err
+	}
+
+	result, err := s.ImageMgr.PruneImages(ctx, filter, s.isImageUsed(ctx))
+	if err != nil {
+		logrus.Errorf("failed to prune images: %v", err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// garbageCollectImages removes the content which is not referenced by any image.
+func (s *Server) garbageCollectImages(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	result, err := s.ImageMgr.GarbageCollect(ctx)
+	if err != nil {
+		logrus.Errorf("failed to garbage collect images: %v", err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// getImageUsage gets the disk usage of images.
+func (s *Server) getImageUsage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	usage, err := s.ImageMgr.Usage(ctx, s.isImageUsed(ctx))
+	if err != nil {
+		logrus.Errorf("failed to get image usage: %v", err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, usage)
+}
+
+// diagnoseImageStore reports the drift between the image store and containerd.
+func (s *Server) diagnoseImageStore(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	diagnosis, err := s.ImageMgr.DiagnoseImageStore(ctx)
+	if err != nil {
+		logrus.Errorf("failed to diagnose image store: %v", err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, diagnosis)
+}
+
+// diffImages compares the layers and the config of two images.
+func (s *Server) diffImages(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	a, b := req.FormValue("a"), req.FormValue("b")
+	if a == "" || b == "" {
+		return httputils.NewHTTPError(fmt.Errorf("both a and b are required"), http.StatusBadRequest)
+	}
+
+	diff, err := s.ImageMgr.DiffImages(ctx, a, b)
+	if err != nil {
+		logrus.Errorf("failed to diff image %s and %s: %v", a, b, err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, diff)
+}
+
+// validateImageReference validates the reference to be used as target tag,
+// and the invalid reference is reported in the result instead of error.
+func (s *Server) validateImageReference(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	ref := req.FormValue("ref")
+	if ref == "" {
+		return httputils.NewHTTPError(fmt.Errorf("ref is required"), http.StatusBadRequest)
+	}
+
+	result := &types.ImageReferenceValidation{}
+	normalized, err := s.ImageMgr.NormalizeReference(ref)
+	if err == nil {
+		result.Normalized = normalized
+		result.Digested = strings.Contains(normalized, "@")
+		err = s.ImageMgr.ValidateReference(ref)
+	}
+
+	switch {
+	case err == nil:
+		result.Valid = true
+	case errtypes.IsInvalidParam(err):
+		result.Message = err.Error()
+	default:
+		logrus.Errorf("failed to validate reference %s: %v", ref, err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, result)
+}
+
+// listImageProvenance lists the provenance records of image pulls.
+func (s *Server) listImageProvenance(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	records, err := s.ImageMgr.ListProvenance(ctx)
+	if err != nil {
+		logrus.Errorf("failed to list image provenance: %v", err)
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, records)
+}
+
+// getImagePullStats returns the pull statistics of each registry.
+func (s *Server) getImagePullStats(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	var windows []time.Duration
+	for _, w := range req.Form["window"] {
+		window, err := time.ParseDuration(w)
+		if err != nil {
+			return httputils.NewHTTPError(fmt.Errorf("invalid window %s: %v", w, err), http.StatusBadRequest)
+		}
+		windows = append(windows, window)
+	}
+
+	stats, err := s.ImageMgr.PullStats(ctx, windows)
+	if err != nil {
+		return err
+	}
+	return EncodeResponse(rw, http.StatusOK, stats)
+}
+
+// getMirrorHealth returns the health of registry mirrors.
+func (s *Server) getMirrorHealth(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	return EncodeResponse(rw, http.StatusOK, s.ImageMgr.MirrorHealth())
+}
+
+// listCorruptImages returns the images failed to be loaded at bootup.
+func (s *Server) listCorruptImages(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	return EncodeResponse(rw, http.StatusOK, s.ImageMgr.ListCorruptImages())
+}
+
 // postImageTag adds tag for the existing image.
 func (s *Server) postImageTag(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	name := mux.Vars(req)["name"]
 
+	if err := req.ParseForm(); err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	// NOTE: the repeated repo/tag pairs are added by batch, which adds
+	// all of them or none of them.
+	if repos := req.Form["repo"]; len(repos) > 1 {
+		tags := req.Form["tag"]
+		if len(tags) != 0 && len(tags) != len(repos) {
+			return httputils.NewHTTPError(fmt.Errorf("the number of repo %d doesn't match the number of tag %d", len(repos), len(tags)), http.StatusBadRequest)
+		}
+		if httputils.BoolValue(req, "force") {
+			return httputils.NewHTTPError(fmt.Errorf("force is not supported for multiple tags"), http.StatusBadRequest)
+		}
+		if httputils.BoolValue(req, "move") {
+			return httputils.NewHTTPError(fmt.Errorf("move is not supported for multiple tags"), http.StatusBadRequest)
+		}
+
+		targetRefs := make([]string, 0, len(repos))
+		for i, repo := range repos {
+			if len(tags) != 0 && tags[i] != "" {
+				repo = fmt.Sprintf("%s:%s", repo, tags[i])
+			}
+			targetRefs = append(targetRefs, repo)
+		}
+
+		if err := s.ImageMgr.AddTags(ctx, name, targetRefs); err != nil {
+			return err
+		}
+
+		rw.WriteHeader(http.StatusCreated)
+		return nil
+	}
+
 	targetRef := req.FormValue("repo")
 	if tag := req.FormValue("tag"); tag != "" {
 		targetRef = fmt.Sprintf("%s:%s", targetRef, tag)
 	}
 
-	if err := s.ImageMgr.AddTag(ctx, name, targetRef); err != nil {
+	if httputils.BoolValue(req, "move") {
+		if httputils.BoolValue(req, "force") {
+			return httputils.NewHTTPError(fmt.Errorf("force is not supported for moving tag"), http.StatusBadRequest)
+		}
+
+		if err := s.ImageMgr.MoveReference(ctx, name, targetRef); err != nil {
+			return err
+		}
+
+		rw.WriteHeader(http.StatusCreated)
+		return nil
+	}
+
+	if err := s.ImageMgr.AddTag(ctx, name, targetRef, httputils.BoolValue(req, "force"), s.isImageUsed(ctx)); err != nil {
 		return err
 	}
 
@@ -191,15 +719,62 @@ func (s *Server) postImageTag(ctx context.Context, rw http.ResponseWriter, req *
 	return nil
 }
 
+// setImageLabels sets the labels of the existing image.
+func (s *Server) setImageLabels(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	name := mux.Vars(req)["name"]
+
+	var labels map[string]string
+	if err := json.NewDecoder(req.Body).Decode(&labels); err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	if err := s.ImageMgr.SetImageLabels(ctx, name, labels); err != nil {
+		return err
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 // loadImage loads an image by http tar stream.
 func (s *Server) loadImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	imageName := req.FormValue("name")
 
-	if err := s.ImageMgr.LoadImage(ctx, imageName, req.Body); err != nil {
-		return err
+	ctx = mgr.WithQueuedNotifier(ctx, func() {
+		rw.Header().Set(queuedHeader, "true")
+	})
+
+	opt := &mgr.ImageLoadOption{
+		Format: req.FormValue("format"),
 	}
 
-	rw.WriteHeader(http.StatusOK)
+	if fromURL := req.FormValue("fromURL"); fromURL != "" {
+		// get the basic auth of url from Request header
+		authConfig := types.AuthConfig{}
+		if authStr := req.Header.Get("X-Load-Auth"); authStr != "" {
+			data := base64.NewDecoder(base64.URLEncoding, strings.NewReader(authStr))
+			if err := json.NewDecoder(data).Decode(&authConfig); err != nil {
+				return httputils.NewHTTPError(err, http.StatusBadRequest)
+			}
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+
+		// Error information has be sent to client, so no need call resp.Write
+		if err := s.ImageMgr.LoadImageFromURL(ctx, imageName, fromURL, &authConfig, newWriteFlusher(rw), opt); err != nil {
+			logrus.Errorf("failed to load image from url: %v", err)
+			return err
+		}
+		return nil
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	// Error information has be sent to client, so no need call resp.Write
+	if err := s.ImageMgr.LoadImage(ctx, imageName, req.Body, newWriteFlusher(rw), opt); err != nil {
+		logrus.Errorf("failed to load image: %v", err)
+		return err
+	}
 	return nil
 }
 
@@ -207,9 +782,44 @@ func (s *Server) loadImage(ctx context.Context, rw http.ResponseWriter, req *htt
 func (s *Server) saveImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	imageName := req.FormValue("name")
 
-	rw.Header().Set("Content-Type", "application/x-tar")
+	if err := req.ParseForm(); err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+	imageNames := req.Form["names"]
+
+	// NOTE: the client which accepts gzip encoding decompresses the
+	// tarstream transparently, but the compress option asks for the
+	// gzip-compressed tarball.
+	opt := &mgr.ImageSaveOption{
+		Reproducible: httputils.BoolValue(req, "reproducible"),
+		Format:       req.FormValue("format"),
+		From:         req.FormValue("from"),
+	}
+	switch {
+	case httputils.BoolValue(req, "compress"):
+		opt.Compress = true
+		rw.Header().Set("Content-Type", "application/gzip")
+	case httputils.AcceptsEncoding(req, "gzip"):
+		opt.Compress = true
+		rw.Header().Set("Content-Type", "application/x-tar")
+		rw.Header().Set("Content-Encoding", "gzip")
+	default:
+		rw.Header().Set("Content-Type", "application/x-tar")
+	}
 
-	r, err := s.ImageMgr.SaveImage(ctx, imageName)
+	ctx = mgr.WithQueuedNotifier(ctx, func() {
+		rw.Header().Set(queuedHeader, "true")
+	})
+
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	if len(imageNames) > 0 {
+		r, err = s.ImageMgr.SaveImages(ctx, imageNames, opt)
+	} else {
+		r, err = s.ImageMgr.SaveImage(ctx, imageName, opt)
+	}
 	if err != nil {
 		return err
 	}
@@ -220,6 +830,67 @@ func (s *Server) saveImage(ctx context.Context, rw http.ResponseWriter, req *htt
 	return err
 }
 
+// inspectImageLayers gets the information of each layer of the image.
+func (s *Server) inspectImageLayers(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	imageName := mux.Vars(req)["name"]
+
+	layers, err := s.ImageMgr.InspectLayers(ctx, imageName)
+	if err != nil {
+		return err
+	}
+
+	return EncodeResponse(rw, http.StatusOK, layers)
+}
+
+// getImageLayer gets the compressed layer blob of the image.
+func (s *Server) getImageLayer(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	imageName := mux.Vars(req)["name"]
+
+	layerDigest, err := digest.Parse(mux.Vars(req)["digest"])
+	if err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	r, err := s.ImageMgr.GetImageLayer(ctx, imageName, layerDigest)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+
+	output := newWriteFlusher(rw)
+	_, err = io.Copy(output, r)
+	return err
+}
+
+// getImageManifest gets the raw manifest of the image.
+func (s *Server) getImageManifest(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	imageName := mux.Vars(req)["name"]
+
+	data, mediaType, err := s.ImageMgr.GetImageManifest(ctx, imageName)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", mediaType)
+	rw.WriteHeader(http.StatusOK)
+	_, err = rw.Write(data)
+	return err
+}
+
+// getImageConfig gets the complete OCI config of the image.
+func (s *Server) getImageConfig(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	imageName := mux.Vars(req)["name"]
+
+	config, err := s.ImageMgr.GetImageConfig(ctx, imageName)
+	if err != nil {
+		return err
+	}
+
+	return EncodeResponse(rw, http.StatusOK, config)
+}
+
 // getImageHistory gets image history.
 func (s *Server) getImageHistory(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	imageName := mux.Vars(req)["name"]
@@ -232,6 +903,37 @@ func (s *Server) getImageHistory(ctx context.Context, rw http.ResponseWriter, re
 	return EncodeResponse(rw, http.StatusOK, history)
 }
 
+// getImageReferences returns the primary references of image, or all the
+// searchable references including the aliases if all is set.
+func (s *Server) getImageReferences(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	name := mux.Vars(req)["name"]
+
+	exist, id, err := s.ImageMgr.HasImage(ctx, name)
+	if err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+	if !exist {
+		return httputils.NewHTTPError(fmt.Errorf("image %s not found", name), http.StatusNotFound)
+	}
+
+	list := s.ImageMgr.ListReferences
+	if httputils.BoolValue(req, "all") {
+		list = s.ImageMgr.ListAllReferences
+	}
+
+	refs, err := list(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	res := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		res = append(res, ref.String())
+	}
+	sort.Strings(res)
+	return EncodeResponse(rw, http.StatusOK, res)
+}
+
 // pushImage will push an image to a specified registry.
 func (s *Server) pushImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 	name := mux.Vars(req)["name"]
@@ -254,3 +956,64 @@ func (s *Server) pushImage(ctx context.Context, rw http.ResponseWriter, req *htt
 
 	return nil
 }
+
+// pushManifestList assembles the manifest list from the local images and
+// pushes it to registry.
+func (s *Server) pushManifestList(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	name := mux.Vars(req)["name"]
+
+	if err := req.ParseForm(); err != nil {
+		return httputils.NewHTTPError(err, http.StatusBadRequest)
+	}
+
+	images := req.Form["image"]
+	if len(images) == 0 {
+		return httputils.NewHTTPError(fmt.Errorf("at least one image is required"), http.StatusBadRequest)
+	}
+
+	// get registry auth from Request header
+	authStr := req.Header.Get("X-Registry-Auth")
+	authConfig := types.AuthConfig{}
+	if authStr != "" {
+		data := base64.NewDecoder(base64.URLEncoding, strings.NewReader(authStr))
+		if err := json.NewDecoder(data).Decode(&authConfig); err != nil {
+			return err
+		}
+	}
+
+	if err := s.ImageMgr.PushManifestList(ctx, name, images, &authConfig, newWriteFlusher(rw)); err != nil {
+		logrus.Errorf("failed to push manifest list %s: %v", name, err)
+		return err
+	}
+
+	return nil
+}
+
+// copyImage copies the image between registries without the local image.
+func (s *Server) copyImage(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	src, dst := req.FormValue("src"), req.FormValue("dst")
+	if src == "" || dst == "" {
+		return httputils.NewHTTPError(fmt.Errorf("both src and dst are required"), http.StatusBadRequest)
+	}
+
+	// get registry auth of source and destination from Request header
+	var srcAuth, dstAuth types.AuthConfig
+	for header, authConfig := range map[string]*types.AuthConfig{
+		"X-Registry-Auth-Source":      &srcAuth,
+		"X-Registry-Auth-Destination": &dstAuth,
+	} {
+		if authStr := req.Header.Get(header); authStr != "" {
+			data := base64.NewDecoder(base64.URLEncoding, strings.NewReader(authStr))
+			if err := json.NewDecoder(data).Decode(authConfig); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.ImageMgr.CopyImage(ctx, src, dst, &srcAuth, &dstAuth, newWriteFlusher(rw)); err != nil {
+		logrus.Errorf("failed to copy image %s to %s: %v", src, dst, err)
+		return err
+	}
+
+	return nil
+}
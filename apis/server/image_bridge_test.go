@@ -3,6 +3,7 @@ package server
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,8 +13,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alibaba/pouch/apis/filters"
 	"github.com/alibaba/pouch/apis/types"
 	"github.com/alibaba/pouch/daemon/mgr"
+	"github.com/alibaba/pouch/pkg/httputils"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,7 +29,7 @@ type mockImgePull struct {
 	handler func(ctx context.Context, imageRef string, authConfig *types.AuthConfig, out io.Writer) error
 }
 
-func (m *mockImgePull) PullImage(ctx context.Context, imageRef string, authConfig *types.AuthConfig, out io.Writer) error {
+func (m *mockImgePull) PullImage(ctx context.Context, imageRef string, authConfig *types.AuthConfig, out io.Writer, opt *mgr.ImagePullOption) error {
 	return m.handler(ctx, imageRef, authConfig, out)
 }
 
@@ -120,3 +127,269 @@ func getMetric(ctx context.Context, t *testing.T, s *Server, key string, keySucc
 
 	return iCount, iCountSuccess
 }
+
+type mockImageInspect struct {
+	mgr.ImageMgr
+	id string
+}
+
+func (m *mockImageInspect) GetImage(ctx context.Context, idOrRef string) (*types.ImageInfo, error) {
+	return &types.ImageInfo{ID: m.id}, nil
+}
+
+type mockContainerList struct {
+	mgr.ContainerMgr
+	containers []*mgr.Container
+	lists      int
+}
+
+func (m *mockContainerList) List(ctx context.Context, option *mgr.ContainerListOption) ([]*mgr.Container, error) {
+	m.lists++
+
+	var res []*mgr.Container
+	for _, c := range m.containers {
+		if option.FilterFunc == nil || option.FilterFunc(c) {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func Test_getImage_containers(t *testing.T) {
+	s := Server{
+		ImageMgr: &mockImageInspect{id: "sha256:image"},
+		ContainerMgr: &mockContainerList{containers: []*mgr.Container{
+			{ID: "c1", Image: "sha256:image"},
+			{ID: "c2", Image: "sha256:other"},
+			{ID: "c3", Image: "sha256:image"},
+		}},
+	}
+
+	inspect := func(url string) types.ImageInfo {
+		w := httptest.NewRecorder()
+		assert.NoError(t, s.getImage(context.Background(), w, httptest.NewRequest(http.MethodGet, url, nil)))
+
+		var info types.ImageInfo
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+		return info
+	}
+
+	// the containers are not counted by default
+	assert.Nil(t, inspect("/images/busybox/json").Containers)
+
+	info := inspect("/images/busybox/json?containers=1")
+	if assert.NotNil(t, info.Containers) {
+		assert.Equal(t, int64(2), *info.Containers)
+	}
+}
+
+func Test_isImageUsed(t *testing.T) {
+	containers := &mockContainerList{containers: []*mgr.Container{
+		{ID: "c1", Image: "sha256:image"},
+		{ID: "c2", Image: "sha256:other"},
+	}}
+	s := Server{ContainerMgr: containers}
+
+	isUsed := s.isImageUsed(context.Background())
+	for id, expected := range map[digest.Digest]bool{
+		"sha256:image":  true,
+		"sha256:other":  true,
+		"sha256:unused": false,
+	} {
+		used, err := isUsed(id)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, used, id)
+	}
+
+	// the containers are listed once for all the images
+	assert.Equal(t, 1, containers.lists)
+}
+
+type mockImageUsage struct {
+	mgr.ImageMgr
+	ids []digest.Digest
+}
+
+func (m *mockImageUsage) Usage(ctx context.Context, isUsed mgr.ImageUsedFunc) (*types.ImageDiskUsage, error) {
+	usage := &types.ImageDiskUsage{}
+	for _, id := range m.ids {
+		used, err := isUsed(id)
+		if err != nil {
+			return nil, err
+		}
+
+		usage.Images++
+		if used {
+			usage.ActiveImages++
+		}
+	}
+	return usage, nil
+}
+
+func Test_getImageUsage(t *testing.T) {
+	containers := &mockContainerList{containers: []*mgr.Container{
+		{ID: "c1", Image: "sha256:image"},
+		{ID: "c2", Image: "sha256:other"},
+		{ID: "c3", Image: "sha256:image"},
+	}}
+	s := Server{
+		ImageMgr:     &mockImageUsage{ids: []digest.Digest{"sha256:image", "sha256:other", "sha256:unused"}},
+		ContainerMgr: containers,
+	}
+
+	w := httptest.NewRecorder()
+	assert.NoError(t, s.getImageUsage(context.Background(), w, httptest.NewRequest(http.MethodGet, "/images/usage", nil)))
+
+	var usage types.ImageDiskUsage
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&usage))
+	assert.Equal(t, int64(3), usage.Images)
+	assert.Equal(t, int64(2), usage.ActiveImages)
+
+	// the containers are listed once for all the images of the request
+	assert.Equal(t, 1, containers.lists)
+}
+
+type mockImageRemove struct {
+	mgr.ImageMgr
+	id      string
+	refs    []string
+	prunes  bool
+	removed []string
+}
+
+func (m *mockImageRemove) GetImage(ctx context.Context, idOrRef string) (*types.ImageInfo, error) {
+	return &types.ImageInfo{ID: m.id}, nil
+}
+
+func (m *mockImageRemove) ListReferences(ctx context.Context, imageID digest.Digest) ([]reference.Named, error) {
+	var refs []reference.Named
+	for _, ref := range m.refs {
+		namedRef, err := reference.Parse(ref)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, namedRef)
+	}
+	return refs, nil
+}
+
+func (m *mockImageRemove) PruneDigestRemovesImage(ctx context.Context, idOrRef string) (bool, error) {
+	return m.prunes, nil
+}
+
+func (m *mockImageRemove) RemoveImage(ctx context.Context, idOrRef string, opt *mgr.ImageRemoveOption) error {
+	m.removed = append(m.removed, idOrRef)
+	return nil
+}
+
+// removeImageRequest sends the removal by the router, which sets the name of
+// image in the path.
+func removeImageRequest(s *Server, url string) error {
+	var err error
+	router := mux.NewRouter()
+	router.HandleFunc("/images/{name:.*}", func(w http.ResponseWriter, req *http.Request) {
+		err = s.removeImage(context.Background(), w, req)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, url, nil))
+	return err
+}
+
+func Test_removeImage_pruneDigest(t *testing.T) {
+	images := &mockImageRemove{
+		id:   "sha256:image",
+		refs: []string{"reg.abc.com/busybox:latest", "reg.abc.com/busybox:1.25"},
+	}
+	containers := &mockContainerList{containers: []*mgr.Container{{ID: "c1", Name: "app", Image: "sha256:image"}}}
+	s := &Server{ImageMgr: images, ContainerMgr: containers}
+
+	// the containers aren't checked if the image is kept by other tags
+	assert.NoError(t, removeImageRequest(s, "/images/reg.abc.com/busybox:latest?prune-digest=1"))
+	assert.Equal(t, 0, containers.lists)
+	assert.Equal(t, []string{"reg.abc.com/busybox:latest"}, images.removed)
+
+	// but they are if the image is removed with the digest references
+	images.removed, images.prunes = nil, true
+	err := removeImageRequest(s, "/images/reg.abc.com/busybox:1.25?prune-digest=1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must force")
+	assert.Equal(t, 1, containers.lists)
+	assert.Empty(t, images.removed)
+}
+
+func Test_removeImage_refuseIfReferenced(t *testing.T) {
+	images := &mockImageRemove{id: "sha256:image", refs: []string{"reg.abc.com/busybox:latest"}}
+	containers := &mockContainerList{containers: []*mgr.Container{
+		{ID: "c1", Name: "app", Image: "sha256:image", State: &types.ContainerState{Status: types.StatusRunning}},
+		{ID: "c2", Name: "job", Image: "sha256:image", State: &types.ContainerState{Status: types.StatusExited}},
+		{ID: "c3", Name: "other", Image: "sha256:other", State: &types.ContainerState{Status: types.StatusStopped}},
+	}}
+	s := &Server{ImageMgr: images, ContainerMgr: containers}
+
+	// the image is refused even with force, and all the containers
+	// referencing it are listed
+	err := removeImageRequest(s, "/images/reg.abc.com/busybox:latest?force=1&refuse-if-referenced=1")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusConflict, httputils.StatusCode(err))
+	assert.Contains(t, err.Error(), "referenced by 2 container(s): c1 (app, running), c2 (job, exited)")
+	assert.Empty(t, images.removed)
+
+	// the stopped container referencing the image is refused too
+	containers.containers = containers.containers[1:]
+	err = removeImageRequest(s, "/images/sha256:image?force=1&refuse-if-referenced=1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "referenced by 1 container(s): c2 (job, exited)")
+	assert.Empty(t, images.removed)
+
+	// but force removes it without the mode
+	assert.NoError(t, removeImageRequest(s, "/images/sha256:image?force=1"))
+	assert.Equal(t, []string{"sha256:image"}, images.removed)
+
+	// and the image not referenced by any container is removed
+	images.removed, containers.containers = nil, containers.containers[1:]
+	assert.NoError(t, removeImageRequest(s, "/images/reg.abc.com/busybox:latest?refuse-if-referenced=1"))
+	assert.Equal(t, []string{"reg.abc.com/busybox:latest"}, images.removed)
+}
+
+type mockImageList struct {
+	mgr.ImageMgr
+	images  []types.ImageInfo
+	skipped []digest.Digest
+}
+
+func (m *mockImageList) ListImages(ctx context.Context, filter filters.Args, opt *mgr.ImageListOption) ([]types.ImageInfo, string, error) {
+	if opt.Warn != nil {
+		for _, id := range m.skipped {
+			opt.Warn(id, fmt.Errorf("image %s not found", id))
+		}
+	}
+	return m.images, "", nil
+}
+
+func Test_listImages_warnings(t *testing.T) {
+	s := &Server{ImageMgr: &mockImageList{
+		images:  []types.ImageInfo{{ID: "sha256:image"}},
+		skipped: []digest.Digest{"sha256:removed", "sha256:broken"},
+	}}
+
+	listImages := func(url string) []byte {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rw := httptest.NewRecorder()
+		assert.NoError(t, s.listImages(context.Background(), rw, req))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		return rw.Body.Bytes()
+	}
+
+	// the shape of response is unchanged without warnings
+	var images []types.ImageInfo
+	assert.NoError(t, json.Unmarshal(listImages("/images/json"), &images))
+	assert.Equal(t, []types.ImageInfo{{ID: "sha256:image"}}, images)
+
+	var resp types.ImageListResp
+	assert.NoError(t, json.Unmarshal(listImages("/images/json?warnings=1"), &resp))
+	assert.Equal(t, []*types.ImageInfo{{ID: "sha256:image"}}, resp.Images)
+	assert.Equal(t, []string{"sha256:removed", "sha256:broken"}, resp.Warnings)
+
+	// the warnings are an empty list rather than null if nothing is skipped
+	s.ImageMgr = &mockImageList{images: []types.ImageInfo{{ID: "sha256:image"}}}
+	assert.Contains(t, string(listImages("/images/json?warnings=1")), `"Warnings":[]`)
+}
@@ -10,7 +10,6 @@ import (
 
 	serverTypes "github.com/alibaba/pouch/apis/server/types"
 	"github.com/alibaba/pouch/apis/types"
-	"github.com/alibaba/pouch/pkg/errtypes"
 	"github.com/alibaba/pouch/pkg/httputils"
 	"github.com/alibaba/pouch/pkg/utils"
 
@@ -67,14 +66,37 @@ func initRoute(s *Server) *mux.Router {
 		// image
 		{Method: http.MethodPost, Path: "/images/create", HandlerFunc: s.pullImage},
 		{Method: http.MethodGet, Path: "/images/search", HandlerFunc: s.searchImages},
+		{Method: http.MethodGet, Path: "/registry/tags", HandlerFunc: s.listRemoteTags},
 		{Method: http.MethodGet, Path: "/images/json", HandlerFunc: s.listImages},
+		{Method: http.MethodPost, Path: "/images/prune", HandlerFunc: s.pruneImages},
+		{Method: http.MethodPost, Path: "/images/copy", HandlerFunc: s.copyImage},
+		{Method: http.MethodPost, Path: "/images/gc", HandlerFunc: s.garbageCollectImages},
+		{Method: http.MethodPost, Path: "/images/remove", HandlerFunc: s.removeImages},
+		{Method: http.MethodPost, Path: "/images/relabel", HandlerFunc: s.relabelNamespace},
+		{Method: http.MethodGet, Path: "/images/usage", HandlerFunc: s.getImageUsage},
+		{Method: http.MethodGet, Path: "/images/diagnose", HandlerFunc: s.diagnoseImageStore},
+		{Method: http.MethodGet, Path: "/images/diff", HandlerFunc: s.diffImages},
+		{Method: http.MethodPost, Path: "/images/validate-ref", HandlerFunc: s.validateImageReference},
+		{Method: http.MethodGet, Path: "/images/provenance", HandlerFunc: s.listImageProvenance},
+		{Method: http.MethodGet, Path: "/images/stats", HandlerFunc: s.getImagePullStats},
+		{Method: http.MethodGet, Path: "/debug/mirrors", HandlerFunc: s.getMirrorHealth},
+		{Method: http.MethodGet, Path: "/debug/images/corrupt", HandlerFunc: s.listCorruptImages},
 		{Method: http.MethodDelete, Path: "/images/{name:.*}", HandlerFunc: s.removeImage},
 		{Method: http.MethodGet, Path: "/images/{name:.*}/json", HandlerFunc: s.getImage},
+		{Method: http.MethodHead, Path: "/images/{name:.*}", HandlerFunc: s.headImage},
 		{Method: http.MethodPost, Path: "/images/{name:.*}/tag", HandlerFunc: s.postImageTag},
+		{Method: http.MethodPost, Path: "/images/{name:.*}/labels", HandlerFunc: s.setImageLabels},
 		{Method: http.MethodPost, Path: "/images/load", HandlerFunc: withCancelHandler(s.loadImage)},
 		{Method: http.MethodGet, Path: "/images/save", HandlerFunc: withCancelHandler(s.saveImage)},
 		{Method: http.MethodGet, Path: "/images/{name:.*}/history", HandlerFunc: s.getImageHistory},
+		{Method: http.MethodGet, Path: "/images/{name:.*}/references", HandlerFunc: s.getImageReferences},
+		{Method: http.MethodGet, Path: "/images/{name:.*}/manifest", HandlerFunc: s.getImageManifest},
+		{Method: http.MethodGet, Path: "/images/{name:.*}/config", HandlerFunc: s.getImageConfig},
+		{Method: http.MethodGet, Path: "/images/{name:.*}/layers", HandlerFunc: s.inspectImageLayers},
+		{Method: http.MethodGet, Path: "/images/{name:.*}/layers/{digest}", HandlerFunc: withCancelHandler(s.getImageLayer)},
 		{Method: http.MethodPost, Path: "/images/{name:.*}/push", HandlerFunc: s.pushImage},
+		{Method: http.MethodPost, Path: "/images/{name:.*}/manifest-list", HandlerFunc: s.pushManifestList},
+		{Method: http.MethodDelete, Path: "/repositories/{repo:.*}", HandlerFunc: s.removeRepository},
 
 		// volume
 		{Method: http.MethodGet, Path: "/volumes", HandlerFunc: s.listVolume},
@@ -231,27 +253,9 @@ func EncodeResponse(rw http.ResponseWriter, statusCode int, data interface{}) er
 
 // HandleErrorResponse handles err from daemon side and constructs response for client side.
 func HandleErrorResponse(w http.ResponseWriter, err error) {
-	var (
-		code   int
-		errMsg string
-	)
-
 	// By default, daemon side returns code 500 if error happens.
-	code = http.StatusInternalServerError
-	errMsg = err.Error()
-
-	httpErr, ok := err.(httputils.HTTPError)
-	if ok {
-		code = httpErr.Code()
-	} else if errtypes.IsNotfound(err) {
-		code = http.StatusNotFound
-	} else if errtypes.IsInvalidParam(err) {
-		code = http.StatusBadRequest
-	} else if errtypes.IsAlreadyExisted(err) {
-		code = http.StatusConflict
-	} else if errtypes.IsNotModified(err) {
-		code = http.StatusNotModified
-	}
+	code := httputils.StatusCode(err)
+	errMsg := err.Error()
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -22,15 +22,33 @@ type ImageInfo struct {
 	// config
 	Config *ContainerConfig `json:"Config,omitempty"`
 
+	// the number of containers using the image, which is only counted if it's requested by the `containers` parameter of inspect.
+	Containers *int64 `json:"Containers,omitempty"`
+
 	// time of image creation.
 	CreatedAt string `json:"CreatedAt,omitempty"`
 
 	// ID of an image.
 	ID string `json:"Id,omitempty"`
 
+	// whether the image is pulled in index-only mode, which keeps all the platforms without unpacking.
+	IndexOnly bool `json:"IndexOnly,omitempty"`
+
+	// the labels of image, which merge the labels set by the labels API and the read-only labels of image config. The label of image config takes precedence.
+	Labels map[string]string `json:"Labels,omitempty"`
+
+	// the media type of the image's target, like the docker or oci manifest, or the manifest list.
+	MediaType string `json:"MediaType,omitempty"`
+
 	// the name of the operating system.
 	Os string `json:"Os,omitempty"`
 
+	// the platform selected from the manifest list, like `linux/arm64/v8`. It's empty if the target isn't manifest list.
+	Platform string `json:"Platform,omitempty"`
+
+	// whether the image doesn't match the platform of host, and it's inspected with the fallback platform.
+	PlatformMismatch bool `json:"PlatformMismatch,omitempty"`
+
 	// repository with digest.
 	RepoDigests []string `json:"RepoDigests"`
 
@@ -42,6 +60,9 @@ type ImageInfo struct {
 
 	// size of image's taking disk space.
 	Size int64 `json:"Size,omitempty"`
+
+	// the digest of the image's target, which is the manifest or the manifest list. The canonical reference of image is made of it even if the image has no tags.
+	TargetDigest string `json:"TargetDigest,omitempty"`
 }
 
 // Validate validates this image info
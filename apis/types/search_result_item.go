@@ -26,6 +26,13 @@ type SearchResultItem struct {
 	// name represents the name of this image
 	Name string `json:"name,omitempty"`
 
+	// pull_count refers to the pull count of this image.
+	PullCount int64 `json:"pull_count,omitempty"`
+
+	// registry is the registry where the image is found, which is set only
+	// if searching all the registries.
+	Registry string `json:"registry,omitempty"`
+
 	// star_count refers to the star count of this image.
 	StarCount int64 `json:"star_count,omitempty"`
 }
@@ -65,7 +65,7 @@ func (i *ImagesCommand) addFlags() {
 	flagSet.BoolVarP(&i.flagQuiet, "quiet", "q", false, "Only show image numeric ID")
 	flagSet.BoolVar(&i.flagDigest, "digest", false, "Show images with digest")
 	flagSet.BoolVar(&i.flagNoTrunc, "no-trunc", false, "Do not truncate output")
-	flagSet.StringSliceVarP(&i.flagFilter, "filter", "f", []string{}, "Filter output based on conditions provided, filter support reference, since, before")
+	flagSet.StringSliceVarP(&i.flagFilter, "filter", "f", []string{}, "Filter output based on conditions provided, filter support reference, since, before, dangling, label")
 }
 
 // runImages is the entry of images container command.
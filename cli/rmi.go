@@ -16,14 +16,15 @@ var rmiDescription = "Remove one or more images by reference." +
 // RmiCommand use to implement 'rmi' command, it remove one or more images by reference
 type RmiCommand struct {
 	baseCommand
-	force bool
+	force      bool
+	repository bool
 }
 
 // Init initialize rmi command
 func (rmi *RmiCommand) Init(c *Cli) {
 	rmi.cli = c
 	rmi.cmd = &cobra.Command{
-		Use:   "rmi [OPTIONS] IMAGE [IMAGE...]",
+		Use:   "rmi [OPTIONS] IMAGE|REPOSITORY [IMAGE|REPOSITORY...]",
 		Short: "Remove one or more images by reference",
 		Long:  rmiDescription,
 		Args:  cobra.MinimumNArgs(1),
@@ -38,6 +39,7 @@ func (rmi *RmiCommand) Init(c *Cli) {
 // addFlags adds flags for specific command
 func (rmi *RmiCommand) addFlags() {
 	rmi.cmd.Flags().BoolVarP(&rmi.force, "force", "f", false, "if image is being used, remove image and all associated resources")
+	rmi.cmd.Flags().BoolVarP(&rmi.repository, "repository", "r", false, "remove all the tags of the repository")
 }
 
 // runRmi is the entry of rmi command
@@ -45,6 +47,10 @@ func (rmi *RmiCommand) runRmi(args []string) error {
 	ctx := context.Background()
 	apiClient := rmi.cli.Client()
 
+	if rmi.repository {
+		return rmi.runRmiRepository(ctx, args)
+	}
+
 	var errs []string
 	for _, name := range args {
 		if err := apiClient.ImageRemove(ctx, name, rmi.force); err != nil {
@@ -61,6 +67,37 @@ func (rmi *RmiCommand) runRmi(args []string) error {
 	return nil
 }
 
+// runRmiRepository removes all the tags of the repositories.
+func (rmi *RmiCommand) runRmiRepository(ctx context.Context, repos []string) error {
+	apiClient := rmi.cli.Client()
+
+	var errs []string
+	for _, repo := range repos {
+		items, err := apiClient.ImageRemoveRepository(ctx, repo, rmi.force)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		for _, item := range items {
+			switch {
+			case item.Error != "":
+				errs = append(errs, item.Error)
+			case item.Untagged != "":
+				fmt.Printf("Untagged: %s\n", item.Untagged)
+			case item.Deleted != "":
+				fmt.Printf("Deleted: %s\n", item.Deleted)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("failed to remove repositories: " + strings.Join(errs, ""))
+	}
+
+	return nil
+}
+
 // rmiExample shows examples in rmi command, and is used in auto-generated cli docs.
 func rmiExample() string {
 	return `$ pouch rmi registry.hub.docker.com/library/busybox:latest registry.hub.docker.com/library/busybox:1.28
@@ -13,6 +13,7 @@ var searchDescription = "\nSearch the images from specific registry."
 type SearchCommand struct {
 	baseCommand
 	registry string
+	limit    int
 }
 
 // Init initialize search command.
@@ -36,7 +37,8 @@ func (s *SearchCommand) Init(c *Cli) {
 func (s *SearchCommand) addFlags() {
 	flagSet := s.cmd.Flags()
 
-	flagSet.StringVarP(&s.registry, "registry", "r", "", "set registry name")
+	flagSet.StringVarP(&s.registry, "registry", "r", "", "set registry name, \"all\" to search the default registry and mirrors")
+	flagSet.IntVar(&s.limit, "limit", 0, "max number of search results, sorted by stars")
 }
 
 func (s *SearchCommand) runSearch(args []string) error {
@@ -45,8 +47,8 @@ func (s *SearchCommand) runSearch(args []string) error {
 
 	term := args[0]
 
-	// TODO: add flags --filter、--format、--limit、--no-trunc
-	searchResults, err := apiClient.ImageSearch(ctx, term, s.registry, fetchRegistryAuth(s.registry))
+	// TODO: add flags --filter、--format、--no-trunc
+	searchResults, err := apiClient.ImageSearch(ctx, term, s.registry, s.limit, fetchRegistryAuth(s.registry))
 
 	if err != nil {
 		return err
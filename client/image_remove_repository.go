@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/alibaba/pouch/apis/types"
+)
+
+// ImageRemoveRepository deletes all the references of the repository.
+func (client *APIClient) ImageRemoveRepository(ctx context.Context, repo string, force bool) ([]types.ImageDeleteResponseItem, error) {
+	q := url.Values{}
+	if force {
+		q.Set("force", "true")
+	}
+
+	items := []types.ImageDeleteResponseItem{}
+
+	resp, err := client.delete(ctx, "/repositories/"+repo, q, nil)
+	if err != nil {
+		return items, err
+	}
+
+	defer ensureCloseReader(resp)
+	err = decodeBody(&items, resp.Body)
+	return items, err
+}
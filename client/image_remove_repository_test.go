@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageRemoveRepositoryNotFoundError(t *testing.T) {
+	client := &APIClient{
+		HTTPCli: newMockClient(errorMockResponse(http.StatusNotFound, "Not Found")),
+	}
+	_, err := client.ImageRemoveRepository(context.Background(), "no repo", true)
+	if err == nil || !strings.Contains(err.Error(), "Not Found") {
+		t.Fatalf("expected a Not Found Error, got %v", err)
+	}
+}
+
+func TestImageRemoveRepository(t *testing.T) {
+	expectedURL := "/repositories/busybox"
+
+	httpClient := newMockClient(func(req *http.Request) (*http.Response, error) {
+		if !strings.HasPrefix(req.URL.Path, expectedURL) {
+			return nil, fmt.Errorf("expected URL '%s', got '%s'", expectedURL, req.URL)
+		}
+		if req.Method != "DELETE" {
+			return nil, fmt.Errorf("expected DELETE method, got %s", req.Method)
+		}
+		if force := req.URL.Query().Get("force"); force != "true" {
+			return nil, fmt.Errorf("expected force true, got %s", force)
+		}
+
+		b, err := json.Marshal([]types.ImageDeleteResponseItem{
+			{Untagged: "busybox:latest"},
+			{Deleted: "sha256:abcd"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		}, nil
+	})
+
+	client := &APIClient{
+		HTTPCli: httpClient,
+	}
+
+	items, err := client.ImageRemoveRepository(context.Background(), "busybox", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, "busybox:latest", items[0].Untagged)
+	assert.Equal(t, "sha256:abcd", items[1].Deleted)
+}
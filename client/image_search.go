@@ -4,17 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"net/url"
+	"strconv"
 
 	"github.com/alibaba/pouch/apis/types"
 )
 
-// ImageSearch requests daemon to search an image from registry.
-func (client *APIClient) ImageSearch(ctx context.Context, term, registry, encodedAuth string) ([]types.SearchResultItem, error) {
+// ImageSearch requests daemon to search an image from registry, at most
+// limit results if limit is positive.
+func (client *APIClient) ImageSearch(ctx context.Context, term, registry string, limit int, encodedAuth string) ([]types.SearchResultItem, error) {
 	var results []types.SearchResultItem
 
 	q := url.Values{}
 	q.Set("term", term)
 	q.Set("registry", registry)
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
 
 	headers := map[string][]string{}
 	if encodedAuth != "" {
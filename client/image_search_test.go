@@ -20,7 +20,7 @@ func TestImageSearchServerError(t *testing.T) {
 		HTTPCli: newMockClient(errorMockResponse(http.StatusInternalServerError, "Server error")),
 	}
 	term, registry, auth := "", "nginx", ""
-	_, err := client.ImageSearch(context.Background(), term, registry, auth)
+	_, err := client.ImageSearch(context.Background(), term, registry, 0, auth)
 	if err == nil || !strings.Contains(err.Error(), "Server error") {
 		t.Fatalf("expected a Server Error, got %v", err)
 	}
@@ -60,7 +60,7 @@ func TestImageSearchOK(t *testing.T) {
 		HTTPCli: httpClient,
 	}
 
-	searchResultResp, err := client.ImageSearch(context.Background(), "nginx", "", "")
+	searchResultResp, err := client.ImageSearch(context.Background(), "nginx", "", 0, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -74,7 +74,7 @@ func TestImageSearchStatusUnauthorizedError(t *testing.T) {
 		HTTPCli: newMockClient(errorMockResponse(http.StatusUnauthorized, "Unauthorized Error")),
 	}
 	term, registry, auth := "", "nginx", "some-auth-code"
-	_, err := client.ImageSearch(context.Background(), term, registry, auth)
+	_, err := client.ImageSearch(context.Background(), term, registry, 0, auth)
 	if err == nil || !strings.Contains(err.Error(), "Unauthorized Error") {
 		t.Fatalf("expected a Unauthorized Error, got %v", err)
 	}
@@ -57,12 +57,13 @@ type ImageAPIClient interface {
 	ImageInspect(ctx context.Context, name string) (types.ImageInfo, error)
 	ImagePull(ctx context.Context, name, tag, encodedAuth string) (io.ReadCloser, error)
 	ImageRemove(ctx context.Context, name string, force bool) error
+	ImageRemoveRepository(ctx context.Context, repo string, force bool) ([]types.ImageDeleteResponseItem, error)
 	ImageTag(ctx context.Context, image string, tag string) error
 	ImageLoad(ctx context.Context, name string, r io.Reader) error
 	ImageSave(ctx context.Context, imageName string) (io.ReadCloser, error)
 	ImageHistory(ctx context.Context, name string) ([]types.HistoryResultItem, error)
 	ImagePush(ctx context.Context, ref, encodedAuth string) (io.ReadCloser, error)
-	ImageSearch(ctx context.Context, term, registry, encodedAuth string) ([]types.SearchResultItem, error)
+	ImageSearch(ctx context.Context, term, registry string, limit int, encodedAuth string) ([]types.SearchResultItem, error)
 }
 
 // VolumeAPIClient defines methods of Volume client.
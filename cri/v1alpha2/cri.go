@@ -1272,7 +1272,7 @@ func (c *CriManager) ListImages(ctx context.Context, r *runtime.ListImagesReques
 	}(time.Now())
 
 	// TODO: handle image list filters.
-	imageList, err := c.ImageMgr.ListImages(ctx, filters.NewArgs())
+	imageList, _, err := c.ImageMgr.ListImages(ctx, filters.NewArgs(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1361,7 +1361,7 @@ func (c *CriManager) PullImage(ctx context.Context, r *runtime.PullImageRequest)
 		authConfig.RegistryToken = r.Auth.RegistryToken
 	}
 
-	if err := c.ImageMgr.PullImage(ctx, imageRef, authConfig, bytes.NewBuffer([]byte{})); err != nil {
+	if err := c.ImageMgr.PullImage(ctx, imageRef, authConfig, bytes.NewBuffer([]byte{}), nil); err != nil {
 		return nil, err
 	}
 
@@ -1385,7 +1385,7 @@ func (c *CriManager) RemoveImage(ctx context.Context, r *runtime.RemoveImageRequ
 
 	imageRef := r.GetImage().GetImage()
 
-	if err := c.ImageMgr.RemoveImage(ctx, imageRef, false); err != nil {
+	if err := c.ImageMgr.RemoveImage(ctx, imageRef, nil); err != nil {
 		if errtypes.IsNotfound(err) {
 			// Now we just return empty if the ErrorNotFound occurred.
 			return &runtime.RemoveImageResponse{}, nil
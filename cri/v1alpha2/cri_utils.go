@@ -1012,7 +1012,7 @@ func (c *CriManager) ensureSandboxImageExists(ctx context.Context, imageRef stri
 		return nil
 	}
 	if errtypes.IsNotfound(err) {
-		err = c.ImageMgr.PullImage(ctx, imageRef, nil, bytes.NewBuffer([]byte{}))
+		err = c.ImageMgr.PullImage(ctx, imageRef, nil, bytes.NewBuffer([]byte{}), nil)
 		if err != nil {
 			return fmt.Errorf("failed to pull sandbox image %q: %v", imageRef, err)
 		}
@@ -0,0 +1,143 @@
+package ctrd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// SkippedPlatformsLabel is set on the index-only image pulled in best-effort
+// mode, which lists the platforms unavailable in the registry, like
+// linux/arm64,linux/arm/v7.
+const SkippedPlatformsLabel = "pouch.skipped-platforms"
+
+type bestEffortKey struct{}
+
+// WithBestEffort makes the index-only FetchImage skip the platforms whose
+// content is unavailable in the registry, instead of failing the whole pull.
+// The skipped platform is reported by notify.
+func WithBestEffort(ctx context.Context, notify func(platform string, err error)) context.Context {
+	if notify == nil {
+		notify = func(string, error) {}
+	}
+	return context.WithValue(ctx, bestEffortKey{}, notify)
+}
+
+// bestEffortNotifier returns the notify set by WithBestEffort, or nil if the
+// context isn't in best-effort mode.
+func bestEffortNotifier(ctx context.Context) func(string, error) {
+	notify, _ := ctx.Value(bestEffortKey{}).(func(string, error))
+	return notify
+}
+
+// SkippedPlatforms returns the platforms skipped by the best-effort pull of
+// the image.
+func SkippedPlatforms(img containerd.Image) []string {
+	label := img.Labels()[SkippedPlatformsLabel]
+	if label == "" {
+		return nil
+	}
+	return strings.Split(label, ",")
+}
+
+// ExcludePlatforms returns the matcher which doesn't match the excluded
+// platforms, which are formatted by platforms.Format.
+func ExcludePlatforms(m platforms.MatchComparer, excluded []string) platforms.MatchComparer {
+	if len(excluded) == 0 {
+		return m
+	}
+
+	set := make(map[string]struct{}, len(excluded))
+	for _, p := range excluded {
+		set[p] = struct{}{}
+	}
+	return &excludedPlatformComparer{MatchComparer: m, excluded: set}
+}
+
+type excludedPlatformComparer struct {
+	platforms.MatchComparer
+	excluded map[string]struct{}
+}
+
+// Match implements platforms.Matcher.
+func (c *excludedPlatformComparer) Match(platform ocispec.Platform) bool {
+	if _, ok := c.excluded[platforms.Format(platforms.Normalize(platform))]; ok {
+		return false
+	}
+	return c.MatchComparer.Match(platform)
+}
+
+// fetchAvailablePlatforms fetches the content of each platform referenced by
+// the index one by one, and returns the platforms failed to be fetched. The
+// error is returned if none of platforms is available, or the unavailable
+// manifest doesn't tell its platform.
+//
+// NOTE: the fetched content is kept by the lease of ctx, and the following
+// pull with the skipped platforms excluded won't fetch it again.
+func fetchAvailablePlatforms(ctx context.Context, cs content.Store, resolver remotes.Resolver, ref string, handler ctrdmetaimages.Handler, notify func(string, error)) ([]string, error) {
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve reference %q: %v", ref, err)
+	}
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, ctrdmetaimages.MediaTypeDockerSchema2ManifestList:
+	default:
+		// there is nothing to skip for the single manifest
+		return nil, nil
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fetcher for %q: %v", name, err)
+	}
+
+	fetch := ctrdmetaimages.Handlers(handler, remotes.FetchHandler(cs, fetcher))
+	if _, err := fetch.Handle(ctx, desc); err != nil {
+		return nil, err
+	}
+
+	data, err := content.ReadBlob(ctx, cs, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	var index ocispec.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal index %s: %v", desc.Digest, err)
+	}
+
+	walk := ctrdmetaimages.Handlers(fetch, ctrdmetaimages.SetChildrenLabels(cs, ctrdmetaimages.ChildrenHandler(cs)))
+
+	var skipped []string
+	for _, manifest := range index.Manifests {
+		err := ctrdmetaimages.Dispatch(ctx, walk, manifest)
+		if err == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if manifest.Platform == nil {
+			return nil, fmt.Errorf("failed to fetch manifest %s without platform: %v", manifest.Digest, err)
+		}
+
+		platform := platforms.Format(platforms.Normalize(*manifest.Platform))
+		notify(platform, err)
+		skipped = append(skipped, platform)
+	}
+
+	if len(index.Manifests) > 0 && len(skipped) == len(index.Manifests) {
+		return nil, fmt.Errorf("none of platforms of %s is available", ref)
+	}
+	return skipped, nil
+}
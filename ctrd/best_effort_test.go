@@ -0,0 +1,159 @@
+package ctrd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type memLabelStore struct {
+	mu     sync.Mutex
+	labels map[digest.Digest]map[string]string
+}
+
+func (s *memLabelStore) Get(dgst digest.Digest) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.labels[dgst], nil
+}
+
+func (s *memLabelStore) Set(dgst digest.Digest, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.labels[dgst] = labels
+	return nil
+}
+
+func (s *memLabelStore) Update(dgst digest.Digest, update map[string]string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	labels := s.labels[dgst]
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range update {
+		if v == "" {
+			delete(labels, k)
+		} else {
+			labels[k] = v
+		}
+	}
+	s.labels[dgst] = labels
+	return labels, nil
+}
+
+// memRegistry is the resolver serving the blobs in memory, and the missing
+// blob is not found like the mirror which is syncing.
+type memRegistry struct {
+	root  ocispec.Descriptor
+	blobs map[digest.Digest][]byte
+}
+
+func (r *memRegistry) add(mediaType string, v interface{}) ocispec.Descriptor {
+	data, ok := v.([]byte)
+	if !ok {
+		data, _ = json.Marshal(v)
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	r.blobs[desc.Digest] = data
+	return desc
+}
+
+func (r *memRegistry) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	return ref, r.root, nil
+}
+
+func (r *memRegistry) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return r, nil
+}
+
+func (r *memRegistry) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+func (r *memRegistry) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	data, ok := r.blobs[desc.Digest]
+	if !ok {
+		return nil, errdefs.ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestFetchAvailablePlatforms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "best-effort")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cs, err := local.NewLabeledStore(dir, &memLabelStore{labels: map[digest.Digest]map[string]string{}})
+	assert.NoError(t, err)
+
+	registry := &memRegistry{blobs: map[digest.Digest][]byte{}}
+	newManifest := func(layer string) ocispec.Descriptor {
+		return registry.add(ocispec.MediaTypeImageManifest, ocispec.Manifest{
+			Config: registry.add(ocispec.MediaTypeImageConfig, []byte("config of "+layer)),
+			Layers: []ocispec.Descriptor{registry.add(ocispec.MediaTypeImageLayer, []byte(layer))},
+		})
+	}
+
+	amd64 := newManifest("amd64")
+	amd64.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := newManifest("arm64")
+	arm64.Platform = &ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+
+	// the layer of arm64 hasn't been synced
+	var manifest ocispec.Manifest
+	assert.NoError(t, json.Unmarshal(registry.blobs[arm64.Digest], &manifest))
+	delete(registry.blobs, manifest.Layers[0].Digest)
+
+	registry.root = registry.add(ocispec.MediaTypeImageIndex, ocispec.Index{
+		Manifests: []ocispec.Descriptor{amd64, arm64},
+	})
+
+	var notified []string
+	notify := func(platform string, err error) {
+		assert.True(t, errdefs.IsNotFound(err))
+		notified = append(notified, platform)
+	}
+	noop := ctrdmetaimages.HandlerFunc(func(context.Context, ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		return nil, nil
+	})
+
+	skipped, err := fetchAvailablePlatforms(context.TODO(), cs, registry, "busybox", noop, notify)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"linux/arm64"}, skipped)
+	assert.Equal(t, []string{"linux/arm64"}, notified)
+
+	// the content of available platform is fetched
+	_, err = cs.Info(context.TODO(), amd64.Digest)
+	assert.NoError(t, err)
+
+	matcher := ExcludePlatforms(platforms.All, skipped)
+	assert.True(t, matcher.Match(*amd64.Platform))
+	assert.False(t, matcher.Match(*arm64.Platform))
+
+	// the pull fails if none of platforms is available
+	delete(registry.blobs, amd64.Digest)
+	assert.NoError(t, cs.Delete(context.TODO(), amd64.Digest))
+	_, err = fetchAvailablePlatforms(context.TODO(), cs, registry, "busybox", noop, func(string, error) {})
+	assert.Error(t, err)
+}
@@ -47,6 +47,23 @@ type Client struct {
 	// insecureRegistries stores the insecure registries
 	insecureRegistries []string
 
+	// maxConcurrentDownloads and maxConcurrentUploads limit the number of
+	// concurrent layer transfers in each pull and push.
+	maxConcurrentDownloads int
+	maxConcurrentUploads   int
+
+	// pushRateLimit caps the upload bandwidth of each push.
+	pushRateLimit int64
+
+	// registryTimeouts limits each request to the registry.
+	registryTimeouts RegistryTimeouts
+
+	// registryUserAgent is the User-Agent of each request to the registry.
+	registryUserAgent string
+
+	// pullLeases counts the pulls sharing the lease of the same reference.
+	pullLeases *pullLeaseUsers
+
 	// containerd grpc pool
 	pool      []scheduler.Factory
 	scheduler scheduler.Scheduler
@@ -72,6 +89,8 @@ func NewClient(opts ...ClientOpt) (APIClient, error) {
 		grpcClientPoolCapacity: defaultGrpcClientPoolCapacity,
 		maxStreamsClient:       defaultMaxStreamsClient,
 		insecureRegistries:     []string{},
+		registryTimeouts:       DefaultRegistryTimeouts,
+		registryUserAgent:      DefaultRegistryUserAgent,
 	}
 
 	for _, opt := range opts {
@@ -88,6 +107,13 @@ func NewClient(opts ...ClientOpt) (APIClient, error) {
 			containers: make(map[string]*containerPack),
 		},
 		insecureRegistries: copts.insecureRegistries,
+
+		maxConcurrentDownloads: copts.maxConcurrentDownloads,
+		maxConcurrentUploads:   copts.maxConcurrentUploads,
+		pushRateLimit:          copts.pushRateLimit,
+		registryTimeouts:       copts.registryTimeouts,
+		registryUserAgent:      copts.registryUserAgent,
+		pullLeases:             newPullLeaseUsers(),
 	}
 
 	lease, err := client.preparePouchdLease(copts.rpcAddr, copts.defaultns)
@@ -5,6 +5,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type clientOpts struct {
@@ -13,6 +14,11 @@ type clientOpts struct {
 	maxStreamsClient       int
 	defaultns              string
 	insecureRegistries     []string
+	maxConcurrentDownloads int
+	maxConcurrentUploads   int
+	pushRateLimit          int64
+	registryTimeouts       RegistryTimeouts
+	registryUserAgent      string
 }
 
 // ClientOpt allows caller to set options for containerd client.
@@ -87,6 +93,76 @@ func WithInsecureRegistries(endpoints []string) ClientOpt {
 	}
 }
 
+// WithMaxConcurrentDownloads limits the number of concurrent layer downloads
+// for each pull, zero means no limitation.
+func WithMaxConcurrentDownloads(max int) ClientOpt {
+	return func(c *clientOpts) error {
+		if max < 0 {
+			return fmt.Errorf("max concurrent downloads %d cannot be negative", max)
+		}
+
+		c.maxConcurrentDownloads = max
+		return nil
+	}
+}
+
+// WithMaxConcurrentUploads limits the number of concurrent layer uploads for
+// each push, zero means no limitation.
+func WithMaxConcurrentUploads(max int) ClientOpt {
+	return func(c *clientOpts) error {
+		if max < 0 {
+			return fmt.Errorf("max concurrent uploads %d cannot be negative", max)
+		}
+
+		c.maxConcurrentUploads = max
+		return nil
+	}
+}
+
+// WithPushRateLimit caps the upload bandwidth (in bytes per second) of each
+// push, zero means no limitation.
+func WithPushRateLimit(limit int64) ClientOpt {
+	return func(c *clientOpts) error {
+		if limit < 0 {
+			return fmt.Errorf("push rate limit %d cannot be negative", limit)
+		}
+
+		c.pushRateLimit = limit
+		return nil
+	}
+}
+
+// WithRegistryTimeouts limits each request to the registry in pull and push,
+// zero means no limitation.
+func WithRegistryTimeouts(timeouts RegistryTimeouts) ClientOpt {
+	return func(c *clientOpts) error {
+		for name, timeout := range map[string]time.Duration{
+			"dial":            timeouts.Dial,
+			"TLS handshake":   timeouts.TLSHandshake,
+			"response header": timeouts.ResponseHeader,
+			"idle":            timeouts.Idle,
+		} {
+			if timeout < 0 {
+				return fmt.Errorf("registry %s timeout %v cannot be negative", name, timeout)
+			}
+		}
+
+		c.registryTimeouts = timeouts
+		return nil
+	}
+}
+
+// WithRegistryUserAgent sets the User-Agent of requests to the registry in
+// pull and push, and the default one is used if it's empty.
+func WithRegistryUserAgent(userAgent string) ClientOpt {
+	return func(c *clientOpts) error {
+		if userAgent != "" {
+			c.registryUserAgent = userAgent
+		}
+		return nil
+	}
+}
+
 func validateHostPort(s string) error {
 	_, port, err := net.SplitHostPort(s)
 	if err != nil {
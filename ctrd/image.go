@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/errdefs"
 	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/opencontainers/go-digest"
@@ -42,6 +44,26 @@ func (c *Client) createImageReference(ctx context.Context, img ctrdmetaimages.Im
 	return wrapperCli.client.ImageService().Create(ctx, img)
 }
 
+// UpdateImage updates the image in the meta data in the containerd, and only
+// the fields given by fieldpaths are updated, like labels.foo.
+func (c *Client) UpdateImage(ctx context.Context, img ctrdmetaimages.Image, fieldpaths ...string) (ctrdmetaimages.Image, error) {
+	image, err := c.updateImage(ctx, img, fieldpaths...)
+	if err != nil {
+		return image, convertCtrdErr(err)
+	}
+	return image, nil
+}
+
+// updateImage updates the image in the meta data in the containerd.
+func (c *Client) updateImage(ctx context.Context, img ctrdmetaimages.Image, fieldpaths ...string) (ctrdmetaimages.Image, error) {
+	wrapperCli, err := c.Get(ctx)
+	if err != nil {
+		return ctrdmetaimages.Image{}, fmt.Errorf("failed to get a containerd grpc client: %v", err)
+	}
+
+	return wrapperCli.client.ImageService().Update(ctx, img, fieldpaths...)
+}
+
 // GetImage returns the containerd's Image.
 func (c *Client) GetImage(ctx context.Context, ref string) (containerd.Image, error) {
 	img, err := c.getImage(ctx, ref)
@@ -198,8 +220,29 @@ func (c *Client) PushImage(ctx context.Context, ref string, authConfig *types.Au
 		return convertCtrdErr(err)
 	}
 
+	return c.pushContent(ctx, wrapperCli, ref, img.Target(), authConfig, out)
+}
+
+// pushContent pushes the content referenced by target to registry as ref.
+func (c *Client) pushContent(ctx context.Context, wrapperCli *WrapperClient, ref string, target ocispec.Descriptor, authConfig *types.AuthConfig, out io.Writer) error {
 	pushTracker := docker.NewInMemoryTracker()
 
+	// fetch progress status, then send to client via out channel.
+	stream := jsonstream.New(out, nil)
+	defer func() {
+		stream.Close()
+		stream.Wait()
+	}()
+
+	// NOTE: the request throttled by registry is retried after the pause,
+	// which should be told to the client.
+	ctx = withThrottleNotifier(ctx, func(host string, wait time.Duration) {
+		logrus.Warnf("registry %s throttles the push of %s, retrying after %s", host, ref, wait)
+		stream.WriteObject(jsonstream.JSONMessage{
+			Status: fmt.Sprintf("Registry %s is throttling requests, retrying after %s", host, wait),
+		})
+	})
+
 	resolver, _, err := c.ResolveImage(ctx, ref, []string{ref}, authConfig, docker.ResolverOptions{
 		Tracker: pushTracker,
 	})
@@ -213,8 +256,6 @@ func (c *Client) PushImage(ctx context.Context, ref string, authConfig *types.Au
 		return nil, nil
 	})
 
-	// fetch progress status, then send to client via out channel.
-	stream := jsonstream.New(out, nil)
 	pctx, cancelProgress := context.WithCancel(ctx)
 	wait := make(chan struct{})
 	go func() {
@@ -222,18 +263,28 @@ func (c *Client) PushImage(ctx context.Context, ref string, authConfig *types.Au
 		close(wait)
 	}()
 
-	err = wrapperCli.client.Push(ctx, ref, img.Target(),
+	resolver = withTransferLimiter(resolver, nil, newTransferLimiter(c.maxConcurrentUploads))
+	resolver = withPushRateLimiter(resolver, newPushRateLimiter(c.pushRateLimit))
+
+	// NOTE: the blob mounted from other repository isn't uploaded, so the
+	// mount is tried before the limiters.
+	if sources := mountSources(ctx); len(sources) > 0 {
+		insecure := c.isInsecureDomain(ref)
+		mounter, err := newBlobMounter(ref, insecure, c.newRegistryClient(ctx, strings.SplitN(ref, "/", 2)[0], insecure), authConfig, pushTracker, sources)
+		if err != nil {
+			logrus.Warnf("failed to mount blobs for %s, uploading all of them: %v", ref, err)
+		} else {
+			resolver = withBlobMounter(resolver, mounter)
+		}
+	}
+
+	err = wrapperCli.client.Push(ctx, ref, target,
 		containerd.WithResolver(resolver),
 		containerd.WithImageHandler(handler))
 
 	cancelProgress()
 	<-wait
 
-	defer func() {
-		stream.Close()
-		stream.Wait()
-	}()
-
 	if err != nil {
 		stream.WriteObject(jsonstream.JSONMessage{
 			Error: &jsonstream.JSONError{
@@ -269,13 +320,39 @@ func (c *Client) FetchImage(ctx context.Context, resolver remotes.Resolver, avai
 		return nil, fmt.Errorf("failed to get a containerd grpc client: %v", err)
 	}
 
+	// NOTE: the content fetched before the pull, like the manifests to
+	// check the size, and the layers fetched by the interrupted pull are
+	// kept by the lease until the image is created.
+	ctx, releaseLease, err := withPullLease(ctx, wrapperCli.client.LeasesService(), c.pullLeases, availableRef)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepare lease of pull")
+	}
+
+	created := false
+	defer func() {
+		if err := releaseLease(ctx, created); err != nil {
+			logrus.Warnf("failed to release lease of pull %s: %v", availableRef, err)
+		}
+	}()
+
 	ongoing := newJobs(availableRef)
 
+	// NOTE: the limitation is per pull, like dockerd.
+	resolver = withTransferLimiter(resolver, newTransferLimiter(c.maxConcurrentDownloads), nil)
+
 	options := []containerd.RemoteOpt{
 		containerd.WithSchema1Conversion,
 		containerd.WithResolver(resolver),
 	}
 
+	// NOTE: the layers skipped in lazy mode are not shown in progress.
+	if IsLazy(ctx) {
+		options = append(options,
+			containerd.WithImageHandler(ctrdmetaimages.HandlerFunc(skipLayersHandler)),
+			containerd.WithPullLabel(LazyLabel, "true"),
+		)
+	}
+
 	handle := func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
 		if desc.MediaType != ctrdmetaimages.MediaTypeDockerSchema1Manifest {
 			ongoing.add(desc)
@@ -284,6 +361,44 @@ func (c *Client) FetchImage(ctx context.Context, resolver remotes.Resolver, avai
 	}
 	options = append(options, containerd.WithImageHandler(ctrdmetaimages.HandlerFunc(handle)))
 
+	var (
+		indexOnly = IsIndexOnly(ctx)
+		notify    = bestEffortNotifier(ctx)
+		maxSize   = maxImageSize(ctx)
+
+		// matcher selects the manifests to be pulled, which is shared
+		// by the size check so that the checked layers are the pulled
+		// ones. At most limit manifests are pulled from the index.
+		matcher platforms.MatchComparer = platforms.Default()
+		limit                           = 1
+	)
+	if indexOnly {
+		matcher, limit = platforms.All, 0
+	}
+
+	if maxSize > 0 {
+		if err := checkImageSize(ctx, wrapperCli.client.ContentStore(), resolver, availableRef, matcher, limit, maxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if indexOnly {
+		// NOTE: the platforms are fetched one by one in best-effort mode.
+		if notify != nil {
+			skipped, err := fetchAvailablePlatforms(ctx, wrapperCli.client.ContentStore(), resolver, availableRef, ctrdmetaimages.HandlerFunc(handle), notify)
+			if err != nil {
+				return nil, err
+			}
+			if len(skipped) > 0 {
+				matcher = ExcludePlatforms(matcher, skipped)
+				options = append(options, containerd.WithPullLabel(SkippedPlatformsLabel, strings.Join(skipped, ",")))
+			}
+		}
+
+		options = append(options, containerd.WithPullLabel(IndexOnlyLabel, "true"))
+	}
+	options = append(options, containerd.WithPlatformMatcher(matcher))
+
 	// fetch progress status, then send to client via out channel.
 	pctx, cancelProgress := context.WithCancel(ctx)
 	wait := make(chan struct{})
@@ -310,6 +425,7 @@ func (c *Client) FetchImage(ctx context.Context, resolver remotes.Resolver, avai
 		return nil, err
 	}
 
+	created = true
 	logrus.Infof("success to fetch image: %s", img.Name())
 	return img, nil
 }
@@ -330,6 +446,7 @@ func (c *Client) fetchProgress(ctx context.Context, wrapperCli *WrapperClient, o
 		cs         = wrapperCli.client.ContentStore()
 		start      = time.Now()
 		progresses = map[string]jsonstream.JSONMessage{}
+		ids        = map[string]string{}
 		done       bool
 	)
 	defer ticker.Stop()
@@ -376,6 +493,7 @@ outer:
 			for _, j := range ongoing.jobs() {
 				key := remotes.MakeRefKey(ctx, j)
 				keys = append(keys, key)
+				ids[key] = j.Digest.String()
 				if _, ok := activeSeen[key]; ok {
 					continue
 				}
@@ -426,8 +544,14 @@ outer:
 				}
 			}
 
+			// NOTE: the progress of content is keyed by the digest so
+			// that the client can render the progress of each layer.
 			for _, key := range keys {
-				stream.WriteObject(progresses[key])
+				msg := progresses[key]
+				if id, ok := ids[key]; ok {
+					msg.ID = id
+				}
+				stream.WriteObject(msg)
 			}
 
 			if done {
@@ -0,0 +1,236 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/containerd/containerd/content"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CopyImage copies the image with all the platforms from the source registry
+// to the destination registry. The content is fetched into the content store
+// only during the copy, and neither the image nor the snapshot is created.
+// The blobs which exist in the destination registry are not uploaded again.
+func (c *Client) CopyImage(ctx context.Context, srcRef, dstRef string, srcAuth, dstAuth *types.AuthConfig, out io.Writer) error {
+	if err := c.copyImage(ctx, srcRef, dstRef, srcAuth, dstAuth, out); err != nil {
+		return convertCtrdErr(err)
+	}
+	return nil
+}
+
+func (c *Client) copyImage(ctx context.Context, srcRef, dstRef string, srcAuth, dstAuth *types.AuthConfig, out io.Writer) error {
+	wrapperCli, err := c.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a containerd grpc client: %v", err)
+	}
+
+	// NOTE: the fetched content is kept by the lease during the push, and
+	// it becomes garbage after the copy.
+	ctx, done, err := wrapperCli.client.WithLease(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to create lease for copy")
+	}
+	defer done(ctx)
+
+	resolver, availableRef, err := c.getResolver(ctx, srcAuth, srcRef, []string{srcRef}, docker.ResolverOptions{})
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the blobs in the destination are neither fetched nor pushed.
+	insecure := c.isInsecureDomain(dstRef)
+	dstBlobs, err := newRemoteBlobs(dstRef, insecure, c.newRegistryClient(ctx, strings.SplitN(dstRef, "/", 2)[0], insecure), dstAuth)
+	if err != nil {
+		logrus.Warnf("failed to check blobs of %s, fetching all of them: %v", dstRef, err)
+	}
+
+	target, err := c.fetchContent(ctx, wrapperCli, resolver, availableRef, dstBlobs, out)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch %s", srcRef)
+	}
+
+	logrus.Infof("copying image %s to %s", srcRef, dstRef)
+	return c.pushContent(ctx, wrapperCli, dstRef, target, dstAuth, out)
+}
+
+// fetchContent fetches the content of all the platforms referenced by ref
+// into the content store, and returns the descriptor of ref. The blobs which
+// exist in dstBlobs are skipped.
+func (c *Client) fetchContent(ctx context.Context, wrapperCli *WrapperClient, resolver remotes.Resolver, ref string, dstBlobs *remoteBlobs, out io.Writer) (ocispec.Descriptor, error) {
+	name, target, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	// NOTE: the schema1 manifest is signed with the name of repository,
+	// which cannot be pushed into another repository as it is.
+	if target.MediaType == ctrdmetaimages.MediaTypeDockerSchema1Manifest {
+		return ocispec.Descriptor{}, fmt.Errorf("schema1 manifest of %s is not supported", ref)
+	}
+
+	resolver = withTransferLimiter(resolver, newTransferLimiter(c.maxConcurrentDownloads), nil)
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	stream := jsonstream.New(out, nil)
+	defer func() {
+		stream.Close()
+		stream.Wait()
+	}()
+
+	ongoing := newJobs(ref)
+	pctx, cancelProgress := context.WithCancel(ctx)
+	wait := make(chan struct{})
+	go func() {
+		if err := c.fetchProgress(pctx, wrapperCli, ongoing, stream); err != nil {
+			logrus.Errorf("failed to get copy's progress: %v", err)
+		}
+		close(wait)
+	}()
+
+	err = dispatchCopyContent(ctx, wrapperCli.client.ContentStore(), fetcher, target, dstBlobs, ongoing, stream)
+
+	cancelProgress()
+	<-wait
+
+	if err != nil {
+		stream.WriteObject(jsonstream.JSONMessage{
+			Error: &jsonstream.JSONError{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			},
+			ErrorMessage: err.Error(),
+		})
+		return ocispec.Descriptor{}, err
+	}
+	return target, nil
+}
+
+// dispatchCopyContent fetches the content of target into the content store.
+// The manifests and indexes are always fetched to walk the children, and the
+// other blobs are skipped if they exist in dstBlobs.
+func dispatchCopyContent(ctx context.Context, cs content.Store, fetcher remotes.Fetcher, target ocispec.Descriptor, dstBlobs *remoteBlobs, ongoing *jobs, stream *jsonstream.JSONStream) error {
+	skipExisting := func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		if dstBlobs == nil || isManifestOrIndex(desc.MediaType) {
+			return nil, nil
+		}
+
+		exists, err := dstBlobs.exists(ctx, desc)
+		if err != nil {
+			logrus.Warnf("failed to check blob %s in destination, fetching it: %v", desc.Digest, err)
+			return nil, nil
+		}
+		if !exists {
+			return nil, nil
+		}
+
+		stream.WriteObject(jsonstream.JSONMessage{
+			ID:     desc.Digest.String(),
+			Status: jsonstream.PushStatusExists,
+		})
+		return nil, ctrdmetaimages.ErrStopHandler
+	}
+
+	handle := func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		ongoing.add(desc)
+		return nil, nil
+	}
+
+	return ctrdmetaimages.Dispatch(ctx, ctrdmetaimages.Handlers(
+		ctrdmetaimages.HandlerFunc(skipExisting),
+		ctrdmetaimages.HandlerFunc(handle),
+		remotes.FetchHandler(cs, fetcher),
+		ctrdmetaimages.ChildrenHandler(cs),
+	), target)
+}
+
+func isManifestOrIndex(mediaType string) bool {
+	switch mediaType {
+	case ctrdmetaimages.MediaTypeDockerSchema2Manifest, ctrdmetaimages.MediaTypeDockerSchema2ManifestList,
+		ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex:
+		return true
+	}
+	return false
+}
+
+// remoteBlobs checks the blobs in the repository of registry.
+type remoteBlobs struct {
+	client     *http.Client
+	authorizer docker.Authorizer
+
+	// blobs is the url of blobs of the repository.
+	blobs url.URL
+}
+
+func newRemoteBlobs(ref string, insecure bool, client *http.Client, authConfig *types.AuthConfig) (*remoteBlobs, error) {
+	repo, err := repositoryURL(ref, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := repo
+	blobs.Path += "blobs/"
+	return &remoteBlobs{
+		client:     client,
+		authorizer: newRegistryAuthorizer(client, authConfig),
+		blobs:      blobs,
+	}, nil
+}
+
+// exists returns true if the blob is in the repository.
+func (r *remoteBlobs) exists(ctx context.Context, desc ocispec.Descriptor) (bool, error) {
+	u := r.blobs
+	u.Path += desc.Digest.String()
+
+	var responses []*http.Response
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+		if err != nil {
+			return false, err
+		}
+		req = req.WithContext(ctx)
+
+		if err := r.authorizer.Authorize(ctx, req); err != nil {
+			return false, err
+		}
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return false, err
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusNotFound:
+			return false, nil
+		case http.StatusUnauthorized:
+			if attempt == maxMountAuthAttempts {
+				return false, fmt.Errorf("unauthorized to check blob %s", desc.Digest)
+			}
+
+			responses = append(responses, resp)
+			if err := r.authorizer.AddResponses(ctx, responses); err != nil {
+				return false, errors.Wrapf(err, "failed to authorize the check of blob %s", desc.Digest)
+			}
+		default:
+			return false, fmt.Errorf("failed to check blob %s: %s", desc.Digest, resp.Status)
+		}
+	}
+}
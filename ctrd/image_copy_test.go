@@ -0,0 +1,79 @@
+package ctrd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/containerd/containerd/content/local"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchCopyContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-copy")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cs, err := local.NewStore(dir)
+	assert.NoError(t, err)
+
+	registry := &memRegistry{blobs: map[digest.Digest][]byte{}}
+	config := registry.add(ocispec.MediaTypeImageConfig, []byte("config"))
+	shared := registry.add(ocispec.MediaTypeImageLayer, []byte("shared layer"))
+	missing := registry.add(ocispec.MediaTypeImageLayer, []byte("missing layer"))
+	manifest := registry.add(ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Config: config,
+		Layers: []ocispec.Descriptor{shared, missing},
+	})
+
+	// the destination has the shared layer
+	var checked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		checked = append(checked, req.Method+" "+req.URL.Path)
+		if req.Method == http.MethodHead && req.URL.Path == "/v2/app/blobs/"+shared.Digest.String() {
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	c := &Client{registryTimeouts: DefaultRegistryTimeouts}
+	dstBlobs, err := newRemoteBlobs(host+"/app:latest", true, c.newRegistryClient(context.TODO(), host, true), nil)
+	assert.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	stream := jsonstream.New(out, nil)
+	fetcher := &recordFetcher{registry: registry, fetched: map[digest.Digest]int64{}}
+	err = dispatchCopyContent(context.TODO(), cs, fetcher, manifest, dstBlobs, newJobs("app"), stream)
+	stream.Close()
+	stream.Wait()
+	assert.NoError(t, err)
+
+	// only the missing blobs are fetched, and the manifest is always fetched
+	assert.Equal(t, map[digest.Digest]int64{
+		manifest.Digest: 0,
+		config.Digest:   0,
+		missing.Digest:  0,
+	}, fetcher.fetched)
+	assert.Len(t, checked, 3)
+	assert.Contains(t, out.String(), jsonstream.PushStatusExists)
+
+	// all the blobs are fetched without the destination
+	fetcher.fetched = map[digest.Digest]int64{}
+	stream = jsonstream.New(ioutil.Discard, nil)
+	err = dispatchCopyContent(context.TODO(), cs, fetcher, manifest, nil, newJobs("app"), stream)
+	stream.Close()
+	stream.Wait()
+	assert.NoError(t, err)
+	assert.Contains(t, fetcher.fetched, shared.Digest)
+}
@@ -0,0 +1,84 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/leases"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// gcLeaseExpiration makes sure the temporary lease is removed by containerd
+// even if pouchd fails to delete it.
+const gcLeaseExpiration = time.Hour
+
+// GarbageCollect triggers the garbage collection of containerd and reports
+// the blobs removed from content store.
+func (c *Client) GarbageCollect(ctx context.Context) (*types.GCResult, error) {
+	result, err := c.garbageCollect(ctx)
+	if err != nil {
+		return nil, convertCtrdErr(err)
+	}
+	return result, nil
+}
+
+// garbageCollect triggers the garbage collection of containerd.
+//
+// NOTE: containerd doesn't expose the API to run the garbage collection
+// directly, but the synchronous deletion of lease runs it before returning.
+func (c *Client) garbageCollect(ctx context.Context) (*types.GCResult, error) {
+	wrapperCli, err := c.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a containerd grpc client: %v", err)
+	}
+
+	cs := wrapperCli.client.ContentStore()
+	before, err := walkBlobs(ctx, cs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk content store")
+	}
+
+	leaseSrv := wrapperCli.client.LeasesService()
+	lease, err := leaseSrv.Create(ctx, leases.WithRandomID(), leases.WithExpiration(gcLeaseExpiration))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create lease")
+	}
+	if err := leaseSrv.Delete(ctx, lease, leases.SynchronousDelete); err != nil {
+		return nil, errors.Wrap(err, "failed to garbage collect")
+	}
+
+	after, err := walkBlobs(ctx, cs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk content store")
+	}
+	return diffBlobs(before, after), nil
+}
+
+// walkBlobs returns the size of each blob in the content store.
+func walkBlobs(ctx context.Context, cs content.Store) (map[digest.Digest]int64, error) {
+	blobs := make(map[digest.Digest]int64)
+	err := cs.Walk(ctx, func(info content.Info) error {
+		blobs[info.Digest] = info.Size
+		return nil
+	})
+	return blobs, err
+}
+
+// diffBlobs counts the blobs which are gone. The blobs added in the meantime,
+// like the ones pulled concurrently, are ignored.
+func diffBlobs(before, after map[digest.Digest]int64) *types.GCResult {
+	result := &types.GCResult{}
+	for dgst, size := range before {
+		if _, ok := after[dgst]; ok {
+			continue
+		}
+		result.BlobsDeleted++
+		result.SpaceReclaimed += size
+	}
+	return result
+}
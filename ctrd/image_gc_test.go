@@ -0,0 +1,23 @@
+package ctrd
+
+import (
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffBlobs(t *testing.T) {
+	var (
+		a = digest.FromString("a")
+		b = digest.FromString("b")
+		c = digest.FromString("c")
+	)
+
+	before := map[digest.Digest]int64{a: 10, b: 20}
+	after := map[digest.Digest]int64{b: 20, c: 30}
+	assert.Equal(t, &types.GCResult{BlobsDeleted: 1, SpaceReclaimed: 10}, diffBlobs(before, after))
+	assert.Equal(t, &types.GCResult{}, diffBlobs(before, before))
+}
@@ -0,0 +1,113 @@
+package ctrd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/content"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type maxImageSizeKey struct{}
+
+// WithMaxImageSize makes FetchImage fail before downloading any layer if the
+// summed size of layers is larger than size in bytes.
+func WithMaxImageSize(ctx context.Context, size int64) context.Context {
+	return context.WithValue(ctx, maxImageSizeKey{}, size)
+}
+
+// maxImageSize returns the size set by WithMaxImageSize, or zero if there is
+// no limitation.
+func maxImageSize(ctx context.Context) int64 {
+	size, _ := ctx.Value(maxImageSizeKey{}).(int64)
+	return size
+}
+
+// checkImageSize fetches the index and the manifests selected by matcher like
+// the pull, and returns error if the summed size of layers is larger than
+// maxSize. The layer shared by platforms is counted once.
+func checkImageSize(ctx context.Context, cs content.Store, resolver remotes.Resolver, ref string, matcher platforms.MatchComparer, limit int, maxSize int64) error {
+	size, err := layersSize(ctx, cs, resolver, ref, matcher, limit)
+	if err != nil {
+		return err
+	}
+
+	if size > maxSize {
+		return errors.Wrapf(errtypes.ErrInvalidParam, "image %s has %d bytes of layers, which exceeds the max image size %d bytes", ref, size, maxSize)
+	}
+	return nil
+}
+
+// layersSize returns the summed size of layers of the manifests selected by
+// matcher. At most limit manifests are selected from the index, and zero
+// means no limitation.
+func layersSize(ctx context.Context, cs content.Store, resolver remotes.Resolver, ref string, matcher platforms.MatchComparer, limit int) (int64, error) {
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve reference %q: %v", ref, err)
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get fetcher for %q: %v", name, err)
+	}
+
+	var (
+		fetch    = remotes.FetchHandler(cs, fetcher)
+		children = ctrdmetaimages.LimitManifests(ctrdmetaimages.FilterPlatforms(ctrdmetaimages.ChildrenHandler(cs), matcher), matcher, limit)
+		layers   = make(map[digest.Digest]int64)
+	)
+
+	handler := ctrdmetaimages.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		switch desc.MediaType {
+		case ocispec.MediaTypeImageIndex, ctrdmetaimages.MediaTypeDockerSchema2ManifestList:
+			if _, err := fetch(ctx, desc); err != nil {
+				return nil, err
+			}
+			return children(ctx, desc)
+		case ocispec.MediaTypeImageManifest, ctrdmetaimages.MediaTypeDockerSchema2Manifest:
+			if _, err := fetch(ctx, desc); err != nil {
+				return nil, err
+			}
+
+			data, err := content.ReadBlob(ctx, cs, desc)
+			if err != nil {
+				return nil, err
+			}
+
+			var manifest ocispec.Manifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal manifest %s: %v", desc.Digest, err)
+			}
+			for _, layer := range manifest.Layers {
+				layers[layer.Digest] = layer.Size
+			}
+			return nil, nil
+		default:
+			// NOTE: the schema1 manifest doesn't tell the size of layers.
+			logrus.Warnf("skip checking the size of %s with media type %s", ref, desc.MediaType)
+			return nil, nil
+		}
+	})
+
+	// NOTE: Walk handles the manifests one by one, so that the layers are
+	// recorded without lock.
+	if err := ctrdmetaimages.Walk(ctx, handler, desc); err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, s := range layers {
+		size += s
+	}
+	return size, nil
+}
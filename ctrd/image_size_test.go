@@ -0,0 +1,62 @@
+package ctrd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/platforms"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckImageSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-size")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cs, err := local.NewStore(dir)
+	assert.NoError(t, err)
+
+	registry := &memRegistry{blobs: map[digest.Digest][]byte{}}
+	base := registry.add(ocispec.MediaTypeImageLayer, []byte("base"))
+	newManifest := func(layer string, platform ocispec.Platform) ocispec.Descriptor {
+		desc := registry.add(ocispec.MediaTypeImageManifest, ocispec.Manifest{
+			Config: registry.add(ocispec.MediaTypeImageConfig, []byte("config of "+layer)),
+			Layers: []ocispec.Descriptor{base, registry.add(ocispec.MediaTypeImageLayer, []byte(layer))},
+		})
+		desc.Platform = &platform
+		return desc
+	}
+
+	amd64 := ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	registry.root = registry.add(ocispec.MediaTypeImageIndex, ocispec.Index{
+		Manifests: []ocispec.Descriptor{
+			newManifest("amd64", amd64),
+			newManifest("arm64", ocispec.Platform{OS: "linux", Architecture: "arm64"}),
+		},
+	})
+
+	// base + amd64
+	size, err := layersSize(context.TODO(), cs, registry, "busybox", platforms.Only(amd64), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4+5), size)
+
+	// the base layer shared by platforms is counted once
+	size, err = layersSize(context.TODO(), cs, registry, "busybox", platforms.All, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4+5+5), size)
+
+	assert.NoError(t, checkImageSize(context.TODO(), cs, registry, "busybox", platforms.All, 0, 14))
+	err = checkImageSize(context.TODO(), cs, registry, "busybox", platforms.All, 0, 13)
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	// none of layers is downloaded
+	_, err = cs.Info(context.TODO(), base.Digest)
+	assert.Error(t, err)
+}
@@ -0,0 +1,30 @@
+package ctrd
+
+import (
+	"context"
+
+	"github.com/containerd/containerd"
+)
+
+// IndexOnlyLabel is set on the containerd image which is pulled with all the
+// platforms and isn't unpacked.
+const IndexOnlyLabel = "pouch.index-only"
+
+type indexOnlyKey struct{}
+
+// WithIndexOnly makes FetchImage fetch the content of all the platforms
+// referenced by the index, without any platform selection.
+func WithIndexOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, indexOnlyKey{}, true)
+}
+
+// IsIndexOnly returns true if the context is set by WithIndexOnly.
+func IsIndexOnly(ctx context.Context) bool {
+	indexOnly, _ := ctx.Value(indexOnlyKey{}).(bool)
+	return indexOnly
+}
+
+// IsIndexOnlyImage returns true if the image is pulled in index-only mode.
+func IsIndexOnlyImage(img containerd.Image) bool {
+	return img.Labels()[IndexOnlyLabel] == "true"
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/containerd/containerd/snapshots"
 	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // APIClient defines common methods of containerd api client
@@ -75,6 +76,8 @@ type ContainerAPIClient interface {
 type ImageAPIClient interface {
 	// CreateImageReference creates the image data into meta data in the containerd.
 	CreateImageReference(ctx context.Context, img ctrdmetaimages.Image) (ctrdmetaimages.Image, error)
+	// UpdateImage updates the fields of image given by fieldpaths in the meta data in the containerd.
+	UpdateImage(ctx context.Context, img ctrdmetaimages.Image, fieldpaths ...string) (ctrdmetaimages.Image, error)
 	// GetImage returns containerd.Image by the given reference.
 	GetImage(ctx context.Context, ref string) (containerd.Image, error)
 	// ListImages returns the list of containerd.Image filtered by the given conditions.
@@ -85,6 +88,10 @@ type ImageAPIClient interface {
 	ResolveImage(ctx context.Context, nameRef string, refs []string, authConfig *types.AuthConfig, opts docker.ResolverOptions) (remotes.Resolver, string, error)
 	// RemoveImage removes the image by the given reference.
 	RemoveImage(ctx context.Context, ref string) error
+	// UnpackLazily prepares the snapshots of the lazily pulled image in the remote snapshotter.
+	UnpackLazily(ctx context.Context, img containerd.Image, ref string, stream *jsonstream.JSONStream) error
+	// UnpackImage unpacks the image into the snapshotter, and sends the status of each layer by the stream.
+	UnpackImage(ctx context.Context, img containerd.Image, snapshotter string, stream *jsonstream.JSONStream) error
 	// ImportImage creates a set of images by tarstream.
 	ImportImage(ctx context.Context, reader io.Reader, opts ...containerd.ImportOpt) ([]containerd.Image, error)
 	// SaveImage saves image to tarstream
@@ -93,12 +100,22 @@ type ImageAPIClient interface {
 	Commit(ctx context.Context, config *CommitConfig) (digest.Digest, error)
 	// PushImage pushes a image to registry
 	PushImage(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer) error
+	// PushManifestList pushes the manifest list with the manifests it references to registry.
+	PushManifestList(ctx context.Context, ref string, desc ocispec.Descriptor, data []byte, authConfig *types.AuthConfig, out io.Writer) error
+	// CopyImage copies the image from the source registry to the destination registry.
+	CopyImage(ctx context.Context, srcRef, dstRef string, srcAuth, dstAuth *types.AuthConfig, out io.Writer) error
+	// GarbageCollect removes the content not referenced by any image or lease.
+	GarbageCollect(ctx context.Context) (*types.GCResult, error)
+	// ListRemoteTags lists the tags of repository in the registry.
+	ListRemoteTags(ctx context.Context, repo string, authConfig *types.AuthConfig) ([]string, error)
 }
 
 // SnapshotAPIClient provides access to containerd snapshot features
 type SnapshotAPIClient interface {
 	// CreateSnapshot creates a active snapshot with image's name and id.
 	CreateSnapshot(ctx context.Context, id, ref string) error
+	// PrepareSnapshot creates a active snapshot with id on the parent.
+	PrepareSnapshot(ctx context.Context, id, parent string) error
 	// GetSnapshot returns the snapshot's info by id.
 	GetSnapshot(ctx context.Context, id string) (snapshots.Info, error)
 	// RemoveSnapshot removes the snapshot by id.
@@ -0,0 +1,187 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/containerd/containerd/snapshots"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// LazyLabel is set on the containerd image which is pulled without the
+// layers, whose snapshots are fetched on demand by the remote snapshotter.
+const LazyLabel = "pouch.lazy"
+
+// The labels passed to the remote snapshotter when preparing the snapshot,
+// which are the same as the ones used by the remote snapshotters like
+// stargz, nydus and overlaybd.
+const (
+	// targetSnapshotLabel is the name of snapshot to be committed, and the
+	// remote snapshotter returns ErrAlreadyExists if it's prepared remotely.
+	targetSnapshotLabel = "containerd.io/snapshot.ref"
+
+	remoteImageRefLabel    = "containerd.io/snapshot/cri.image-ref"
+	remoteLayerDigestLabel = "containerd.io/snapshot/cri.layer-digest"
+	remoteImageLayersLabel = "containerd.io/snapshot/cri.image-layers"
+
+	// remoteImageLayersLimit limits the size of image-layers label, which
+	// is the same as the containerd.
+	remoteImageLayersLimit = 4096
+)
+
+type lazyKey struct{}
+
+// WithLazy makes FetchImage fetch the manifest and config only, without the
+// layers.
+func WithLazy(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lazyKey{}, true)
+}
+
+// IsLazy returns true if the context is set by WithLazy.
+func IsLazy(ctx context.Context) bool {
+	lazy, _ := ctx.Value(lazyKey{}).(bool)
+	return lazy
+}
+
+// IsLazyImage returns true if the image is pulled in lazy mode.
+func IsLazyImage(img containerd.Image) bool {
+	return img.Labels()[LazyLabel] == "true"
+}
+
+// skipLayersHandler stops fetching the layers in lazy mode, and only the
+// manifests, indexes and configs are fetched.
+func skipLayersHandler(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	switch desc.MediaType {
+	case ctrdmetaimages.MediaTypeDockerSchema2Manifest, ctrdmetaimages.MediaTypeDockerSchema2ManifestList,
+		ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex,
+		ctrdmetaimages.MediaTypeDockerSchema2Config, ocispec.MediaTypeImageConfig, docker.LegacyConfigMediaType:
+		return nil, nil
+	}
+	return nil, ctrdmetaimages.ErrStopHandler
+}
+
+// UnpackLazily prepares the snapshots of the lazily pulled image in the remote
+// snapshotter, which mounts the layers from the registry instead of the local
+// content. The status of each layer is sent by the stream.
+func (c *Client) UnpackLazily(ctx context.Context, img containerd.Image, ref string, stream *jsonstream.JSONStream) error {
+	if err := c.unpackLazily(ctx, img, ref, stream); err != nil {
+		return convertCtrdErr(err)
+	}
+	return nil
+}
+
+func (c *Client) unpackLazily(ctx context.Context, img containerd.Image, ref string, stream *jsonstream.JSONStream) error {
+	wrapperCli, err := c.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a containerd grpc client: %v", err)
+	}
+
+	var (
+		cs          = img.ContentStore()
+		snapshotter = CurrentSnapshotterName(ctx)
+	)
+
+	manifest, err := ctrdmetaimages.Manifest(ctx, cs, img.Target(), platforms.Default())
+	if err != nil {
+		return err
+	}
+
+	diffIDs, err := img.RootFS(ctx)
+	if err != nil {
+		return err
+	}
+
+	sn := wrapperCli.client.SnapshotService(snapshotter)
+	defer sn.Close()
+
+	chainID, err := prepareRemoteSnapshots(ctx, sn, snapshotter, ref, manifest.Layers, diffIDs, layerProgress{stream})
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the snapshot is referenced by the config like Unpack, so that
+	// it's kept by the garbage collection.
+	gcLabel := fmt.Sprintf("containerd.io/gc.ref.snapshot.%s", snapshotter)
+	_, err = cs.Update(ctx, content.Info{
+		Digest: manifest.Config.Digest,
+		Labels: map[string]string{gcLabel: chainID.String()},
+	}, "labels."+gcLabel)
+	return err
+}
+
+// prepareRemoteSnapshots prepares the snapshot of each layer with the labels
+// of remote snapshotter, and returns the chainID of top layer. The snapshotter
+// which doesn't support remote snapshot is rejected. The layer prepared
+// remotely is complete without being downloaded.
+func prepareRemoteSnapshots(ctx context.Context, sn snapshots.Snapshotter, snapshotter string, ref string, layers []ocispec.Descriptor, diffIDs []digest.Digest, progress layerProgress) (digest.Digest, error) {
+	if len(layers) != len(diffIDs) {
+		return "", fmt.Errorf("mismatched number of layers and diffIDs")
+	}
+
+	var parent digest.Digest
+	for i, layer := range layers {
+		chainID := identity.ChainID(diffIDs[:i+1])
+		if _, err := sn.Stat(ctx, chainID.String()); err == nil {
+			progress.write(layer, jsonstream.PullStatusExists, nil)
+			parent = chainID
+			continue
+		} else if !errdefs.IsNotFound(err) {
+			return "", err
+		}
+
+		labels := map[string]string{
+			targetSnapshotLabel:    chainID.String(),
+			remoteImageRefLabel:    ref,
+			remoteLayerDigestLabel: layer.Digest.String(),
+			remoteImageLayersLabel: remoteImageLayers(layers[i:]),
+		}
+
+		key := fmt.Sprintf("lazy-%d-%s", time.Now().UnixNano(), chainID)
+		_, err := sn.Prepare(ctx, key, parent.String(), snapshots.WithLabels(labels))
+		if err == nil {
+			// NOTE: the snapshotter prepares the active snapshot to
+			// be extracted, which means the remote snapshot is not
+			// supported.
+			if rerr := sn.Remove(ctx, key); rerr != nil {
+				return "", errors.Wrapf(rerr, "failed to remove snapshot %s", key)
+			}
+			return "", errors.Wrapf(errdefs.ErrInvalidArgument, "snapshotter %s doesn't support remote snapshot", snapshotter)
+		}
+		if !errdefs.IsAlreadyExists(err) {
+			return "", errors.Wrapf(err, "failed to prepare remote snapshot of layer %s", layer.Digest)
+		}
+		progress.write(layer, jsonstream.PullStatusComplete, nil)
+		parent = chainID
+	}
+	return parent, nil
+}
+
+// remoteImageLayers returns the digests of layers, from the current one to
+// the top, which helps the remote snapshotter to prefetch them.
+func remoteImageLayers(layers []ocispec.Descriptor) string {
+	var (
+		digests []string
+		size    int
+	)
+	for _, layer := range layers {
+		size += len(layer.Digest.String()) + 1
+		if size > remoteImageLayersLimit {
+			break
+		}
+		digests = append(digests, layer.Digest.String())
+	}
+	return strings.Join(digests, ",")
+}
@@ -0,0 +1,96 @@
+package ctrd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// remoteSnapshotter commits the snapshot remotely if remote is true, or
+// prepares the active snapshot like the local snapshotter.
+type remoteSnapshotter struct {
+	snapshots.Snapshotter
+
+	remote    bool
+	committed map[string]map[string]string
+	removed   []string
+}
+
+func (s *remoteSnapshotter) Stat(ctx context.Context, key string) (snapshots.Info, error) {
+	if _, ok := s.committed[key]; ok {
+		return snapshots.Info{Name: key}, nil
+	}
+	return snapshots.Info{}, errdefs.ErrNotFound
+}
+
+func (s *remoteSnapshotter) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	var info snapshots.Info
+	for _, opt := range opts {
+		opt(&info)
+	}
+
+	if !s.remote {
+		return nil, nil
+	}
+	s.committed[info.Labels[targetSnapshotLabel]] = info.Labels
+	return nil, errdefs.ErrAlreadyExists
+}
+
+func (s *remoteSnapshotter) Remove(ctx context.Context, key string) error {
+	s.removed = append(s.removed, key)
+	return nil
+}
+
+func TestPrepareRemoteSnapshots(t *testing.T) {
+	var (
+		layers  []ocispec.Descriptor
+		diffIDs []digest.Digest
+	)
+	for _, layer := range []string{"base", "lib", "app"} {
+		layers = append(layers, ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString(layer + ".gz")})
+		diffIDs = append(diffIDs, digest.FromString(layer))
+	}
+
+	// the base layer has been committed by other image
+	sn := &remoteSnapshotter{
+		remote:    true,
+		committed: map[string]map[string]string{identity.ChainID(diffIDs[:1]).String(): nil},
+	}
+
+	chainID, err := prepareRemoteSnapshots(context.TODO(), sn, "stargz", "reg.abc.com/app:1.0", layers, diffIDs, layerProgress{})
+	assert.NoError(t, err)
+	assert.Equal(t, identity.ChainID(diffIDs), chainID)
+	assert.Equal(t, 3, len(sn.committed))
+
+	labels := sn.committed[identity.ChainID(diffIDs[:2]).String()]
+	assert.Equal(t, "reg.abc.com/app:1.0", labels[remoteImageRefLabel])
+	assert.Equal(t, layers[1].Digest.String(), labels[remoteLayerDigestLabel])
+	assert.Equal(t, layers[1].Digest.String()+","+layers[2].Digest.String(), labels[remoteImageLayersLabel])
+
+	// the snapshotter which doesn't support remote snapshot is rejected
+	local := &remoteSnapshotter{committed: map[string]map[string]string{}}
+	_, err = prepareRemoteSnapshots(context.TODO(), local, "overlayfs", "reg.abc.com/app:1.0", layers, diffIDs, layerProgress{})
+	assert.True(t, errdefs.IsInvalidArgument(err))
+	assert.Equal(t, 1, len(local.removed))
+}
+
+func TestSkipLayersHandler(t *testing.T) {
+	for mediaType, skipped := range map[string]bool{
+		ocispec.MediaTypeImageIndex:                    false,
+		ctrdmetaimages.MediaTypeDockerSchema2Manifest:  false,
+		ctrdmetaimages.MediaTypeDockerSchema2Config:    false,
+		ocispec.MediaTypeImageLayerGzip:                true,
+		ctrdmetaimages.MediaTypeDockerSchema2LayerGzip: true,
+	} {
+		_, err := skipLayersHandler(context.TODO(), ocispec.Descriptor{MediaType: mediaType})
+		assert.Equal(t, skipped, err == ctrdmetaimages.ErrStopHandler, mediaType)
+	}
+}
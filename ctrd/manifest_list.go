@@ -0,0 +1,57 @@
+package ctrd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// PushManifestList writes the manifest list described by desc into the
+// content store, and pushes it with the manifests it references to registry
+// as ref. The manifest list is not kept as local image.
+func (c *Client) PushManifestList(ctx context.Context, ref string, desc ocispec.Descriptor, data []byte, authConfig *types.AuthConfig, out io.Writer) error {
+	if err := c.pushManifestList(ctx, ref, desc, data, authConfig, out); err != nil {
+		return convertCtrdErr(err)
+	}
+	return nil
+}
+
+func (c *Client) pushManifestList(ctx context.Context, ref string, desc ocispec.Descriptor, data []byte, authConfig *types.AuthConfig, out io.Writer) error {
+	wrapperCli, err := c.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a containerd grpc client: %v", err)
+	}
+
+	var index ocispec.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return errors.Wrap(err, "failed to unmarshal manifest list")
+	}
+
+	// NOTE: the manifest list is kept by the lease during the push.
+	ctx, done, err := wrapperCli.client.WithLease(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to create lease for push")
+	}
+	defer done(ctx)
+
+	labels := make(map[string]string, len(index.Manifests))
+	for i, m := range index.Manifests {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.m.%d", i)] = m.Digest.String()
+	}
+
+	cs := wrapperCli.client.ContentStore()
+	if err := content.WriteBlob(ctx, cs, remotes.MakeRefKey(ctx, desc), bytes.NewReader(data), desc, content.WithLabels(labels)); err != nil {
+		return errors.Wrap(err, "failed to write manifest list")
+	}
+
+	return c.pushContent(ctx, wrapperCli, ref, desc, authConfig, out)
+}
@@ -0,0 +1,92 @@
+package ctrd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/leases"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// pullLeasePrefix is the prefix of lease ID which keeps the content
+	// fetched by the pull until the image is created.
+	pullLeasePrefix = "pouch-pull-"
+
+	// pullLeaseExpiration makes sure the content of the abandoned pull is
+	// removed by containerd eventually.
+	pullLeaseExpiration = 24 * time.Hour
+)
+
+// pullLeaseID returns the lease ID of the pull, which is the same for the
+// pulls of the same reference.
+func pullLeaseID(ref string) string {
+	return pullLeasePrefix + digest.FromString(ref).Hex()
+}
+
+// pullLeaseUsers counts the in-flight pulls sharing the lease of the same
+// reference, like the concurrent pulls with different options, so that the
+// lease is removed by the last one instead of the first one to finish.
+type pullLeaseUsers struct {
+	mu    sync.Mutex
+	users map[string]int
+}
+
+func newPullLeaseUsers() *pullLeaseUsers {
+	return &pullLeaseUsers{
+		users: make(map[string]int),
+	}
+}
+
+// withPullLease sets the lease of pull for context, and the lease left by
+// the interrupted pull of the same reference is reused. The returned release
+// must be called when the pull finishes, and it removes the lease only if it
+// is the last user of the lease and the image is created.
+//
+// NOTE: the lease of containerd is removed after each pull, even if it fails,
+// so that the layers fetched by the interrupted pull become garbage. The lease
+// of pull keeps them and the partially written ingests, so that the next pull
+// skips the complete layers and resumes the partial ones from the offset.
+func withPullLease(ctx context.Context, ls leases.Manager, users *pullLeaseUsers, ref string) (context.Context, func(ctx context.Context, created bool) error, error) {
+	if _, ok := leases.FromContext(ctx); ok {
+		return ctx, func(context.Context, bool) error {
+			return nil
+		}, nil
+	}
+
+	id := pullLeaseID(ref)
+
+	// NOTE: the lease is created and removed with the lock held, so that
+	// the new user never gets the lease being removed.
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	existing, err := ls.List(ctx, "id=="+id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(existing) == 0 {
+		if _, err := ls.Create(ctx, leases.WithID(id), leases.WithExpiration(pullLeaseExpiration)); err != nil && !errdefs.IsAlreadyExists(err) {
+			return nil, nil, err
+		}
+	}
+	users.users[id]++
+
+	return leases.WithLease(ctx, id), func(ctx context.Context, created bool) error {
+		users.mu.Lock()
+		defer users.mu.Unlock()
+
+		if users.users[id]--; users.users[id] > 0 {
+			return nil
+		}
+		delete(users.users, id)
+
+		if !created {
+			return nil
+		}
+		return ls.Delete(ctx, leases.Lease{ID: id})
+	}, nil
+}
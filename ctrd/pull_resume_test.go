@@ -0,0 +1,173 @@
+package ctrd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/remotes"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// memLeases is leases.Manager which only supports the filter by ID.
+type memLeases struct {
+	leases map[string]leases.Lease
+}
+
+func (m *memLeases) Create(ctx context.Context, opts ...leases.Opt) (leases.Lease, error) {
+	var l leases.Lease
+	for _, opt := range opts {
+		if err := opt(&l); err != nil {
+			return leases.Lease{}, err
+		}
+	}
+	if _, ok := m.leases[l.ID]; ok {
+		return leases.Lease{}, errdefs.ErrAlreadyExists
+	}
+	m.leases[l.ID] = l
+	return l, nil
+}
+
+func (m *memLeases) Delete(ctx context.Context, l leases.Lease, opts ...leases.DeleteOpt) error {
+	if _, ok := m.leases[l.ID]; !ok {
+		return errdefs.ErrNotFound
+	}
+	delete(m.leases, l.ID)
+	return nil
+}
+
+func (m *memLeases) List(ctx context.Context, filters ...string) ([]leases.Lease, error) {
+	var res []leases.Lease
+	for id, l := range m.leases {
+		if len(filters) == 0 || filters[0] == "id=="+id {
+			res = append(res, l)
+		}
+	}
+	return res, nil
+}
+
+// seekRecorder records the offset which the fetch resumes from.
+type seekRecorder struct {
+	*bytes.Reader
+	record func(int64)
+}
+
+func (r seekRecorder) Seek(offset int64, whence int) (int64, error) {
+	r.record(offset)
+	return r.Reader.Seek(offset, whence)
+}
+
+func (r seekRecorder) Close() error {
+	return nil
+}
+
+// recordFetcher records the offset of each fetched blob.
+type recordFetcher struct {
+	registry *memRegistry
+	fetched  map[digest.Digest]int64
+}
+
+func (f *recordFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	rc, err := f.registry.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := ioutil.ReadAll(rc)
+
+	f.fetched[desc.Digest] = 0
+	return seekRecorder{Reader: bytes.NewReader(data), record: func(offset int64) {
+		f.fetched[desc.Digest] = offset
+	}}, nil
+}
+
+func TestWithPullLease(t *testing.T) {
+	ls := &memLeases{leases: map[string]leases.Lease{}}
+	users := newPullLeaseUsers()
+
+	ctx, release, err := withPullLease(context.TODO(), ls, users, "reg.abc.com/library/busybox:latest")
+	assert.NoError(t, err)
+
+	id, ok := leases.FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, pullLeaseID("reg.abc.com/library/busybox:latest"), id)
+	assert.Contains(t, ls.leases[id].Labels, "containerd.io/gc.expire")
+
+	// the lease in context is used as it is
+	nested, releaseNested, err := withPullLease(ctx, ls, users, "reg.abc.com/library/busybox:1.30")
+	assert.NoError(t, err)
+	assert.Equal(t, ctx, nested)
+	assert.NoError(t, releaseNested(nested, true))
+	assert.Equal(t, 1, len(ls.leases))
+
+	// the failed pull keeps the lease for the next pull to resume
+	assert.NoError(t, release(ctx, false))
+	assert.Equal(t, 1, len(ls.leases))
+
+	// the lease left by the interrupted pull is reused
+	ctx, release, err = withPullLease(context.TODO(), ls, users, "reg.abc.com/library/busybox:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(ls.leases))
+
+	// the concurrent pull of the same reference shares the lease, and the
+	// first one to finish doesn't remove it
+	ctx2, release2, err := withPullLease(context.TODO(), ls, users, "reg.abc.com/library/busybox:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(ls.leases))
+
+	assert.NoError(t, release(ctx, true))
+	assert.Equal(t, 1, len(ls.leases))
+
+	assert.NoError(t, release2(ctx2, true))
+	assert.Equal(t, 0, len(ls.leases))
+	assert.Equal(t, 0, len(users.users))
+}
+
+func TestResumePull(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-resume")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cs, err := local.NewStore(dir)
+	assert.NoError(t, err)
+
+	registry := &memRegistry{blobs: map[digest.Digest][]byte{}}
+	complete := registry.add(ocispec.MediaTypeImageLayer, []byte("complete layer"))
+	partial := registry.add(ocispec.MediaTypeImageLayer, []byte("partial layer"))
+	missing := registry.add(ocispec.MediaTypeImageLayer, []byte("missing layer"))
+
+	// the content left by the interrupted pull
+	ctx := context.TODO()
+	assert.NoError(t, content.WriteBlob(ctx, cs, remotes.MakeRefKey(ctx, complete), bytes.NewReader(registry.blobs[complete.Digest]), complete))
+
+	cw, err := content.OpenWriter(ctx, cs, content.WithRef(remotes.MakeRefKey(ctx, partial)), content.WithDescriptor(partial))
+	assert.NoError(t, err)
+	_, err = cw.Write(registry.blobs[partial.Digest][:7])
+	assert.NoError(t, err)
+	assert.NoError(t, cw.Close())
+
+	fetcher := &recordFetcher{registry: registry, fetched: map[digest.Digest]int64{}}
+	handler := remotes.FetchHandler(cs, fetcher)
+	assert.NoError(t, ctrdmetaimages.Dispatch(ctx, handler, complete, partial, missing))
+
+	// only the missing layers are fetched, and the partial one is resumed
+	assert.Equal(t, map[digest.Digest]int64{
+		partial.Digest: 7,
+		missing.Digest: 0,
+	}, fetcher.fetched)
+
+	for _, desc := range []ocispec.Descriptor{complete, partial, missing} {
+		data, err := content.ReadBlob(ctx, cs, desc)
+		assert.NoError(t, err)
+		assert.Equal(t, registry.blobs[desc.Digest], data)
+	}
+}
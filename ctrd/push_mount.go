@@ -0,0 +1,241 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxMountSources caps the source repositories tried for each blob,
+	// because each failed mount costs one request.
+	maxMountSources = 3
+
+	// maxMountAuthAttempts caps the attempts to authorize the mount.
+	maxMountAuthAttempts = 3
+)
+
+type mountSourcesKey struct{}
+
+// WithMountSources gives the repositories on the same registry which may have
+// the blobs to be pushed, like library/app-v1 for the blobs shared with
+// library/app-v2. The push tries to mount the blob from them by the cross
+// repository blob mount before uploading it.
+func WithMountSources(ctx context.Context, sources map[digest.Digest][]string) context.Context {
+	return context.WithValue(ctx, mountSourcesKey{}, sources)
+}
+
+// mountSources returns the sources set by WithMountSources.
+func mountSources(ctx context.Context) map[digest.Digest][]string {
+	sources, _ := ctx.Value(mountSourcesKey{}).(map[digest.Digest][]string)
+	return sources
+}
+
+// blobMounter mounts the blob into the repository of ref from other
+// repositories of the same registry.
+type blobMounter struct {
+	client     *http.Client
+	authorizer docker.Authorizer
+
+	// uploads is the url of blob uploads of the target repository.
+	uploads url.URL
+	sources map[digest.Digest][]string
+	tracker docker.StatusTracker
+}
+
+// newBlobMounter creates the mounter with its own authorizer, because the
+// token for mount has the pull scope of the source repository, which should
+// not replace the token of push.
+func newBlobMounter(ref string, insecure bool, client *http.Client, authConfig *types.AuthConfig, tracker docker.StatusTracker, sources map[digest.Digest][]string) (*blobMounter, error) {
+	repo, err := repositoryURL(ref, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := repo
+	uploads.Path += "blobs/uploads/"
+	return &blobMounter{
+		client:     client,
+		authorizer: newRegistryAuthorizer(client, authConfig),
+		uploads:    uploads,
+		sources:    sources,
+		tracker:    tracker,
+	}, nil
+}
+
+// repositoryURL returns the url of the repository of ref, like
+// https://reg.abc.com/v2/library/busybox/.
+func repositoryURL(ref string, insecure bool) (url.URL, error) {
+	namedRef, err := reference.Parse(ref)
+	if err != nil {
+		return url.URL{}, err
+	}
+
+	parts := strings.SplitN(namedRef.Name(), "/", 2)
+	if len(parts) != 2 {
+		return url.URL{}, fmt.Errorf("reference %s should contain the registry", ref)
+	}
+	domain, path := parts[0], parts[1]
+
+	// NOTE: the same as the resolver of containerd.
+	host := domain
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	return url.URL{Scheme: scheme, Host: host, Path: "/v2/" + path + "/"}, nil
+}
+
+// mount tries to mount the blob from the repository, and returns false if
+// the registry doesn't mount it.
+func (m *blobMounter) mount(ctx context.Context, desc ocispec.Descriptor, from string) (bool, error) {
+	u := m.uploads
+	u.RawQuery = url.Values{"mount": {desc.Digest.String()}, "from": {from}}.Encode()
+
+	var responses []*http.Response
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+		if err != nil {
+			return false, err
+		}
+		req = req.WithContext(ctx)
+
+		if err := m.authorizer.Authorize(ctx, req); err != nil {
+			return false, err
+		}
+
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return false, err
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusCreated:
+			return true, nil
+		case http.StatusAccepted:
+			// NOTE: the registry starts the upload instead if it
+			// can't mount the blob, which should be cancelled.
+			m.cancelUpload(ctx, resp)
+			return false, nil
+		case http.StatusUnauthorized:
+			if attempt == maxMountAuthAttempts {
+				return false, fmt.Errorf("unauthorized to mount %s from %s", desc.Digest, from)
+			}
+
+			// NOTE: the authorizer rejects the repeated challenge as
+			// the invalid authorization.
+			responses = append(responses, resp)
+			if err := m.authorizer.AddResponses(ctx, responses); err != nil {
+				return false, errors.Wrapf(err, "failed to authorize the mount of %s", desc.Digest)
+			}
+		default:
+			return false, fmt.Errorf("failed to mount %s from %s: %s", desc.Digest, from, resp.Status)
+		}
+	}
+}
+
+// cancelUpload cancels the upload started by the failed mount.
+func (m *blobMounter) cancelUpload(ctx context.Context, resp *http.Response) {
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, location.String(), nil)
+	if err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+
+	if err := m.authorizer.Authorize(ctx, req); err != nil {
+		return
+	}
+
+	if resp, err := m.client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// withBlobMounter wraps the resolver to mount the blobs before pushing them.
+func withBlobMounter(resolver remotes.Resolver, mounter *blobMounter) remotes.Resolver {
+	if mounter == nil || len(mounter.sources) == 0 {
+		return resolver
+	}
+	return &mountingResolver{Resolver: resolver, mounter: mounter}
+}
+
+type mountingResolver struct {
+	remotes.Resolver
+	mounter *blobMounter
+}
+
+// Pusher implements remotes.Resolver.
+func (r *mountingResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	pusher, err := r.Resolver.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &mountingPusher{Pusher: pusher, mounter: r.mounter}, nil
+}
+
+type mountingPusher struct {
+	remotes.Pusher
+	mounter *blobMounter
+}
+
+// Push implements remotes.Pusher.
+//
+// The mounted blob is recorded as the existing one in the tracker, like the
+// blob which has been in the repository, and then ErrAlreadyExists tells the
+// push to skip it.
+func (p *mountingPusher) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	switch desc.MediaType {
+	case ctrdmetaimages.MediaTypeDockerSchema2Manifest, ctrdmetaimages.MediaTypeDockerSchema2ManifestList,
+		ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex:
+		return p.Pusher.Push(ctx, desc)
+	}
+
+	sources := p.mounter.sources[desc.Digest]
+	if len(sources) > maxMountSources {
+		sources = sources[:maxMountSources]
+	}
+
+	for _, from := range sources {
+		mounted, err := p.mounter.mount(ctx, desc, from)
+		if err != nil {
+			logrus.Warnf("failed to mount blob %s from %s, trying to upload it: %v", desc.Digest, from, err)
+			continue
+		}
+		if !mounted {
+			continue
+		}
+
+		logrus.Debugf("mounted blob %s from %s", desc.Digest, from)
+		ref := remotes.MakeRefKey(ctx, desc)
+		p.mounter.tracker.SetStatus(ref, docker.Status{
+			Status: content.Status{Ref: ref},
+		})
+		return nil, errors.Wrapf(errdefs.ErrAlreadyExists, "content %v mounted from %s", desc.Digest, from)
+	}
+	return p.Pusher.Push(ctx, desc)
+}
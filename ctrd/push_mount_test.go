@@ -0,0 +1,106 @@
+package ctrd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// mountRegistry mounts the blobs of app-v1, and starts the upload for the
+// blob unknown to the source repository.
+type mountRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string]bool
+	cancelled []string
+}
+
+func (r *mountRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.Method == http.MethodDelete {
+		r.cancelled = append(r.cancelled, req.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	q := req.URL.Query()
+	if req.Method != http.MethodPost || req.URL.Path != "/v2/app-v2/blobs/uploads/" || q.Get("mount") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("from") == "app-v1" && r.blobs[q.Get("mount")] {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.Header().Set("Location", "/v2/app-v2/blobs/uploads/uuid")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// recordPusher records the descriptors to be uploaded.
+type recordPusher struct {
+	pushed []digest.Digest
+}
+
+func (p *recordPusher) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	p.pushed = append(p.pushed, desc.Digest)
+	return nil, nil
+}
+
+func TestMountingPusher(t *testing.T) {
+	shared, other := digest.FromString("shared"), digest.FromString("other")
+	registry := &mountRegistry{blobs: map[string]bool{shared.String(): true}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	tracker := docker.NewInMemoryTracker()
+	ref := strings.TrimPrefix(server.URL, "http://") + "/app-v2:latest"
+	c := &Client{registryTimeouts: DefaultRegistryTimeouts}
+	client := c.newRegistryClient(context.TODO(), strings.TrimPrefix(server.URL, "http://"), true)
+	mounter, err := newBlobMounter(ref, true, client, nil, tracker, map[digest.Digest][]string{
+		shared: {"app-v0", "app-v1"},
+		other:  {"app-v1"},
+	})
+	assert.NoError(t, err)
+
+	inner := &recordPusher{}
+	pusher := &mountingPusher{Pusher: inner, mounter: mounter}
+
+	// the shared layer is mounted from app-v1 after app-v0 fails
+	layer := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: shared}
+	_, err = pusher.Push(context.TODO(), layer)
+	assert.True(t, errdefs.IsAlreadyExists(err))
+
+	status, err := tracker.GetStatus(remotes.MakeRefKey(context.TODO(), layer))
+	assert.NoError(t, err)
+	assert.True(t, status.StartedAt.IsZero())
+
+	// the layer unknown to app-v1 is uploaded, and the upload started by
+	// the failed mount is cancelled
+	_, err = pusher.Push(context.TODO(), ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: other})
+	assert.NoError(t, err)
+
+	// the manifest is never mounted
+	manifest := digest.FromString("manifest")
+	registry.blobs[manifest.String()] = true
+	_, err = pusher.Push(context.TODO(), ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: manifest})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []digest.Digest{other, manifest}, inner.pushed)
+	assert.Equal(t, []string{
+		"/v2/app-v2/blobs/uploads/uuid",
+		"/v2/app-v2/blobs/uploads/uuid",
+	}, registry.cancelled)
+}
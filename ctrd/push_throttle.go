@@ -0,0 +1,198 @@
+package ctrd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxThrottleRetries is the max number of times to retry the request
+	// throttled by registry.
+	maxThrottleRetries = 5
+
+	// defaultRetryAfter is used if the throttled response has no valid
+	// Retry-After header.
+	defaultRetryAfter = time.Second
+
+	// maxRetryAfter caps the pause requested by registry.
+	maxRetryAfter = time.Minute
+
+	// maxRateLimitBurst caps the size of each throttled write.
+	maxRateLimitBurst = 32 << 10
+)
+
+type throttleNotifierKey struct{}
+
+// ThrottleNotifier is called before the request throttled by registry is
+// retried after the pause.
+type ThrottleNotifier func(host string, wait time.Duration)
+
+// withThrottleNotifier sets the notifier for context, which enables the
+// retry of the request throttled by registry.
+func withThrottleNotifier(ctx context.Context, fn ThrottleNotifier) context.Context {
+	return context.WithValue(ctx, throttleNotifierKey{}, fn)
+}
+
+// getThrottleNotifier gets the notifier from context.
+func getThrottleNotifier(ctx context.Context) ThrottleNotifier {
+	fn, _ := ctx.Value(throttleNotifierKey{}).(ThrottleNotifier)
+	return fn
+}
+
+// retryAfterTransport retries the request after the pause required by the
+// Retry-After header if registry responds 429 Too Many Requests.
+//
+// NOTE: only the request without body is retried, because the streamed
+// body of blob upload cannot be replayed. The HEAD and POST requests before
+// upload are the ones usually throttled.
+type retryAfterTransport struct {
+	base   http.RoundTripper
+	notify ThrottleNotifier
+}
+
+// withRetryAfter wraps the transport if the context has the notifier.
+func withRetryAfter(ctx context.Context, tr http.RoundTripper) http.RoundTripper {
+	notify := getThrottleNotifier(ctx)
+	if notify == nil {
+		return tr
+	}
+	return &retryAfterTransport{base: tr, notify: notify}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		return t.base.RoundTrip(req)
+	}
+
+	for i := 0; ; i++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || i == maxThrottleRetries {
+			return resp, err
+		}
+
+		wait := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+
+		t.notify(req.URL.Host, wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter parses the Retry-After header, which is either seconds or
+// HTTP date. The pause is capped by maxRetryAfter.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	wait := defaultRetryAfter
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		wait = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		wait = t.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+	}
+
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
+
+// newPushRateLimiter returns nil if limit is not positive, which means no
+// limitation. The limit is bytes per second.
+func newPushRateLimiter(limit int64) *rate.Limiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	burst := maxRateLimitBurst
+	if limit < int64(burst) {
+		burst = int(limit)
+	}
+	return rate.NewLimiter(rate.Limit(limit), burst)
+}
+
+// rateLimitedResolver caps the total bandwidth of blob uploads.
+type rateLimitedResolver struct {
+	remotes.Resolver
+	limiter *rate.Limiter
+}
+
+// withPushRateLimiter wraps the resolver if there is limitation.
+func withPushRateLimiter(resolver remotes.Resolver, limiter *rate.Limiter) remotes.Resolver {
+	if limiter == nil {
+		return resolver
+	}
+	return &rateLimitedResolver{Resolver: resolver, limiter: limiter}
+}
+
+// Pusher implements remotes.Resolver.
+func (r *rateLimitedResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	pusher, err := r.Resolver.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedPusher{Pusher: pusher, limiter: r.limiter}, nil
+}
+
+type rateLimitedPusher struct {
+	remotes.Pusher
+	limiter *rate.Limiter
+}
+
+// Push implements remotes.Pusher.
+func (p *rateLimitedPusher) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	cw, err := p.Pusher.Push(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedWriter{Writer: cw, ctx: ctx, limiter: p.limiter}, nil
+}
+
+// rateLimitedWriter waits for the limiter before writing each chunk into the
+// upload stream.
+type rateLimitedWriter struct {
+	content.Writer
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+// Write implements io.Writer.
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > w.limiter.Burst() {
+			chunk = chunk[:w.limiter.Burst()]
+		}
+
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := w.Writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
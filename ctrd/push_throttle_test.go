@@ -0,0 +1,108 @@
+package ctrd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		value  string
+		expect time.Duration
+	}{
+		{value: "", expect: defaultRetryAfter},
+		{value: "3", expect: 3 * time.Second},
+		{value: "0", expect: 0},
+		{value: "-1", expect: defaultRetryAfter},
+		{value: "3600", expect: maxRetryAfter},
+		{value: now.Add(10 * time.Second).Format(http.TimeFormat), expect: 10 * time.Second},
+		{value: now.Add(-10 * time.Second).Format(http.TimeFormat), expect: 0},
+		{value: "soon", expect: defaultRetryAfter},
+	} {
+		assert.Equal(t, tc.expect, parseRetryAfter(tc.value, now), tc.value)
+	}
+}
+
+func TestRetryAfterTransport(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// no retry without notifier
+	assert.Equal(t, http.DefaultTransport, withRetryAfter(context.TODO(), http.DefaultTransport))
+
+	var pauses []time.Duration
+	ctx := withThrottleNotifier(context.TODO(), func(host string, wait time.Duration) {
+		pauses = append(pauses, wait)
+	})
+	client := &http.Client{Transport: withRetryAfter(ctx, http.DefaultTransport)}
+
+	resp, err := client.Head(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, []time.Duration{0, 0}, pauses)
+
+	// the request with body is not retried
+	requests = 0
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("blob"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 1, requests)
+}
+
+type bufferWriter struct {
+	content.Writer
+	buf    bytes.Buffer
+	writes int
+}
+
+func (w *bufferWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func TestRateLimitedWriter(t *testing.T) {
+	assert.Nil(t, newPushRateLimiter(0))
+	assert.Equal(t, maxRateLimitBurst, newPushRateLimiter(1<<30).Burst())
+
+	limiter := newPushRateLimiter(1 << 20)
+	assert.Equal(t, maxRateLimitBurst, limiter.Burst())
+
+	cw := &bufferWriter{}
+	w := &rateLimitedWriter{Writer: cw, ctx: context.TODO(), limiter: limiter}
+
+	data := bytes.Repeat([]byte("a"), 3*maxRateLimitBurst+1)
+	n, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, data, cw.buf.Bytes())
+	assert.Equal(t, 4, cw.writes)
+
+	// the write is canceled with the context
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	w = &rateLimitedWriter{Writer: cw, ctx: ctx, limiter: newPushRateLimiter(1)}
+	_, err = w.Write([]byte("ab"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package ctrd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultTokenLifetime is used if the token server doesn't tell the
+	// lifetime of token, which is 60 seconds by the token spec.
+	defaultTokenLifetime = 60 * time.Second
+
+	// maxTokenRefreshMargin caps the margin to refresh the token before it
+	// expires, which leaves the time for the request in flight.
+	maxTokenRefreshMargin = 10 * time.Second
+
+	// maxTokenResponseSize caps the size of token response to be inspected.
+	maxTokenResponseSize = 1 << 20
+)
+
+// refreshingAuthorizer refreshes the bearer token before it expires, so that
+// the late blob request of the long pull doesn't fail with the expired token.
+//
+// The tokens are still fetched by the authorizer of containerd, which is
+// wrapped to learn the lifetime of token from the token response. The 401
+// response which led to the token is kept as the challenge to refresh it.
+type refreshingAuthorizer struct {
+	docker.Authorizer
+
+	// refreshMu serializes the refresh so that the concurrent requests
+	// don't fetch the token several times.
+	refreshMu sync.Mutex
+
+	mu         sync.Mutex
+	challenges map[string]*tokenChallenge
+
+	now func() time.Time
+}
+
+// tokenChallenge is the challenge of the token for the host.
+type tokenChallenge struct {
+	resp      *http.Response
+	refreshAt time.Time
+}
+
+// newRefreshingAuthorizer creates the authorizer, and the token requests
+// are sent by client.
+func newRefreshingAuthorizer(client *http.Client, credentials func(string) (string, string, error)) docker.Authorizer {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	tokenClient := &http.Client{
+		Transport: &tokenLifetimeTransport{base: base},
+	}
+
+	return &refreshingAuthorizer{
+		Authorizer: docker.NewAuthorizer(tokenClient, credentials),
+		challenges: make(map[string]*tokenChallenge),
+		now:        time.Now,
+	}
+}
+
+// Authorize implements docker.Authorizer.
+func (a *refreshingAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	host := req.URL.Host
+	if c := a.challenge(host); c != nil && !a.now().Before(c.refreshAt) {
+		if err := a.refresh(ctx, host); err != nil {
+			// NOTE: the request with the old token will get 401,
+			// and the token will be fetched again.
+			logrus.Warnf("failed to refresh the token of registry %s: %v", host, err)
+		}
+	}
+	return a.Authorizer.Authorize(ctx, req)
+}
+
+// AddResponses implements docker.Authorizer.
+func (a *refreshingAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
+	host := responses[len(responses)-1].Request.URL.Host
+	return a.addResponses(ctx, host, responses)
+}
+
+func (a *refreshingAuthorizer) addResponses(ctx context.Context, host string, responses []*http.Response) error {
+	lifetime := &tokenLifetime{}
+	if err := a.Authorizer.AddResponses(withTokenLifetime(ctx, lifetime), responses); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	issuedAt, expiresIn, ok := lifetime.get()
+	if !ok {
+		// the basic auth never expires
+		delete(a.challenges, host)
+		return nil
+	}
+
+	margin := expiresIn / 10
+	if margin > maxTokenRefreshMargin {
+		margin = maxTokenRefreshMargin
+	}
+	a.challenges[host] = &tokenChallenge{
+		resp:      responses[len(responses)-1],
+		refreshAt: issuedAt.Add(expiresIn - margin),
+	}
+	return nil
+}
+
+// refresh fetches the token again by the challenge.
+func (a *refreshingAuthorizer) refresh(ctx context.Context, host string) error {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	// the token may have been refreshed by other request
+	c := a.challenge(host)
+	if c == nil || a.now().Before(c.refreshAt) {
+		return nil
+	}
+
+	// NOTE: the single response is never treated as invalid authorization.
+	return a.addResponses(ctx, host, []*http.Response{c.resp})
+}
+
+func (a *refreshingAuthorizer) challenge(host string) *tokenChallenge {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.challenges[host]
+}
+
+type tokenLifetimeKey struct{}
+
+// tokenLifetime records the lifetime of the token fetched.
+type tokenLifetime struct {
+	mu        sync.Mutex
+	issuedAt  time.Time
+	expiresIn time.Duration
+	set       bool
+}
+
+func (l *tokenLifetime) record(issuedAt time.Time, expiresIn time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.issuedAt, l.expiresIn, l.set = issuedAt, expiresIn, true
+}
+
+func (l *tokenLifetime) get() (time.Time, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.issuedAt, l.expiresIn, l.set
+}
+
+func withTokenLifetime(ctx context.Context, l *tokenLifetime) context.Context {
+	return context.WithValue(ctx, tokenLifetimeKey{}, l)
+}
+
+// tokenLifetimeTransport inspects the token response to learn the lifetime
+// of token. It's only used by the token requests of authorizer.
+type tokenLifetimeTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *tokenLifetimeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	lifetime, _ := req.Context().Value(tokenLifetimeKey{}).(*tokenLifetime)
+	if lifetime == nil {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseSize))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var tr struct {
+		ExpiresIn int `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		// let the authorizer report the invalid response
+		return resp, nil
+	}
+
+	expiresIn := defaultTokenLifetime
+	if tr.ExpiresIn > 0 {
+		expiresIn = time.Duration(tr.ExpiresIn) * time.Second
+	}
+
+	// NOTE: the issued_at of response is ignored, because the clock of
+	// token server may be different from local.
+	lifetime.record(time.Now(), expiresIn)
+	return resp, nil
+}
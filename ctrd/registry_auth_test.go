@@ -0,0 +1,123 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// shortLivedTokenRegistry only accepts the latest token, and the token
+// issued before is treated as expired.
+type shortLivedTokenRegistry struct {
+	mu           sync.Mutex
+	token        string
+	issued       int
+	unauthorized int
+	blob         []byte
+}
+
+func (r *shortLivedTokenRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		r.issued++
+		r.token = fmt.Sprintf("token-%d", r.issued)
+		fmt.Fprintf(w, `{"token": %q, "expires_in": 60}`, r.token)
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer "+r.token || r.token == "" {
+		r.unauthorized++
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="registry",scope="repository:library/busybox:pull",error="invalid_token"`, req.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Write(r.blob)
+}
+
+func (r *shortLivedTokenRegistry) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.token = "revoked"
+}
+
+func (r *shortLivedTokenRegistry) stats() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.issued, r.unauthorized
+}
+
+func TestRefreshingAuthorizer(t *testing.T) {
+	registry := &shortLivedTokenRegistry{blob: []byte("layer")}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	client := &http.Client{}
+	authorizer := newRefreshingAuthorizer(client, func(string) (string, string, error) {
+		return "", "", nil
+	}).(*refreshingAuthorizer)
+
+	resolver := docker.NewResolver(docker.ResolverOptions{
+		Authorizer: authorizer,
+		Client:     client,
+		PlainHTTP:  true,
+	})
+
+	ref := strings.TrimPrefix(server.URL, "http://") + "/library/busybox:latest"
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(registry.blob),
+		Size:      int64(len(registry.blob)),
+	}
+
+	fetch := func() {
+		fetcher, err := resolver.Fetcher(context.TODO(), ref)
+		assert.NoError(t, err)
+
+		rc, err := fetcher.Fetch(context.TODO(), desc)
+		assert.NoError(t, err)
+		defer rc.Close()
+
+		data, err := ioutil.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.Equal(t, registry.blob, data)
+	}
+
+	// the first request gets the anonymous token by 401
+	fetch()
+	issued, unauthorized := registry.stats()
+	assert.Equal(t, 1, issued)
+	assert.Equal(t, 1, unauthorized)
+
+	// the token is refreshed before it expires, without 401
+	authorizer.now = func() time.Time {
+		return time.Now().Add(time.Minute)
+	}
+	fetch()
+	issued, unauthorized = registry.stats()
+	assert.Equal(t, 2, issued)
+	assert.Equal(t, 1, unauthorized)
+
+	// the token expired earlier than expected is refreshed by 401, and
+	// the request is retried
+	authorizer.now = time.Now
+	registry.expire()
+	fetch()
+	issued, unauthorized = registry.stats()
+	assert.Equal(t, 3, issued)
+	assert.Equal(t, 2, unauthorized)
+}
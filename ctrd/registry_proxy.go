@@ -0,0 +1,33 @@
+package ctrd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// RegistryProxyFunc returns the proxy used to access the registry host, nil
+// means using the proxy from the environment.
+type RegistryProxyFunc func(host string) *url.URL
+
+type registryProxyKey struct{}
+
+// WithRegistryProxy sets the proxy of registries for context, which will be
+// used by the resolver and the fetch of the image.
+func WithRegistryProxy(ctx context.Context, fn RegistryProxyFunc) context.Context {
+	return context.WithValue(ctx, registryProxyKey{}, fn)
+}
+
+// registryProxy returns the proxy function of the transport for the host.
+func registryProxy(ctx context.Context, host string) func(*http.Request) (*url.URL, error) {
+	fn, _ := ctx.Value(registryProxyKey{}).(RegistryProxyFunc)
+	if fn == nil {
+		return proxyFromEnvironment
+	}
+
+	proxyURL := fn(host)
+	if proxyURL == nil {
+		return proxyFromEnvironment
+	}
+	return http.ProxyURL(proxyURL)
+}
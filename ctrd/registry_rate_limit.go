@@ -0,0 +1,133 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The rate limit headers returned by the registry like Docker Hub, whose
+// value is the number of pulls with the optional window in seconds, like
+// "100;w=21600".
+const (
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+)
+
+// RegistryRateLimit is the pull rate limit told by the registry.
+type RegistryRateLimit struct {
+	// Limit is the max number of pulls in the window, zero if unknown.
+	Limit int
+
+	// Remaining is the number of pulls remaining in the window.
+	Remaining int
+
+	// Window is the period of the limit, zero if unknown.
+	Window time.Duration
+}
+
+// String returns the human readable rate limit.
+func (l RegistryRateLimit) String() string {
+	s := fmt.Sprintf("%d pulls remaining", l.Remaining)
+	if l.Limit > 0 {
+		s = fmt.Sprintf("%d of %d pulls remaining", l.Remaining, l.Limit)
+	}
+	if l.Window > 0 {
+		s += fmt.Sprintf(" per %s", l.Window)
+	}
+	return s
+}
+
+type rateLimitNotifierKey struct{}
+
+// RateLimitNotifier is called with the rate limit of each registry response
+// which has the rate limit headers.
+type RateLimitNotifier func(host string, limit RegistryRateLimit)
+
+// WithRateLimitNotifier sets the notifier for context, which is called when
+// the registry responds the rate limit headers.
+func WithRateLimitNotifier(ctx context.Context, fn RateLimitNotifier) context.Context {
+	return context.WithValue(ctx, rateLimitNotifierKey{}, fn)
+}
+
+// getRateLimitNotifier gets the notifier from context.
+func getRateLimitNotifier(ctx context.Context) RateLimitNotifier {
+	fn, _ := ctx.Value(rateLimitNotifierKey{}).(RateLimitNotifier)
+	return fn
+}
+
+// rateLimitTransport inspects the rate limit headers of the responses.
+type rateLimitTransport struct {
+	base   http.RoundTripper
+	notify RateLimitNotifier
+}
+
+// withRateLimitNotifier wraps the transport if the context has the notifier.
+func withRateLimitNotifier(ctx context.Context, tr http.RoundTripper) http.RoundTripper {
+	notify := getRateLimitNotifier(ctx)
+	if notify == nil {
+		return tr
+	}
+	return &rateLimitTransport{base: tr, notify: notify}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if limit, ok := parseRateLimit(resp.Header); ok {
+		t.notify(req.URL.Host, limit)
+	}
+	return resp, nil
+}
+
+// parseRateLimit returns false if there is no valid RateLimit-Remaining
+// header. The invalid RateLimit-Limit header is ignored.
+func parseRateLimit(header http.Header) (RegistryRateLimit, bool) {
+	var limit RegistryRateLimit
+
+	remaining, window, ok := parseRateLimitValue(header.Get(rateLimitRemainingHeader))
+	if !ok {
+		return limit, false
+	}
+	limit.Remaining, limit.Window = remaining, window
+
+	if n, w, ok := parseRateLimitValue(header.Get(rateLimitLimitHeader)); ok {
+		limit.Limit = n
+		if limit.Window == 0 {
+			limit.Window = w
+		}
+	}
+	return limit, true
+}
+
+// parseRateLimitValue parses the value like "100;w=21600".
+func parseRateLimitValue(v string) (int, time.Duration, bool) {
+	if v == "" {
+		return 0, 0, false
+	}
+
+	parts := strings.Split(v, ";")
+	n, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || n < 0 {
+		return 0, 0, false
+	}
+
+	var window time.Duration
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 || kv[0] != "w" {
+			continue
+		}
+		if secs, err := strconv.Atoi(kv[1]); err == nil && secs > 0 {
+			window = time.Duration(secs) * time.Second
+		}
+	}
+	return n, window, true
+}
@@ -0,0 +1,70 @@
+package ctrd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit     string
+		remaining string
+		expected  RegistryRateLimit
+		ok        bool
+	}{
+		{"100;w=21600", "76;w=21600", RegistryRateLimit{Limit: 100, Remaining: 76, Window: 6 * time.Hour}, true},
+		{"", "76", RegistryRateLimit{Remaining: 76}, true},
+		{"100;w=21600", "0", RegistryRateLimit{Limit: 100, Window: 6 * time.Hour}, true},
+		{"invalid", "5;w=60", RegistryRateLimit{Remaining: 5, Window: time.Minute}, true},
+		{"100;w=21600", "", RegistryRateLimit{}, false},
+		{"100", "-1", RegistryRateLimit{}, false},
+	} {
+		header := http.Header{}
+		if tc.limit != "" {
+			header.Set(rateLimitLimitHeader, tc.limit)
+		}
+		if tc.remaining != "" {
+			header.Set(rateLimitRemainingHeader, tc.remaining)
+		}
+
+		limit, ok := parseRateLimit(header)
+		assert.Equal(t, tc.ok, ok, tc.remaining)
+		assert.Equal(t, tc.expected, limit, tc.remaining)
+	}
+
+	assert.Equal(t, "76 of 100 pulls remaining per 6h0m0s", RegistryRateLimit{Limit: 100, Remaining: 76, Window: 6 * time.Hour}.String())
+	assert.Equal(t, "76 pulls remaining", RegistryRateLimit{Remaining: 76}.String())
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "/manifests/") {
+			w.Header().Set(rateLimitLimitHeader, "100;w=21600")
+			w.Header().Set(rateLimitRemainingHeader, "76;w=21600")
+		}
+	}))
+	defer server.Close()
+
+	// no transport without the notifier
+	assert.Equal(t, http.DefaultTransport, withRateLimitNotifier(context.TODO(), http.DefaultTransport))
+
+	var hosts []string
+	ctx := WithRateLimitNotifier(context.TODO(), func(host string, limit RegistryRateLimit) {
+		hosts = append(hosts, host)
+		assert.Equal(t, 76, limit.Remaining)
+	})
+	client := &http.Client{Transport: withRateLimitNotifier(ctx, http.DefaultTransport)}
+
+	for _, path := range []string{"/v2/library/busybox/manifests/latest", "/v2/library/busybox/blobs/sha256:abc"} {
+		resp, err := client.Get(server.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{strings.TrimPrefix(server.URL, "http://")}, hosts)
+}
@@ -0,0 +1,161 @@
+package ctrd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxTagsListPages caps the pages of tags list to be followed.
+	maxTagsListPages = 100
+
+	// maxTagsListSize caps the size of each page of tags list.
+	maxTagsListSize = 8 << 20
+
+	// maxTagsListAuthAttempts caps the attempts to authorize the request.
+	maxTagsListAuthAttempts = 3
+)
+
+// ListRemoteTags lists the tags of the repository, like
+// registry.hub.docker.com/library/busybox, in the registry by the tags list
+// API. The transport and the auth are the same as the ones of pull.
+func (c *Client) ListRemoteTags(ctx context.Context, repo string, authConfig *types.AuthConfig) ([]string, error) {
+	tags, err := c.listRemoteTags(ctx, repo, authConfig)
+	if err != nil {
+		return nil, convertCtrdErr(err)
+	}
+	return tags, nil
+}
+
+// listRemoteTags follows the pages of tags list by the Link header.
+func (c *Client) listRemoteTags(ctx context.Context, repo string, authConfig *types.AuthConfig) ([]string, error) {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) != 2 {
+		return nil, errors.Wrapf(errtypes.ErrInvalidParam, "repository %s should contain the registry", repo)
+	}
+	domain, path := parts[0], parts[1]
+
+	// NOTE: the same as the resolver of containerd.
+	host := domain
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+
+	insecure := c.isInsecureDomain(repo)
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+
+	client := c.newRegistryClient(ctx, domain, insecure)
+	authorizer := newRegistryAuthorizer(client, authConfig)
+
+	next := &url.URL{Scheme: scheme, Host: host, Path: "/v2/" + path + "/tags/list"}
+	tags := []string{}
+	for i := 0; next != nil; i++ {
+		if i == maxTagsListPages {
+			return nil, fmt.Errorf("too many pages of tags list for %s", repo)
+		}
+
+		page, link, err := fetchTagsPage(ctx, client, authorizer, next.String())
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page...)
+
+		if next, err = nextTagsPage(next, link); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// fetchTagsPage fetches one page of tags list, and returns the Link header
+// which points to the next page.
+func fetchTagsPage(ctx context.Context, client *http.Client, authorizer docker.Authorizer, u string) ([]string, string, error) {
+	var responses []*http.Response
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+
+		if err := authorizer.Authorize(ctx, req); err != nil {
+			return nil, "", err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			resp.Body.Close()
+			if attempt == maxTagsListAuthAttempts {
+				return nil, "", fmt.Errorf("unauthorized to list tags by %s", u)
+			}
+
+			// NOTE: the authorizer rejects the repeated challenge as
+			// the invalid authorization.
+			responses = append(responses, resp)
+			if err := authorizer.AddResponses(ctx, responses); err != nil {
+				return nil, "", errors.Wrapf(err, "failed to authorize the tags list of %s", u)
+			}
+			continue
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, "", errors.Wrapf(errtypes.ErrNotfound, "repository of %s", u)
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			return nil, "", fmt.Errorf("failed to list tags by %s: %s", u, resp.Status)
+		}
+
+		data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTagsListSize))
+		if err != nil {
+			return nil, "", err
+		}
+
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, "", errors.Wrapf(err, "invalid tags list of %s", u)
+		}
+		return list.Tags, resp.Header.Get("Link"), nil
+	}
+}
+
+// nextTagsPage parses the Link header like `</v2/foo/tags/list?last=a&n=10>;
+// rel="next"`, which is relative to the current page.
+func nextTagsPage(current *url.URL, link string) (*url.URL, error) {
+	if link == "" {
+		return nil, nil
+	}
+
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start == -1 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return nil, nil
+	}
+
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid link %s of tags list", link)
+	}
+	return current.ResolveReference(next), nil
+}
@@ -0,0 +1,67 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tagsRegistry serves the tags list by two pages behind the bearer token.
+func tagsRegistry(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "repository:library/busybox:pull", req.URL.Query().Get("scope"))
+		fmt.Fprint(w, `{"token": "secret"}`)
+	})
+	mux.HandleFunc("/v2/library/busybox/tags/list", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="registry",scope="repository:library/busybox:pull"`, req.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if req.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/library/busybox/tags/list?last=1.28&n=2>; rel="next"`)
+			fmt.Fprint(w, `{"name": "library/busybox", "tags": ["1.27", "1.28"]}`)
+			return
+		}
+		fmt.Fprint(w, `{"name": "library/busybox", "tags": ["latest"]}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestListRemoteTags(t *testing.T) {
+	server := tagsRegistry(t)
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	c := &Client{insecureRegistries: []string{host}}
+
+	tags, err := c.ListRemoteTags(context.TODO(), host+"/library/busybox", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.27", "1.28", "latest"}, tags)
+
+	_, err = c.ListRemoteTags(context.TODO(), host+"/library/missing", nil)
+	assert.True(t, errtypes.IsNotfound(err))
+}
+
+func TestNextTagsPage(t *testing.T) {
+	current, err := url.Parse("https://reg.abc.com/v2/foo/tags/list")
+	assert.NoError(t, err)
+
+	next, err := nextTagsPage(current, `</v2/foo/tags/list?last=a&n=10>; rel="next"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://reg.abc.com/v2/foo/tags/list?last=a&n=10", next.String())
+
+	next, err = nextTagsPage(current, "")
+	assert.NoError(t, err)
+	assert.Nil(t, next)
+}
@@ -0,0 +1,79 @@
+package ctrd
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// RegistryTimeouts limits each request to the registry, so that the wedged
+// connection doesn't block the pull or push forever. Zero means no limitation.
+type RegistryTimeouts struct {
+	// Dial is the timeout of establishing the connection.
+	Dial time.Duration
+
+	// TLSHandshake is the timeout of TLS handshake.
+	TLSHandshake time.Duration
+
+	// ResponseHeader is the timeout of waiting for the response headers
+	// after the request is written.
+	ResponseHeader time.Duration
+
+	// Idle closes the connection if no data is read or written in the
+	// period, like the stalled download of layer.
+	Idle time.Duration
+}
+
+// DefaultRegistryTimeouts is used if the timeouts are not set.
+var DefaultRegistryTimeouts = RegistryTimeouts{
+	Dial:           30 * time.Second,
+	TLSHandshake:   10 * time.Second,
+	ResponseHeader: 30 * time.Second,
+	Idle:           60 * time.Second,
+}
+
+// dialContext returns the dial function which applies the idle timeout on
+// the connection.
+func (t RegistryTimeouts) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   t.Dial,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || t.Idle <= 0 {
+			return conn, err
+		}
+		return &idleTimeoutConn{Conn: conn, timeout: t.Idle}, nil
+	}
+}
+
+// idleTimeoutConn extends the deadline before each read and write, so that
+// the read or write fails if it's blocked longer than timeout.
+//
+// NOTE: the transport keeps reading the connection for the response while
+// the request body is being written, so that the write also extends the
+// read deadline. Otherwise, the upload of large blob which lasts longer than
+// timeout is killed by the pending read.
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// Read implements net.Conn.
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// Write implements net.Conn.
+func (c *idleTimeoutConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
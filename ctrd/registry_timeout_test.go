@@ -0,0 +1,115 @@
+package ctrd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/":
+		case "/v2/stalled-header":
+			<-release
+		case "/v2/stalled-body":
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			<-release
+		}
+	}))
+	defer server.Close()
+
+	// NOTE: the stalled handlers are released before closing server.
+	defer close(release)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	c := &Client{registryTimeouts: RegistryTimeouts{
+		ResponseHeader: 100 * time.Millisecond,
+		Idle:           200 * time.Millisecond,
+	}}
+	client := c.newRegistryClient(context.TODO(), host, true)
+
+	resp, err := client.Get(server.URL + "/v2/")
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// the wedged request fails instead of blocking forever
+	_, err = client.Get(server.URL + "/v2/stalled-header")
+	assert.Error(t, err)
+
+	resp, err = client.Get(server.URL + "/v2/stalled-body")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = ioutil.ReadAll(resp.Body)
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("expected timeout error, but got %v", err)
+	}
+}
+
+// slowReader yields the chunks with the interval, like the upload of large
+// blob.
+type slowReader struct {
+	chunks   int
+	interval time.Duration
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	if r.chunks == 0 {
+		return 0, io.EOF
+	}
+	r.chunks--
+	time.Sleep(r.interval)
+	b[0] = 'x'
+	return 1, nil
+}
+
+func TestRegistryTimeoutsSlowUpload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	c := &Client{registryTimeouts: RegistryTimeouts{
+		ResponseHeader: 100 * time.Millisecond,
+		Idle:           200 * time.Millisecond,
+	}}
+	client := c.newRegistryClient(context.TODO(), host, true)
+
+	// the upload lasts longer than the idle timeout, but it's never idle
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/v2/blobs/uploads/1", &slowReader{chunks: 10, interval: 50 * time.Millisecond})
+	assert.NoError(t, err)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, strings.Repeat("x", 10), string(data))
+}
+
+func TestWithRegistryTimeouts(t *testing.T) {
+	opts := &clientOpts{}
+	assert.NoError(t, WithRegistryTimeouts(DefaultRegistryTimeouts)(opts))
+	assert.Equal(t, DefaultRegistryTimeouts, opts.registryTimeouts)
+
+	assert.NoError(t, WithRegistryTimeouts(RegistryTimeouts{})(opts))
+	assert.Error(t, WithRegistryTimeouts(RegistryTimeouts{Idle: -time.Second})(opts))
+}
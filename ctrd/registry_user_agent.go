@@ -0,0 +1,38 @@
+package ctrd
+
+import (
+	"net/http"
+
+	"github.com/alibaba/pouch/version"
+)
+
+// DefaultRegistryUserAgent is the User-Agent of registry requests if it's
+// not set, so that the registry can tell the requests of pouch.
+var DefaultRegistryUserAgent = "pouch/" + version.Version
+
+// userAgentTransport sets the User-Agent header of requests.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+// withUserAgent wraps the transport if the userAgent is not empty.
+func withUserAgent(tr http.RoundTripper, userAgent string) http.RoundTripper {
+	if userAgent == "" {
+		return tr
+	}
+	return &userAgentTransport{base: tr, userAgent: userAgent}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// NOTE: RoundTrip should not modify the request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	r.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,46 @@
+package ctrd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryUserAgent(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		userAgents = append(userAgents, req.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, userAgent := range []string{DefaultRegistryUserAgent, "pouch-replicator/1.0"} {
+		c := &Client{registryUserAgent: userAgent}
+		client := c.newRegistryClient(context.TODO(), host, true)
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/", nil)
+		assert.NoError(t, err)
+		req.Header.Set("User-Agent", "containerd/1.0")
+
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+
+		// the request of caller is not modified
+		assert.Equal(t, "containerd/1.0", req.Header.Get("User-Agent"))
+	}
+	assert.Equal(t, []string{DefaultRegistryUserAgent, "pouch-replicator/1.0"}, userAgents)
+}
+
+func TestWithRegistryUserAgent(t *testing.T) {
+	opts := &clientOpts{registryUserAgent: DefaultRegistryUserAgent}
+	assert.NoError(t, WithRegistryUserAgent("")(opts))
+	assert.Equal(t, DefaultRegistryUserAgent, opts.registryUserAgent)
+
+	assert.NoError(t, WithRegistryUserAgent("pouch-replicator/1.0")(opts))
+	assert.Equal(t, "pouch-replicator/1.0", opts.registryUserAgent)
+}
@@ -0,0 +1,90 @@
+package ctrd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type acceptMediaTypesKey struct{}
+
+// GetAcceptMediaTypes gets the preferred manifest media types from context.
+func GetAcceptMediaTypes(ctx context.Context) []string {
+	mediaTypes, _ := ctx.Value(acceptMediaTypesKey{}).([]string)
+	return mediaTypes
+}
+
+// WithAcceptMediaTypes sets the preferred manifest media types for context,
+// which will be used as the Accept header when resolving the image reference.
+func WithAcceptMediaTypes(ctx context.Context, mediaTypes []string) context.Context {
+	return context.WithValue(ctx, acceptMediaTypesKey{}, mediaTypes)
+}
+
+// acceptTransport overrides the Accept header of the manifest HEAD request,
+// which is used by the resolver to negotiate the manifest format. The GET
+// retried by the resolver after the HEAD is not allowed is overridden too.
+type acceptTransport struct {
+	base   http.RoundTripper
+	accept string
+
+	mu sync.Mutex
+	// fallbacks records the manifest URLs whose HEAD is not allowed.
+	fallbacks map[string]struct{}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *acceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.Contains(req.URL.Path, "/manifests/") || !t.negotiating(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	// NOTE: RoundTrip should not modify the request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	r.Header.Set("Accept", t.accept)
+
+	resp, err := t.base.RoundTrip(r)
+	if err == nil && req.Method == http.MethodHead && resp.StatusCode == http.StatusMethodNotAllowed {
+		t.mu.Lock()
+		t.fallbacks[req.URL.String()] = struct{}{}
+		t.mu.Unlock()
+	}
+	return resp, err
+}
+
+// negotiating returns true if the request is the HEAD of manifest, or the GET
+// retried for the HEAD which is not allowed.
+func (t *acceptTransport) negotiating(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodHead:
+		return true
+	case http.MethodGet:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if _, ok := t.fallbacks[req.URL.String()]; ok {
+			delete(t.fallbacks, req.URL.String())
+			return true
+		}
+	}
+	return false
+}
+
+// withAcceptMediaTypes wraps the transport if the context has the preferred
+// manifest media types.
+func withAcceptMediaTypes(ctx context.Context, tr http.RoundTripper) http.RoundTripper {
+	mediaTypes := GetAcceptMediaTypes(ctx)
+	if len(mediaTypes) == 0 {
+		return tr
+	}
+	return &acceptTransport{
+		base:      tr,
+		accept:    strings.Join(mediaTypes, ", "),
+		fallbacks: map[string]struct{}{},
+	}
+}
@@ -0,0 +1,117 @@
+package ctrd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptMediaTypes(t *testing.T) {
+	var accepts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepts = append(accepts, r.Header.Get("Accept"))
+	}))
+	defer server.Close()
+
+	const defaultAccept = "application/vnd.oci.image.manifest.v1+json, *"
+	mediaTypes := []string{
+		"application/vnd.docker.distribution.manifest.v2+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+	}
+
+	for _, tc := range []struct {
+		ctx    context.Context
+		method string
+		path   string
+		expect string
+	}{
+		{
+			ctx:    context.TODO(),
+			method: http.MethodHead,
+			path:   "/v2/library/busybox/manifests/latest",
+			expect: defaultAccept,
+		}, {
+			ctx:    WithAcceptMediaTypes(context.TODO(), mediaTypes),
+			method: http.MethodHead,
+			path:   "/v2/library/busybox/manifests/latest",
+			expect: mediaTypes[0] + ", " + mediaTypes[1],
+		}, {
+			ctx:    WithAcceptMediaTypes(context.TODO(), mediaTypes),
+			method: http.MethodGet,
+			path:   "/v2/library/busybox/blobs/sha256:abcd",
+			expect: defaultAccept,
+		},
+	} {
+		accepts = nil
+
+		req, err := http.NewRequest(tc.method, server.URL+tc.path, nil)
+		if err != nil {
+			t.Fatalf("failed to new request: %v", err)
+		}
+		req.Header.Set("Accept", defaultAccept)
+
+		resp, err := withAcceptMediaTypes(tc.ctx, http.DefaultTransport).RoundTrip(req)
+		if err != nil {
+			t.Fatalf("failed to round trip: %v", err)
+		}
+		resp.Body.Close()
+
+		assert.Equal(t, []string{tc.expect}, accepts)
+		assert.Equal(t, defaultAccept, req.Header.Get("Accept"))
+	}
+}
+
+func TestAcceptMediaTypesHeadNotAllowed(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+	dgst := digest.FromBytes(manifest)
+
+	var accepts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		accepts = append(accepts, r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.Write(manifest)
+	}))
+	defer server.Close()
+
+	mediaTypes := []string{ocispec.MediaTypeImageManifest}
+	ctx := WithAcceptMediaTypes(context.TODO(), mediaTypes)
+
+	resolver := docker.NewResolver(docker.ResolverOptions{
+		Client:    &http.Client{Transport: withAcceptMediaTypes(ctx, http.DefaultTransport)},
+		PlainHTTP: true,
+	})
+
+	// the GET retried after the HEAD is not allowed is negotiated too
+	ref := strings.TrimPrefix(server.URL, "http://") + "/library/busybox:latest"
+	_, desc, err := resolver.Resolve(ctx, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, dgst, desc.Digest)
+	assert.Equal(t, mediaTypes, accepts)
+
+	// the manifest fetched by digest is not overridden
+	fetcher, err := resolver.Fetcher(ctx, ref)
+	assert.NoError(t, err)
+
+	rc, err := fetcher.Fetch(ctx, desc)
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, data)
+	assert.Equal(t, []string{mediaTypes[0], mediaTypes[0] + ", *"}, accepts)
+}
@@ -55,6 +55,20 @@ func (c *Client) CreateSnapshot(ctx context.Context, id, ref string) error {
 	return err
 }
 
+// PrepareSnapshot creates a active snapshot with id on the parent, which is
+// the chain ID of image's rootfs. It returns ErrNotfound if the parent is
+// missing.
+func (c *Client) PrepareSnapshot(ctx context.Context, id, parent string) error {
+	wrapperCli, err := c.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a containerd grpc client: %v", err)
+	}
+	ctx = leases.WithLease(ctx, wrapperCli.lease.ID)
+
+	_, err = wrapperCli.client.SnapshotService(CurrentSnapshotterName(ctx)).Prepare(ctx, id, parent)
+	return convertCtrdErr(err)
+}
+
 // GetSnapshot returns the snapshot's info by id.
 func (c *Client) GetSnapshot(ctx context.Context, id string) (snapshots.Info, error) {
 	wrapperCli, err := c.Get(ctx)
@@ -0,0 +1,145 @@
+package ctrd
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/containerd/containerd/content"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/semaphore"
+)
+
+// newTransferLimiter returns nil if max is not positive, which means no
+// limitation.
+func newTransferLimiter(max int) *semaphore.Weighted {
+	if max <= 0 {
+		return nil
+	}
+	return semaphore.NewWeighted(int64(max))
+}
+
+// isLayerBlob returns true if the descriptor is not index, manifest or
+// config. Only the layer blobs are limited since the others are small.
+func isLayerBlob(desc ocispec.Descriptor) bool {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageConfig,
+		ctrdmetaimages.MediaTypeDockerSchema2ManifestList, ctrdmetaimages.MediaTypeDockerSchema2Manifest,
+		ctrdmetaimages.MediaTypeDockerSchema2Config, ctrdmetaimages.MediaTypeDockerSchema1Manifest:
+		return false
+	}
+	return true
+}
+
+// limitedResolver limits the number of concurrent layer downloads and
+// uploads. The slot is held until the reader or writer of the layer is
+// closed.
+type limitedResolver struct {
+	remotes.Resolver
+	downloads *semaphore.Weighted
+	uploads   *semaphore.Weighted
+}
+
+// withTransferLimiter wraps the resolver if there is any limitation.
+func withTransferLimiter(resolver remotes.Resolver, downloads, uploads *semaphore.Weighted) remotes.Resolver {
+	if downloads == nil && uploads == nil {
+		return resolver
+	}
+	return &limitedResolver{
+		Resolver:  resolver,
+		downloads: downloads,
+		uploads:   uploads,
+	}
+}
+
+// Fetcher implements remotes.Resolver.
+func (r *limitedResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	fetcher, err := r.Resolver.Fetcher(ctx, ref)
+	if err != nil || r.downloads == nil {
+		return fetcher, err
+	}
+	return &limitedFetcher{Fetcher: fetcher, sem: r.downloads}, nil
+}
+
+// Pusher implements remotes.Resolver.
+func (r *limitedResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	pusher, err := r.Resolver.Pusher(ctx, ref)
+	if err != nil || r.uploads == nil {
+		return pusher, err
+	}
+	return &limitedPusher{Pusher: pusher, sem: r.uploads}, nil
+}
+
+type limitedFetcher struct {
+	remotes.Fetcher
+	sem *semaphore.Weighted
+}
+
+// Fetch implements remotes.Fetcher.
+func (f *limitedFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if !isLayerBlob(desc) {
+		return f.Fetcher.Fetch(ctx, desc)
+	}
+
+	if err := f.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	rc, err := f.Fetcher.Fetch(ctx, desc)
+	if err != nil {
+		f.sem.Release(1)
+		return nil, err
+	}
+	return &releaseOnCloseReadCloser{ReadCloser: rc, release: func() { f.sem.Release(1) }}, nil
+}
+
+type limitedPusher struct {
+	remotes.Pusher
+	sem *semaphore.Weighted
+}
+
+// Push implements remotes.Pusher.
+func (p *limitedPusher) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	if !isLayerBlob(desc) {
+		return p.Pusher.Push(ctx, desc)
+	}
+
+	if err := p.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	cw, err := p.Pusher.Push(ctx, desc)
+	if err != nil {
+		p.sem.Release(1)
+		return nil, err
+	}
+	return &releaseOnCloseWriter{Writer: cw, release: func() { p.sem.Release(1) }}, nil
+}
+
+type releaseOnCloseReadCloser struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close releases the slot after closing the reader.
+func (r *releaseOnCloseReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+type releaseOnCloseWriter struct {
+	content.Writer
+	once    sync.Once
+	release func()
+}
+
+// Close releases the slot after closing the writer.
+func (w *releaseOnCloseWriter) Close() error {
+	err := w.Writer.Close()
+	w.once.Do(w.release)
+	return err
+}
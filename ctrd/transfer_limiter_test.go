@@ -0,0 +1,58 @@
+package ctrd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	remotes.Resolver
+}
+
+func (r *fakeResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("blob")), nil
+	}), nil
+}
+
+func TestLimitedFetcher(t *testing.T) {
+	// no limitation
+	resolver := &fakeResolver{}
+	assert.Equal(t, remotes.Resolver(resolver), withTransferLimiter(resolver, newTransferLimiter(0), nil))
+
+	fetcher, err := withTransferLimiter(resolver, newTransferLimiter(2), nil).Fetcher(context.TODO(), "")
+	assert.NoError(t, err)
+
+	layer := ocispec.Descriptor{MediaType: images.MediaTypeDockerSchema2LayerGzip}
+	manifest := ocispec.Descriptor{MediaType: images.MediaTypeDockerSchema2Manifest}
+
+	first, err := fetcher.Fetch(context.TODO(), layer)
+	assert.NoError(t, err)
+	_, err = fetcher.Fetch(context.TODO(), layer)
+	assert.NoError(t, err)
+
+	// the manifest is not limited
+	_, err = fetcher.Fetch(context.TODO(), manifest)
+	assert.NoError(t, err)
+
+	// the third layer waits for the slot
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	_, err = fetcher.Fetch(ctx, layer)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the slot is released once after closing
+	assert.NoError(t, first.Close())
+	assert.NoError(t, first.Close())
+	_, err = fetcher.Fetch(context.TODO(), layer)
+	assert.NoError(t, err)
+}
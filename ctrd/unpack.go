@@ -0,0 +1,131 @@
+package ctrd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/rootfs"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// UnpackImage unpacks the layers of image into the snapshotter like the
+// Unpack of containerd image, and sends the status of each layer by the
+// stream while it's applied.
+func (c *Client) UnpackImage(ctx context.Context, img containerd.Image, snapshotter string, stream *jsonstream.JSONStream) error {
+	if err := c.unpackImage(ctx, img, snapshotter, stream); err != nil {
+		return convertCtrdErr(err)
+	}
+	return nil
+}
+
+func (c *Client) unpackImage(ctx context.Context, img containerd.Image, snapshotter string, stream *jsonstream.JSONStream) error {
+	wrapperCli, err := c.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a containerd grpc client: %v", err)
+	}
+
+	ctx, done, err := wrapperCli.client.WithLease(ctx)
+	if err != nil {
+		return err
+	}
+	defer done(ctx)
+
+	cs := img.ContentStore()
+	manifest, err := ctrdmetaimages.Manifest(ctx, cs, img.Target(), platforms.Default())
+	if err != nil {
+		return err
+	}
+
+	diffIDs, err := img.RootFS(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		sn = wrapperCli.client.SnapshotService(snapshotter)
+		a  = wrapperCli.client.DiffService()
+	)
+	defer sn.Close()
+
+	apply := func(layer rootfs.Layer, chain []digest.Digest) (bool, error) {
+		unpacked, err := rootfs.ApplyLayer(ctx, layer, chain, sn, a)
+		if err != nil || !unpacked {
+			return unpacked, err
+		}
+
+		// NOTE: the uncompressed label is set after the uncompressed
+		// digest has been verified through apply, like containerd.
+		_, err = cs.Update(ctx, content.Info{
+			Digest: layer.Blob.Digest,
+			Labels: map[string]string{"containerd.io/uncompressed": layer.Diff.Digest.String()},
+		}, "labels.containerd.io/uncompressed")
+		return true, err
+	}
+
+	chainID, err := unpackLayers(manifest.Layers, diffIDs, apply, layerProgress{stream})
+	if err != nil {
+		return err
+	}
+
+	gcLabel := fmt.Sprintf("containerd.io/gc.ref.snapshot.%s", snapshotter)
+	_, err = cs.Update(ctx, content.Info{
+		Digest: manifest.Config.Digest,
+		Labels: map[string]string{gcLabel: chainID.String()},
+	}, "labels."+gcLabel)
+	return err
+}
+
+// unpackLayers applies the layers one by one, and returns the chainID of top
+// layer. The layer whose snapshot exists is not applied again.
+func unpackLayers(layers []ocispec.Descriptor, diffIDs []digest.Digest, apply func(rootfs.Layer, []digest.Digest) (bool, error), progress layerProgress) (digest.Digest, error) {
+	if len(layers) != len(diffIDs) {
+		return "", fmt.Errorf("mismatched number of layers and diffIDs")
+	}
+
+	var chain []digest.Digest
+	for i, blob := range layers {
+		progress.write(blob, jsonstream.PullStatusExtracting, &jsonstream.ProgressDetail{Total: blob.Size})
+
+		unpacked, err := apply(rootfs.Layer{
+			Blob: blob,
+			Diff: ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayer, Digest: diffIDs[i]},
+		}, chain)
+		if err != nil {
+			return "", err
+		}
+
+		if unpacked {
+			progress.write(blob, jsonstream.PullStatusComplete, &jsonstream.ProgressDetail{Current: blob.Size, Total: blob.Size})
+		} else {
+			progress.write(blob, jsonstream.PullStatusExists, nil)
+		}
+		chain = append(chain, diffIDs[i])
+	}
+	return identity.ChainID(chain), nil
+}
+
+// layerProgress sends the status of each layer during the unpack, keyed by
+// the layer digest like the download progress of fetchProgress.
+type layerProgress struct {
+	stream *jsonstream.JSONStream
+}
+
+func (p layerProgress) write(layer ocispec.Descriptor, status string, detail *jsonstream.ProgressDetail) {
+	if p.stream == nil {
+		return
+	}
+
+	p.stream.WriteObject(jsonstream.JSONMessage{
+		ID:     layer.Digest.String(),
+		Status: status,
+		Detail: detail,
+	})
+}
@@ -0,0 +1,81 @@
+package ctrd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/containerd/containerd/rootfs"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnpackLayers(t *testing.T) {
+	var (
+		layers  []ocispec.Descriptor
+		diffIDs []digest.Digest
+	)
+	for _, layer := range []string{"base", "app"} {
+		layers = append(layers, ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageLayerGzip,
+			Digest:    digest.FromString(layer + ".gz"),
+			Size:      int64(len(layer)),
+		})
+		diffIDs = append(diffIDs, digest.FromString(layer))
+	}
+
+	// the snapshot of base layer has been unpacked by other image
+	var applied []digest.Digest
+	apply := func(layer rootfs.Layer, chain []digest.Digest) (bool, error) {
+		assert.Equal(t, applied, chain)
+		applied = append(applied, layer.Diff.Digest)
+		return layer.Blob.Digest != layers[0].Digest, nil
+	}
+
+	out := new(bytes.Buffer)
+	stream := jsonstream.New(out, nil)
+	chainID, err := unpackLayers(layers, diffIDs, apply, layerProgress{stream})
+	stream.Close()
+	stream.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, identity.ChainID(diffIDs), chainID)
+	assert.Equal(t, diffIDs, applied)
+
+	var msgs []jsonstream.JSONMessage
+	dec := json.NewDecoder(out)
+	for {
+		var msg jsonstream.JSONMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if !assert.NoError(t, err) {
+			return
+		}
+		msgs = append(msgs, msg)
+	}
+
+	// the status of each layer follows the apply
+	assert.Equal(t, []jsonstream.JSONMessage{
+		{ID: layers[0].Digest.String(), Status: jsonstream.PullStatusExtracting, Detail: &jsonstream.ProgressDetail{Total: 4}},
+		{ID: layers[0].Digest.String(), Status: jsonstream.PullStatusExists},
+		{ID: layers[1].Digest.String(), Status: jsonstream.PullStatusExtracting, Detail: &jsonstream.ProgressDetail{Total: 3}},
+		{ID: layers[1].Digest.String(), Status: jsonstream.PullStatusComplete, Detail: &jsonstream.ProgressDetail{Current: 3, Total: 3}},
+	}, msgs)
+
+	// the layer after the failed one is not applied
+	applied = nil
+	apply = func(layer rootfs.Layer, chain []digest.Digest) (bool, error) {
+		applied = append(applied, layer.Diff.Digest)
+		return false, io.ErrUnexpectedEOF
+	}
+	_, err = unpackLayers(layers, diffIDs, apply, layerProgress{})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, diffIDs[:1], applied)
+
+	_, err = unpackLayers(layers, diffIDs[:1], apply, layerProgress{})
+	assert.Error(t, err)
+}
@@ -3,9 +3,9 @@ package ctrd
 import (
 	"context"
 	"crypto/tls"
-	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"syscall"
 	"time"
 
@@ -108,15 +108,10 @@ func newImageResolver(refToName map[string]string, resolverOpt docker.ResolverOp
 
 // getResolver try to resolve ref in the reference list, return the resolver and the first available ref.
 func (c *Client) getResolver(ctx context.Context, authConfig *types.AuthConfig, name string, refs []string, resolverOpt docker.ResolverOptions) (remotes.Resolver, string, error) {
-	username, secret := "", ""
-	if authConfig != nil {
-		username = authConfig.Username
-		secret = authConfig.Password
-	}
-
 	var (
 		availableRef string
 		opt          docker.ResolverOptions
+		lastErr      error
 	)
 
 	for _, ref := range refs {
@@ -128,44 +123,36 @@ func (c *Client) getResolver(ctx context.Context, authConfig *types.AuthConfig,
 		namedRef = reference.TrimTagForDigest(reference.WithDefaultTagIfMissing(namedRef))
 
 		insecure := c.isInsecureDomain(ref)
-		tr := &http.Transport{
-			Proxy: proxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:        10,
-			IdleConnTimeout:     30 * time.Second,
-			TLSHandshakeTimeout: 10 * time.Second,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: insecure,
-			},
-			ExpectContinueTimeout: 5 * time.Second,
-		}
+		client := c.newRegistryClient(ctx, strings.SplitN(ref, "/", 2)[0], insecure)
 
 		opt = docker.ResolverOptions{
 			Tracker:   resolverOpt.Tracker,
 			PlainHTTP: insecure,
-			Credentials: func(host string) (string, string, error) {
-				// Only one host
-				return username, secret, nil
-			},
-			Client: &http.Client{
-				Transport: tr,
-			},
+			// NOTE: the token is refreshed before it expires, because
+			// the pull of large image may last longer than the token.
+			Authorizer: newRegistryAuthorizer(client, authConfig),
+			Client:     client,
 		}
 
 		resolver := docker.NewResolver(opt)
 
-		if _, _, err := resolver.Resolve(ctx, namedRef.String()); err == nil {
+		_, _, err = resolver.Resolve(ctx, namedRef.String())
+		if err == nil {
 			availableRef = namedRef.String()
 			break
 		}
+		lastErr = err
 	}
 
 	if availableRef == "" {
-		logrus.Warnf("there is no available image reference after trying %+q", refs)
+		logrus.Warnf("there is no available image reference after trying %+q: %v", refs, lastErr)
+
+		// NOTE: the error of the last reference, which is the original
+		// one without mirror, tells why the image is unavailable, like
+		// the auth failure or the unreachable registry.
+		if lastErr != nil && !errdefs.IsNotFound(lastErr) {
+			return nil, "", lastErr
+		}
 		return nil, "", errtypes.ErrNotfound
 	}
 
@@ -176,6 +163,47 @@ func (c *Client) getResolver(ctx context.Context, authConfig *types.AuthConfig,
 	return newImageResolver(refToName, opt), availableRef, nil
 }
 
+// newRegistryClient creates the http client to request the registry host,
+// whose requests are limited by the registry timeouts and carry the
+// User-Agent of client.
+func (c *Client) newRegistryClient(ctx context.Context, host string, insecure bool) *http.Client {
+	timeouts := c.registryTimeouts
+
+	// NOTE: the proxy may contain the credential so that it should
+	// not be logged.
+	tr := &http.Transport{
+		Proxy:                 registryProxy(ctx, host),
+		DialContext:           timeouts.dialContext(),
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   timeouts.TLSHandshake,
+		ResponseHeaderTimeout: timeouts.ResponseHeader,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: insecure,
+		},
+		ExpectContinueTimeout: 5 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: withRetryAfter(ctx, withRateLimitNotifier(ctx, withAcceptMediaTypes(ctx, withUserAgent(tr, c.registryUserAgent)))),
+	}
+}
+
+// newRegistryAuthorizer creates the authorizer with the credential of
+// authConfig, whose token requests are sent by client.
+func newRegistryAuthorizer(client *http.Client, authConfig *types.AuthConfig) docker.Authorizer {
+	username, secret := "", ""
+	if authConfig != nil {
+		username = authConfig.Username
+		secret = authConfig.Password
+	}
+
+	return newRefreshingAuthorizer(client, func(host string) (string, string, error) {
+		// Only one host
+		return username, secret, nil
+	})
+}
+
 // GetWeightDevice Convert weight device from []*types.WeightDevice to []specs.LinuxWeightDevice
 func GetWeightDevice(devs []*types.WeightDevice) ([]specs.LinuxWeightDevice, error) {
 	var stat syscall.Stat_t
@@ -114,8 +114,178 @@ type Config struct {
 	DefaultLogConfig types.LogConfig `json:"default-log-config,omitempty"`
 
 	// RegistryMirrors is a list of registry URLs that act as a mirror for the default registry.
+	// The mirror can be a template like mirror.internal/dockerhub/{path}, whose {path} is
+	// replaced with the repository path of image, like library/ubuntu:20.04.
 	RegistryMirrors []string `json:"registry-mirrors,omitempty"`
 
+	// PerRegistryMirrors is the mirrors keyed by registry domain, like
+	// {"docker.io": ["m1", "m2"], "gcr.io": ["m3"]}. The mirrors of the
+	// default registry here override the RegistryMirrors. The mirror can
+	// be a template like RegistryMirrors.
+	PerRegistryMirrors map[string][]string `json:"per-registry-mirrors,omitempty"`
+
+	// RegistryNamespaces is the namespace attached to the unqualified name
+	// keyed by registry domain, like {"myreg.internal": "library"}, so that
+	// myreg.internal/foo expands to myreg.internal/library/foo. The entry of
+	// the default registry overrides the DefaultRegistryNS, and the empty
+	// namespace means nothing to be attached.
+	RegistryNamespaces map[string]string `json:"registry-namespaces,omitempty"`
+
+	// MirrorOnly pulls the images only from the mirrors without falling back
+	// to the upstream registry, so that the pull fails instead of reaching
+	// the upstream if all the mirrors miss.
+	MirrorOnly bool `json:"mirror-only,omitempty"`
+
+	// PullRetryCount is the max number of times to retry a failed image pull
+	// on retryable errors, like network timeout or 5xx from registry.
+	PullRetryCount int `json:"pull-retry-count,omitempty"`
+
+	// PullRetryBaseDelay specifies the base delay (in time.Second) between
+	// image pull retries, which is doubled after each retry.
+	PullRetryBaseDelay int `json:"pull-retry-base-delay,omitempty"`
+
+	// PullIdleTimeout specifies the period (in time.Second) that the image
+	// pull will fail if no data is received, zero means no limitation.
+	PullIdleTimeout int `json:"pull-idle-timeout,omitempty"`
+
+	// MaxImageSize fails the image pull before downloading any layer if the
+	// summed size (in bytes) of layers is larger than it, zero means no
+	// limitation.
+	MaxImageSize int64 `json:"max-image-size,omitempty"`
+
+	// PullAllowlist restricts the image pull to the references matching any
+	// of the patterns, like docker.io/* and reg.abc.com/library/*. The
+	// wildcard * matches any sequence including /. No restriction if it's
+	// empty.
+	PullAllowlist []string `json:"pull-allowlist,omitempty"`
+
+	// PullDenylist rejects the image pull of the references matching any
+	// of the patterns, like */internal-secret/*, which takes precedence
+	// over PullAllowlist.
+	PullDenylist []string `json:"pull-denylist,omitempty"`
+
+	// SearchTimeout specifies the timeout (in time.Second) of searching
+	// images from each registry, zero means no limitation.
+	SearchTimeout int `json:"search-timeout,omitempty"`
+
+	// ImageBootupWorkers is the number of workers to load the images into
+	// the local store at bootup, zero means the number of CPUs.
+	ImageBootupWorkers int `json:"image-bootup-workers,omitempty"`
+
+	// ImageLoadTimeout specifies the deadline (in time.Second) to load the
+	// images into the local store at bootup, zero means 10 minutes.
+	ImageLoadTimeout int `json:"image-load-timeout,omitempty"`
+
+	// RemoveCorruptImages removes the images whose content is missing at
+	// bootup, so that they stop failing on every boot.
+	RemoveCorruptImages bool `json:"remove-corrupt-images,omitempty"`
+
+	// AllowImplicitMultiTagRemove relaxes the check of removing image by ID
+	// without force. By default, it fails if the references of image have
+	// different repositories, like reg.abc.com/app:latest and
+	// reg.abc.com/base:v1. If it's set, it only fails if the references
+	// are in different registries, like reg.abc.com/app:latest and
+	// localhost:5000/app:latest. The references of the same repository,
+	// like app:latest and app:v1, are removable without force either way.
+	AllowImplicitMultiTagRemove bool `json:"allow-implicit-multi-tag-remove,omitempty"`
+
+	// MaxConcurrentDownloads limits the number of concurrent layer
+	// downloads for each pull, zero means no limitation.
+	MaxConcurrentDownloads int `json:"max-concurrent-downloads,omitempty"`
+
+	// MaxConcurrentUploads limits the number of concurrent layer uploads
+	// for each push, zero means no limitation.
+	MaxConcurrentUploads int `json:"max-concurrent-uploads,omitempty"`
+
+	// PushRateLimit caps the upload bandwidth (in bytes per second) of
+	// each push, zero means no limitation.
+	PushRateLimit int64 `json:"push-rate-limit,omitempty"`
+
+	// RegistryDialTimeout, RegistryTLSHandshakeTimeout and
+	// RegistryResponseHeaderTimeout specify the timeouts (in time.Second)
+	// of connecting, TLS handshake and waiting for the response headers of
+	// each request to the registry in pull and push, zero means no
+	// limitation.
+	RegistryDialTimeout           int `json:"registry-dial-timeout,omitempty"`
+	RegistryTLSHandshakeTimeout   int `json:"registry-tls-handshake-timeout,omitempty"`
+	RegistryResponseHeaderTimeout int `json:"registry-response-header-timeout,omitempty"`
+
+	// RegistryIdleTimeout specifies the period (in time.Second) to close
+	// the registry connection if no data is read or written, like the
+	// stalled download of layer, zero means no limitation.
+	RegistryIdleTimeout int `json:"registry-idle-timeout,omitempty"`
+
+	// RegistryUserAgent is the User-Agent of the requests to the registry
+	// in pull, push and search, like pouch/1.3.0 by default.
+	RegistryUserAgent string `json:"registry-user-agent,omitempty"`
+
+	// MaxConcurrentSaves limits the number of concurrent image save
+	// operations, zero means no limitation.
+	MaxConcurrentSaves int `json:"max-concurrent-saves,omitempty"`
+
+	// MaxConcurrentLoads limits the number of concurrent image load
+	// operations, zero means no limitation.
+	MaxConcurrentLoads int `json:"max-concurrent-loads,omitempty"`
+
+	// LoadMaxLayers limits the number of layers declared by each manifest
+	// in the loaded tarstream, 0 means no limitation.
+	LoadMaxLayers int `json:"load-max-layers,omitempty"`
+
+	// LoadMaxManifestSize limits the size (in bytes) of the manifests in
+	// the loaded tarstream, 0 means no limitation.
+	LoadMaxManifestSize int64 `json:"load-max-manifest-size,omitempty"`
+
+	// LoadMaxEntries limits the number of entries in the loaded tarstream,
+	// 0 means no limitation.
+	LoadMaxEntries int `json:"load-max-entries,omitempty"`
+
+	// LoadMaxSize limits the total size (in bytes) of the entries in the
+	// loaded tarstream, 0 means no limitation.
+	LoadMaxSize int64 `json:"load-max-size,omitempty"`
+
+	// ImagePlatformFallback is the platform, like linux/amd64, used to
+	// inspect the image which doesn't match the host's platform.
+	ImagePlatformFallback string `json:"image-platform-fallback,omitempty"`
+
+	// SaveCompressionLevel is the gzip level, from 1 (best speed) to 9
+	// (best compression), of the compressed tarstream of image save. Zero
+	// means the default level.
+	SaveCompressionLevel int `json:"save-compression-level,omitempty"`
+
+	// RequireDigestPull rejects pulling the image by tag, which only allows
+	// the reference pinned by digest like busybox@sha256:...
+	RequireDigestPull bool `json:"require-digest-pull,omitempty"`
+
+	// VerifyPulledContent re-verifies the digest of each pulled blob against
+	// the manifest before the image is stored.
+	VerifyPulledContent bool `json:"verify-pulled-content,omitempty"`
+
+	// ContentTrust enables the content trust (notary v1) verification when
+	// pulling images from the registries, which is keyed by registry domain.
+	ContentTrust map[string]ContentTrustConfig `json:"content-trust,omitempty"`
+
+	// SignatureKeys enables the cosign-style signature verification when
+	// pulling images from the registries. It's the files of PEM-encoded
+	// ecdsa public keys keyed by registry domain, and the pulled image must
+	// be signed by one of them.
+	SignatureKeys map[string][]string `json:"signature-keys,omitempty"`
+
+	// SigningKeys enables the cosign-style signing when pushing images to
+	// the registries. It's the file of PEM-encoded ecdsa private key keyed
+	// by registry domain, and the signature of pushed image is pushed into
+	// the same repository.
+	SigningKeys map[string]string `json:"signing-keys,omitempty"`
+
+	// RegistryProxies is the HTTP/HTTPS proxy used to pull images, which is
+	// keyed by registry domain, like {"gcr.io": "http://proxy:3128"}. The
+	// proxy from environment is used if there is no proxy for the registry.
+	RegistryProxies map[string]string `json:"registry-proxies,omitempty"`
+
+	// CredentialHelpers is the suffix of docker-style credential helper,
+	// like ecr-login for docker-credential-ecr-login, keyed by registry
+	// domain. The helper is used if there is no auth in the request.
+	CredentialHelpers map[string]string `json:"credential-helpers,omitempty"`
+
 	// oom_score_adj for the daemon
 	OOMScoreAdjust int `json:"oom-score-adjust,omitempty"`
 
@@ -131,6 +301,16 @@ type Config struct {
 	// AllowMultiSnapshotter allows multi snapshotter, default false
 	AllowMultiSnapshotter bool `json:"allow-multi-snapshotter,omitempty"`
 
+	// PullSnapshotters are the snapshotters which can be chosen per image
+	// pull instead of the default one, like overlaybd for the lazy-loadable
+	// images. It requires allow-multi-snapshotter.
+	PullSnapshotters []string `json:"pull-snapshotters,omitempty"`
+
+	// RemoteSnapshotters are the snapshotters which support the remote
+	// snapshot, like stargz, nydus and overlaybd. Only they can be used by
+	// the lazy pull, whose layers are fetched on demand.
+	RemoteSnapshotters []string `json:"remote-snapshotters,omitempty"`
+
 	// CgroupDriver sets cgroup driver for all containers
 	CgroupDriver string `json:"cgroup-driver,omitempty"`
 
@@ -145,6 +325,16 @@ type Config struct {
 	MachineMemory uint64 `json:"-"`
 }
 
+// ContentTrustConfig is the trust server config of registry.
+type ContentTrustConfig struct {
+	// Server is the address of trust server, like https://notary.docker.io.
+	Server string `json:"server,omitempty"`
+
+	// RootKeyIDs are the IDs of trusted root keys. The root metadata from
+	// the trust server must be signed by one of them.
+	RootKeyIDs []string `json:"root-key-ids,omitempty"`
+}
+
 // GetCgroupDriver gets cgroup driver used in runc.
 func (cfg *Config) GetCgroupDriver() string {
 	return cfg.CgroupDriver
@@ -186,6 +376,104 @@ func (cfg *Config) Validate() error {
 		cfg.Runtimes[cfg.DefaultRuntime] = types.Runtime{Path: cfg.DefaultRuntime}
 	}
 
+	// validates save compression level
+	if cfg.SaveCompressionLevel < 0 || cfg.SaveCompressionLevel > 9 {
+		return fmt.Errorf("save compression level %d should be in range [0, 9]", cfg.SaveCompressionLevel)
+	}
+
+	// validates max image size
+	if cfg.MaxImageSize < 0 {
+		return fmt.Errorf("max image size %d cannot be negative", cfg.MaxImageSize)
+	}
+
+	// validates pull snapshotters
+	if len(cfg.PullSnapshotters) > 0 && !cfg.AllowMultiSnapshotter {
+		return fmt.Errorf("pull snapshotters %v require allow-multi-snapshotter", cfg.PullSnapshotters)
+	}
+	for _, snapshotter := range cfg.PullSnapshotters {
+		if snapshotter == "" {
+			return fmt.Errorf("pull snapshotter cannot be empty")
+		}
+	}
+
+	// validates pull policy patterns
+	for _, pattern := range append(append([]string{}, cfg.PullAllowlist...), cfg.PullDenylist...) {
+		if pattern == "" {
+			return fmt.Errorf("pull policy pattern cannot be empty")
+		}
+	}
+
+	// validates image load timeout
+	if cfg.ImageLoadTimeout < 0 {
+		return fmt.Errorf("image load timeout %d cannot be negative", cfg.ImageLoadTimeout)
+	}
+
+	// validates registry mirrors
+	for _, mirror := range cfg.RegistryMirrors {
+		if err := validateRegistryMirror(mirror); err != nil {
+			return err
+		}
+	}
+
+	// validates per registry mirrors
+	for registry, mirrors := range cfg.PerRegistryMirrors {
+		if registry == "" {
+			return fmt.Errorf("registry of per registry mirrors cannot be empty")
+		}
+		for _, mirror := range mirrors {
+			if mirror == "" {
+				return fmt.Errorf("mirror of registry %s cannot be empty", registry)
+			}
+			if err := validateRegistryMirror(mirror); err != nil {
+				return err
+			}
+		}
+	}
+
+	// validates registry namespaces
+	for registry, ns := range cfg.RegistryNamespaces {
+		if registry == "" {
+			return fmt.Errorf("registry of registry namespaces cannot be empty")
+		}
+		if strings.HasPrefix(ns, "/") || strings.HasSuffix(ns, "/") {
+			return fmt.Errorf("namespace %q of registry %s cannot start or end with /", ns, registry)
+		}
+	}
+
+	// validates registry proxies
+	//
+	// NOTE: the proxy may contain the credential, which should not be in
+	// the error message.
+	for registry, proxy := range cfg.RegistryProxies {
+		if _, err := utils.ParseProxyURL(proxy); err != nil {
+			return fmt.Errorf("invalid proxy of registry %s: %v", registry, err)
+		}
+	}
+
+	// validates content trust config
+	for registry, trust := range cfg.ContentTrust {
+		if trust.Server == "" {
+			return fmt.Errorf("trust server of registry %s cannot be empty", registry)
+		}
+		if len(trust.RootKeyIDs) == 0 {
+			return fmt.Errorf("root key IDs of registry %s cannot be empty", registry)
+		}
+	}
+
+	// validates signature keys
+	for registry, keys := range cfg.SignatureKeys {
+		if len(keys) == 0 {
+			return fmt.Errorf("signature keys of registry %s cannot be empty", registry)
+		}
+	}
+
+	// validates signing keys
+	for registry, key := range cfg.SigningKeys {
+		if key == "" {
+			return fmt.Errorf("signing key of registry %s cannot be empty", registry)
+		}
+	}
+
 	// if cgroup driver is empty, use default cgroup driver
 	if cfg.CgroupDriver == "" {
 		cfg.CgroupDriver = DefaultCgroupDriver
@@ -314,3 +602,19 @@ func validateCgroupDriver(driver string) error {
 
 	return fmt.Errorf("invalid cgroup driver: %s, valid driver is cgroupfs or systemd", driver)
 }
+
+// validateRegistryMirror validates the mirror template, whose {path} should
+// be used once and not in the domain.
+func validateRegistryMirror(mirror string) error {
+	n := strings.Count(mirror, "{path}")
+	if n == 0 {
+		return nil
+	}
+	if n > 1 {
+		return fmt.Errorf("invalid registry mirror %s: {path} can be used only once", mirror)
+	}
+	if strings.Contains(strings.SplitN(mirror, "/", 2)[0], "{path}") {
+		return fmt.Errorf("invalid registry mirror %s: {path} cannot be used in the domain", mirror)
+	}
+	return nil
+}
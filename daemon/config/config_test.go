@@ -300,3 +300,32 @@ func TestValidateCgroupDriver(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateRegistryMirror(t *testing.T) {
+	for _, tc := range []struct {
+		mirror    string
+		expectErr bool
+	}{
+		{
+			mirror:    "mirror.com",
+			expectErr: false,
+		},
+		{
+			mirror:    "mirror.internal/dockerhub/{path}",
+			expectErr: false,
+		},
+		{
+			mirror:    "mirror.internal/{path}/{path}",
+			expectErr: true,
+		},
+		{
+			mirror:    "{path}.mirror.internal/dockerhub",
+			expectErr: true,
+		},
+	} {
+		err := validateRegistryMirror(tc.mirror)
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("expectd error: %v, but get %s", tc.expectErr, err)
+		}
+	}
+}
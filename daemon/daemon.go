@@ -6,6 +6,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"time"
 
 	"github.com/alibaba/pouch/apis/server"
 	criservice "github.com/alibaba/pouch/cri"
@@ -99,6 +100,16 @@ func NewDaemon(cfg *config.Config) *Daemon {
 		ctrd.WithRPCAddr(cfg.ContainerdAddr),
 		ctrd.WithDefaultNamespace(cfg.DefaultNamespace),
 		ctrd.WithInsecureRegistries(cfg.InsecureRegistries),
+		ctrd.WithMaxConcurrentDownloads(cfg.MaxConcurrentDownloads),
+		ctrd.WithMaxConcurrentUploads(cfg.MaxConcurrentUploads),
+		ctrd.WithPushRateLimit(cfg.PushRateLimit),
+		ctrd.WithRegistryTimeouts(ctrd.RegistryTimeouts{
+			Dial:           time.Duration(cfg.RegistryDialTimeout) * time.Second,
+			TLSHandshake:   time.Duration(cfg.RegistryTLSHandshakeTimeout) * time.Second,
+			ResponseHeader: time.Duration(cfg.RegistryResponseHeaderTimeout) * time.Second,
+			Idle:           time.Duration(cfg.RegistryIdleTimeout) * time.Second,
+		}),
+		ctrd.WithRegistryUserAgent(cfg.RegistryUserAgent),
 	)
 	if err != nil {
 		logrus.Errorf("failed to new containerd's client: %v", err)
@@ -116,6 +127,13 @@ func NewDaemon(cfg *config.Config) *Daemon {
 
 	logrus.Infof("Snapshotter is set to be %s", ctrd.CurrentSnapshotterName(context.TODO()))
 
+	for _, snapshotter := range cfg.PullSnapshotters {
+		if err = ctrdClient.CheckSnapshotterValid(snapshotter, true); err != nil {
+			logrus.Errorf("failed to check pull snapshotter: %v", err)
+			return nil
+		}
+	}
+
 	return &Daemon{
 		config:         cfg,
 		ctrdClient:     ctrdClient,
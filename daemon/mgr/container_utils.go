@@ -1,6 +1,7 @@
 package mgr
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -22,6 +23,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/selinux/go-selinux/label"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // containerID returns the container's id, the parameter 'nameOrPrefix' may be container's
@@ -108,6 +110,24 @@ func (mgr *ContainerManager) generateName(id string) string {
 	return name
 }
 
+// createSnapshot creates the snapshot of container on the image's rootfs. The
+// chain ID cached after pull is used as the parent if any, so that the image
+// isn't read from containerd again. The rootfs is read from the image if the
+// cached one is missing, like the stale cache.
+func (mgr *ContainerManager) createSnapshot(ctx context.Context, snapID, image string) error {
+	chainID, err := mgr.ImageMgr.GetImageChainID(ctx, image)
+	if err != nil {
+		return mgr.Client.CreateSnapshot(ctx, snapID, image)
+	}
+
+	err = mgr.Client.PrepareSnapshot(ctx, snapID, chainID.String())
+	if errtypes.IsNotfound(err) {
+		logrus.Warnf("failed to prepare snapshot %s on cached chain ID %s of image %s, read it from image: %v", snapID, chainID, image, err)
+		return mgr.Client.CreateSnapshot(ctx, snapID, image)
+	}
+	return err
+}
+
 // getRuntimeType returns containerd runtime type, type shim v1 by default.
 func (mgr *ContainerManager) getRuntimeType(runtime string) (string, error) {
 	r, exist := mgr.Config.Runtimes[runtime]
@@ -1,15 +1,22 @@
 package mgr
 
 import (
+	"context"
 	"path"
 	"reflect"
 	"testing"
 
 	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/ctrd"
 	"github.com/alibaba/pouch/pkg/collect"
+	"github.com/alibaba/pouch/pkg/errtypes"
 	"github.com/alibaba/pouch/pkg/meta"
 	"github.com/alibaba/pouch/pkg/utils"
 
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -286,3 +293,58 @@ func Test_mergeEnvSlice(t *testing.T) {
 		})
 	}
 }
+
+// fakeSnapshotClient records the snapshots created, and only the parents
+// given exist.
+type fakeSnapshotClient struct {
+	ctrd.APIClient
+
+	parents  map[string]bool
+	prepared map[string]string
+	created  map[string]string
+}
+
+func (c *fakeSnapshotClient) PrepareSnapshot(ctx context.Context, id, parent string) error {
+	if !c.parents[parent] {
+		return pkgerrors.Wrapf(errtypes.ErrNotfound, "parent snapshot %s", parent)
+	}
+	c.prepared[id] = parent
+	return nil
+}
+
+func (c *fakeSnapshotClient) CreateSnapshot(ctx context.Context, id, ref string) error {
+	c.created[id] = ref
+	return nil
+}
+
+func TestContainerManager_createSnapshot(t *testing.T) {
+	diffIDs := []digest.Digest{digest.FromString("layer1"), digest.FromString("layer2")}
+	chainID := identity.ChainID(diffIDs).String()
+
+	img := newFakeImage(t, memProvider{}, "docker.io/library/busybox:latest", ocispec.Image{
+		OS:     "linux",
+		RootFS: ocispec.RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	imageMgr, _ := newFakeImageManager(t, img)
+
+	client := &fakeSnapshotClient{
+		parents:  map[string]bool{chainID: true},
+		prepared: map[string]string{},
+		created:  map[string]string{},
+	}
+	mgr := &ContainerManager{ImageMgr: imageMgr, Client: client}
+
+	// the cached chain ID is used as the parent
+	assert.NoError(t, mgr.createSnapshot(context.TODO(), "snap1", img.name))
+	assert.Equal(t, map[string]string{"snap1": chainID}, client.prepared)
+	assert.Empty(t, client.created)
+
+	// the rootfs is read from image if the cached chain ID is stale
+	delete(client.parents, chainID)
+	assert.NoError(t, mgr.createSnapshot(context.TODO(), "snap2", img.name))
+	assert.Equal(t, map[string]string{"snap2": img.name}, client.created)
+
+	// the image without cache is read too
+	assert.NoError(t, mgr.createSnapshot(context.TODO(), "snap3", "unknown"))
+	assert.Equal(t, "unknown", client.created["snap3"])
+}
@@ -89,6 +89,18 @@ func (mgr *ImageManager) LogImageEventWithAttributes(ctx context.Context, imageI
 	_ = mgr.eventsService.Publish(ctx, action, types.EventTypeImage, actor)
 }
 
+// imageEventAttributes returns the attributes with the labels of image, which
+// is used to log the event after the image has been removed.
+func (mgr *ImageManager) imageEventAttributes(ctx context.Context, imageID string) map[string]string {
+	attributes := map[string]string{}
+
+	img, err := mgr.GetImage(ctx, imageID)
+	if err == nil && img.Config != nil {
+		copyAttributes(attributes, img.Config.Labels)
+	}
+	return attributes
+}
+
 // copyAttributes guarantees that labels are not mutated by event triggers.
 func copyAttributes(attributes, labels map[string]string) {
 	if labels == nil {
@@ -2,15 +2,15 @@ package mgr
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"net/http"
 	"net/url"
-	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alibaba/pouch/apis/filters"
@@ -20,17 +20,20 @@ import (
 	"github.com/alibaba/pouch/daemon/events"
 	"github.com/alibaba/pouch/hookplugins"
 	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/httputils"
 	"github.com/alibaba/pouch/pkg/jsonstream"
 	"github.com/alibaba/pouch/pkg/reference"
 	"github.com/alibaba/pouch/pkg/utils"
-	searchtypes "github.com/alibaba/pouch/registry/types"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
 	ctrdmetaimages "github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	pkgerrors "github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -39,7 +42,8 @@ import (
 // The daemon will load all the images from containerd into memory. At
 // the beginning, we assume that it can load it in 10 secs. But if the
 // system has busy IO, it will take long time to load it, especially the
-// more-layers and huge-size images. So update it from 10 secs to 10 mins.
+// more-layers and huge-size images. So update it from 10 secs to 10 mins,
+// which is the default if image-load-timeout isn't set.
 var deadlineLoadImagesAtBootup = time.Minute * 10
 
 // the filter tags set allowed when pouch images -f
@@ -47,6 +51,8 @@ var acceptedImageFilterTags = map[string]bool{
 	"before":    true,
 	"since":     true,
 	"reference": true,
+	"dangling":  true,
+	"label":     true,
 }
 
 // ImageMgr as an interface defines all operations against images.
@@ -55,25 +61,82 @@ type ImageMgr interface {
 	LookupImageReferences(ref string) []string
 
 	// PullImage pulls images from specified registry.
-	PullImage(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer) error
+	PullImage(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer, opt *ImagePullOption) error
 
 	// PushImage pushes image to specified registry.
 	PushImage(ctx context.Context, name, tag string, authConfig *types.AuthConfig, out io.Writer) error
 
+	// PushManifestList assembles the manifest list from the local images and pushes it.
+	PushManifestList(ctx context.Context, listRef string, platformRefs []string, authConfig *types.AuthConfig, out io.Writer) error
+
+	// CopyImage copies the image between registries without the local image.
+	CopyImage(ctx context.Context, srcRef, dstRef string, srcAuth, dstAuth *types.AuthConfig, out io.Writer) error
+
 	// GetImage returns imageInfo by reference or id.
 	GetImage(ctx context.Context, idOrRef string) (*types.ImageInfo, error)
 
-	// ListImages lists images stored by containerd.
-	ListImages(ctx context.Context, filter filters.Args) ([]types.ImageInfo, error)
+	// HasImage returns true and the image ID if the image exists, without
+	// inspecting the image.
+	HasImage(ctx context.Context, idOrRef string) (bool, digest.Digest, error)
+
+	// ListImages lists images stored by containerd, including the ones
+	// without reference if opt.All is true. The cursor of next page is
+	// returned if there are more images than opt.Limit.
+	ListImages(ctx context.Context, filter filters.Args, opt *ImageListOption) ([]types.ImageInfo, string, error)
+
+	// Search Images from specified registry, at most limit results if limit is positive.
+	SearchImages(ctx context.Context, name, registry string, limit int, authConfig *types.AuthConfig) ([]types.SearchResultItem, error)
 
-	// Search Images from specified registry.
-	SearchImages(ctx context.Context, name, registry string, authConfig *types.AuthConfig) ([]types.SearchResultItem, error)
+	// ListRemoteTags lists the tags of repository in the registry.
+	ListRemoteTags(ctx context.Context, repo string, auth *types.AuthConfig) ([]string, error)
 
 	// RemoveImage deletes an image by reference.
-	RemoveImage(ctx context.Context, idOrRef string, force bool) error
+	RemoveImage(ctx context.Context, idOrRef string, opt *ImageRemoveOption) error
+
+	// PruneDigestRemovesImage returns true if removing the tag with PruneDigest removes the image.
+	PruneDigestRemovesImage(ctx context.Context, idOrRef string) (bool, error)
+
+	// RemoveImages deletes a batch of images, continuing past individual failures.
+	RemoveImages(ctx context.Context, idOrRefs []string, force bool, isUsed ImageUsedFunc) ([]types.ImageDeleteResponseItem, error)
+
+	// RemoveRepository deletes all the references of the repository.
+	RemoveRepository(ctx context.Context, repo string, force bool, isUsed ImageUsedFunc) ([]types.ImageDeleteResponseItem, error)
+
+	// RelabelNamespace moves the local images from one namespace to another.
+	RelabelNamespace(ctx context.Context, oldNS, newNS string) ([]types.ImageDeleteResponseItem, error)
+
+	// PruneImages removes the images which are not used by any container.
+	PruneImages(ctx context.Context, filter filters.Args, isUsed ImageUsedFunc) (*types.ImagePruneResult, error)
+
+	// GarbageCollect removes the content which is not referenced by any image.
+	GarbageCollect(ctx context.Context) (*types.GCResult, error)
+
+	// Usage returns the disk usage of images, which counts the shared blobs once.
+	Usage(ctx context.Context, isUsed ImageUsedFunc) (*types.ImageDiskUsage, error)
+
+	// DiagnoseImageStore reports the drift between local store and containerd.
+	DiagnoseImageStore(ctx context.Context) (*types.StoreDiagnosis, error)
+
+	// AddTag creates target ref for source image. If force is true, the
+	// target ref used by other image will be moved to the source image,
+	// unless it's the last reference of the other image used by container.
+	AddTag(ctx context.Context, sourceImage string, targetRef string, force bool, isUsed ImageUsedFunc) error
+
+	// AddTags creates all the target refs for source image, or none of them.
+	AddTags(ctx context.Context, sourceImage string, targetRefs []string) error
+
+	// MoveReference renames the source reference to the target reference.
+	MoveReference(ctx context.Context, source, target string) error
+
+	// ValidateReference validates the reference to be used as target tag.
+	ValidateReference(ref string) error
 
-	// AddTag creates target ref for source image.
-	AddTag(ctx context.Context, sourceImage string, targetRef string) error
+	// NormalizeReference returns the normalized form of the reference.
+	NormalizeReference(ref string) (string, error)
+
+	// SetImageLabels sets the labels of image in containerd meta data, and
+	// the labels of image config are immutable.
+	SetImageLabels(ctx context.Context, idOrRef string, labels map[string]string) error
 
 	// CheckReference returns imageID, actual reference and primary reference.
 	CheckReference(ctx context.Context, idOrRef string) (digest.Digest, reference.Named, reference.Named, error)
@@ -81,11 +144,51 @@ type ImageMgr interface {
 	// ListReferences returns all references
 	ListReferences(ctx context.Context, imageID digest.Digest) ([]reference.Named, error)
 
+	// ListAllReferences returns all the searchable references of image,
+	// including the aliases like Name@Digest.
+	ListAllReferences(ctx context.Context, imageID digest.Digest) ([]reference.Named, error)
+
 	// LoadImage creates a set of images by tarstream.
-	LoadImage(ctx context.Context, imageName string, tarstream io.ReadCloser) error
+	LoadImage(ctx context.Context, imageName string, tarstream io.ReadCloser, out io.Writer, opt *ImageLoadOption) error
+
+	// LoadImageFromURL creates a set of images by tarstream downloaded from the url.
+	LoadImageFromURL(ctx context.Context, imageName, url string, authConfig *types.AuthConfig, out io.Writer, opt *ImageLoadOption) error
+
+	// ImportImage creates a single-layer image from the rootfs tarball.
+	ImportImage(ctx context.Context, ref string, changes []string, rootfs io.ReadCloser) error
 
 	// SaveImage saves image to tarstream.
-	SaveImage(ctx context.Context, idOrRef string) (io.ReadCloser, error)
+	SaveImage(ctx context.Context, idOrRef string, opt *ImageSaveOption) (io.ReadCloser, error)
+
+	// SaveImages saves several images to one docker-compatible tarstream.
+	SaveImages(ctx context.Context, idOrRefs []string, opt *ImageSaveOption) (io.ReadCloser, error)
+
+	// ExportBlobs writes the blobs of image into the blobs/sha256 layout of directory.
+	ExportBlobs(ctx context.Context, idOrRef string, destDir string) error
+
+	// InspectLayers returns the information of each layer of the image.
+	InspectLayers(ctx context.Context, idOrRef string) ([]types.LayerInfo, error)
+
+	// DiffImages compares the layers and the config of two images.
+	DiffImages(ctx context.Context, ref1, ref2 string) (*types.ImageDiff, error)
+
+	// GetImageLayer returns the compressed layer blob of the image.
+	GetImageLayer(ctx context.Context, idOrRef string, layerDigest digest.Digest) (io.ReadCloser, error)
+
+	// GetImageManifest returns the raw manifest or index of the image and its media type.
+	GetImageManifest(ctx context.Context, idOrRef string) ([]byte, string, error)
+
+	// ListProvenance returns the provenance records of image pulls.
+	ListProvenance(ctx context.Context) ([]types.ImageProvenance, error)
+
+	// PullStats returns the pull statistics of each registry over the windows.
+	PullStats(ctx context.Context, windows []time.Duration) ([]types.RegistryPullStats, error)
+
+	// MirrorHealth returns the health of mirrors which failed recently.
+	MirrorHealth() []types.MirrorHealth
+
+	// ListCorruptImages returns the images failed to be loaded at bootup.
+	ListCorruptImages() []types.CorruptImage
 
 	// ImageHistory returns image history by reference.
 	ImageHistory(ctx context.Context, idOrRef string) ([]types.HistoryResultItem, error)
@@ -95,6 +198,29 @@ type ImageMgr interface {
 
 	// GetOCIImageConfig returns the image config of OCI
 	GetOCIImageConfig(ctx context.Context, image string) (ocispec.ImageConfig, error)
+
+	// GetImageChainID returns the chain ID of the image's rootfs cached after pull.
+	GetImageChainID(ctx context.Context, idOrRef string) (digest.Digest, error)
+
+	// GetImageConfig returns the complete OCI image config by reference or id.
+	GetImageConfig(ctx context.Context, idOrRef string) (ocispec.Image, error)
+}
+
+// isRegistryMirror returns true if the registry is one of the mirrors.
+func (mgr *ImageManager) isRegistryMirror(registry string) bool {
+	for _, mirror := range mgr.RegistryMirrors {
+		if mirrorOfReference(mirror) == registry {
+			return true
+		}
+	}
+	for _, mirrors := range mgr.PerRegistryMirrors {
+		for _, mirror := range mirrors {
+			if mirrorOfReference(mirror) == registry {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // ImageManager is an implementation of interface ImageMgr.
@@ -110,6 +236,16 @@ type ImageManager struct {
 	// RegistryMirrors is a list of registry URLs that act as a mirror for the default registry.
 	RegistryMirrors []string
 
+	// PerRegistryMirrors is the mirrors keyed by the registry domain.
+	PerRegistryMirrors map[string][]string
+
+	// RegistryNamespaces is the namespace attached to the unqualified name,
+	// keyed by the registry domain.
+	RegistryNamespaces map[string]string
+
+	// MirrorOnly omits the upstream registry from the references to pull.
+	MirrorOnly bool
+
 	// client is a interface to the containerd client.
 	// It is used to interact with containerd.
 	client ctrd.APIClient
@@ -122,6 +258,119 @@ type ImageManager struct {
 
 	// imagePlugin is a plugin called before image operations
 	imagePlugin hookplugins.ImagePlugin
+
+	// pullRetryCount is the max number of retries for a failed pull.
+	pullRetryCount int
+
+	// pullRetryBaseDelay is the delay before the first retry, which will
+	// be doubled after each retry.
+	pullRetryBaseDelay time.Duration
+
+	// pullIdleTimeout is the period to fail the pull if there is no data
+	// received. The pull can take long time as long as it's progressing.
+	pullIdleTimeout time.Duration
+
+	// maxImageSize fails the pull if the summed size of layers is larger
+	// than it, zero means no limitation.
+	maxImageSize int64
+
+	// pullSnapshotters are the snapshotters which can be chosen per pull.
+	pullSnapshotters []string
+
+	// remoteSnapshotters are the snapshotters which can be used by the
+	// lazy pull.
+	remoteSnapshotters []string
+
+	// pullPolicy restricts the references which can be pulled.
+	pullPolicy *pullPolicy
+
+	// searchTimeout is the timeout of searching images from each registry.
+	searchTimeout time.Duration
+	// registryUserAgent is the User-Agent of search requests.
+	registryUserAgent string
+
+	// insecureRegistries accept HTTP or HTTPS with certificates from
+	// unknown CAs, which is the same to the resolver of containerd client.
+	insecureRegistries []string
+
+	// saveLimiter and loadLimiter limit the concurrent save/load operations
+	// to protect the IO-bound host.
+	saveLimiter *ioLimiter
+	loadLimiter *ioLimiter
+
+	// provenance records where the pulled images came from.
+	provenance *provenanceRecorder
+
+	// pullStats aggregates the pulls of each registry in memory.
+	pullStats *pullStats
+
+	// mirrorHealth tracks the failures of mirrors to try the failing
+	// mirrors last.
+	mirrorHealth *mirrorHealth
+
+	// imageLocks coordinates the inspect and removal of the same image.
+	imageLocks *imageLocker
+
+	// mountBlobs caches the blobs of sibling images, which are the mount
+	// sources of push.
+	mountBlobs *mountBlobCache
+
+	// registryProxies is the proxy used to pull images keyed by registry
+	// domain, which may contain the credential and should not be logged.
+	registryProxies map[string]*url.URL
+
+	// bootupWorkers is the number of workers to load images at bootup.
+	bootupWorkers int
+
+	// bootupTimeout is the deadline to load images at bootup.
+	bootupTimeout time.Duration
+
+	// corruptImages records the images failed to be loaded at bootup.
+	corruptImages *corruptImages
+
+	// removeCorruptImages removes the images whose content is missing at
+	// bootup.
+	removeCorruptImages bool
+
+	// allowImplicitMultiTagRemove allows removing the image by ID without
+	// force if all its references are in the same registry.
+	allowImplicitMultiTagRemove bool
+
+	// infoCache caches the size and OCI spec by the target digest.
+	infoCache *imageInfoCache
+
+	// platformFallback is used to inspect the image which doesn't match
+	// the default platform.
+	platformFallback platforms.MatchComparer
+
+	// trustClients verifies the content trust of images, which is keyed
+	// by registry domain.
+	trustClients map[string]*trustClient
+	// signatureVerifiers verifies the signature of images, which is keyed
+	// by registry domain.
+	signatureVerifiers map[string]*signatureVerifier
+	// imageSigners signs the pushed images, which is keyed by registry
+	// domain.
+	imageSigners map[string]*imageSigner
+	// saveCompressionLevel is the gzip level of compressed image save.
+	saveCompressionLevel int
+	// requireDigestPull rejects the pull by mutable tag.
+	requireDigestPull bool
+	// verifyPulledContent re-verifies the pulled blobs before storing.
+	verifyPulledContent bool
+	// loadLimits rejects the abusive tarstream in LoadImage, and limits
+	// the rootfs tarball in ImportImage by the entry count and size.
+	loadLimits loadLimits
+
+	// importDir keeps the temporary layer of ImportImage, which is under
+	// the home dir instead of /tmp since the layer may be large.
+	importDir string
+	// credentials gets the registry auth from credential helpers.
+	credentials *credentialStore
+	// pulls deduplicates the concurrent pulls of the same image.
+	pulls *pullGroup
+	// unpacking tracks the layer chains being unpacked by the pulls.
+	unpacking *unpackingLayers
 }
 
 // NewImageManager initializes a brand new image manager.
@@ -132,14 +381,99 @@ func NewImageManager(cfg *config.Config, client ctrd.APIClient, eventsService *e
 	}
 
 	mgr := &ImageManager{
-		DefaultRegistry:  cfg.DefaultRegistry,
-		DefaultNamespace: cfg.DefaultRegistryNS,
-		RegistryMirrors:  cfg.RegistryMirrors,
+		DefaultRegistry:    cfg.DefaultRegistry,
+		DefaultNamespace:   cfg.DefaultRegistryNS,
+		RegistryMirrors:    cfg.RegistryMirrors,
+		PerRegistryMirrors: cfg.PerRegistryMirrors,
+		RegistryNamespaces: cfg.RegistryNamespaces,
+		MirrorOnly:         cfg.MirrorOnly,
 
 		client:        client,
 		localStore:    store,
 		eventsService: eventsService,
 		imagePlugin:   imagePlugin,
+
+		pullRetryCount:     cfg.PullRetryCount,
+		pullRetryBaseDelay: time.Duration(cfg.PullRetryBaseDelay) * time.Second,
+		pullIdleTimeout:    time.Duration(cfg.PullIdleTimeout) * time.Second,
+		maxImageSize:       cfg.MaxImageSize,
+		pullSnapshotters:   cfg.PullSnapshotters,
+		remoteSnapshotters: cfg.RemoteSnapshotters,
+		searchTimeout:      time.Duration(cfg.SearchTimeout) * time.Second,
+		insecureRegistries: cfg.InsecureRegistries,
+
+		saveLimiter: newIOLimiter("image save", cfg.MaxConcurrentSaves),
+		loadLimiter: newIOLimiter("image load", cfg.MaxConcurrentLoads),
+		loadLimits: loadLimits{
+			maxLayers:       cfg.LoadMaxLayers,
+			maxManifestSize: cfg.LoadMaxManifestSize,
+			maxEntries:      cfg.LoadMaxEntries,
+			maxSize:         cfg.LoadMaxSize,
+		},
+		importDir:   filepath.Join(cfg.HomeDir, "image-import"),
+		credentials: newCredentialStore(cfg.CredentialHelpers),
+
+		provenance: newProvenanceRecorder(filepath.Join(cfg.HomeDir, "image-provenance.log"), provenanceLogMaxSize, provenanceLogMaxFiles),
+		pullStats:  newPullStats(pullStatsRetention),
+
+		mirrorHealth: newMirrorHealth(mirrorFailureThreshold, mirrorCooldown),
+		imageLocks:   newImageLocker(),
+		mountBlobs:   newMountBlobCache(),
+
+		bootupWorkers: cfg.ImageBootupWorkers,
+		bootupTimeout: time.Duration(cfg.ImageLoadTimeout) * time.Second,
+		infoCache:     newImageInfoCache(),
+		pulls:         newPullGroup(),
+		unpacking:     newUnpackingLayers(),
+
+		corruptImages:       newCorruptImages(),
+		removeCorruptImages: cfg.RemoveCorruptImages,
+
+		allowImplicitMultiTagRemove: cfg.AllowImplicitMultiTagRemove,
+	}
+
+	mgr.verifyPulledContent = cfg.VerifyPulledContent
+
+	mgr.registryUserAgent = cfg.RegistryUserAgent
+	if mgr.registryUserAgent == "" {
+		mgr.registryUserAgent = ctrd.DefaultRegistryUserAgent
+	}
+	mgr.requireDigestPull = cfg.RequireDigestPull
+	mgr.saveCompressionLevel = cfg.SaveCompressionLevel
+
+	if mgr.pullPolicy, err = newPullPolicy(cfg.PullAllowlist, cfg.PullDenylist); err != nil {
+		return nil, err
+	}
+
+	if mgr.registryProxies, err = parseRegistryProxies(cfg.RegistryProxies); err != nil {
+		return nil, err
+	}
+
+	mgr.trustClients = make(map[string]*trustClient, len(cfg.ContentTrust))
+	for registry, trust := range cfg.ContentTrust {
+		mgr.trustClients[registry] = newTrustClient(trust.Server, trust.RootKeyIDs, mgr.isInsecureRegistry(registry), mgr.registryProxies[registry])
+	}
+
+	mgr.signatureVerifiers = make(map[string]*signatureVerifier, len(cfg.SignatureKeys))
+	for registry, keys := range cfg.SignatureKeys {
+		if mgr.signatureVerifiers[registry], err = newSignatureVerifier(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	mgr.imageSigners = make(map[string]*imageSigner, len(cfg.SigningKeys))
+	for registry, key := range cfg.SigningKeys {
+		if mgr.imageSigners[registry], err = newImageSigner(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ImagePlatformFallback != "" {
+		p, err := platforms.Parse(cfg.ImagePlatformFallback)
+		if err != nil {
+			return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid image platform fallback %s: %v", cfg.ImagePlatformFallback, err)
+		}
+		mgr.platformFallback = platforms.Only(p)
 	}
 
 	if err := mgr.updateLocalStore(); err != nil {
@@ -167,34 +501,187 @@ func (mgr *ImageManager) LookupImageReferences(ref string) []string {
 	// for partial reference like 'ns/ubuntu', 'ubuntu'
 	var fullRefs []string
 
-	// if the domain field is empty, concat the ref with registry mirror urls.
+	// NOTE: the mirrors of registry in PerRegistryMirrors take precedence
+	// over the global RegistryMirrors.
+	mirrors, hasMirrors := mgr.PerRegistryMirrors[registry]
+	if registry == "" {
+		mirrors, hasMirrors = mgr.PerRegistryMirrors[mgr.DefaultRegistry]
+	}
+
+	// the global registry mirrors are used only if the domain field is empty.
+	globalMirrors := registry == "" && !hasMirrors
 	if registry == "" {
+		registry = mgr.DefaultRegistry
+	}
+
+	// attach the namespace of registry, like the default namespace of the
+	// default registry.
+	if ns := registryNamespace(registry, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces); ns != "" && !strings.ContainsAny(remainder, "/") {
+		remainder = ns + "/" + remainder
+	}
+
+	// NOTE: the ref is concatenated with the global mirror as it is, but the
+	// template takes the path with namespace, since the remote repository
+	// of Artifactory or Nexus doesn't complete the namespace like Docker Hub.
+	if globalMirrors {
 		for _, reg := range mgr.RegistryMirrors {
-			fullRefs = append(fullRefs, path.Join(reg, ref))
+			if isMirrorTemplate(reg) {
+				fullRefs = append(fullRefs, mirrorReference(reg, remainder))
+			} else {
+				fullRefs = append(fullRefs, mirrorReference(reg, ref))
+			}
 		}
-		registry = mgr.DefaultRegistry
 	}
 
-	// attach the default namespace if the registry match the default registry.
-	if registry == mgr.DefaultRegistry && !strings.ContainsAny(remainder, "/") {
-		remainder = mgr.DefaultNamespace + "/" + remainder
+	for _, reg := range mirrors {
+		fullRefs = append(fullRefs, mirrorReference(reg, remainder))
 	}
 
-	fullRefs = append(fullRefs, registry+"/"+remainder)
+	// NOTE: the registry of reference is kept in mirror-only mode if it's
+	// one of the mirrors, which is pulled from the mirror explicitly.
+	if !mgr.MirrorOnly || mgr.isRegistryMirror(registry) {
+		fullRefs = append(fullRefs, registry+"/"+remainder)
+	}
 
-	return fullRefs
+	// the mirrors which failed recently are tried last.
+	return mgr.mirrorHealth.order(fullRefs)
 }
 
 // PullImage pulls images from specified registry.
-func (mgr *ImageManager) PullImage(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer) error {
+//
+// The concurrent pulls of the same reference with the same options share one
+// underlying pull, and all of them receive the same result.
+func (mgr *ImageManager) PullImage(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer, opt *ImagePullOption) error {
+	namedRef, err := reference.Parse(addDefaultRegistryIfMissing(ref, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces))
+	if err != nil {
+		return mgr.pullImage(ctx, ref, authConfig, out, opt)
+	}
+	namedRef = reference.TrimTagForDigest(reference.WithDefaultTagIfMissing(namedRef))
+
+	var notify ctrd.RateLimitNotifier
+	if opt != nil {
+		notify = opt.RateLimitNotifier
+	}
+
+	// NOTE: the rate limit of the shared pull is notified to all the
+	// callers, like the progress.
+	return mgr.pulls.do(ctx, pullKey(namedRef.String(), authConfig, opt), out, notify, func(ctx context.Context, out io.Writer, notify ctrd.RateLimitNotifier) error {
+		sharedOpt := ImagePullOption{}
+		if opt != nil {
+			sharedOpt = *opt
+		}
+		sharedOpt.RateLimitNotifier = notify
+		return mgr.pullImage(ctx, ref, authConfig, out, &sharedOpt)
+	})
+}
+
+// pullImage pulls the image and writes the progress into out.
+func (mgr *ImageManager) pullImage(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer, opt *ImagePullOption) (err error) {
+	var (
+		start    = time.Now()
+		registry = mgr.registryOfReference(ref)
+		img      containerd.Image
+	)
+	defer func() {
+		mgr.recordPullStats(ctx, registry, img, start, err)
+	}()
+
 	namedRef, err := reference.Parse(ref)
 	if err != nil {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid reference %s: %v", ref, err)
+	}
+
+	if _, ok := namedRef.(reference.Digested); !ok && mgr.requireDigestPull {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "image %s must be pulled by digest like name@sha256:..., since require-digest-pull is enabled", ref)
+	}
+
+	if opt == nil {
+		opt = &ImagePullOption{}
+	}
+
+	authConfig, err = mgr.resolveAuthConfig(ctx, ref, authConfig)
+	if err != nil {
+		return err
+	}
+
+	if len(opt.AcceptMediaTypes) > 0 {
+		if err := validateManifestMediaTypes(opt.AcceptMediaTypes); err != nil {
+			return err
+		}
+		ctx = ctrd.WithAcceptMediaTypes(ctx, opt.AcceptMediaTypes)
+	}
+
+	if opt.BestEffort && !opt.IndexOnly {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "best-effort pull of %s requires index-only", ref)
+	}
+
+	if opt.MaxImageSize < 0 {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "max image size %d cannot be negative", opt.MaxImageSize)
+	}
+
+	if opt.IndexOnly {
+		ctx = ctrd.WithIndexOnly(ctx)
+	}
+
+	if opt.Snapshotter != "" {
+		if err := mgr.validatePullSnapshotter(opt.Snapshotter); err != nil {
+			return err
+		}
+		ctx = ctrd.WithSnapshotter(ctx, opt.Snapshotter)
+	}
+
+	if opt.Lazy {
+		if opt.IndexOnly {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "lazy pull of %s cannot be index-only", ref)
+		}
+
+		snapshotter := ctrd.CurrentSnapshotterName(ctx)
+		if !utils.StringInSlice(mgr.remoteSnapshotters, snapshotter) {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "lazy pull requires the remote snapshotter, but %s is not in remote-snapshotters", snapshotter)
+		}
+		ctx = ctrd.WithLazy(ctx)
+	}
+
+	proxyFunc, err := mgr.registryProxyFunc(opt.Proxy)
+	if err != nil {
+		return err
+	}
+	if proxyFunc != nil {
+		ctx = ctrd.WithRegistryProxy(ctx, proxyFunc)
+	}
+
+	// NOTE: the pull policy is enforced before any network call and before
+	// the stream is opened, and the mirrors denied by policy are skipped.
+	if err := mgr.pullPolicy.check(addDefaultRegistryIfMissing(ref, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces)); err != nil {
 		return err
 	}
 
+	fullRefs := mgr.LookupImageReferences(ref)
+	if len(fullRefs) == 0 {
+		return pkgerrors.Wrapf(errtypes.ErrNotfound, "no mirror to pull image %s, since mirror-only is enabled", ref)
+	}
+
+	if fullRefs = mgr.pullPolicy.filter(fullRefs); len(fullRefs) == 0 {
+		return pkgerrors.Wrapf(errtypes.ErrForbidden, "pulling %s is denied by pull policy: all the registries and mirrors are denied", ref)
+	}
+
 	pctx, cancel := context.WithCancel(ctx)
 	stream := jsonstream.New(out, nil)
 
+	if maxImageSize := pullMaxImageSize(mgr.maxImageSize, opt.MaxImageSize); maxImageSize > 0 {
+		pctx = ctrd.WithMaxImageSize(pctx, maxImageSize)
+	}
+
+	if opt.BestEffort {
+		pctx = ctrd.WithBestEffort(pctx, func(platform string, err error) {
+			logrus.Warnf("skip platform %s of image %s: %v", platform, ref, err)
+			stream.WriteObject(jsonstream.JSONMessage{
+				ID:     platform,
+				Status: fmt.Sprintf("Skipped unavailable platform: %v", err),
+			})
+		})
+	}
+
 	closeStream := func() {
 		// close and wait stream
 		stream.Close()
@@ -206,7 +693,7 @@ func (mgr *ImageManager) PullImage(ctx context.Context, ref string, authConfig *
 		// Send Error information to client through stream
 		message := jsonstream.JSONMessage{
 			Error: &jsonstream.JSONError{
-				Code:    http.StatusInternalServerError,
+				Code:    httputils.StatusCode(err),
 				Message: err.Error(),
 			},
 			ErrorMessage: err.Error(),
@@ -215,38 +702,103 @@ func (mgr *ImageManager) PullImage(ctx context.Context, ref string, authConfig *
 		closeStream()
 	}
 
-	fullRefs := mgr.LookupImageReferences(ref)
 	namedRef = reference.TrimTagForDigest(reference.WithDefaultTagIfMissing(namedRef))
 
+	// NOTE: the rate limit of registry, like the remaining pulls of Docker
+	// Hub, is told to the client to preempt the throttling.
+	ctx = ctrd.WithRateLimitNotifier(ctx, newRateLimitReporter(stream, opt.RateLimitNotifier).report)
+
 	resolver, availableRef, err := mgr.client.ResolveImage(ctx, namedRef.String(), fullRefs, authConfig, docker.ResolverOptions{})
+	mgr.mirrorHealth.observe(fullRefs, availableRef)
+	// NOTE: nothing is written into the stream before the image is
+	// resolved and verified, so that the error is returned as the status
+	// of response.
 	if err != nil {
-		return err
+		closeStream()
+		return classifyPullError(err)
 	}
-	logrus.Infof("pulling image name %v reference %v", namedRef.String(), availableRef)
 
-	img, err := mgr.client.FetchImage(pctx, resolver, availableRef, authConfig, stream)
+	// NOTE: the signature image is resolved by tag, which cannot be pinned
+	// by the content trust.
+	sigResolver := resolver
+	resolver, err = mgr.trustedResolverIfRequired(ctx, resolver, namedRef.String())
 	if err != nil {
-		writeStream(err)
+		closeStream()
 		return err
 	}
 
+	var verified bool
+	resolver, verified, err = mgr.verifySignatureIfRequired(ctx, resolver, sigResolver, namedRef.String(), availableRef)
+	if err != nil {
+		closeStream()
+		return classifyPullError(err)
+	}
+	if verified {
+		stream.WriteObject(jsonstream.JSONMessage{
+			ID:     availableRef,
+			Status: "Signature verified",
+		})
+	}
+
+	registry = mgr.registryOfReference(availableRef)
+	logrus.Infof("pulling image name %v reference %v", namedRef.String(), availableRef)
+
 	// before image unpack, call WithImageUnpack
 	ctx = ctrd.WithImageUnpack(ctx)
 
-	// unpack image
-	if err = img.Unpack(ctx, ctrd.CurrentSnapshotterName(ctx)); err != nil {
+	for attempt := 1; ; attempt++ {
+		img, err = mgr.fetchAndUnpackImage(ctx, pctx, resolver, availableRef, authConfig, stream)
+		if err == nil || attempt > mgr.pullRetryCount || !isRetryablePullError(err) {
+			break
+		}
+
+		delay := mgr.pullRetryBaseDelay << uint(attempt-1)
+		logrus.Warnf("failed to pull image %s, retry after %v: %v", availableRef, delay, err)
+		stream.WriteObject(jsonstream.JSONMessage{
+			ID:     availableRef,
+			Status: fmt.Sprintf("Retrying pull (attempt %d)", attempt+1),
+		})
+
+		select {
+		case <-time.After(delay):
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		break
+	}
+
+	if err == nil && mgr.verifyPulledContent {
+		if err = mgr.verifyPulledImage(ctx, img); err != nil {
+			if rerr := mgr.client.RemoveImage(ctx, img.Name()); rerr != nil {
+				logrus.Warnf("failed to remove corrupt image %s: %v", img.Name(), rerr)
+			}
+		}
+	}
+
+	if err != nil {
+		err = classifyPullError(err)
 		writeStream(err)
 		return err
 	}
 
+	// NOTE: the digest reference can be used to pin the image, which is
+	// also stored as searchable reference.
+	stream.WriteObject(jsonstream.JSONMessage{
+		ID:     reference.WithDigest(namedRef, img.Target().Digest).String(),
+		Status: fmt.Sprintf("Digest: %s", img.Target().Digest),
+	})
 	closeStream()
 
 	// NOTE: pull image with different snapshotter, refer #2574
 	// clean snapshotter key if has been set, not allow
-	// user set except through image plugin
-	ctx = ctrd.CleanSnapshotter(ctx)
+	// user set except through image plugin or the snapshotter
+	// allowed by pull-snapshotters
+	if opt.Snapshotter == "" {
+		ctx = ctrd.CleanSnapshotter(ctx)
+	}
 	// call plugin before pull image
-	if mgr.imagePlugin != nil {
+	if mgr.imagePlugin != nil && !opt.IndexOnly {
 		if err = mgr.imagePlugin.PostPull(ctx, ctrd.CurrentSnapshotterName(ctx), img); err != nil {
 			logrus.Errorf("failed to execute post pull plugin: %s", err)
 			return err
@@ -254,10 +806,134 @@ func (mgr *ImageManager) PullImage(ctx context.Context, ref string, authConfig *
 	}
 
 	mgr.LogImageEvent(ctx, img.Name(), namedRef.String(), "pull")
+	mgr.recordProvenance(ctx, ref, availableRef, img)
 
 	return mgr.StoreImageReference(ctx, img)
 }
 
+// validatePullSnapshotter checks the snapshotter chosen by the pull, which
+// should be the default one or allowed by pull-snapshotters.
+func (mgr *ImageManager) validatePullSnapshotter(snapshotter string) error {
+	if snapshotter == ctrd.CurrentSnapshotterName(context.TODO()) {
+		return nil
+	}
+
+	if !utils.StringInSlice(mgr.pullSnapshotters, snapshotter) {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "snapshotter %s is not allowed by pull-snapshotters", snapshotter)
+	}
+	return nil
+}
+
+// fetchAndUnpackImage fetches the image content and unpacks it into the
+// snapshotter. The progress of fetching and unpacking will be sent by the
+// stream.
+func (mgr *ImageManager) fetchAndUnpackImage(ctx, pctx context.Context, resolver remotes.Resolver, availableRef string, authConfig *types.AuthConfig, stream *jsonstream.JSONStream) (containerd.Image, error) {
+	img, err := mgr.fetchImageWithIdleTimeout(pctx, resolver, availableRef, authConfig, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: the index-only image keeps all the platforms without unpacking.
+	if ctrd.IsIndexOnly(ctx) {
+		return img, nil
+	}
+
+	// NOTE: the snapshots of local images are referenced as parents during
+	// the unpack, which cannot be removed until the unpack is done.
+	if diffIDs, err := img.RootFS(ctx); err == nil {
+		release := mgr.unpacking.add(diffIDs)
+		defer release()
+	}
+
+	// NOTE: the layers of lazy image are mounted by the remote snapshotter
+	// without extracting.
+	if ctrd.IsLazy(ctx) {
+		if err := mgr.client.UnpackLazily(ctx, img, availableRef, stream); err != nil {
+			return nil, err
+		}
+		return img, nil
+	}
+
+	if err := mgr.client.UnpackImage(ctx, img, ctrd.CurrentSnapshotterName(ctx), stream); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// verifyPulledImage re-verifies the digest of config and layers of the
+// pulled image against the manifest. All the blobs referenced by the index
+// are verified for the index-only image, except the skipped platforms.
+func (mgr *ImageManager) verifyPulledImage(ctx context.Context, img containerd.Image) error {
+	cs := img.ContentStore()
+	if ctrd.IsIndexOnlyImage(img) {
+		verifyHandler := func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+			return nil, verifyBlob(ctx, cs, desc)
+		}
+
+		handlers := ctrdmetaimages.Handlers(
+			ctrdmetaimages.HandlerFunc(verifyHandler),
+			ctrdmetaimages.FilterPlatforms(ctrdmetaimages.ChildrenHandler(cs), indexOnlyPlatforms(img)),
+		)
+		if err := ctrdmetaimages.Walk(ctx, handlers, img.Target()); err != nil {
+			return pkgerrors.Wrapf(err, "failed to verify pulled content of image %s", img.Name())
+		}
+		return nil
+	}
+
+	manifest, err := mgr.imageManifest(ctx, img)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the layers of lazy image are not in the content store.
+	blobs := []ocispec.Descriptor{manifest.Config}
+	if !ctrd.IsLazyImage(img) {
+		blobs = append(blobs, manifest.Layers...)
+	}
+	for _, desc := range blobs {
+		if err := verifyBlob(ctx, cs, desc); err != nil {
+			return pkgerrors.Wrapf(err, "failed to verify pulled content of image %s", img.Name())
+		}
+	}
+	return nil
+}
+
+// pullMaxImageSize returns the max image size of the pull, which is the
+// smaller one of the limitation in config and the request. Zero means no
+// limitation.
+func pullMaxImageSize(config, request int64) int64 {
+	if request > 0 && (config == 0 || request < config) {
+		return request
+	}
+	return config
+}
+
+// imageLayers returns the layer descriptors of the image for the platform used
+// to inspect it. It's only used to show the status so that the error is
+// ignored.
+func (mgr *ImageManager) imageLayers(ctx context.Context, img containerd.Image) []ocispec.Descriptor {
+	manifest, err := mgr.imageManifest(ctx, img)
+	if err != nil {
+		logrus.Debugf("failed to get manifest of image %s: %v", img.Name(), err)
+		return nil
+	}
+	return manifest.Layers
+}
+
+// writeLayersStatus sends the status of each layer, keyed by layer digest.
+func writeLayersStatus(stream *jsonstream.JSONStream, layers []ocispec.Descriptor, status string) {
+	for _, layer := range layers {
+		stream.WriteObject(jsonstream.JSONMessage{
+			ID:     layer.Digest.String(),
+			Status: status,
+			Detail: &jsonstream.ProgressDetail{
+				Current: layer.Size,
+				Total:   layer.Size,
+			},
+		})
+	}
+}
+
 // PushImage pushes image to specified registry.
 func (mgr *ImageManager) PushImage(ctx context.Context, name, tag string, authConfig *types.AuthConfig, out io.Writer) error {
 	ref, err := reference.Parse(name)
@@ -271,7 +947,37 @@ func (mgr *ImageManager) PushImage(ctx context.Context, name, tag string, authCo
 		ref = reference.WithTag(ref, tag)
 	}
 
-	return mgr.client.PushImage(ctx, ref.String(), authConfig, out)
+	img, err := mgr.client.GetImage(ctx, ref.String())
+	if err == nil {
+		if err := checkLocalLayers(img, "push"); err != nil {
+			return err
+		}
+	}
+
+	authConfig, err = mgr.resolveAuthConfig(ctx, ref.String(), authConfig)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the blobs shared with the sibling repositories on the same
+	// registry are mounted instead of uploaded.
+	ctx = ctrd.WithMountSources(ctx, mgr.mountSources(ctx, ref, img))
+
+	if err := mgr.client.PushImage(ctx, ref.String(), authConfig, out); err != nil {
+		return err
+	}
+
+	// NOTE: the image has been pushed even if it fails to be signed, which
+	// is told to the client, and the unsigned image is rejected by the pull
+	// with signature verification.
+	if err := mgr.signImageIfRequired(ctx, ref.String(), authConfig, out); err != nil {
+		return err
+	}
+
+	if id, _, _, err := mgr.CheckReference(ctx, ref.String()); err == nil {
+		mgr.LogImageEvent(ctx, id.String(), ref.String(), "push")
+	}
+	return nil
 }
 
 // GetImage returns imageInfo by reference.
@@ -281,6 +987,11 @@ func (mgr *ImageManager) GetImage(ctx context.Context, idOrRef string) (*types.I
 		return nil, err
 	}
 
+	// NOTE: the image may be removed after CheckReference, and then the
+	// containerdImageToImageInfo returns ErrNotfound.
+	unlock := mgr.imageLocks.rlock(id)
+	defer unlock()
+
 	imgInfo, err := mgr.containerdImageToImageInfo(ctx, id)
 	if err != nil {
 		return nil, err
@@ -288,57 +999,132 @@ func (mgr *ImageManager) GetImage(ctx context.Context, idOrRef string) (*types.I
 	return &imgInfo, nil
 }
 
+// HasImage returns true and the image ID if the image exists. Unlike GetImage,
+// it only searches the local store, which is cheap for the polling clients.
+func (mgr *ImageManager) HasImage(ctx context.Context, idOrRef string) (bool, digest.Digest, error) {
+	id, _, _, err := mgr.CheckReference(ctx, idOrRef)
+	if err != nil {
+		if errtypes.IsNotfound(err) {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	return true, id, nil
+}
+
 // ListImages lists images stored by containerd.
-func (mgr *ImageManager) ListImages(ctx context.Context, filter filters.Args) ([]types.ImageInfo, error) {
+//
+// The image without any primary reference, like the intermediate image of
+// build cache, is listed only if opt.All is true. It is shown as <none>:<none>
+// with empty RepoTags and RepoDigests.
+//
+// The images are in the order of local store unless opt.Sort is given.
+//
+// If opt.Limit or opt.Since is given, the images are sorted by ID, and at
+// most opt.Limit images after the cursor opt.Since are returned with the
+// cursor of next page. The cursor is empty if it's the last page.
+//
+// The image which fails to be converted is skipped, and opt.Warn is called
+// with it if given.
+func (mgr *ImageManager) ListImages(ctx context.Context, filter filters.Args, opt *ImageListOption) ([]types.ImageInfo, string, error) {
 	if err := filter.Validate(acceptedImageFilterTags); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	beforeImages := filter.Get("before")
-	sinceImages := filter.Get("since")
-	referenceFilter := filter.Get("reference")
+	if opt == nil {
+		opt = &ImageListOption{}
+	}
+
+	desc, err := validateImageListOrder(opt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	since, err := validateImageListPage(opt)
+	if err != nil {
+		return nil, "", err
+	}
+	paginated := opt.Limit > 0 || since != ""
+
+	beforeImages := filter.Get("before")
+	sinceImages := filter.Get("since")
+	referenceFilter := filter.Get("reference")
+
+	dangling, danglingFilter, err := getDanglingFilter(filter)
+	if err != nil {
+		return nil, "", err
+	}
 
 	// refuse undefined behavior
 	if len(beforeImages) > 1 {
-		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "can't use before filter more than one")
+		return nil, "", pkgerrors.Wrapf(errtypes.ErrInvalidParam, "can't use before filter more than one")
 	}
 	// refuse undefined behavior
 	if len(sinceImages) > 1 {
-		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "can't use since filter more than one")
+		return nil, "", pkgerrors.Wrapf(errtypes.ErrInvalidParam, "can't use since filter more than one")
 	}
 
 	ctrdImageInfos := mgr.localStore.ListCtrdImageInfo()
 	imgInfos := make([]types.ImageInfo, 0, len(ctrdImageInfos))
 
+	if opt.Sort == ImageListSortCreated {
+		sortImagesByCreated(ctrdImageInfos, desc)
+	}
+
+	if paginated {
+		sort.Slice(ctrdImageInfos, func(i, j int) bool {
+			return ctrdImageInfos[i].ID < ctrdImageInfos[j].ID
+		})
+	}
+
 	var (
 		beforeFilter, sinceFilter *types.ImageInfo
 		beforeTime, sinceTime     time.Time
-		err                       error
 	)
 
 	if len(beforeImages) > 0 {
 		beforeFilter, err = mgr.GetImage(ctx, beforeImages[0])
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		beforeTime, err = time.Parse(utils.TimeLayout, beforeFilter.CreatedAt)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
 	if len(sinceImages) > 0 {
 		sinceFilter, err = mgr.GetImage(ctx, sinceImages[0])
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		sinceTime, err = time.Parse(utils.TimeLayout, sinceFilter.CreatedAt)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
 	for _, img := range ctrdImageInfos {
+		// NOTE: one more image is collected to know whether there is
+		// next page.
+		if opt.Limit > 0 && len(imgInfos) > opt.Limit {
+			break
+		}
+
+		if since != "" && img.ID <= since {
+			continue
+		}
+
+		hidden := len(mgr.localStore.GetPrimaryReferences(img.ID)) == 0
+		if hidden && !opt.All {
+			continue
+		}
+
+		// NOTE: the index-only image without creation time cannot match
+		// the before or since filter.
+		if (beforeFilter != nil || sinceFilter != nil) && img.OCISpec.Created == nil {
+			continue
+		}
 		if beforeFilter != nil {
 			if img.OCISpec.Created.Equal(beforeTime) || img.OCISpec.Created.After(beforeTime) {
 				continue
@@ -350,192 +1136,748 @@ func (mgr *ImageManager) ListImages(ctx context.Context, filter filters.Args) ([
 			}
 		}
 
-		imgInfo, err := mgr.containerdImageToImageInfo(ctx, img.ID)
+		// label filter supports both label=key and label=key=value,
+		// and the image should match all the label filters.
+		if !filter.MatchKVList("label", imageLabels(img)) {
+			continue
+		}
+
+		imgInfo, err := mgr.containerdImageToImageInfo(ctx, img.ID)
+		if err != nil {
+			logrus.Warnf("failed to convert containerd image(%v) to ImageInfo during list images: %v", img.ID, err)
+			if opt.Warn != nil {
+				opt.Warn(img.ID, err)
+			}
+			continue
+		}
+
+		if hidden {
+			imgInfo.RepoTags, imgInfo.RepoDigests = []string{}, []string{}
+		}
+
+		if danglingFilter && dangling != (len(imgInfo.RepoTags) == 0) {
+			continue
+		}
+
+		if len(referenceFilter) == 0 {
+			imgInfos = append(imgInfos, imgInfo)
+			continue
+		}
+
+		// do reference filter
+		imgInfo.RepoDigests, err = filterReference(referenceFilter, imgInfo.RepoDigests)
+		if err != nil {
+			return []types.ImageInfo{}, "", err
+		}
+
+		imgInfo.RepoTags, err = filterReference(referenceFilter, imgInfo.RepoTags)
+		if err != nil {
+			return []types.ImageInfo{}, "", err
+		}
+
+		if len(imgInfo.RepoTags) > 0 || len(imgInfo.RepoDigests) > 0 {
+			imgInfos = append(imgInfos, imgInfo)
+		}
+
+	}
+
+	var next string
+	if opt.Limit > 0 && len(imgInfos) > opt.Limit {
+		imgInfos = imgInfos[:opt.Limit]
+		next = imgInfos[opt.Limit-1].ID
+	}
+	return imgInfos, next, nil
+}
+
+// RemoveImage deletes a reference.
+//
+// NOTE: if the reference is short ID or ID, should remove all the references.
+//
+// If opt.PruneDigest is true and the removed tag leaves only the digest
+// references with the same name, like busybox@sha256:..., they are removed
+// too so that the image fully disappears.
+func (mgr *ImageManager) RemoveImage(ctx context.Context, idOrRef string, opt *ImageRemoveOption) error {
+	if opt == nil {
+		opt = &ImageRemoveOption{}
+	}
+
+	id, namedRef, primaryRef, err := mgr.CheckReference(ctx, idOrRef)
+	if err != nil {
+		return err
+	}
+	return mgr.removeCheckedImage(ctx, idOrRef, id, namedRef, primaryRef, opt)
+}
+
+// PruneDigestRemovesImage returns true if removing the tag with PruneDigest
+// removes the image, since only the digest references with the same name
+// are left, which are pruned with the tag.
+func (mgr *ImageManager) PruneDigestRemovesImage(ctx context.Context, idOrRef string) (bool, error) {
+	id, namedRef, primaryRef, err := mgr.CheckReference(ctx, idOrRef)
+	if err != nil {
+		return false, err
+	}
+
+	namedRef = reference.TrimTagForDigest(namedRef)
+	if !reference.IsNameTagged(namedRef) {
+		return false, nil
+	}
+
+	// NOTE: the references attached to the primary reference are removed
+	// with it, like removeImage.
+	removed := map[string]struct{}{namedRef.String(): {}}
+	if primaryRef.String() == namedRef.String() {
+		for _, ref := range mgr.localStore.GetReferencesByPrimary(primaryRef) {
+			removed[ref.String()] = struct{}{}
+		}
+	}
+
+	var left []reference.Named
+	for _, ref := range mgr.localStore.GetReferences(id) {
+		if _, ok := removed[ref.String()]; !ok {
+			left = append(left, ref)
+		}
+	}
+	return len(orphanDigestReferences(left, namedRef)) > 0, nil
+}
+
+// removeCheckedImage removes the reference which has been checked by
+// CheckReference, and logs the untag and delete events.
+func (mgr *ImageManager) removeCheckedImage(ctx context.Context, idOrRef string, id digest.Digest, namedRef, primaryRef reference.Named, opt *ImageRemoveOption) error {
+	removeAll := reference.IsNamedOnly(namedRef) || strings.HasPrefix(id.String(), namedRef.String())
+	namedRef = reference.TrimTagForDigest(namedRef)
+
+	// NOTE: the labels of image are collected before holding the write
+	// lock because it inspects the image, and the image may be deleted.
+	attributes := mgr.imageEventAttributes(ctx, id.String())
+
+	refs, err := mgr.removeImage(ctx, idOrRef, id, namedRef, primaryRef, removeAll, opt)
+
+	// NOTE: the references may be removed partially if it fails.
+	mgr.logRemovalEvents(ctx, id, refs, attributes)
+	return err
+}
+
+// logRemovalEvents logs the untag event of each reference which has been
+// removed from refs, and the delete event if the image is gone, like dockerd.
+func (mgr *ImageManager) logRemovalEvents(ctx context.Context, id digest.Digest, refs []reference.Named, attributes map[string]string) {
+	left := map[string]struct{}{}
+	for _, ref := range mgr.localStore.GetReferences(id) {
+		left[ref.String()] = struct{}{}
+	}
+
+	var untagged []string
+	for _, ref := range refs {
+		if _, ok := left[ref.String()]; !ok {
+			untagged = append(untagged, ref.String())
+		}
+	}
+	sort.Strings(untagged)
+
+	for _, ref := range untagged {
+		untagAttributes := map[string]string{}
+		copyAttributes(untagAttributes, attributes)
+		mgr.LogImageEventWithAttributes(ctx, id.String(), ref, "untag", untagAttributes)
+	}
+
+	if len(untagged) > 0 && len(mgr.localStore.GetPrimaryReferences(id)) == 0 {
+		mgr.LogImageEventWithAttributes(ctx, id.String(), id.String(), "delete", attributes)
+	}
+}
+
+// removeImage removes the reference of the image while holding the write
+// lock of the image, and returns the references of the image before the
+// removal.
+func (mgr *ImageManager) removeImage(ctx context.Context, idOrRef string, id digest.Digest, namedRef, primaryRef reference.Named, removeAll bool, opt *ImageRemoveOption) ([]reference.Named, error) {
+	force := opt.Force
+
+	unlock := mgr.imageLocks.lock(id)
+	defer unlock()
+
+	refs := mgr.localStore.GetReferences(id)
+
+	// since there is no rollback functionality, no guarantee that the
+	// containerd.RemoveImage must success. so if the localStore has been
+	// remove all the primary references, we should clear the CtrdImageInfo
+	// cache.
+	defer func() {
+		if len(mgr.localStore.GetPrimaryReferences(id)) == 0 {
+			mgr.clearImageInfo(id)
+		}
+	}()
+
+	// should remove all the references if the reference is ID (Named Only)
+	// or Digest ID (Tagged Named)
+	if removeAll {
+		// NOTE: the user maybe use the following references to pull one image
+		//
+		//	busybox:1.25
+		//	busybox@sha256:29f5d56d12684887bdfa50dcd29fc31eea4aaf4ad3bec43daf19026a7ce69912
+		//
+		// There are referencing to the same image. They have the same
+		// locator though there are two primary references. For this
+		// case, we should remove two primary references without force
+		// option.
+		//
+		// However, if there is alias like localhost:5000/busybox:latest
+		// as searchable reference, we cannot remove the image because
+		// the searchable reference has different locator without force.
+		// It's different reference from locator aspect.
+		//
+		// If allow-implicit-multi-tag-remove is set, the references in
+		// the same registry, like localhost:5000/busybox:latest and
+		// localhost:5000/base:latest, are removable without force, but
+		// the alias in other registry still requires force.
+		unique := uniqueLocatorReference
+		if mgr.allowImplicitMultiTagRemove {
+			unique = uniqueRegistryReference
+		}
+		if !force && !unique(refs) {
+			return refs, fmt.Errorf("Unable to remove the image %q (must force) - image has serveral references", idOrRef)
+		}
+
+		if err := mgr.checkUnpackingLayers(id, idOrRef, force); err != nil {
+			return refs, err
+		}
+
+		return refs, mgr.removePrimaryReferences(ctx, id)
+	}
+
+	// remove the image if the nameRef is primary reference
+	if primaryRef.String() == namedRef.String() {
+		// the content of image is released if it's the last primary reference
+		if len(mgr.localStore.GetPrimaryReferences(id)) == 1 {
+			if err := mgr.checkUnpackingLayers(id, idOrRef, force); err != nil {
+				return refs, err
+			}
+		}
+
+		if err := mgr.localStore.RemoveReference(id, primaryRef); err != nil {
+			return refs, err
+		}
+
+		if err := mgr.client.RemoveImage(ctx, primaryRef.String()); err != nil {
+			return refs, err
+		}
+	} else if err := mgr.localStore.RemoveReference(id, namedRef); err != nil {
+		return refs, err
+	}
+
+	if opt.PruneDigest && reference.IsNameTagged(namedRef) {
+		return refs, mgr.pruneOrphanDigestReferences(ctx, id, namedRef, force)
+	}
+	return refs, nil
+}
+
+// pruneOrphanDigestReferences removes the digest references with the same
+// name as the removed tag if they are the only references left, like the
+// busybox@sha256:... pulled by digest before busybox:latest. It should be
+// called with the image lock held.
+func (mgr *ImageManager) pruneOrphanDigestReferences(ctx context.Context, id digest.Digest, tagRef reference.Named, force bool) error {
+	refs := orphanDigestReferences(mgr.localStore.GetReferences(id), tagRef)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	// NOTE: the tag has been removed, so that the image is kept instead of
+	// failing the removal if its layers are being unpacked.
+	if err := mgr.checkUnpackingLayers(id, tagRef.String(), force); err != nil {
+		logrus.Infof("keep the digest references of image %s: %v", id, err)
+		return nil
+	}
+
+	for _, ref := range refs {
+		pRef, err := mgr.localStore.GetPrimaryReference(ref)
+		if err != nil {
+			continue
+		}
+
+		if err := mgr.localStore.RemoveReference(id, ref); err != nil {
+			return err
+		}
+
+		if pRef.String() == ref.String() {
+			if err := mgr.client.RemoveImage(ctx, ref.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkUnpackingLayers returns the conflict error if the layer chain of the
+// image is being unpacked by the concurrent pull, unless force is set. It
+// should be called with the image lock held.
+//
+// NOTE: containerd keeps the layers shared by other images by reference
+// counting, but the pull being unpacked references the snapshots of image
+// before the pulled image is created.
+func (mgr *ImageManager) checkUnpackingLayers(id digest.Digest, idOrRef string, force bool) error {
+	if force {
+		return nil
+	}
+
+	info, err := mgr.localStore.GetCtrdImageInfo(id)
+	if err != nil {
+		return nil
+	}
+
+	if mgr.unpacking.shares(info.OCISpec.RootFS.DiffIDs) {
+		return pkgerrors.Wrapf(errtypes.ErrConflict, "unable to remove the image %q (must force) - its layers are being unpacked by pull", idOrRef)
+	}
+	return nil
+}
+
+// RemoveImages deletes a batch of images and returns the result of each one.
+// The failure of one image doesn't stop removing the others.
+//
+// Like the single removal, the image will be checked whether it's used by
+// container when there is only one primary reference or it's removed by ID.
+func (mgr *ImageManager) RemoveImages(ctx context.Context, idOrRefs []string, force bool, isUsed ImageUsedFunc) ([]types.ImageDeleteResponseItem, error) {
+	if len(idOrRefs) == 0 {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "no image to be removed")
+	}
+
+	res := make([]types.ImageDeleteResponseItem, 0, len(idOrRefs))
+	for _, idOrRef := range idOrRefs {
+		items, err := mgr.removeImageWithResult(ctx, idOrRef, force, isUsed)
+		if err != nil {
+			res = append(res, types.ImageDeleteResponseItem{
+				Error: fmt.Sprintf("failed to remove image %q: %v", idOrRef, err),
+			})
+			continue
+		}
+		res = append(res, items...)
+	}
+	return res, nil
+}
+
+// RemoveRepository deletes all the references whose repository matches the
+// given one, like RemoveImages.
+func (mgr *ImageManager) RemoveRepository(ctx context.Context, repo string, force bool, isUsed ImageUsedFunc) ([]types.ImageDeleteResponseItem, error) {
+	repoRef, err := reference.Parse(repo)
+	if err != nil {
+		return nil, pkgerrors.Wrap(errtypes.ErrInvalidParam, err.Error())
+	}
+
+	if !reference.IsNamedOnly(repoRef) {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "repository %s cannot contain tag or digest", repo)
+	}
+
+	names := map[string]struct{}{
+		repoRef.Name(): {},
+		addDefaultRegistryIfMissing(repoRef.Name(), mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces): {},
+	}
+
+	var refs []string
+	for _, ref := range mgr.localStore.ListAllReferences() {
+		if _, ok := names[ref.Name()]; ok {
+			refs = append(refs, ref.String())
+		}
+	}
+
+	if len(refs) == 0 {
+		return nil, pkgerrors.Wrapf(errtypes.ErrNotfound, "repository %s", repo)
+	}
+	sort.Strings(refs)
+
+	res := make([]types.ImageDeleteResponseItem, 0, len(refs))
+	for _, ref := range refs {
+		items, err := mgr.removeImageWithResult(ctx, ref, force, isUsed)
+		if err != nil {
+			// the reference maybe removed with the primary reference
+			if errtypes.IsNotfound(err) {
+				continue
+			}
+			res = append(res, types.ImageDeleteResponseItem{
+				Error: fmt.Sprintf("failed to remove image %q: %v", ref, err),
+			})
+			continue
+		}
+		res = append(res, items...)
+	}
+	return res, nil
+}
+
+// removeImageWithResult removes the image and returns the untagged references
+// and the deleted image ID.
+func (mgr *ImageManager) removeImageWithResult(ctx context.Context, idOrRef string, force bool, isUsed ImageUsedFunc) ([]types.ImageDeleteResponseItem, error) {
+	id, namedRef, primaryRef, err := mgr.CheckReference(ctx, idOrRef)
+	if err != nil {
+		return nil, err
+	}
+
+	isImageIDPrefix := strings.HasPrefix(id.String(), idOrRef) || strings.HasPrefix(id.Hex(), idOrRef)
+	if !force && isUsed != nil &&
+		(len(mgr.localStore.GetPrimaryReferences(id)) == 1 || isImageIDPrefix) {
+
+		used, err := isUsed(id)
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			return nil, fmt.Errorf("Unable to remove the image %q (must force) - image is being used by container", id)
+		}
+	}
+
+	before := mgr.localStore.GetReferences(id)
+	if err := mgr.removeCheckedImage(ctx, idOrRef, id, namedRef, primaryRef, &ImageRemoveOption{Force: force}); err != nil {
+		return nil, err
+	}
+
+	after := make(map[string]struct{})
+	for _, ref := range mgr.localStore.GetReferences(id) {
+		after[ref.String()] = struct{}{}
+	}
+
+	var items []types.ImageDeleteResponseItem
+	for _, ref := range before {
+		if _, ok := after[ref.String()]; !ok {
+			items = append(items, types.ImageDeleteResponseItem{Untagged: ref.String()})
+		}
+	}
+
+	if _, err := mgr.localStore.GetCtrdImageInfo(id); err == errCtrdImageInfoNotExist {
+		items = append(items, types.ImageDeleteResponseItem{Deleted: id.String()})
+	}
+	return items, nil
+}
+
+// AddTag adds the tag reference to the source image.
+//
+// NOTE(fuwei): AddTag hacks the containerd metadata boltdb, which we add the
+// reference into the containerd metadata boltdb with the existing image content.
+// It means that the "tag" is primary reference in the pouchd.
+//
+// For example,
+//	pouch tag A B
+//	pouch rmi A
+//
+// The B is still there.
+//
+// If force is true, the tag used by other image will be moved from that
+// image, which allows moving the tag like myapp:latest to new build. The tag
+// cannot be moved if it's the last reference of the image used by container,
+// which is checked by isUsed. Otherwise, ErrAlreadyExisted is returned if
+// the tag refers to other image.
+func (mgr *ImageManager) AddTag(ctx context.Context, sourceImage string, targetTag string, force bool, isUsed ImageUsedFunc) error {
+	tagRef, err := mgr.normalizeTagReference(targetTag)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := tagRef.(reference.Digested); ok {
+		return mgr.validateTagReference(tagRef)
+	}
+
+	ctrdImg, err := mgr.fetchContainerdImage(ctx, sourceImage)
+	if err != nil {
+		return err
+	}
+
+	id, err := mgr.imageID(ctx, ctrdImg)
+	if err != nil {
+		return err
+	}
+
+	if force {
+		moved, err := mgr.moveTagFromOtherImage(ctx, id, ctrdImg, tagRef, isUsed)
+		if err != nil || !moved {
+			return err
+		}
+	} else {
+		if err := mgr.checkTagCollision(ctx, id, ctrdImg, tagRef); err != nil {
+			return err
+		}
+		if err := mgr.validateTagReference(tagRef); err != nil {
+			return err
+		}
+
+		unlock := mgr.imageLocks.lock(id)
+		err := mgr.createReference(ctx, ctrdImg, tagRef)
+		unlock()
 		if err != nil {
-			logrus.Warnf("failed to convert containerd image(%v) to ImageInfo during list images: %v", img.ID, err)
-			continue
+			return err
 		}
+	}
 
-		if len(referenceFilter) == 0 {
-			imgInfos = append(imgInfos, imgInfo)
-			continue
-		}
+	mgr.LogImageEvent(ctx, id.String(), tagRef.String(), "tag")
+	return nil
+}
 
-		// do reference filter
-		imgInfo.RepoDigests, err = filterReference(referenceFilter, imgInfo.RepoDigests)
-		if err != nil {
-			return []types.ImageInfo{}, err
-		}
+// AddTags adds all the tag references to the source image. All the tags are
+// validated before creating any of them, and the created tags will be
+// removed if one of them fails.
+func (mgr *ImageManager) AddTags(ctx context.Context, sourceImage string, targetTags []string) error {
+	if len(targetTags) == 0 {
+		return pkgerrors.Wrap(errtypes.ErrInvalidParam, "no tag to be added")
+	}
 
-		imgInfo.RepoTags, err = filterReference(referenceFilter, imgInfo.RepoTags)
+	var (
+		tagRefs []reference.Named
+		seen    = make(map[string]struct{})
+	)
+	for _, targetTag := range targetTags {
+		tagRef, err := mgr.normalizeTagReference(targetTag)
 		if err != nil {
-			return []types.ImageInfo{}, err
+			return err
 		}
 
-		if len(imgInfo.RepoTags) > 0 || len(imgInfo.RepoDigests) > 0 {
-			imgInfos = append(imgInfos, imgInfo)
+		if _, ok := tagRef.(reference.Digested); ok {
+			return mgr.validateTagReference(tagRef)
 		}
 
-	}
-	return imgInfos, nil
-}
-
-// SearchImages searches imaged from specified registry.
-func (mgr *ImageManager) SearchImages(ctx context.Context, name, registry string, auth *types.AuthConfig) ([]types.SearchResultItem, error) {
-	// Directly send API calls towards specified registry
-	if len(registry) == 0 {
-		registry = "https://" + mgr.DefaultRegistry + "/v1/"
+		if _, ok := seen[tagRef.String()]; ok {
+			continue
+		}
+		seen[tagRef.String()] = struct{}{}
+		tagRefs = append(tagRefs, tagRef)
 	}
 
-	u := registry + "search?q=" + url.QueryEscape(name)
-	req, err := http.NewRequest("GET", u, nil)
+	ctrdImg, err := mgr.fetchContainerdImage(ctx, sourceImage)
 	if err != nil {
-		return nil, err
-	}
-
-	if auth != nil && auth.Username != "" && auth.Password != "" {
-		req.SetBasicAuth(auth.Username, auth.Password)
+		return err
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	id, err := mgr.imageID(ctx, ctrdImg)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("unexepected status code %d", res.StatusCode)
+	for _, tagRef := range tagRefs {
+		if err := mgr.checkTagCollision(ctx, id, ctrdImg, tagRef); err != nil {
+			return err
+		}
+		if err := mgr.validateTagReference(tagRef); err != nil {
+			return err
+		}
 	}
 
-	rawData, err := ioutil.ReadAll(res.Body)
+	created, err := mgr.createReferences(ctx, id, ctrdImg, tagRefs)
 	if err != nil {
-		return nil, err
+		// NOTE: the created tags are removed after releasing the lock,
+		// since the removal holds it.
+		for _, ref := range created {
+			if err := mgr.RemoveImage(ctx, ref.String(), nil); err != nil {
+				logrus.Warnf("failed to rollback reference %s: %v", ref, err)
+			}
+		}
+		return err
 	}
 
-	var searchResultResp searchtypes.SearchResultResp
-	var result []types.SearchResultItem
-	err = json.Unmarshal(rawData, &searchResultResp)
-	if err != nil {
-		return nil, err
+	for _, tagRef := range created {
+		mgr.LogImageEvent(ctx, id.String(), tagRef.String(), "tag")
 	}
+	return nil
+}
+
+// createReferences creates the tag references for the image while holding
+// the write lock of the image, and returns the created ones. The tag which
+// has referred to the image is skipped, so that it's neither rolled back nor
+// reported as created. The reference failed to be created is removed from
+// local store.
+func (mgr *ImageManager) createReferences(ctx context.Context, id digest.Digest, ctrdImg containerd.Image, tagRefs []reference.Named) ([]reference.Named, error) {
+	unlock := mgr.imageLocks.lock(id)
+	defer unlock()
+
+	var created []reference.Named
+	for _, tagRef := range tagRefs {
+		existingID, _, _, err := mgr.CheckReference(ctx, tagRef.String())
+		if err == nil {
+			if existingID != id {
+				return created, pkgerrors.Wrapf(errtypes.ErrAlreadyExisted, "tag %s refers to image %s, use force to move it to image %s", tagRef, existingID, id)
+			}
+			continue
+		}
+		if !errtypes.IsNotfound(err) {
+			return created, err
+		}
 
-	// TODO: sort results by count num
-	for _, searchResultItem := range searchResultResp.Results {
-		result = append(result, *searchResultItem)
+		if err := mgr.createReference(ctx, ctrdImg, tagRef); err != nil {
+			// NOTE: createReference adds the reference into local store
+			// before containerd meta db.
+			if err := mgr.localStore.RemoveReference(id, tagRef); err != nil {
+				logrus.Warnf("failed to rollback reference %s in local store: %v", tagRef, err)
+			}
+			return created, err
+		}
+		created = append(created, tagRef)
 	}
-	return result, err
+	return created, nil
 }
 
-// RemoveImage deletes a reference.
+// checkTagCollision returns ErrAlreadyExisted if the tag refers to the image
+// other than id, which should be moved by force instead of being overridden
+// silently.
 //
-// NOTE: if the reference is short ID or ID, should remove all the references.
-func (mgr *ImageManager) RemoveImage(ctx context.Context, idOrRef string, force bool) error {
-	id, namedRef, primaryRef, err := mgr.CheckReference(ctx, idOrRef)
+// NOTE: the tag may only exist in containerd, like the image failed to be
+// loaded at bootup, and creating it again makes local store inconsistent
+// with containerd.
+func (mgr *ImageManager) checkTagCollision(ctx context.Context, id digest.Digest, ctrdImg containerd.Image, tagRef reference.Named) error {
+	existingID, _, _, err := mgr.CheckReference(ctx, tagRef.String())
+	if err == nil {
+		if existingID != id {
+			return pkgerrors.Wrapf(errtypes.ErrAlreadyExisted, "tag %s refers to image %s, use force to move it to image %s", tagRef, existingID, id)
+		}
+		return nil
+	}
+	if !errtypes.IsNotfound(err) {
+		return err
+	}
+
+	existingImg, err := mgr.client.GetImage(ctx, tagRef.String())
 	if err != nil {
+		if errtypes.IsNotfound(err) {
+			return nil
+		}
 		return err
 	}
+	if existingImg.Target().Digest != ctrdImg.Target().Digest {
+		return pkgerrors.Wrapf(errtypes.ErrAlreadyExisted, "tag %s refers to the unloaded image with target %s, use force to move it to image %s", tagRef, existingImg.Target().Digest, id)
+	}
+	return pkgerrors.Wrapf(errtypes.ErrAlreadyExisted, "tag %s exists in containerd but isn't loaded, use force to recreate it", tagRef)
+}
 
-	// since there is no rollback functionality, no guarantee that the
-	// containerd.RemoveImage must success. so if the localStore has been
-	// remove all the primary references, we should clear the CtrdImageInfo
-	// cache.
-	defer func() {
-		if len(mgr.localStore.GetPrimaryReferences(id)) == 0 {
-			mgr.localStore.ClearCtrdImageInfo(id)
+// moveTagFromOtherImage moves the tag reference used by the image other than
+// id to ctrdImg. The tag is pointed to ctrdImg before it's untagged from the
+// other image, so that the tag is never missing, and the other image is never
+// removed if the tag is its last reference and it's used by container. It
+// returns false if the tag has been used by id.
+//
+// The tag which only exists in containerd is moved too.
+func (mgr *ImageManager) moveTagFromOtherImage(ctx context.Context, id digest.Digest, ctrdImg containerd.Image, tagRef reference.Named, isUsed ImageUsedFunc) (bool, error) {
+	existingID, _, primaryRef, err := mgr.CheckReference(ctx, tagRef.String())
+	if err != nil {
+		if !errtypes.IsNotfound(err) {
+			return false, err
 		}
-	}()
 
-	// should remove all the references if the reference is ID (Named Only)
-	// or Digest ID (Tagged Named)
-	if reference.IsNamedOnly(namedRef) ||
-		strings.HasPrefix(id.String(), namedRef.String()) {
+		unlock := mgr.imageLocks.lock(id)
+		defer unlock()
 
-		// NOTE: the user maybe use the following references to pull one image
-		//
-		//	busybox:1.25
-		//	busybox@sha256:29f5d56d12684887bdfa50dcd29fc31eea4aaf4ad3bec43daf19026a7ce69912
-		//
-		// There are referencing to the same image. They have the same
-		// locator though there are two primary references. For this
-		// case, we should remove two primary references without force
-		// option.
-		//
-		// However, if there is alias like localhost:5000/busybox:latest
-		// as searchable reference, we cannot remove the image because
-		// the searchable reference has different locator without force.
-		// It's different reference from locator aspect.
-		if !force && !uniqueLocatorReference(mgr.localStore.GetReferences(id)) {
-			return fmt.Errorf("Unable to remove the image %q (must force) - image has serveral references", idOrRef)
+		if _, err := mgr.client.GetImage(ctx, tagRef.String()); err != nil {
+			if !errtypes.IsNotfound(err) {
+				return false, err
+			}
+			return true, mgr.createReference(ctx, ctrdImg, tagRef)
 		}
+		return true, mgr.replaceReference(ctx, id, ctrdImg, tagRef)
+	}
 
-		for _, ref := range mgr.localStore.GetPrimaryReferences(id) {
-			if err := mgr.client.RemoveImage(ctx, ref.String()); err != nil {
-				return err
-			}
+	if existingID == id {
+		return false, nil
+	}
 
-			if err := mgr.localStore.RemoveReference(id, ref); err != nil {
-				return err
+	action, err := mgr.moveTag(ctx, id, existingID, ctrdImg, tagRef, primaryRef, isUsed)
+	if err != nil {
+		return false, err
+	}
+	mgr.LogImageEvent(ctx, existingID.String(), tagRef.String(), action)
+	return true, nil
+}
+
+// moveTag moves the tag from the existing image to ctrdImg while holding the
+// write locks of both images, and returns the action of event for the
+// existing image.
+func (mgr *ImageManager) moveTag(ctx context.Context, id, existingID digest.Digest, ctrdImg containerd.Image, tagRef, primaryRef reference.Named, isUsed ImageUsedFunc) (string, error) {
+	unlock := mgr.imageLocks.lockAll(id, existingID)
+	defer unlock()
+
+	// the searchable reference only exists in local store, which is taken
+	// from the existing image by createReference.
+	if primaryRef.String() != tagRef.String() {
+		if err := mgr.createReference(ctx, ctrdImg, tagRef); err != nil {
+			if err := mgr.localStore.AddReference(existingID, primaryRef, tagRef); err != nil {
+				logrus.Warnf("failed to rollback reference %s in local store: %v", tagRef, err)
 			}
+			return "", err
 		}
-		return nil
+		return "untag", nil
 	}
 
-	namedRef = reference.TrimTagForDigest(namedRef)
-	// remove the image if the nameRef is primary reference
-	if primaryRef.String() == namedRef.String() {
-		if err := mgr.localStore.RemoveReference(id, primaryRef); err != nil {
-			return err
+	if len(mgr.localStore.GetPrimaryReferences(existingID)) == 1 && isUsed != nil {
+		used, err := isUsed(existingID)
+		if err != nil {
+			return "", err
 		}
+		if used {
+			return "", pkgerrors.Wrapf(errtypes.ErrInUse, "unable to move tag %s, since it's the last reference of image %s used by container", tagRef, existingID)
+		}
+	}
 
-		return mgr.client.RemoveImage(ctx, primaryRef.String())
+	// NOTE: the references attached to the tag, like Name@Digest, belong
+	// to the existing image, which are removed with the tag.
+	aliases := mgr.localStore.GetReferencesByPrimary(tagRef)
+	if err := mgr.localStore.RemoveReference(existingID, tagRef); err != nil {
+		return "", err
 	}
 
-	// untag event
-	mgr.LogImageEvent(ctx, namedRef.String(), namedRef.String(), "untag")
-	return mgr.localStore.RemoveReference(id, namedRef)
-}
+	if err := mgr.replaceReference(ctx, id, ctrdImg, tagRef); err != nil {
+		for _, ref := range append([]reference.Named{tagRef}, aliases...) {
+			if err := mgr.localStore.AddReference(existingID, tagRef, ref); err != nil {
+				logrus.Warnf("failed to rollback reference %s in local store: %v", ref, err)
+			}
+		}
+		return "", err
+	}
 
-// AddTag adds the tag reference to the source image.
-//
-// NOTE(fuwei): AddTag hacks the containerd metadata boltdb, which we add the
-// reference into the containerd metadata boltdb with the existing image content.
-// It means that the "tag" is primary reference in the pouchd.
-//
-// For example,
-//	pouch tag A B
-//	pouch rmi A
-//
-// The B is still there.
-func (mgr *ImageManager) AddTag(ctx context.Context, sourceImage string, targetTag string) error {
-	targetTag = addDefaultRegistryIfMissing(targetTag, mgr.DefaultRegistry, mgr.DefaultNamespace)
+	if len(mgr.localStore.GetPrimaryReferences(existingID)) == 0 {
+		mgr.clearImageInfo(existingID)
+		return "delete", nil
+	}
+	return "untag", nil
+}
 
-	tagRef, err := parseTagReference(targetTag)
+// replaceReference points the existing reference in containerd meta db to
+// ctrdImg in place, and adds it into local store for id. The reference in
+// containerd meta db is restored if local store fails. It should be called
+// with the write lock of id held.
+func (mgr *ImageManager) replaceReference(ctx context.Context, id digest.Digest, ctrdImg containerd.Image, ref reference.Named) error {
+	old, err := mgr.client.GetImage(ctx, ref.String())
 	if err != nil {
 		return err
 	}
 
-	if err := mgr.validateTagReference(tagRef); err != nil {
+	if _, err := mgr.client.UpdateImage(ctx, ctrdmetaimages.Image{
+		Name:   ref.String(),
+		Target: ctrdImg.Target(),
+		Labels: ctrdImg.Labels(),
+	}, "target", "labels"); err != nil {
 		return err
 	}
 
-	ctrdImg, err := mgr.fetchContainerdImage(ctx, sourceImage)
-	if err != nil {
+	if err := mgr.addReferenceIntoStore(id, ref, ctrdImg.Target().Digest); err != nil {
+		if _, rerr := mgr.client.UpdateImage(ctx, ctrdmetaimages.Image{
+			Name:   ref.String(),
+			Target: old.Target(),
+			Labels: old.Labels(),
+		}, "target", "labels"); rerr != nil {
+			logrus.Warnf("failed to rollback reference %s in containerd: %v", ref, rerr)
+		}
 		return err
 	}
+	return nil
+}
 
+// createReference adds the reference for the containerd image into both
+// local store and containerd meta db. It should be called with the write
+// lock of the image held.
+func (mgr *ImageManager) createReference(ctx context.Context, ctrdImg containerd.Image, ref reference.Named) error {
 	// add the reference into memory
-	cfg, err := ctrdImg.Config(ctx)
+	id, err := mgr.imageID(ctx, ctrdImg)
 	if err != nil {
 		return err
 	}
-	if err := mgr.addReferenceIntoStore(cfg.Digest, tagRef, ctrdImg.Target().Digest); err != nil {
+	if err := mgr.addReferenceIntoStore(id, ref, ctrdImg.Target().Digest); err != nil {
 		return err
 	}
 
 	// add the reference into containerd meta db
+	//
+	// NOTE: the labels like index-only should be kept for the new reference.
 	_, err = mgr.client.CreateImageReference(ctx, ctrdmetaimages.Image{
-		Name:   tagRef.String(),
+		Name:   ref.String(),
 		Target: ctrdImg.Target(),
+		Labels: ctrdImg.Labels(),
 	})
 	return err
 }
@@ -547,22 +1889,22 @@ func (mgr *ImageManager) ImageHistory(ctx context.Context, idOrRef string) ([]ty
 		return nil, err
 	}
 
-	desc, err := img.Config(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	ociImage, err := containerdImageToOciImage(ctx, img)
+	desc, ociImage, err := mgr.imageOciImage(ctx, img)
 	if err != nil {
 		return nil, err
 	}
 
 	cs := img.ContentStore()
-	manifest, err := mgr.getManifest(ctx, cs, img, platforms.Default())
+	manifest, err := mgr.imageManifest(ctx, img)
 	if err != nil {
 		return nil, err
 	}
 
+	// parentImages is used to resolve the ID of the lower layers, which is
+	// the image in the local store that has the same layers and history.
+	parentImages := indexImagesByHistory(mgr.localStore.ListCtrdImageInfo())
+	diffIDs := ociImage.RootFS.DiffIDs
+
 	ociImageHistory := ociImage.History
 	lenOciImageHistory := len(ociImageHistory)
 	history := make([]types.HistoryResultItem, lenOciImageHistory)
@@ -580,10 +1922,16 @@ func (mgr *ImageManager) ImageHistory(ctx context.Context, idOrRef string) ([]ty
 			Size:       0,
 		}
 
-		// TODO: here we just set imageID of top image layer, we do nothing with the lower image ID, after pouch
-		// enables build/commit functionality, we should get local lower image(parent image) layer ID.
 		if i == 0 {
 			history[i].ID = desc.Digest.String()
+		} else if j+1 <= len(diffIDs) {
+			key := imageHistoryKey{
+				chainID:    identity.ChainID(diffIDs[:j+1]),
+				historyLen: lenOciImageHistory - i,
+			}
+			if id, ok := parentImages[key]; ok {
+				history[i].ID = id.String()
+			}
 		}
 
 		// Note: number of manifest layers should be less than ociImage History messages due to the existence of empty layers.
@@ -592,11 +1940,16 @@ func (mgr *ImageManager) ImageHistory(ctx context.Context, idOrRef string) ([]ty
 			if j < 0 {
 				return nil, errors.New("number of manifest layers shouldn't be less than number of non-empty layer in history info")
 			}
-			info, err := cs.Info(ctx, manifest.Layers[j].Digest)
-			if err != nil {
-				return nil, err
+			// NOTE: the layers of lazy image are not in the content
+			// store, and the size is from the manifest.
+			history[i].Size = manifest.Layers[j].Size
+			if !ctrd.IsLazyImage(img) {
+				info, err := cs.Info(ctx, manifest.Layers[j].Digest)
+				if err != nil {
+					return nil, err
+				}
+				history[i].Size = info.Size
 			}
-			history[i].Size = info.Size
 			j--
 		}
 	}
@@ -624,7 +1977,7 @@ func (mgr *ImageManager) CheckReference(ctx context.Context, idOrRef string) (ac
 			return
 		}
 
-		newIDOrRef := addDefaultRegistryIfMissing(idOrRef, mgr.DefaultRegistry, mgr.DefaultNamespace)
+		newIDOrRef := addDefaultRegistryIfMissing(idOrRef, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces)
 		if newIDOrRef == idOrRef {
 			return
 		}
@@ -666,8 +2019,26 @@ func (mgr *ImageManager) ListReferences(ctx context.Context, imageID digest.Dige
 	return mgr.localStore.GetPrimaryReferences(imageID), nil
 }
 
+// ListAllReferences returns all the searchable references of image sorted by
+// name, which includes the primary references and the aliases added with
+// them, like Name@Digest.
+func (mgr *ImageManager) ListAllReferences(ctx context.Context, imageID digest.Digest) ([]reference.Named, error) {
+	refs := mgr.localStore.GetReferences(imageID)
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+	return refs, nil
+}
+
 // GetOCIImageConfig returns the image config of OCI
+//
+// The config cached after pull is returned if any, so that the container
+// creation doesn't read the config from containerd again.
 func (mgr *ImageManager) GetOCIImageConfig(ctx context.Context, image string) (ocispec.ImageConfig, error) {
+	if info, ok := mgr.cachedImageInfo(ctx, image); ok {
+		return info.OCISpec.Config, nil
+	}
+
 	img, err := mgr.client.GetImage(ctx, image)
 	if err != nil {
 		return ocispec.ImageConfig{}, err
@@ -679,58 +2050,324 @@ func (mgr *ImageManager) GetOCIImageConfig(ctx context.Context, image string) (o
 	return ociImage.Config, nil
 }
 
+// GetImageChainID returns the chain ID of the image's rootfs cached after
+// pull, which is the parent of the snapshot prepared for the container.
+func (mgr *ImageManager) GetImageChainID(ctx context.Context, idOrRef string) (digest.Digest, error) {
+	info, ok := mgr.cachedImageInfo(ctx, idOrRef)
+	if !ok {
+		return "", pkgerrors.Wrapf(errtypes.ErrNotfound, "chain ID of image %s", idOrRef)
+	}
+	return info.ChainID, nil
+}
+
+// cachedImageInfo returns the cached information of image which can be
+// used in place of containerd's. The image inspected with the fallback
+// platform is excluded since containerd reads the default platform.
+func (mgr *ImageManager) cachedImageInfo(ctx context.Context, idOrRef string) (CtrdImageInfo, bool) {
+	id, _, _, err := mgr.CheckReference(ctx, idOrRef)
+	if err != nil {
+		return CtrdImageInfo{}, false
+	}
+
+	info, err := mgr.localStore.GetCtrdImageInfo(id)
+	if err != nil || info.IndexOnly || info.PlatformMismatch || info.ChainID == "" {
+		return CtrdImageInfo{}, false
+	}
+	return info, true
+}
+
+// GetImageConfig returns the complete OCI image config, which contains the
+// execution parameters like GetOCIImageConfig and the platform, rootfs and
+// history of the image.
+func (mgr *ImageManager) GetImageConfig(ctx context.Context, idOrRef string) (ocispec.Image, error) {
+	img, err := mgr.fetchContainerdImage(ctx, idOrRef)
+	if err != nil {
+		return ocispec.Image{}, err
+	}
+
+	_, ociImage, err := mgr.imageOciImage(ctx, img)
+	return ociImage, err
+}
+
 // updateLocalStore updates the local store.
 func (mgr *ImageManager) updateLocalStore() error {
-	ctx, cancel := context.WithTimeout(context.Background(), deadlineLoadImagesAtBootup)
+	timeout := mgr.bootupTimeout
+	if timeout <= 0 {
+		timeout = deadlineLoadImagesAtBootup
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	imgs, err := mgr.client.ListImages(ctx)
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return pkgerrors.Wrapf(err, "failed to list images within image-load-timeout %s", timeout)
+		}
 		return err
 	}
 
-	for _, img := range imgs {
-		if err := mgr.StoreImageReference(ctx, img); err != nil {
-			logrus.Warnf("failed to load the image reference into local store: %v", err)
+	// NOTE: the images are inspected concurrently, but the references are
+	// stored in the order of images so that the result is the same as the
+	// serial loading, like which primary reference the digest reference
+	// belongs to.
+	var (
+		records  = make([]*imageRecord, len(imgs))
+		failures = make([]error, len(imgs))
+		jobs     = make(chan int)
+		wg       sync.WaitGroup
+	)
+
+	workers := mgr.bootupWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				// NOTE: the rest of images are skipped quietly
+				// after the deadline, which is reported once.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				record, err := mgr.inspectImageRecord(ctx, imgs[idx])
+				if err != nil {
+					if ctx.Err() == nil {
+						failures[idx] = err
+					}
+					continue
+				}
+				records[idx] = record
+			}
+		}()
+	}
+
+	for idx := range imgs {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	loaded := 0
+	for idx, record := range records {
+		if failures[idx] != nil {
+			mgr.reportCorruptImage(ctx, imgs[idx], failures[idx])
+			continue
+		}
+		if record == nil {
+			continue
+		}
+
+		if err := mgr.storeImageRecord(record); err != nil {
+			mgr.reportCorruptImage(ctx, imgs[idx], err)
+			continue
 		}
+		loaded++
+	}
+
+	if ctx.Err() == context.DeadlineExceeded && loaded < len(imgs) {
+		logrus.Errorf("loading images at bootup exceeded the deadline %s: only %d of %d images loaded, consider increasing image-load-timeout", timeout, loaded, len(imgs))
 	}
 	return nil
 }
 
+// imageRecord is the information of containerd image to be stored into the
+// local store.
+type imageRecord struct {
+	ref    reference.Named
+	target digest.Digest
+	info   CtrdImageInfo
+}
+
 // StoreImageReference updates image reference in memory store.
 func (mgr *ImageManager) StoreImageReference(ctx context.Context, img containerd.Image) error {
-	imgCfg, err := img.Config(ctx)
+	record, err := mgr.inspectImageRecord(ctx, img)
 	if err != nil {
 		return err
 	}
+	return mgr.storeImageRecord(record)
+}
 
+// inspectImageRecord reads the config and size of the image from the cache or
+// containerd, which doesn't touch the local store.
+func (mgr *ImageManager) inspectImageRecord(ctx context.Context, img containerd.Image) (*imageRecord, error) {
 	namedRef, err := reference.Parse(img.Name())
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	key := imageInfoCacheKey{
+		target:    img.Target().Digest,
+		indexOnly: ctrd.IsIndexOnlyImage(img),
 	}
 
-	size, err := img.Size(ctx)
+	info, ok := mgr.infoCache.get(key)
+	if !ok {
+		if key.indexOnly {
+			info, err = mgr.inspectIndexOnlyImage(ctx, img)
+		} else {
+			info, err = mgr.inspectImage(ctx, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mgr.infoCache.put(key, info)
+	}
+
+	// NOTE: the labels are kept out of infoCache because they belong to
+	// the containerd image instead of the target.
+	info.Labels = userImageLabels(img.Labels())
+
+	return &imageRecord{
+		ref:    namedRef,
+		target: key.target,
+		info:   info,
+	}, nil
+}
+
+// inspectImage reads the config and size of the image for the default
+// platform, or the fallback one if the image doesn't support it.
+func (mgr *ImageManager) inspectImage(ctx context.Context, img containerd.Image) (CtrdImageInfo, error) {
+	imgCfg, matcher, platformMismatch, err := mgr.imageConfig(ctx, img)
 	if err != nil {
-		return err
+		return CtrdImageInfo{}, err
 	}
 
-	ociImage, err := containerdImageToOciImage(ctx, img)
+	// NOTE: the size is summed by the descriptors, which doesn't require
+	// the layers in the content store, like the lazy image.
+	size, err := (&ctrdmetaimages.Image{Target: img.Target()}).Size(ctx, img.ContentStore(), matcher)
 	if err != nil {
-		return err
+		return CtrdImageInfo{}, err
+	}
+
+	ociImage, err := readOciImage(ctx, img.ContentStore(), imgCfg)
+	if err != nil {
+		return CtrdImageInfo{}, err
 	}
 
-	if err := mgr.addReferenceIntoStore(imgCfg.Digest, namedRef, img.Target().Digest); err != nil {
+	platform, err := indexPlatform(ctx, img.ContentStore(), img.Target(), matcher)
+	if err != nil {
+		return CtrdImageInfo{}, err
+	}
+
+	return CtrdImageInfo{
+		ID:               imgCfg.Digest,
+		Size:             size,
+		OCISpec:          ociImage,
+		PlatformMismatch: platformMismatch,
+		ChainID:          identity.ChainID(ociImage.RootFS.DiffIDs),
+		MediaType:        img.Target().MediaType,
+		TargetDigest:     img.Target().Digest,
+		Platform:         platform,
+	}, nil
+}
+
+// inspectIndexOnlyImage reads the index-only image, whose ID is the digest
+// of index and size is the total size of all the platforms.
+func (mgr *ImageManager) inspectIndexOnlyImage(ctx context.Context, img containerd.Image) (CtrdImageInfo, error) {
+	size, err := (&ctrdmetaimages.Image{Target: img.Target()}).Size(ctx, img.ContentStore(), indexOnlyPlatforms(img))
+	if err != nil {
+		return CtrdImageInfo{}, err
+	}
+
+	return CtrdImageInfo{
+		ID:           img.Target().Digest,
+		Size:         size,
+		IndexOnly:    true,
+		MediaType:    img.Target().MediaType,
+		TargetDigest: img.Target().Digest,
+	}, nil
+}
+
+// storeImageRecord adds the reference and caches the image information
+// while holding the write lock of the image.
+func (mgr *ImageManager) storeImageRecord(record *imageRecord) error {
+	unlock := mgr.imageLocks.lock(record.info.ID)
+	defer unlock()
+
+	if err := mgr.addReferenceIntoStore(record.info.ID, record.ref, record.target); err != nil {
 		return err
 	}
 
-	mgr.localStore.CacheCtrdImageInfo(imgCfg.Digest, CtrdImageInfo{
-		ID:      imgCfg.Digest,
-		Size:    size,
-		OCISpec: ociImage,
-	})
+	// NOTE: the labels are merged with the other references of the image,
+	// since the reference created before setting labels has none of them.
+	if cached, err := mgr.localStore.GetCtrdImageInfo(record.info.ID); err == nil {
+		record.info.Labels = mergeImageLabels(cached.Labels, record.info.Labels)
+	}
+
+	mgr.localStore.CacheCtrdImageInfo(record.info.ID, record.info)
+	mgr.corruptImages.remove(record.ref.String())
 	return nil
 }
 
+// imageID returns the ID of image, which is the digest of config for the
+// default platform, or the digest of index for the index-only image.
+func (mgr *ImageManager) imageID(ctx context.Context, img containerd.Image) (digest.Digest, error) {
+	if ctrd.IsIndexOnlyImage(img) {
+		return img.Target().Digest, nil
+	}
+
+	cfg, _, _, err := mgr.imageConfig(ctx, img)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Digest, nil
+}
+
+// imageConfig returns the config descriptor of the image for the default
+// platform, and the platform matcher used to read the image.
+//
+// If the image doesn't support the default platform, like amd64-only image
+// on arm64 host, the config for the fallback platform will be returned with
+// platformMismatch true so that the image still can be inspected.
+func (mgr *ImageManager) imageConfig(ctx context.Context, img containerd.Image) (cfg ocispec.Descriptor, matcher platforms.MatchComparer, platformMismatch bool, err error) {
+	cfg, err = img.Config(ctx)
+	if err == nil {
+		return cfg, platforms.Default(), false, nil
+	}
+
+	if mgr.platformFallback == nil || !errdefs.IsNotFound(err) {
+		return ocispec.Descriptor{}, nil, false, err
+	}
+
+	cfg, fallbackErr := ctrdmetaimages.Config(ctx, img.ContentStore(), img.Target(), mgr.platformFallback)
+	if fallbackErr != nil {
+		return ocispec.Descriptor{}, nil, false, err
+	}
+
+	logrus.Warnf("image %s doesn't match the default platform, use the fallback platform for inspection", img.Name())
+	return cfg, mgr.platformFallback, true, nil
+}
+
+// imageManifest returns the manifest of the image for the platform used to
+// inspect it, see imageConfig.
+func (mgr *ImageManager) imageManifest(ctx context.Context, img containerd.Image) (ocispec.Manifest, error) {
+	_, matcher, _, err := mgr.imageConfig(ctx, img)
+	if err != nil {
+		return ocispec.Manifest{}, err
+	}
+	return mgr.getManifest(ctx, img.ContentStore(), img, matcher)
+}
+
+// imageOciImage returns the config descriptor and the oci image spec of the
+// image for the platform used to inspect it, see imageConfig.
+func (mgr *ImageManager) imageOciImage(ctx context.Context, img containerd.Image) (ocispec.Descriptor, ocispec.Image, error) {
+	cfg, _, _, err := mgr.imageConfig(ctx, img)
+	if err != nil {
+		return ocispec.Descriptor{}, ocispec.Image{}, err
+	}
+
+	ociImage, err := readOciImage(ctx, img.ContentStore(), cfg)
+	if err != nil {
+		return ocispec.Descriptor{}, ocispec.Image{}, err
+	}
+	return cfg, ociImage, nil
+}
+
 func (mgr *ImageManager) addReferenceIntoStore(id digest.Digest, ref reference.Named, dig digest.Digest) error {
 	// add primary reference as searchable reference
 	if err := mgr.localStore.AddReference(id, ref, ref); err != nil {
@@ -765,8 +2402,14 @@ func (mgr *ImageManager) containerdImageToImageInfo(ctx context.Context, id dige
 		ociImage    = ctrdImageInfo.OCISpec
 		repoTags    = make([]string, 0)
 		repoDigests = make([]string, 0)
+		createdAt   string
 	)
 
+	// NOTE: there is no config for the index-only image.
+	if ociImage.Created != nil {
+		createdAt = ociImage.Created.Format(utils.TimeLayout)
+	}
+
 	for _, ref := range mgr.localStore.GetReferences(ctrdImageInfo.ID) {
 		switch ref.(type) {
 		case reference.Tagged:
@@ -779,7 +2422,7 @@ func (mgr *ImageManager) containerdImageToImageInfo(ctx context.Context, id dige
 	return types.ImageInfo{
 		Architecture: ociImage.Architecture,
 		Config:       getImageInfoConfigFromOciImage(ociImage),
-		CreatedAt:    ociImage.Created.Format(utils.TimeLayout),
+		CreatedAt:    createdAt,
 		ID:           ctrdImageInfo.ID.String(),
 		Os:           ociImage.OS,
 		RepoDigests:  repoDigests,
@@ -788,10 +2431,26 @@ func (mgr *ImageManager) containerdImageToImageInfo(ctx context.Context, id dige
 			Type:   ociImage.RootFS.Type,
 			Layers: digestSliceToStringSlice(ociImage.RootFS.DiffIDs),
 		},
-		Size: ctrdImageInfo.Size,
+		Size:             ctrdImageInfo.Size,
+		PlatformMismatch: ctrdImageInfo.PlatformMismatch,
+		IndexOnly:        ctrdImageInfo.IndexOnly,
+		Labels:           imageLabels(ctrdImageInfo),
+		MediaType:        ctrdImageInfo.MediaType,
+		Platform:         ctrdImageInfo.Platform,
+		TargetDigest:     ctrdImageInfo.TargetDigest.String(),
 	}, nil
 }
 
+// checkLocalLayers returns ErrInvalidParam if the image is pulled lazily,
+// whose layer blobs are not in the content store, so that the action reading
+// the layer blobs fails with the clear error instead of the opaque NotFound.
+func checkLocalLayers(img containerd.Image, action string) error {
+	if ctrd.IsLazyImage(img) {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "cannot %s image %s pulled lazily, whose layers are not in the local content store", action, img.Name())
+	}
+	return nil
+}
+
 func (mgr *ImageManager) fetchContainerdImage(ctx context.Context, idOrRef string) (containerd.Image, error) {
 	_, _, ref, err := mgr.CheckReference(ctx, idOrRef)
 	if err != nil {
@@ -831,7 +2490,7 @@ func (mgr *ImageManager) getManifest(ctx context.Context, cs content.Store, img
 	}
 
 	// diffIDs info
-	diffIDs, err := img.RootFS(ctx)
+	diffIDs, err := ctrdmetaimages.RootFS(ctx, cs, manifest.Config)
 	if err != nil {
 		return ocispec.Manifest{}, err
 	}
@@ -862,7 +2521,11 @@ func filterReference(filter, ref []string) ([]string, error) {
 	for _, ref := range ref {
 		var found bool
 		for _, pattern := range filter {
-			found, err = filters.FamiliarMatch(pattern, ref)
+			if strings.Contains(pattern, "@") {
+				found, err = matchDigestReference(pattern, ref)
+			} else {
+				found, err = filters.FamiliarMatch(pattern, ref)
+			}
 			if err != nil {
 				return []string{}, err
 			}
@@ -0,0 +1,53 @@
+package mgr
+
+import (
+	"context"
+	"io"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// CopyImage copies the image from the registry of srcRef to the registry of
+// dstRef without creating the local image, so that neither the local tags nor
+// the snapshots are touched. All the platforms of image are copied.
+//
+// The source is restricted by the pull policy like pull, and the registry
+// mirrors are not used since the source is given explicitly.
+func (mgr *ImageManager) CopyImage(ctx context.Context, srcRef, dstRef string, srcAuth, dstAuth *types.AuthConfig, out io.Writer) error {
+	src, err := mgr.normalizeTagReference(srcRef)
+	if err != nil {
+		return err
+	}
+	src = reference.TrimTagForDigest(src)
+
+	dst, err := mgr.normalizeTagReference(dstRef)
+	if err != nil {
+		return err
+	}
+	if _, ok := dst.(reference.Digested); ok {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "destination reference %s cannot contain digest", dstRef)
+	}
+
+	if canonicalDockerHub(src.String()) == canonicalDockerHub(dst.String()) {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "source and destination are the same %s", src)
+	}
+
+	if err := mgr.pullPolicy.check(src.String()); err != nil {
+		return err
+	}
+
+	srcAuth, err = mgr.resolveAuthConfig(ctx, src.String(), srcAuth)
+	if err != nil {
+		return err
+	}
+	dstAuth, err = mgr.resolveAuthConfig(ctx, dst.String(), dstAuth)
+	if err != nil {
+		return err
+	}
+
+	return mgr.client.CopyImage(ctx, src.String(), dst.String(), srcAuth, dstAuth, out)
+}
@@ -0,0 +1,51 @@
+package mgr
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyImage(t *testing.T) {
+	policy, err := newPullPolicy(nil, []string{"quay.io/*"})
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		pullPolicy:       policy,
+		client:           client,
+	}
+
+	assert.NoError(t, mgr.CopyImage(context.TODO(), "busybox", "reg.abc.com/mirror/busybox:1.0", nil, nil, ioutil.Discard))
+	assert.Equal(t, [2]string{"registry.hub.docker.com/library/busybox:latest", "reg.abc.com/mirror/busybox:1.0"}, client.copied)
+
+	// the tag of source is trimmed if it's pinned by digest
+	dgst := "sha256:59eec8837a4d942cc19a52b8c09ea75121acc38114a2c68b98983ce9356b8610"
+	assert.NoError(t, mgr.CopyImage(context.TODO(), "busybox:1.0@"+dgst, "reg.abc.com/mirror/busybox", nil, nil, ioutil.Discard))
+	assert.Equal(t, [2]string{"registry.hub.docker.com/library/busybox@" + dgst, "reg.abc.com/mirror/busybox:latest"}, client.copied)
+
+	err = mgr.CopyImage(context.TODO(), "busybox", "reg.abc.com/mirror/busybox@"+dgst, nil, nil, ioutil.Discard)
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	err = mgr.CopyImage(context.TODO(), "busybox", "registry.hub.docker.com/library/busybox:latest", nil, nil, ioutil.Discard)
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	// the aliases of Docker Hub refer to the same image
+	err = mgr.CopyImage(context.TODO(), "busybox", "docker.io/busybox:latest", nil, nil, ioutil.Discard)
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	err = mgr.CopyImage(context.TODO(), "quay.io/coreos/etcd:v3", "reg.abc.com/coreos/etcd:v3", nil, nil, ioutil.Discard)
+	assert.True(t, errtypes.IsForbidden(err))
+
+	// the pattern of Docker Hub alias restricts the source too
+	mgr.pullPolicy, err = newPullPolicy(nil, []string{"index.docker.io/secret:*"})
+	assert.NoError(t, err)
+	err = mgr.CopyImage(context.TODO(), "secret:1.0", "reg.abc.com/secret:1.0", nil, nil, ioutil.Discard)
+	assert.True(t, errtypes.IsForbidden(err))
+}
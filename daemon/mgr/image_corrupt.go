@@ -0,0 +1,98 @@
+package mgr
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/sirupsen/logrus"
+)
+
+// corruptImages records the images failed to be loaded into the local store
+// at bootup, like the image whose content is missing after a crashed pull.
+// The nil corruptImages records nothing.
+type corruptImages struct {
+	mu     sync.Mutex
+	images map[string]types.CorruptImage
+}
+
+func newCorruptImages() *corruptImages {
+	return &corruptImages{
+		images: make(map[string]types.CorruptImage),
+	}
+}
+
+func (c *corruptImages) add(img types.CorruptImage) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.images[img.Name] = img
+}
+
+// remove forgets the image which has been stored successfully, like the one
+// pulled again.
+func (c *corruptImages) remove(name string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.images, name)
+}
+
+// list returns the corrupt images sorted by name.
+func (c *corruptImages) list() []types.CorruptImage {
+	res := []types.CorruptImage{}
+	if c == nil {
+		return res
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, img := range c.images {
+		res = append(res, img)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// ListCorruptImages returns the images failed to be loaded at bootup.
+func (mgr *ImageManager) ListCorruptImages() []types.CorruptImage {
+	return mgr.corruptImages.list()
+}
+
+// reportCorruptImage records the image failed to be loaded at bootup. The
+// image whose content is missing can never be loaded, and it's removed if
+// remove-corrupt-images is enabled so that it stops failing on every boot.
+func (mgr *ImageManager) reportCorruptImage(ctx context.Context, img containerd.Image, err error) {
+	logrus.Warnf("failed to load the image reference %s into local store: %v", img.Name(), err)
+
+	corrupt := types.CorruptImage{
+		Name:   img.Name(),
+		Digest: img.Target().Digest.String(),
+		Error:  err.Error(),
+	}
+
+	if mgr.removeCorruptImages && errdefs.IsNotFound(err) {
+		if rerr := mgr.client.RemoveImage(ctx, img.Name()); rerr != nil {
+			logrus.Warnf("failed to remove corrupt image %s: %v", img.Name(), rerr)
+		} else {
+			logrus.Infof("removed corrupt image %s whose content is missing", img.Name())
+			corrupt.Removed = true
+		}
+	}
+	mgr.corruptImages.add(corrupt)
+}
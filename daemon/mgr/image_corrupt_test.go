@@ -0,0 +1,60 @@
+package mgr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/containerd/containerd/errdefs"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportCorruptImage(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	missing := &fakeImage{name: "reg.abc.com/app:1.0", target: ocispec.Descriptor{Digest: digest.FromString("missing")}}
+	invalid := &fakeImage{name: "reg.abc.com/app:0.9", target: ocispec.Descriptor{Digest: digest.FromString("invalid")}}
+
+	client := newFakeImageClient(missing, invalid)
+	mgr := &ImageManager{
+		client:              client,
+		localStore:          store,
+		corruptImages:       newCorruptImages(),
+		removeCorruptImages: true,
+	}
+
+	mgr.reportCorruptImage(context.TODO(), missing, pkgerrors.Wrap(errdefs.ErrNotFound, "content digest"))
+	mgr.reportCorruptImage(context.TODO(), invalid, fmt.Errorf("invalid config"))
+
+	// only the image whose content is missing is removed
+	assert.Equal(t, []string{missing.name}, client.removed)
+	assert.Equal(t, []types.CorruptImage{
+		{
+			Name:   invalid.name,
+			Digest: invalid.target.Digest.String(),
+			Error:  "invalid config",
+		},
+		{
+			Name:    missing.name,
+			Digest:  missing.target.Digest.String(),
+			Error:   "content digest: not found",
+			Removed: true,
+		},
+	}, mgr.ListCorruptImages())
+
+	// the image stored successfully again is forgotten
+	id := digest.FromString("config")
+	assert.NoError(t, mgr.storeImageRecord(&imageRecord{
+		ref:    mustParseReference(t, invalid.name),
+		target: id,
+		info:   CtrdImageInfo{ID: id},
+	}))
+	assert.Len(t, mgr.ListCorruptImages(), 1)
+	assert.Equal(t, missing.name, mgr.ListCorruptImages()[0].Name)
+}
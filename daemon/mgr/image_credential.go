@@ -0,0 +1,203 @@
+package mgr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// credentialHelperPrefix is the prefix of docker credential helper
+	// binary, like docker-credential-ecr-login.
+	credentialHelperPrefix = "docker-credential-"
+
+	// credentialCacheTTL is used when the expiry of secret is unknown.
+	credentialCacheTTL = 10 * time.Minute
+
+	// credentialExpiryMargin refreshes the secret before its expiry.
+	credentialExpiryMargin = time.Minute
+
+	// credentialsNotFound is the message when there is no credential in
+	// the helper for the server.
+	credentialsNotFound = "credentials not found in native keychain"
+
+	// credentialIdentityTokenUsername means the secret is identity token.
+	credentialIdentityTokenUsername = "<token>"
+)
+
+// credentialHelperOutput is the output of credential helper get command.
+type credentialHelperOutput struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+type cachedCredential struct {
+	auth      *types.AuthConfig
+	expiresAt time.Time
+}
+
+// credentialStore gets the credential of registry from the docker-style
+// credential helper and caches it until expiry.
+//
+// The helper is run without holding the lock, so that the slow helper of one
+// registry doesn't block the others. The concurrent gets of the same registry
+// share one run of the helper.
+type credentialStore struct {
+	sync.Mutex
+
+	// helpers is the helper suffix keyed by registry host, like
+	// {"123456.dkr.ecr.us-east-1.amazonaws.com": "ecr-login"}.
+	helpers map[string]string
+	cache   map[string]cachedCredential
+	runs    singleflight.Group
+
+	// execHelper runs the helper get command with server as stdin, and
+	// returns its stdout and stderr separately.
+	execHelper func(ctx context.Context, helper, server string) (stdout, stderr []byte, err error)
+}
+
+// newCredentialStore returns nil if there is no helper.
+func newCredentialStore(helpers map[string]string) *credentialStore {
+	if len(helpers) == 0 {
+		return nil
+	}
+
+	return &credentialStore{
+		helpers:    helpers,
+		cache:      make(map[string]cachedCredential),
+		execHelper: execCredentialHelper,
+	}
+}
+
+// get returns the credential of registry host. It returns nil if there is
+// no helper for the host or the helper has no credential for it.
+func (s *credentialStore) get(ctx context.Context, host string) (*types.AuthConfig, error) {
+	helper, ok := s.helpers[host]
+	if !ok {
+		return nil, nil
+	}
+
+	s.Lock()
+	cached, ok := s.cache[host]
+	s.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.auth, nil
+	}
+
+	auth, err, _ := s.runs.Do(host, func() (interface{}, error) {
+		return s.fetch(ctx, helper, host)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auth.(*types.AuthConfig), nil
+}
+
+// fetch runs the helper to get the credential of host, and caches it.
+func (s *credentialStore) fetch(ctx context.Context, helper, host string) (*types.AuthConfig, error) {
+	stdout, stderr, err := s.execHelper(ctx, helper, host)
+	if err != nil {
+		// NOTE: the helpers of docker-credential-helpers print the
+		// error into stdout.
+		msg := strings.TrimSpace(string(stderr))
+		if msg == "" {
+			msg = strings.TrimSpace(string(stdout))
+		}
+		if strings.Contains(msg, credentialsNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get credential of %s from helper %s%s: %v: %s", host, credentialHelperPrefix, helper, err, msg)
+	}
+
+	var cred credentialHelperOutput
+	if err := json.Unmarshal(stdout, &cred); err != nil {
+		return nil, fmt.Errorf("failed to decode credential of %s from helper %s%s: %v", host, credentialHelperPrefix, helper, err)
+	}
+
+	auth := &types.AuthConfig{
+		ServerAddress: host,
+		Username:      cred.Username,
+		Password:      cred.Secret,
+	}
+	if cred.Username == credentialIdentityTokenUsername {
+		auth.Username = ""
+		auth.IdentityToken = cred.Secret
+	}
+
+	expiresAt := time.Now().Add(credentialCacheTTL)
+	if exp, ok := tokenExpiry(cred.Secret); ok && exp.Add(-credentialExpiryMargin).Before(expiresAt) {
+		expiresAt = exp.Add(-credentialExpiryMargin)
+	}
+
+	s.Lock()
+	s.cache[host] = cachedCredential{auth: auth, expiresAt: expiresAt}
+	s.Unlock()
+	return auth, nil
+}
+
+func execCredentialHelper(ctx context.Context, helper, server string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, credentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// tokenExpiry returns the exp claim if the secret is JWT.
+func tokenExpiry(secret string) (time.Time, bool) {
+	parts := strings.Split(secret, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
+
+// isEmptyAuthConfig returns true if there is no credential in authConfig.
+func isEmptyAuthConfig(authConfig *types.AuthConfig) bool {
+	return authConfig == nil ||
+		(authConfig.Username == "" && authConfig.Password == "" &&
+			authConfig.Auth == "" && authConfig.IdentityToken == "" && authConfig.RegistryToken == "")
+}
+
+// resolveAuthConfig gets the credential from the helper of registry if the
+// authConfig is empty.
+func (mgr *ImageManager) resolveAuthConfig(ctx context.Context, ref string, authConfig *types.AuthConfig) (*types.AuthConfig, error) {
+	if mgr.credentials == nil || !isEmptyAuthConfig(authConfig) {
+		return authConfig, nil
+	}
+
+	auth, err := mgr.credentials.get(ctx, mgr.registryOfReference(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	if auth == nil {
+		return authConfig, nil
+	}
+	return auth, nil
+}
@@ -0,0 +1,127 @@
+package mgr
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialStore(t *testing.T) {
+	calls := 0
+	store := newCredentialStore(map[string]string{
+		"reg.abc.com":   "test",
+		"token.abc.com": "test",
+		"empty.abc.com": "test",
+	})
+	store.execHelper = func(ctx context.Context, helper, server string) ([]byte, []byte, error) {
+		calls++
+		switch server {
+		case "reg.abc.com":
+			// the warning in stderr is not parsed
+			return []byte(`{"ServerURL":"reg.abc.com","Username":"foo","Secret":"bar"}`), []byte("warning: deprecated"), nil
+		case "token.abc.com":
+			return []byte(`{"ServerURL":"token.abc.com","Username":"<token>","Secret":"identity"}`), nil, nil
+		default:
+			return []byte(credentialsNotFound), nil, fmt.Errorf("exit status 1")
+		}
+	}
+
+	auth, err := store.get(context.TODO(), "reg.abc.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", auth.Username)
+	assert.Equal(t, "bar", auth.Password)
+
+	// the credential should be cached
+	_, err = store.get(context.TODO(), "reg.abc.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// the helper should be called again after expiry
+	cached := store.cache["reg.abc.com"]
+	cached.expiresAt = time.Now().Add(-time.Second)
+	store.cache["reg.abc.com"] = cached
+	_, err = store.get(context.TODO(), "reg.abc.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	auth, err = store.get(context.TODO(), "token.abc.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "", auth.Username)
+	assert.Equal(t, "identity", auth.IdentityToken)
+
+	auth, err = store.get(context.TODO(), "empty.abc.com")
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+
+	// no helper for the registry
+	auth, err = store.get(context.TODO(), "other.abc.com")
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+	assert.Equal(t, 4, calls)
+}
+
+func TestCredentialStoreSlowHelper(t *testing.T) {
+	var (
+		calls   int32
+		release = make(chan struct{})
+	)
+	store := newCredentialStore(map[string]string{
+		"reg.abc.com":  "test",
+		"slow.abc.com": "test",
+	})
+	store.execHelper = func(ctx context.Context, helper, server string) ([]byte, []byte, error) {
+		atomic.AddInt32(&calls, 1)
+		if server == "slow.abc.com" {
+			<-release
+		}
+		return []byte(`{"Username":"foo","Secret":"bar"}`), nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			auth, err := store.get(context.TODO(), "slow.abc.com")
+			assert.NoError(t, err)
+			assert.NotNil(t, auth)
+		}()
+	}
+
+	// the slow helper doesn't block the other registry
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := store.get(context.TODO(), "reg.abc.com")
+		assert.NoError(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("get is blocked by the slow helper of other registry")
+	}
+
+	close(release)
+	wg.Wait()
+
+	// the concurrent gets of slow.abc.com share one run of the helper, or
+	// the later one gets the cached credential
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestTokenExpiry(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp":1500000000}`))
+
+	exp, ok := tokenExpiry("header." + payload + ".signature")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1500000000), exp.Unix())
+
+	_, ok = tokenExpiry("plain-password")
+	assert.False(t, ok)
+}
@@ -0,0 +1,80 @@
+package mgr
+
+import (
+	"context"
+	"sort"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/ctrd"
+
+	"github.com/containerd/containerd"
+	"github.com/sirupsen/logrus"
+)
+
+// DiagnoseImageStore reports the drift between the local store and the
+// containerd's actual images. It's read-only and doesn't repair anything.
+func (mgr *ImageManager) DiagnoseImageStore(ctx context.Context) (*types.StoreDiagnosis, error) {
+	imgs, err := mgr.client.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrdImages := make(map[string]containerd.Image, len(imgs))
+	for _, img := range imgs {
+		ctrdImages[img.Name()] = img
+	}
+
+	diagnosis := &types.StoreDiagnosis{
+		MissingInContainerd: []string{},
+		MissingInStore:      []string{},
+		Mismatches:          []*types.ImageStoreMismatch{},
+	}
+
+	primaryRefs := mgr.localStore.ListPrimaryReferences()
+	for ref, id := range primaryRefs {
+		img, ok := ctrdImages[ref]
+		if !ok {
+			diagnosis.MissingInContainerd = append(diagnosis.MissingInContainerd, ref)
+			continue
+		}
+
+		// NOTE: the image is inspected without the cache, by the same
+		// platform as it's recorded.
+		var actual CtrdImageInfo
+		if ctrd.IsIndexOnlyImage(img) {
+			actual, err = mgr.inspectIndexOnlyImage(ctx, img)
+		} else {
+			actual, err = mgr.inspectImage(ctx, img)
+		}
+		if err != nil {
+			logrus.Warnf("failed to inspect image %s during diagnosis: %v", ref, err)
+			continue
+		}
+
+		// NOTE: the cached size is zero if the CtrdImageInfo is missing,
+		// which is reported as mismatch too.
+		cached, _ := mgr.localStore.GetCtrdImageInfo(id)
+		if actual.ID != id || cached.Size != actual.Size {
+			diagnosis.Mismatches = append(diagnosis.Mismatches, &types.ImageStoreMismatch{
+				Reference:  ref,
+				CachedID:   id.String(),
+				ActualID:   actual.ID.String(),
+				CachedSize: cached.Size,
+				ActualSize: actual.Size,
+			})
+		}
+	}
+
+	for name := range ctrdImages {
+		if _, ok := primaryRefs[name]; !ok {
+			diagnosis.MissingInStore = append(diagnosis.MissingInStore, name)
+		}
+	}
+
+	sort.Strings(diagnosis.MissingInContainerd)
+	sort.Strings(diagnosis.MissingInStore)
+	sort.Slice(diagnosis.Mismatches, func(i, j int) bool {
+		return diagnosis.Mismatches[i].Reference < diagnosis.Mismatches[j].Reference
+	})
+	return diagnosis, nil
+}
@@ -0,0 +1,62 @@
+package mgr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnoseImageStore(t *testing.T) {
+	provider := memProvider{}
+	newImage := func(name string) *fakeImage {
+		return newFakeImage(t, provider, name, ocispec.Image{
+			Architecture: "amd64",
+			OS:           "linux",
+			Config:       ocispec.ImageConfig{Labels: map[string]string{"name": name}},
+		})
+	}
+
+	app, gone, changed := newImage("reg.abc.com/app:1.0"), newImage("reg.abc.com/gone:1.0"), newImage("reg.abc.com/app:2.0")
+	mgr, client := newFakeImageManager(t, app, gone, changed)
+
+	// the image is removed from containerd, another one is added without
+	// the local store and the cached size is stale
+	delete(client.images, gone.name)
+	client.images["reg.abc.com/new:1.0"] = newImage("reg.abc.com/new:1.0")
+
+	var (
+		id   digest.Digest
+		size int64
+	)
+	for _, info := range mgr.localStore.ListCtrdImageInfo() {
+		if info.TargetDigest == changed.target.Digest {
+			id, size = info.ID, info.Size
+			info.Size++
+			mgr.localStore.CacheCtrdImageInfo(info.ID, info)
+		}
+	}
+
+	diagnosis, err := mgr.DiagnoseImageStore(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"reg.abc.com/gone:1.0"}, diagnosis.MissingInContainerd)
+	assert.Equal(t, []string{"reg.abc.com/new:1.0"}, diagnosis.MissingInStore)
+	assert.Equal(t, []*types.ImageStoreMismatch{{
+		Reference:  "reg.abc.com/app:2.0",
+		CachedID:   id.String(),
+		ActualID:   id.String(),
+		CachedSize: size + 1,
+		ActualSize: size,
+	}}, diagnosis.Mismatches)
+
+	// the drift is only reported without repair
+	_, err = mgr.localStore.GetPrimaryReference(mustParseReference(t, "reg.abc.com/gone:1.0"))
+	assert.NoError(t, err)
+	info, err := mgr.localStore.GetCtrdImageInfo(id)
+	assert.NoError(t, err)
+	assert.Equal(t, size+1, info.Size)
+}
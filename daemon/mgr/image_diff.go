@@ -0,0 +1,139 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// DiffImages compares the layers and the config of two images. The layers
+// are compared by digest, so the same content compressed differently is
+// treated as different layers.
+func (mgr *ImageManager) DiffImages(ctx context.Context, ref1, ref2 string) (*types.ImageDiff, error) {
+	id1, layers1, config1, err := mgr.diffableImage(ctx, ref1)
+	if err != nil {
+		return nil, err
+	}
+
+	id2, layers2, config2, err := mgr.diffableImage(ctx, ref2)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, onlyInA, onlyInB := diffImageLayers(layers1, layers2)
+	return &types.ImageDiff{
+		A:            id1,
+		B:            id2,
+		SharedLayers: shared,
+		OnlyInA:      onlyInA,
+		OnlyInB:      onlyInB,
+		ConfigDiffs:  diffImageConfigs(config1, config2),
+	}, nil
+}
+
+// diffableImage returns the ID, the layer digests and the config of image.
+func (mgr *ImageManager) diffableImage(ctx context.Context, idOrRef string) (string, []string, ocispec.ImageConfig, error) {
+	img, err := mgr.fetchContainerdImage(ctx, idOrRef)
+	if err != nil {
+		return "", nil, ocispec.ImageConfig{}, err
+	}
+
+	manifest, err := mgr.imageManifest(ctx, img)
+	if err != nil {
+		return "", nil, ocispec.ImageConfig{}, err
+	}
+
+	_, ociImage, err := mgr.imageOciImage(ctx, img)
+	if err != nil {
+		return "", nil, ocispec.ImageConfig{}, err
+	}
+
+	layers := make([]string, 0, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		layers = append(layers, layer.Digest.String())
+	}
+	return manifest.Config.Digest.String(), layers, ociImage.Config, nil
+}
+
+// diffImageLayers splits the layers into the shared ones and the ones only
+// in either image. The results keep the order of the layers.
+func diffImageLayers(a, b []string) (shared, onlyInA, onlyInB []string) {
+	inA := make(map[string]struct{}, len(a))
+	for _, layer := range a {
+		inA[layer] = struct{}{}
+	}
+
+	inB := make(map[string]struct{}, len(b))
+	for _, layer := range b {
+		inB[layer] = struct{}{}
+	}
+
+	shared, onlyInA, onlyInB = []string{}, []string{}, []string{}
+	for _, layer := range a {
+		if _, ok := inB[layer]; ok {
+			shared = append(shared, layer)
+		} else {
+			onlyInA = append(onlyInA, layer)
+		}
+	}
+
+	for _, layer := range b {
+		if _, ok := inA[layer]; !ok {
+			onlyInB = append(onlyInB, layer)
+		}
+	}
+	return shared, onlyInA, onlyInB
+}
+
+// diffImageConfigs returns the config fields which differ. The slices are
+// compared as a whole and the labels are compared one by one.
+func diffImageConfigs(a, b ocispec.ImageConfig) []*types.ImageConfigDiff {
+	diffs := []*types.ImageConfigDiff{}
+
+	add := func(field, va, vb string) {
+		if va != vb {
+			diffs = append(diffs, &types.ImageConfigDiff{Field: field, A: va, B: vb})
+		}
+	}
+
+	add("Env", formatConfigSlice(a.Env), formatConfigSlice(b.Env))
+	add("Cmd", formatConfigSlice(a.Cmd), formatConfigSlice(b.Cmd))
+	add("Entrypoint", formatConfigSlice(a.Entrypoint), formatConfigSlice(b.Entrypoint))
+	add("WorkingDir", a.WorkingDir, b.WorkingDir)
+	add("User", a.User, b.User)
+
+	keys := make([]string, 0, len(a.Labels)+len(b.Labels))
+	for k := range a.Labels {
+		keys = append(keys, k)
+	}
+	for k := range b.Labels {
+		if _, ok := a.Labels[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		add("Labels."+k, a.Labels[k], b.Labels[k])
+	}
+	return diffs
+}
+
+// formatConfigSlice formats the slice like the exec form of Dockerfile, so
+// that ["a b"] and ["a", "b"] are different.
+func formatConfigSlice(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return strings.Join(s, " ")
+	}
+	return string(data)
+}
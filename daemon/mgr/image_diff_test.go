@@ -0,0 +1,51 @@
+package mgr
+
+import (
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffImageLayers(t *testing.T) {
+	shared, onlyInA, onlyInB := diffImageLayers(
+		[]string{"sha256:base", "sha256:a1", "sha256:common"},
+		[]string{"sha256:base", "sha256:common", "sha256:b1"},
+	)
+	assert.Equal(t, []string{"sha256:base", "sha256:common"}, shared)
+	assert.Equal(t, []string{"sha256:a1"}, onlyInA)
+	assert.Equal(t, []string{"sha256:b1"}, onlyInB)
+
+	shared, onlyInA, onlyInB = diffImageLayers(nil, []string{"sha256:b1"})
+	assert.Equal(t, []string{}, shared)
+	assert.Equal(t, []string{}, onlyInA)
+	assert.Equal(t, []string{"sha256:b1"}, onlyInB)
+}
+
+func TestDiffImageConfigs(t *testing.T) {
+	a := ocispec.ImageConfig{
+		Env:        []string{"PATH=/bin"},
+		Cmd:        []string{"sh", "-c"},
+		WorkingDir: "/",
+		Labels:     map[string]string{"same": "1", "changed": "a", "removed": "x"},
+	}
+	b := ocispec.ImageConfig{
+		Env:        []string{"PATH=/bin"},
+		Cmd:        []string{"sh -c"},
+		WorkingDir: "/",
+		User:       "nobody",
+		Labels:     map[string]string{"same": "1", "changed": "b", "added": "y"},
+	}
+
+	assert.Equal(t, []*types.ImageConfigDiff{
+		{Field: "Cmd", A: `["sh","-c"]`, B: `["sh -c"]`},
+		{Field: "User", A: "", B: "nobody"},
+		{Field: "Labels.added", A: "", B: "y"},
+		{Field: "Labels.changed", A: "a", B: "b"},
+		{Field: "Labels.removed", A: "x", B: ""},
+	}, diffImageConfigs(a, b))
+
+	assert.Equal(t, []*types.ImageConfigDiff{}, diffImageConfigs(a, a))
+}
@@ -0,0 +1,145 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/content"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// ExportBlobs writes the manifest, config and layer blobs of the image into
+// the blobs/<algorithm>/<hex> layout under destDir, like the oci.v1 image
+// layout without tar. If the image is the index, the index and the manifest
+// of the platform are written. The blob which has been in destDir is skipped.
+//
+// The destDir should be the absolute path, since it's resolved by daemon
+// instead of the client.
+func (mgr *ImageManager) ExportBlobs(ctx context.Context, idOrRef string, destDir string) error {
+	if destDir == "" {
+		return pkgerrors.Wrap(errtypes.ErrInvalidParam, "destination directory cannot be empty")
+	}
+	if !filepath.IsAbs(destDir) {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "destination directory %s should be absolute path", destDir)
+	}
+
+	img, err := mgr.fetchContainerdImage(ctx, idOrRef)
+	if err != nil {
+		return err
+	}
+
+	if err := checkLocalLayers(img, "export blobs of"); err != nil {
+		return err
+	}
+
+	cs := img.ContentStore()
+	manifest, err := mgr.imageManifest(ctx, img)
+	if err != nil {
+		return err
+	}
+
+	descs, ok, err := manifestBlobs(ctx, cs, img.Target(), manifest.Config.Digest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pkgerrors.Errorf("failed to find manifest of config %s in image %s", manifest.Config.Digest, idOrRef)
+	}
+
+	descs = append(append(descs, manifest.Config), manifest.Layers...)
+	for _, desc := range descs {
+		if err := exportBlob(ctx, cs, desc, destDir); err != nil {
+			return pkgerrors.Wrapf(err, "failed to export blob %s of image %s", desc.Digest, idOrRef)
+		}
+	}
+	return nil
+}
+
+// manifestBlobs returns the index and manifest blobs from desc to the manifest
+// of config, and false if there is no such manifest.
+func manifestBlobs(ctx context.Context, provider content.Provider, desc ocispec.Descriptor, config digest.Digest) ([]ocispec.Descriptor, bool, error) {
+	switch desc.MediaType {
+	case ctrdmetaimages.MediaTypeDockerSchema2Manifest, ocispec.MediaTypeImageManifest:
+		b, err := content.ReadBlob(ctx, provider, desc)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			return nil, false, err
+		}
+		return []ocispec.Descriptor{desc}, manifest.Config.Digest == config, nil
+	case ctrdmetaimages.MediaTypeDockerSchema2ManifestList, ocispec.MediaTypeImageIndex:
+		children, err := ctrdmetaimages.Children(ctx, provider, desc)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, child := range children {
+			descs, ok, err := manifestBlobs(ctx, provider, child, config)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				return append([]ocispec.Descriptor{desc}, descs...), true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// exportBlob copies the blob into destDir. The blob is written into the
+// temporary file first and renamed after its digest is verified, so that
+// the partial blob is never seen.
+func exportBlob(ctx context.Context, provider content.Provider, desc ocispec.Descriptor, destDir string) error {
+	dir := filepath.Join(destDir, "blobs", desc.Digest.Algorithm().String())
+	target := filepath.Join(dir, desc.Digest.Hex())
+
+	if fi, err := os.Stat(target); err == nil && fi.Size() == desc.Size {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	ra, err := provider.ReaderAt(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	tmp, err := ioutil.TempFile(dir, ".tmp-"+desc.Digest.Hex())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	verifier := desc.Digest.Verifier()
+	n, err := io.Copy(io.MultiWriter(tmp, verifier), content.NewReader(ra))
+	if err != nil {
+		return err
+	}
+	if n != desc.Size || !verifier.Verified() {
+		return pkgerrors.Errorf("unexpected content of blob %s", desc.Digest)
+	}
+
+	if err := tmp.Chmod(0444); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,90 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-blob")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	provider := memProvider{}
+	desc := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+	target := filepath.Join(dir, "blobs", "sha256", desc.Digest.Hex())
+
+	assert.NoError(t, exportBlob(context.TODO(), provider, desc, dir))
+	got, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("layer"), got)
+
+	// the existing blob is skipped without reading content store
+	assert.NoError(t, exportBlob(context.TODO(), memProvider{}, desc, dir))
+
+	// the corrupt blob is never written
+	corrupt := desc
+	corrupt.Digest = digest.FromString("other")
+	assert.Error(t, exportBlob(context.TODO(), memProvider{corrupt.Digest: []byte("layer")}, corrupt, dir))
+	_, err = os.Stat(filepath.Join(dir, "blobs", "sha256", corrupt.Digest.Hex()))
+	assert.True(t, os.IsNotExist(err))
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "blobs", "sha256"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestManifestBlobs(t *testing.T) {
+	provider := memProvider{}
+	manifest := func(config string) (ocispec.Descriptor, digest.Digest) {
+		configDesc := provider.add(ocispec.MediaTypeImageConfig, []byte(config))
+		b, err := json.Marshal(ocispec.Manifest{
+			Versioned: ocispecs.Versioned{SchemaVersion: 2},
+			Config:    configDesc,
+		})
+		assert.NoError(t, err)
+		return provider.add(ocispec.MediaTypeImageManifest, b), configDesc.Digest
+	}
+
+	amd64, amd64Config := manifest(`{"architecture":"amd64","os":"linux"}`)
+	arm64, arm64Config := manifest(`{"architecture":"arm64","os":"linux"}`)
+
+	b, err := json.Marshal(ocispec.Index{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Manifests: []ocispec.Descriptor{amd64, arm64},
+	})
+	assert.NoError(t, err)
+	index := provider.add(ocispec.MediaTypeImageIndex, b)
+
+	// the index and the manifest of the platform are both exported
+	descs, ok, err := manifestBlobs(context.TODO(), provider, index, arm64Config)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []ocispec.Descriptor{index, arm64}, descs)
+
+	descs, ok, err = manifestBlobs(context.TODO(), provider, amd64, amd64Config)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []ocispec.Descriptor{amd64}, descs)
+
+	_, ok, err = manifestBlobs(context.TODO(), provider, index, digest.FromString("other"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestExportBlobsRelativeDir(t *testing.T) {
+	mgr := &ImageManager{}
+	err := mgr.ExportBlobs(context.TODO(), "busybox", "blobs")
+	assert.True(t, errtypes.IsInvalidParam(err), "%v", err)
+}
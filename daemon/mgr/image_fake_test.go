@@ -0,0 +1,453 @@
+package mgr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/ctrd"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type memReaderAt struct {
+	*bytes.Reader
+}
+
+func (r memReaderAt) Close() error {
+	return nil
+}
+
+// memProvider is content.Provider backed by the memory.
+type memProvider map[digest.Digest][]byte
+
+func (p memProvider) ReaderAt(ctx context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	data, ok := p[desc.Digest]
+	if !ok {
+		return nil, errdefs.ErrNotFound
+	}
+	return memReaderAt{bytes.NewReader(data)}, nil
+}
+
+func (p memProvider) add(mediaType string, data []byte) ocispec.Descriptor {
+	dgst := digest.FromBytes(data)
+	p[dgst] = data
+	return ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(data)),
+	}
+}
+
+// memContentStore is content.Store backed by the memory, which only supports
+// reading. The ingestion is not implemented.
+type memContentStore struct {
+	memProvider
+}
+
+func (s memContentStore) Info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	data, ok := s.memProvider[dgst]
+	if !ok {
+		return content.Info{}, errdefs.ErrNotFound
+	}
+	return content.Info{Digest: dgst, Size: int64(len(data))}, nil
+}
+
+func (s memContentStore) Update(ctx context.Context, info content.Info, fieldpaths ...string) (content.Info, error) {
+	return content.Info{}, errdefs.ErrNotImplemented
+}
+
+func (s memContentStore) Walk(ctx context.Context, fn content.WalkFunc, filters ...string) error {
+	dgsts := make([]digest.Digest, 0, len(s.memProvider))
+	for dgst := range s.memProvider {
+		dgsts = append(dgsts, dgst)
+	}
+	sort.Slice(dgsts, func(i, j int) bool {
+		return dgsts[i] < dgsts[j]
+	})
+
+	for _, dgst := range dgsts {
+		if err := fn(content.Info{Digest: dgst, Size: int64(len(s.memProvider[dgst]))}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s memContentStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	if _, ok := s.memProvider[dgst]; !ok {
+		return errdefs.ErrNotFound
+	}
+	delete(s.memProvider, dgst)
+	return nil
+}
+
+func (s memContentStore) Status(ctx context.Context, ref string) (content.Status, error) {
+	return content.Status{}, errdefs.ErrNotFound
+}
+
+func (s memContentStore) ListStatuses(ctx context.Context, filters ...string) ([]content.Status, error) {
+	return nil, nil
+}
+
+func (s memContentStore) Abort(ctx context.Context, ref string) error {
+	return errdefs.ErrNotFound
+}
+
+func (s memContentStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+// fakeImage is the containerd image whose content is in memory. The image
+// without content is enough for the tests which only use its metadata, like
+// the tag of index-only image.
+type fakeImage struct {
+	name   string
+	labels map[string]string
+	target ocispec.Descriptor
+	store  memContentStore
+}
+
+func (img *fakeImage) Name() string {
+	return img.name
+}
+
+func (img *fakeImage) Labels() map[string]string {
+	return img.labels
+}
+
+func (img *fakeImage) Target() ocispec.Descriptor {
+	return img.target
+}
+
+func (img *fakeImage) Unpack(ctx context.Context, snapshotter string) error {
+	return errdefs.ErrNotImplemented
+}
+
+func (img *fakeImage) RootFS(ctx context.Context) ([]digest.Digest, error) {
+	config, err := img.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ctrdmetaimages.RootFS(ctx, img.store, config)
+}
+
+func (img *fakeImage) Size(ctx context.Context) (int64, error) {
+	return (&ctrdmetaimages.Image{Target: img.target}).Size(ctx, img.store, platforms.Default())
+}
+
+func (img *fakeImage) Config(ctx context.Context) (ocispec.Descriptor, error) {
+	return ctrdmetaimages.Config(ctx, img.store, img.target, platforms.Default())
+}
+
+func (img *fakeImage) IsUnpacked(ctx context.Context, snapshotter string) (bool, error) {
+	return false, nil
+}
+
+func (img *fakeImage) ContentStore() content.Store {
+	return img.store
+}
+
+// newFakeImage returns the single-platform image with the config and layers,
+// whose content is added into the provider.
+func newFakeImage(t *testing.T, provider memProvider, name string, config ocispec.Image, layers ...ocispec.Descriptor) *fakeImage {
+	return &fakeImage{
+		name:   name,
+		target: addTestManifest(t, provider, config, layers...),
+		store:  memContentStore{memProvider: provider},
+	}
+}
+
+// newIndexOnlyImage returns the index-only image without content.
+func newIndexOnlyImage(name string, target ocispec.Descriptor) *fakeImage {
+	return &fakeImage{
+		name:   name,
+		labels: map[string]string{ctrd.IndexOnlyLabel: "true"},
+		target: target,
+	}
+}
+
+// addTestManifest adds the manifest with the config and layers into the
+// provider, and returns its descriptor.
+func addTestManifest(t *testing.T, provider memProvider, config ocispec.Image, layers ...ocispec.Descriptor) ocispec.Descriptor {
+	data, err := json.Marshal(config)
+	assert.NoError(t, err)
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Config:    provider.add(ocispec.MediaTypeImageConfig, data),
+		Layers:    layers,
+	})
+	assert.NoError(t, err)
+	return provider.add(ocispec.MediaTypeImageManifest, manifest)
+}
+
+// fakeImageClient is ctrd.APIClient which keeps the containerd images in the
+// memory by name, and records the calls to the registry. All the image APIs
+// are implemented, and the ones not supported return ErrNotImplemented.
+type fakeImageClient struct {
+	ctrd.APIClient
+
+	mu     sync.Mutex
+	images map[string]*fakeImage
+
+	// gets counts the calls of GetImage.
+	gets int
+	// resolved records the references resolved, and none of them is
+	// available.
+	resolved []string
+	// copied records the source and destination of the last copy.
+	copied [2]string
+	// removed records the removed references.
+	removed []string
+	// imports are the images created by the import once the whole
+	// tarstream is read, which overwrite the ones with same name.
+	imports []*fakeImage
+
+	// createErrs fails the creation of the references.
+	createErrs map[string]error
+	// updateErr fails the update of the references.
+	updateErr error
+	// removeErrs fails the removal of the references.
+	removeErrs map[string]error
+	// blockList blocks the list of images until the context is done.
+	blockList bool
+}
+
+func newFakeImageClient(imgs ...*fakeImage) *fakeImageClient {
+	c := &fakeImageClient{images: map[string]*fakeImage{}}
+	for _, img := range imgs {
+		c.images[img.name] = img
+	}
+	return c
+}
+
+// newFakeImageManager returns the manager whose local store references the
+// images, which are read from the memory.
+func newFakeImageManager(t *testing.T, imgs ...*fakeImage) (*ImageManager, *fakeImageClient) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient(imgs...)
+	mgr := &ImageManager{
+		localStore:    store,
+		infoCache:     newImageInfoCache(),
+		corruptImages: newCorruptImages(),
+		client:        client,
+	}
+	for _, img := range imgs {
+		assert.NoError(t, mgr.StoreImageReference(context.TODO(), img))
+	}
+	return mgr, client
+}
+
+func (c *fakeImageClient) CreateImageReference(ctx context.Context, img ctrdmetaimages.Image) (ctrdmetaimages.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err, ok := c.createErrs[img.Name]; ok {
+		return ctrdmetaimages.Image{}, err
+	}
+	if _, ok := c.images[img.Name]; ok {
+		return ctrdmetaimages.Image{}, pkgerrors.Wrapf(errtypes.ErrAlreadyExisted, "image %s", img.Name)
+	}
+	c.images[img.Name] = &fakeImage{name: img.Name, labels: img.Labels, target: img.Target, store: c.store(img.Target)}
+	return img, nil
+}
+
+// UpdateImage updates the image like containerd, which replaces the target
+// and labels without fieldpaths.
+func (c *fakeImageClient) UpdateImage(ctx context.Context, img ctrdmetaimages.Image, fieldpaths ...string) (ctrdmetaimages.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.updateErr != nil {
+		return ctrdmetaimages.Image{}, c.updateErr
+	}
+
+	existing, ok := c.images[img.Name]
+	if !ok {
+		return ctrdmetaimages.Image{}, pkgerrors.Wrapf(errtypes.ErrNotfound, "image %s", img.Name)
+	}
+
+	updated := *existing
+	if len(fieldpaths) == 0 {
+		updated.labels, updated.target = img.Labels, img.Target
+		updated.store = c.store(img.Target)
+	}
+
+	for _, path := range fieldpaths {
+		switch {
+		case path == "target":
+			updated.target = img.Target
+		case path == "labels":
+			updated.labels = img.Labels
+		case strings.HasPrefix(path, "labels."):
+			labels := make(map[string]string, len(updated.labels))
+			for k, v := range updated.labels {
+				labels[k] = v
+			}
+
+			key := strings.TrimPrefix(path, "labels.")
+			if v := img.Labels[key]; v != "" {
+				labels[key] = v
+			} else {
+				delete(labels, key)
+			}
+			updated.labels = labels
+		default:
+			return ctrdmetaimages.Image{}, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "cannot update %s of image", path)
+		}
+	}
+
+	c.images[img.Name] = &updated
+	return ctrdmetaimages.Image{Name: updated.name, Labels: updated.labels, Target: updated.target}, nil
+}
+
+// store returns the content store of the image with the same target, so that
+// the new reference can be read like the existing one.
+func (c *fakeImageClient) store(target ocispec.Descriptor) memContentStore {
+	for _, img := range c.images {
+		if img.target.Digest == target.Digest {
+			return img.store
+		}
+	}
+	return memContentStore{}
+}
+
+func (c *fakeImageClient) GetImage(ctx context.Context, ref string) (containerd.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gets++
+	img, ok := c.images[ref]
+	if !ok {
+		return nil, pkgerrors.Wrapf(errtypes.ErrNotfound, "image %s", ref)
+	}
+	return img, nil
+}
+
+func (c *fakeImageClient) ListImages(ctx context.Context, filter ...string) ([]containerd.Image, error) {
+	if c.blockList {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.images))
+	for name := range c.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	imgs := make([]containerd.Image, 0, len(names))
+	for _, name := range names {
+		imgs = append(imgs, c.images[name])
+	}
+	return imgs, nil
+}
+
+func (c *fakeImageClient) FetchImage(ctx context.Context, resolver remotes.Resolver, ref string, authConfig *types.AuthConfig, stream *jsonstream.JSONStream) (containerd.Image, error) {
+	return nil, errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) ResolveImage(ctx context.Context, nameRef string, refs []string, authConfig *types.AuthConfig, opts docker.ResolverOptions) (remotes.Resolver, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resolved = append(c.resolved, refs...)
+	return nil, "", errtypes.ErrNotfound
+}
+
+func (c *fakeImageClient) RemoveImage(ctx context.Context, ref string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.removeErrs[ref]; err != nil {
+		return err
+	}
+	if _, ok := c.images[ref]; !ok {
+		return pkgerrors.Wrapf(errtypes.ErrNotfound, "image %s", ref)
+	}
+	delete(c.images, ref)
+	c.removed = append(c.removed, ref)
+	return nil
+}
+
+func (c *fakeImageClient) UnpackLazily(ctx context.Context, img containerd.Image, ref string, stream *jsonstream.JSONStream) error {
+	return errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) UnpackImage(ctx context.Context, img containerd.Image, snapshotter string, stream *jsonstream.JSONStream) error {
+	return errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) ImportImage(ctx context.Context, reader io.Reader, opts ...containerd.ImportOpt) ([]containerd.Image, error) {
+	if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	imgs := make([]containerd.Image, 0, len(c.imports))
+	for _, img := range c.imports {
+		c.images[img.name] = img
+		imgs = append(imgs, img)
+	}
+	return imgs, nil
+}
+
+func (c *fakeImageClient) SaveImage(ctx context.Context, exporter ctrdmetaimages.Exporter, ref string) (io.ReadCloser, error) {
+	return nil, errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) Commit(ctx context.Context, config *ctrd.CommitConfig) (digest.Digest, error) {
+	return "", errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) PushImage(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer) error {
+	return errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) PushManifestList(ctx context.Context, ref string, desc ocispec.Descriptor, data []byte, authConfig *types.AuthConfig, out io.Writer) error {
+	return errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) CopyImage(ctx context.Context, srcRef, dstRef string, srcAuth, dstAuth *types.AuthConfig, out io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.copied = [2]string{srcRef, dstRef}
+	return nil
+}
+
+func (c *fakeImageClient) GarbageCollect(ctx context.Context) (*types.GCResult, error) {
+	return nil, errtypes.ErrNotImplemented
+}
+
+func (c *fakeImageClient) ListRemoteTags(ctx context.Context, repo string, authConfig *types.AuthConfig) ([]string, error) {
+	return nil, errtypes.ErrNotImplemented
+}
@@ -0,0 +1,442 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ImportImage creates a single-layer image from the rootfs tarball, which
+// may be gzip-compressed. The Dockerfile-style changes like `CMD ["sh"]` or
+// `ENV A=B` are applied to the config of image.
+//
+// The image is synthesized into the oci.v1 format tarstream, and then it's
+// imported like LoadImage.
+func (mgr *ImageManager) ImportImage(ctx context.Context, ref string, changes []string, rootfs io.ReadCloser) error {
+	defer rootfs.Close()
+
+	ref = addDefaultRegistryIfMissing(ref, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces)
+	namedRef, err := parseTagReference(ref)
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.validateTagReference(namedRef); err != nil {
+		return err
+	}
+
+	var config ocispec.ImageConfig
+	for _, change := range changes {
+		if err := applyImportChange(&config, change); err != nil {
+			return err
+		}
+	}
+
+	if err := mgr.loadLimiter.acquire(ctx); err != nil {
+		return err
+	}
+	defer mgr.loadLimiter.release()
+
+	layer, err := newImportLayer(rootfs, mgr.importDir, mgr.loadLimits)
+	if err != nil {
+		return pkgerrors.Wrap(err, "failed to read rootfs tarball")
+	}
+	defer layer.remove()
+
+	created := time.Now().UTC()
+	img := ocispec.Image{
+		Created:      &created,
+		Architecture: runtime.GOARCH,
+		OS:           runtime.GOOS,
+		Config:       config,
+		RootFS: ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{layer.diffID},
+		},
+		History: []ocispec.History{
+			{
+				Created:   &created,
+				CreatedBy: "pouch import",
+				Comment:   "Imported from rootfs tarball",
+			},
+		},
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeImportArchive(pw, img, layer))
+	}()
+
+	imgs, err := mgr.client.ImportImage(ctx, pr, containerd.WithImageRefTranslator(func(string) string {
+		return namedRef.String()
+	}))
+	pr.Close()
+	if err != nil {
+		return pkgerrors.Wrap(err, "failed to import image into containerd by rootfs tarball")
+	}
+
+	for _, img := range imgs {
+		if err := mgr.StoreImageReference(ctx, img); err != nil {
+			return pkgerrors.Wrapf(err, "failed to store reference %s", img.Name())
+		}
+
+		id, err := mgr.imageID(ctx, img)
+		if err != nil {
+			return err
+		}
+		mgr.LogImageEvent(ctx, id.String(), img.Name(), "import")
+	}
+	return nil
+}
+
+// applyImportChange applies the Dockerfile-style instruction to the config.
+// The supported instructions are CMD, ENTRYPOINT, ENV, LABEL, USER and
+// WORKDIR.
+func applyImportChange(config *ocispec.ImageConfig, change string) error {
+	fields := strings.SplitN(strings.TrimSpace(change), " ", 2)
+	if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid change %q", change)
+	}
+	instruction, arg := strings.ToUpper(fields[0]), strings.TrimSpace(fields[1])
+
+	switch instruction {
+	case "CMD":
+		config.Cmd = parseImportCommand(arg)
+	case "ENTRYPOINT":
+		config.Entrypoint = parseImportCommand(arg)
+	case "ENV":
+		kvs, err := parseImportKeyValues(arg)
+		if err != nil {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid change %q: %v", change, err)
+		}
+		for _, kv := range kvs {
+			config.Env = setImportEnv(config.Env, kv[0], kv[1])
+		}
+	case "LABEL":
+		kvs, err := parseImportKeyValues(arg)
+		if err != nil {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid change %q: %v", change, err)
+		}
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		for _, kv := range kvs {
+			config.Labels[kv[0]] = kv[1]
+		}
+	case "USER":
+		config.User = arg
+	case "WORKDIR":
+		config.WorkingDir = arg
+	default:
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "unsupported instruction %s in change %q", instruction, change)
+	}
+	return nil
+}
+
+// parseImportCommand parses the command in exec form like ["sh", "-c"], or
+// the shell form which is run by /bin/sh -c.
+func parseImportCommand(arg string) []string {
+	var cmd []string
+	if strings.HasPrefix(arg, "[") && json.Unmarshal([]byte(arg), &cmd) == nil {
+		return cmd
+	}
+	return []string{"/bin/sh", "-c", arg}
+}
+
+// parseImportKeyValues parses the key-value pairs like `A=B C="D E"`, or the
+// legacy form `A B C` which means A is "B C".
+func parseImportKeyValues(arg string) ([][2]string, error) {
+	if !strings.Contains(strings.SplitN(arg, " ", 2)[0], "=") {
+		fields := strings.SplitN(arg, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("missing value of %s", fields[0])
+		}
+		return [][2]string{{fields[0], strings.TrimSpace(fields[1])}}, nil
+	}
+
+	words, err := splitImportWords(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	var kvs [][2]string
+	for _, word := range words {
+		kv := strings.SplitN(word, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid key-value pair %s", word)
+		}
+		kvs = append(kvs, [2]string{kv[0], kv[1]})
+	}
+	return kvs, nil
+}
+
+// splitImportWords splits the words separated by whitespace like the shell,
+// in which the whitespace quoted by single or double quotes, or escaped by
+// backslash, is kept. The quotes and backslashes are removed.
+func splitImportWords(arg string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, c := range arg {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if escaped || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape in %s", arg)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// setImportEnv sets the env, which overrides the existing one with same key.
+func setImportEnv(env []string, key, value string) []string {
+	for i, e := range env {
+		if strings.SplitN(e, "=", 2)[0] == key {
+			env[i] = key + "=" + value
+			return env
+		}
+	}
+	return append(env, key+"="+value)
+}
+
+// importLayer is the gzip-compressed layer in the temporary file.
+type importLayer struct {
+	file   *os.File
+	desc   ocispec.Descriptor
+	diffID digest.Digest
+}
+
+// newImportLayer writes the rootfs tarball into the temporary file in dir as
+// the gzip-compressed layer, and computes the digest of both the uncompressed
+// and compressed content. The tarball is limited by the entry count and size
+// of limits.
+func newImportLayer(rootfs io.Reader, dir string, limits loadLimits) (_ *importLayer, err0 error) {
+	br := bufio.NewReader(rootfs)
+
+	var uncompressed io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		uncompressed = gr
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := ioutil.TempFile(dir, "pouch-import-")
+	if err != nil {
+		return nil, err
+	}
+
+	layer := &importLayer{file: file}
+	defer func() {
+		if err0 != nil {
+			layer.remove()
+		}
+	}()
+
+	var (
+		diffIDDigester     = digest.Canonical.Digester()
+		compressedDigester = digest.Canonical.Digester()
+		counter            = &writeCounter{}
+		gw                 = gzip.NewWriter(io.MultiWriter(file, compressedDigester.Hash(), counter))
+	)
+
+	// NOTE: the tar reader checks the tarball is valid, and the bytes read
+	// by tar reader is the uncompressed layer.
+	var (
+		tr    = tar.NewReader(io.TeeReader(uncompressed, io.MultiWriter(gw, diffIDDigester.Hash())))
+		count = limits.counter()
+	)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if err := count(hdr); err != nil {
+			return nil, err
+		}
+	}
+
+	// drain the padding after the end of archive
+	if _, err := io.Copy(ioutil.Discard, io.TeeReader(uncompressed, io.MultiWriter(gw, diffIDDigester.Hash()))); err != nil {
+		return nil, err
+	}
+
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	layer.diffID = diffIDDigester.Digest()
+	layer.desc = ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayerGzip,
+		Digest:    compressedDigester.Digest(),
+		Size:      counter.n,
+	}
+	return layer, nil
+}
+
+func (l *importLayer) remove() {
+	l.file.Close()
+	if err := os.Remove(l.file.Name()); err != nil {
+		logrus.Warnf("failed to remove temporary layer %s: %v", l.file.Name(), err)
+	}
+}
+
+// writeCounter counts the bytes written.
+type writeCounter struct {
+	n int64
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// writeImportArchive writes the image with the single layer into the oci.v1
+// format tarstream.
+func writeImportArchive(w io.Writer, img ocispec.Image, layer *importLayer) error {
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	configJSON, err := json.Marshal(img)
+	if err != nil {
+		return err
+	}
+	configDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(configJSON),
+		Size:      int64(len(configJSON)),
+	}
+
+	manifestJSON, err := json.Marshal(ocispec.Manifest{
+		Versioned: ocispecs.Versioned{
+			SchemaVersion: 2,
+		},
+		Config: configDesc,
+		Layers: []ocispec.Descriptor{layer.desc},
+	})
+	if err != nil {
+		return err
+	}
+	manifestDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestJSON),
+		Size:      int64(len(manifestJSON)),
+		// NOTE: the name of image is translated by caller.
+		Annotations: map[string]string{
+			ocispec.AnnotationRefName: "latest",
+		},
+	}
+
+	layout, err := jsonRecord(ocispec.ImageLayoutFile, 0444, ocispec.ImageLayout{
+		Version: ocispec.ImageLayoutVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	index, err := jsonRecord("index.json", 0644, ocispec.Index{
+		Versioned: ocispecs.Versioned{
+			SchemaVersion: 2,
+		},
+		Manifests: []ocispec.Descriptor{manifestDesc},
+	})
+	if err != nil {
+		return err
+	}
+
+	records := map[string]tarRecord{
+		layout.header.Name: layout,
+		index.header.Name:  index,
+	}
+	for _, record := range []tarRecord{
+		directoryRecord("blobs/"),
+		directoryRecord("blobs/" + digest.Canonical.String() + "/"),
+		bytesBlobRecord(configDesc, configJSON),
+		bytesBlobRecord(manifestDesc, manifestJSON),
+		fileBlobRecord(layer.desc, layer.file),
+	} {
+		records[record.header.Name] = record
+	}
+	return writeTarRecords(context.Background(), tw, records)
+}
+
+func bytesBlobRecord(desc ocispec.Descriptor, b []byte) tarRecord {
+	name := "blobs/" + desc.Digest.Algorithm().String() + "/" + desc.Digest.Hex()
+	return tarRecord{
+		header: normalizedHeader(name, 0444, desc.Size, tar.TypeReg),
+		copyTo: func(ctx context.Context, w io.Writer) (int64, error) {
+			n, err := w.Write(b)
+			return int64(n), err
+		},
+	}
+}
+
+func fileBlobRecord(desc ocispec.Descriptor, file *os.File) tarRecord {
+	name := "blobs/" + desc.Digest.Algorithm().String() + "/" + desc.Digest.Hex()
+	return tarRecord{
+		header: normalizedHeader(name, 0444, desc.Size, tar.TypeReg),
+		copyTo: func(ctx context.Context, w io.Writer) (int64, error) {
+			return io.Copy(w, io.NewSectionReader(file, 0, desc.Size))
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyImportChange(t *testing.T) {
+	var config ocispec.ImageConfig
+
+	for _, change := range []string{
+		`CMD ["/bin/sh", "-c", "top"]`,
+		`ENTRYPOINT /entrypoint.sh`,
+		`ENV A=1 B="2"`,
+		`ENV A 3 4`,
+		`ENV C="hello world" D='a "b"' E=x\ y`,
+		`LABEL maintainer=pouch`,
+		`user nobody`,
+		`WORKDIR /root`,
+	} {
+		assert.NoError(t, applyImportChange(&config, change), change)
+	}
+
+	assert.Equal(t, []string{"/bin/sh", "-c", "top"}, config.Cmd)
+	assert.Equal(t, []string{"/bin/sh", "-c", "/entrypoint.sh"}, config.Entrypoint)
+	assert.Equal(t, []string{"A=3 4", "B=2", "C=hello world", `D=a "b"`, "E=x y"}, config.Env)
+	assert.Equal(t, map[string]string{"maintainer": "pouch"}, config.Labels)
+	assert.Equal(t, "nobody", config.User)
+	assert.Equal(t, "/root", config.WorkingDir)
+
+	for _, change := range []string{"CMD", "EXPOSE 80", "ENV =1", "ENV A", `ENV A="1`} {
+		assert.True(t, errtypes.IsInvalidParam(applyImportChange(&config, change)), change)
+	}
+}
+
+func TestNewImportLayer(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "import-layer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// the directory of temporary layers is created if missing
+	dir := filepath.Join(tmp, "image-import")
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"hello", "world"} {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 5}))
+		_, err := tw.Write([]byte(name))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	rootfs := buf.Bytes()
+
+	compressed := new(bytes.Buffer)
+	gw := gzip.NewWriter(compressed)
+	_, err = gw.Write(rootfs)
+	assert.NoError(t, err)
+	assert.NoError(t, gw.Close())
+
+	// the diffID is the same for both uncompressed and compressed rootfs
+	for _, input := range [][]byte{rootfs, compressed.Bytes()} {
+		layer, err := newImportLayer(bytes.NewReader(input), dir, loadLimits{})
+		assert.NoError(t, err)
+		assert.Equal(t, digest.FromBytes(rootfs), layer.diffID)
+
+		blob := make([]byte, layer.desc.Size)
+		_, err = layer.file.ReadAt(blob, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, layer.desc.Digest, digest.FromBytes(blob))
+		layer.remove()
+	}
+
+	_, err = newImportLayer(bytes.NewReader([]byte("not a tarball")), dir, loadLimits{})
+	assert.Error(t, err)
+
+	// the rootfs tarball is limited like the loaded tarstream
+	for _, limits := range []loadLimits{{maxEntries: 1}, {maxSize: 8}} {
+		_, err = newImportLayer(bytes.NewReader(rootfs), dir, limits)
+		assert.True(t, errtypes.IsInvalidParam(err), "%+v: %v", limits, err)
+	}
+
+	// the temporary layers are removed
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,89 @@
+package mgr
+
+import (
+	"sync"
+
+	"github.com/alibaba/pouch/apis/metrics"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	imageInfoCacheHit  = "hit"
+	imageInfoCacheMiss = "miss"
+)
+
+// imageInfoCacheKey is the target digest of containerd image. The index-only
+// image has different information for the same target.
+type imageInfoCacheKey struct {
+	target    digest.Digest
+	indexOnly bool
+}
+
+// imageInfoCache caches the size and OCI spec of image keyed by the target
+// digest, so that storing the reference for the same target doesn't walk the
+// content again. The content of target is immutable, so that the cache is
+// only invalidated when the image is removed.
+type imageInfoCache struct {
+	sync.Mutex
+	infos map[imageInfoCacheKey]CtrdImageInfo
+}
+
+func newImageInfoCache() *imageInfoCache {
+	return &imageInfoCache{
+		infos: make(map[imageInfoCacheKey]CtrdImageInfo),
+	}
+}
+
+// get returns the cached information of target.
+func (c *imageInfoCache) get(key imageInfoCacheKey) (CtrdImageInfo, bool) {
+	if c == nil {
+		return CtrdImageInfo{}, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	info, ok := c.infos[key]
+	if ok {
+		metrics.ImageInfoCacheCounter.WithLabelValues(imageInfoCacheHit).Inc()
+	} else {
+		metrics.ImageInfoCacheCounter.WithLabelValues(imageInfoCacheMiss).Inc()
+	}
+	return info, ok
+}
+
+func (c *imageInfoCache) put(key imageInfoCacheKey, info CtrdImageInfo) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.infos[key] = info
+}
+
+// invalidate removes the cached information of the image ID, which is called
+// when the image is removed from the local store.
+func (c *imageInfoCache) invalidate(id digest.Digest) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for key, info := range c.infos {
+		if info.ID == id {
+			delete(c.infos, key)
+		}
+	}
+}
+
+// clearImageInfo clears the image information in both the local store and
+// the cache.
+func (mgr *ImageManager) clearImageInfo(id digest.Digest) {
+	mgr.localStore.ClearCtrdImageInfo(id)
+	mgr.infoCache.invalidate(id)
+}
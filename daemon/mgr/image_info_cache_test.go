@@ -0,0 +1,44 @@
+package mgr
+
+import (
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageInfoCache(t *testing.T) {
+	cache := newImageInfoCache()
+
+	var (
+		id     = digest.FromString("config")
+		target = digest.FromString("manifest")
+		key    = imageInfoCacheKey{target: target}
+	)
+
+	_, ok := cache.get(key)
+	assert.False(t, ok)
+
+	cache.put(key, CtrdImageInfo{ID: id, Size: 1024})
+	info, ok := cache.get(key)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1024), info.Size)
+
+	// the index-only image has different information for the same target
+	_, ok = cache.get(imageInfoCacheKey{target: target, indexOnly: true})
+	assert.False(t, ok)
+
+	cache.invalidate(digest.FromString("other"))
+	_, ok = cache.get(key)
+	assert.True(t, ok)
+
+	cache.invalidate(id)
+	_, ok = cache.get(key)
+	assert.False(t, ok)
+
+	// nil cache means no cache
+	var nilCache *imageInfoCache
+	nilCache.put(key, info)
+	_, ok = nilCache.get(key)
+	assert.False(t, ok)
+}
@@ -0,0 +1,163 @@
+package mgr
+
+import (
+	"context"
+	"strings"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// reservedImageLabelPrefixes are the prefixes of labels used by pouch and
+// containerd on the containerd image, which cannot be set by user.
+var reservedImageLabelPrefixes = []string{"pouch.", "containerd.io/"}
+
+// SetImageLabels sets the labels of image, which are stored in containerd
+// meta data instead of image config, so that the image can be classified
+// after pull without rebuilding. The empty value removes the label.
+//
+// The labels are kept per image ID, and they are set on all the primary
+// references of the image. The labels of image config are immutable, and they take precedence when both of them
+// are merged, like the label filter of ListImages.
+func (mgr *ImageManager) SetImageLabels(ctx context.Context, idOrRef string, labels map[string]string) error {
+	if len(labels) == 0 {
+		return pkgerrors.Wrap(errtypes.ErrInvalidParam, "no label is given")
+	}
+
+	id, _, _, err := mgr.CheckReference(ctx, idOrRef)
+	if err != nil {
+		return err
+	}
+
+	unlock := mgr.imageLocks.lock(id)
+	defer unlock()
+
+	info, err := mgr.localStore.GetCtrdImageInfo(id)
+	if err != nil {
+		if err == errCtrdImageInfoNotExist {
+			return pkgerrors.Wrapf(errtypes.ErrNotfound, "failed to get ctrd image info from cache by imageID: %v", id)
+		}
+		return err
+	}
+
+	for k := range labels {
+		if err := validateImageLabel(k, info.OCISpec.Config.Labels); err != nil {
+			return err
+		}
+	}
+
+	primaryRefs := mgr.localStore.GetPrimaryReferences(id)
+	if len(primaryRefs) == 0 {
+		return pkgerrors.Wrapf(errtypes.ErrNotfound, "image %s", idOrRef)
+	}
+
+	// NOTE: the labels are stored on the containerd image of each primary
+	// reference, which may differ, like the tag pulled after setting labels.
+	// The labels of image ID are set on all of them so that they agree.
+	merged := make(map[string]string, len(info.Labels)+len(labels))
+	for k, v := range info.Labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+
+	fieldpaths := make([]string, 0, len(merged)+len(labels))
+	for k := range merged {
+		fieldpaths = append(fieldpaths, "labels."+k)
+	}
+	for k := range labels {
+		if _, ok := merged[k]; !ok {
+			fieldpaths = append(fieldpaths, "labels."+k)
+		}
+	}
+
+	for _, ref := range primaryRefs {
+		if _, err := mgr.client.UpdateImage(ctx, ctrdmetaimages.Image{
+			Name:   ref.String(),
+			Labels: merged,
+		}, fieldpaths...); err != nil {
+			return pkgerrors.Wrapf(err, "failed to set labels of %s", ref)
+		}
+	}
+
+	// NOTE: the map is replaced instead of updated because the cached info
+	// is shared by the readers.
+	info.Labels = merged
+	mgr.localStore.CacheCtrdImageInfo(id, info)
+	return nil
+}
+
+// mergeImageLabels merges the labels of the containerd images which refer to
+// the same image ID, and the labels of later one take precedence.
+func mergeImageLabels(labels ...map[string]string) map[string]string {
+	res := make(map[string]string)
+	for _, l := range labels {
+		for k, v := range l {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// validateImageLabel checks the key of label to be set, which should neither
+// be reserved nor defined by the image config.
+func validateImageLabel(key string, configLabels map[string]string) error {
+	if key == "" {
+		return pkgerrors.Wrap(errtypes.ErrInvalidParam, "label key cannot be empty")
+	}
+
+	if isReservedImageLabel(key) {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "label %s is reserved", key)
+	}
+
+	if _, ok := configLabels[key]; ok {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "label %s is defined by image config and is immutable", key)
+	}
+	return nil
+}
+
+// userImageLabels returns the labels of containerd image set by user, which
+// excludes the reserved ones like index-only.
+func userImageLabels(labels map[string]string) map[string]string {
+	res := make(map[string]string)
+	for k, v := range labels {
+		if isReservedImageLabel(k) {
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func isReservedImageLabel(key string) bool {
+	for _, prefix := range reservedImageLabelPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageLabels merges the labels set by user and the labels of image config,
+// and the label of image config takes precedence.
+func imageLabels(info CtrdImageInfo) map[string]string {
+	if len(info.Labels) == 0 {
+		return info.OCISpec.Config.Labels
+	}
+
+	res := make(map[string]string, len(info.Labels)+len(info.OCISpec.Config.Labels))
+	for k, v := range info.Labels {
+		res[k] = v
+	}
+	for k, v := range info.OCISpec.Config.Labels {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,91 @@
+package mgr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alibaba/pouch/apis/filters"
+	"github.com/alibaba/pouch/ctrd"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetImageLabels(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	id := digest.FromString("busybox")
+	client := newFakeImageClient()
+	for _, name := range []string{"reg.abc.com/library/busybox:latest", "reg.abc.com/library/busybox:1.30", "reg.abc.com/library/busybox:1.31"} {
+		client.images[name] = &fakeImage{name: name, target: ocispec.Descriptor{Digest: id}}
+	}
+	client.images["reg.abc.com/library/busybox:latest"].labels = map[string]string{ctrd.IndexOnlyLabel: "false"}
+	mgr := &ImageManager{
+		client:     client,
+		localStore: store,
+		imageLocks: newImageLocker(),
+	}
+
+	for _, name := range []string{"reg.abc.com/library/busybox:latest", "reg.abc.com/library/busybox:1.30"} {
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+	}
+	info := CtrdImageInfo{ID: id}
+	info.OCISpec.Config = ocispec.ImageConfig{Labels: map[string]string{"maintainer": "pouch"}}
+	mgr.localStore.CacheCtrdImageInfo(id, info)
+
+	listByLabel := func(label string) int {
+		infos, _, err := mgr.ListImages(context.TODO(), filters.NewArgs(filters.Arg("label", label)), nil)
+		assert.NoError(t, err)
+		return len(infos)
+	}
+	assert.Equal(t, 0, listByLabel("tier=base"))
+
+	assert.NoError(t, mgr.SetImageLabels(context.TODO(), "reg.abc.com/library/busybox:1.30", map[string]string{"tier": "base", "team": "infra"}))
+
+	// the labels are set on all the primary references
+	assert.Equal(t, map[string]string{"tier": "base", "team": "infra"}, client.images["reg.abc.com/library/busybox:1.30"].labels)
+	assert.Equal(t, "base", client.images["reg.abc.com/library/busybox:latest"].labels["tier"])
+
+	img, err := mgr.GetImage(context.TODO(), id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"tier": "base", "team": "infra", "maintainer": "pouch"}, img.Labels)
+	assert.Equal(t, map[string]string{"maintainer": "pouch"}, img.Config.Labels)
+	assert.Equal(t, 1, listByLabel("tier=base"))
+	assert.Equal(t, 1, listByLabel("maintainer=pouch"))
+
+	// the empty value removes the label
+	assert.NoError(t, mgr.SetImageLabels(context.TODO(), id.String(), map[string]string{"tier": ""}))
+	assert.Equal(t, 0, listByLabel("tier"))
+	assert.Equal(t, 1, listByLabel("team=infra"))
+
+	// the labels are kept for the image ID when the tag without labels is
+	// stored, and they are set on the new tag by the next update
+	newTag, err := reference.Parse("reg.abc.com/library/busybox:1.31")
+	assert.NoError(t, err)
+	record := &imageRecord{ref: newTag, target: id, info: CtrdImageInfo{ID: id, Labels: map[string]string{}}}
+	record.info.OCISpec.Config = info.OCISpec.Config
+	assert.NoError(t, mgr.storeImageRecord(record))
+	assert.Equal(t, 1, listByLabel("team=infra"))
+
+	assert.NoError(t, mgr.SetImageLabels(context.TODO(), id.String(), map[string]string{"tier": "app"}))
+	assert.Equal(t, map[string]string{"tier": "app", "team": "infra"}, client.images[newTag.String()].labels)
+	assert.Equal(t, map[string]string{"tier": "app", "team": "infra"}, userImageLabels(client.images["reg.abc.com/library/busybox:latest"].labels))
+
+	for _, labels := range []map[string]string{
+		nil,
+		{"": "empty"},
+		{"maintainer": "others"},
+		{ctrd.IndexOnlyLabel: "true"},
+		{"containerd.io/gc.root": "true"},
+	} {
+		err := mgr.SetImageLabels(context.TODO(), "reg.abc.com/library/busybox:1.30", labels)
+		assert.True(t, errtypes.IsInvalidParam(err), "labels %v", labels)
+	}
+	assert.Equal(t, "false", client.images["reg.abc.com/library/busybox:latest"].labels[ctrd.IndexOnlyLabel])
+}
@@ -0,0 +1,99 @@
+package mgr
+
+import (
+	"context"
+	"io"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// InspectLayers returns the information of each layer of the image, in order
+// from bottom-most to top-most.
+func (mgr *ImageManager) InspectLayers(ctx context.Context, idOrRef string) ([]types.LayerInfo, error) {
+	img, err := mgr.fetchContainerdImage(ctx, idOrRef)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := img.ContentStore()
+	manifest, err := mgr.imageManifest(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: getManifest has checked the number of diffIDs and layers.
+	diffIDs, err := ctrdmetaimages.RootFS(ctx, cs, manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]types.LayerInfo, 0, len(manifest.Layers))
+	for i, layer := range manifest.Layers {
+		info, err := cs.Info(ctx, layer.Digest)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return nil, pkgerrors.Wrapf(errtypes.ErrNotfound, "layer %s of image %s: %v", layer.Digest, idOrRef, err)
+			}
+			return nil, err
+		}
+
+		layers = append(layers, types.LayerInfo{
+			Digest:    layer.Digest.String(),
+			MediaType: layer.MediaType,
+			Size:      info.Size,
+			DiffID:    diffIDs[i].String(),
+		})
+	}
+	return layers, nil
+}
+
+// GetImageLayer returns the compressed layer blob of the image.
+func (mgr *ImageManager) GetImageLayer(ctx context.Context, idOrRef string, layerDigest digest.Digest) (io.ReadCloser, error) {
+	img, err := mgr.fetchContainerdImage(ctx, idOrRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkLocalLayers(img, "get layer of"); err != nil {
+		return nil, err
+	}
+
+	cs := img.ContentStore()
+	manifest, err := mgr.imageManifest(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.Digest != layerDigest {
+			continue
+		}
+
+		ra, err := cs.ReaderAt(ctx, layer)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return nil, pkgerrors.Wrapf(errtypes.ErrNotfound, "layer %s of image %s: %v", layerDigest, idOrRef, err)
+			}
+			return nil, err
+		}
+
+		return &layerReadCloser{
+			Reader: content.NewReader(ra),
+			Closer: ra,
+		}, nil
+	}
+	return nil, pkgerrors.Wrapf(errtypes.ErrNotfound, "layer %s is not part of image %s", layerDigest, idOrRef)
+}
+
+// layerReadCloser reads the layer blob from the content.ReaderAt.
+type layerReadCloser struct {
+	io.Reader
+	io.Closer
+}
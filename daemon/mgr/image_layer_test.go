@@ -0,0 +1,89 @@
+package mgr
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetImageLayer(t *testing.T) {
+	provider := memProvider{}
+	base := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("base"))
+	app := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("app"))
+	other := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("other"))
+
+	img := newFakeImage(t, provider, "reg.abc.com/app:1.0", ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromString("base"), digest.FromString("app")}},
+	}, base, app)
+	mgr, _ := newFakeImageManager(t, img)
+
+	rc, err := mgr.GetImageLayer(context.TODO(), img.name, app.Digest)
+	if assert.NoError(t, err) {
+		data, err := ioutil.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.NoError(t, rc.Close())
+		assert.Equal(t, []byte("app"), data)
+	}
+
+	// the blob in the content store is not returned if it's not the layer
+	// of image
+	_, err = mgr.GetImageLayer(context.TODO(), img.name, other.Digest)
+	assert.True(t, errtypes.IsNotfound(err), "%v", err)
+
+	_, err = mgr.GetImageLayer(context.TODO(), img.name, img.target.Digest)
+	assert.True(t, errtypes.IsNotfound(err), "%v", err)
+
+	// the layer missing in the content store is not found too
+	delete(provider, base.Digest)
+	_, err = mgr.GetImageLayer(context.TODO(), img.name, base.Digest)
+	assert.True(t, errtypes.IsNotfound(err), "%v", err)
+
+	_, err = mgr.GetImageLayer(context.TODO(), "reg.abc.com/none:1.0", app.Digest)
+	assert.True(t, errtypes.IsNotfound(err), "%v", err)
+}
+
+func TestInspectLayers(t *testing.T) {
+	provider := memProvider{}
+	base := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("base layer"))
+	app := provider.add(ocispec.MediaTypeImageLayer, []byte("app"))
+	diffIDs := []digest.Digest{digest.FromString("base"), digest.FromString("app")}
+
+	img := newFakeImage(t, provider, "reg.abc.com/app:1.0", ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: diffIDs},
+	}, base, app)
+
+	mismatched := newFakeImage(t, provider, "reg.abc.com/app:2.0", ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: diffIDs[:1]},
+	}, base, app)
+	mgr, _ := newFakeImageManager(t, img, mismatched)
+
+	// the layers are listed from bottom-most to top-most with the size
+	// of blob in the content store
+	layers, err := mgr.InspectLayers(context.TODO(), img.name)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.LayerInfo{
+		{Digest: base.Digest.String(), MediaType: base.MediaType, Size: 10, DiffID: diffIDs[0].String()},
+		{Digest: app.Digest.String(), MediaType: app.MediaType, Size: 3, DiffID: diffIDs[1].String()},
+	}, layers)
+
+	_, err = mgr.InspectLayers(context.TODO(), mismatched.name)
+	assert.Error(t, err)
+
+	// the layer missing in the content store can't be inspected
+	delete(provider, app.Digest)
+	_, err = mgr.InspectLayers(context.TODO(), img.name)
+	assert.True(t, errtypes.IsNotfound(err), "%v", err)
+}
@@ -0,0 +1,89 @@
+package mgr
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+type queuedNotifierKey struct{}
+
+// WithQueuedNotifier returns a context carrying the callback which will be
+// called when the image operation has to wait for an available slot.
+func WithQueuedNotifier(ctx context.Context, fn func()) context.Context {
+	return context.WithValue(ctx, queuedNotifierKey{}, fn)
+}
+
+func notifyQueued(ctx context.Context) {
+	if fn, ok := ctx.Value(queuedNotifierKey{}).(func()); ok && fn != nil {
+		fn()
+	}
+}
+
+// ioLimiter limits the number of concurrent IO-bound image operations, like
+// SaveImage and LoadImage. The nil ioLimiter means no limitation.
+type ioLimiter struct {
+	name  string
+	slots chan struct{}
+}
+
+// newIOLimiter returns ioLimiter with max concurrent slots. If the max is
+// not positive, it returns nil which means no limitation.
+func newIOLimiter(name string, max int) *ioLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &ioLimiter{
+		name:  name,
+		slots: make(chan struct{}, max),
+	}
+}
+
+// acquire takes a slot. If there is no available slot, the caller will be
+// queued until one of the running operations releases the slot or the ctx
+// is cancelled.
+func (l *ioLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	logrus.Infof("%s is queued, waiting for available slot", l.name)
+	notifyQueued(ctx)
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release gives back the slot.
+func (l *ioLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// releaseOnCloseReader releases the slot when the reader is closed.
+type releaseOnCloseReader struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the reader and releases the slot only once.
+func (r *releaseOnCloseReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,35 @@
+package mgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIOLimiter(t *testing.T) {
+	// nil limiter means no limitation
+	var unlimited *ioLimiter
+	assert.Nil(t, newIOLimiter("unlimited", 0))
+	assert.NoError(t, unlimited.acquire(context.TODO()))
+	unlimited.release()
+
+	l := newIOLimiter("test", 1)
+	assert.NoError(t, l.acquire(context.TODO()))
+
+	// the second one should be queued and cancelled by the context
+	queued := false
+	ctx, cancel := context.WithTimeout(WithQueuedNotifier(context.TODO(), func() {
+		queued = true
+	}), 100*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, l.acquire(ctx))
+	assert.True(t, queued)
+
+	// the cancelled one doesn't take the slot
+	l.release()
+	assert.NoError(t, l.acquire(context.TODO()))
+	l.release()
+}
@@ -1,23 +1,77 @@
 package mgr
 
 import (
+	"archive/tar"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
 	"time"
 
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/jsonstream"
 	"github.com/alibaba/pouch/pkg/multierror"
 	"github.com/alibaba/pouch/pkg/reference"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/images/archive"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	pkgerrors "github.com/pkg/errors"
 )
 
-// LoadImage loads images by the oci.v1 format tarstream.
-func (mgr *ImageManager) LoadImage(ctx context.Context, imageName string, tarstream io.ReadCloser) error {
+const (
+	// imageLoadStatusLoaded means the image is loaded successfully.
+	imageLoadStatusLoaded = "loaded"
+	// imageLoadStatusFailed means the image fails to be loaded.
+	imageLoadStatusFailed = "failed"
+)
+
+// LoadImage loads images by the docker or oci.v1 format tarstream. The
+// progress and the outcome of each image are written into out as NDJSON.
+func (mgr *ImageManager) LoadImage(ctx context.Context, imageName string, tarstream io.ReadCloser, out io.Writer, opt *ImageLoadOption) error {
 	defer tarstream.Close()
 
+	if out == nil {
+		out = ioutil.Discard
+	}
+	stream := jsonstream.New(out, &ndjsonFormat{})
+
+	err := mgr.loadImage(ctx, imageName, tarstream, stream, opt)
+	if err != nil {
+		// Send Error information to client through stream
+		stream.WriteObject(jsonstream.JSONMessage{
+			Error: &jsonstream.JSONError{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			},
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	// close and wait stream
+	stream.Close()
+	stream.Wait()
+	return err
+}
+
+func (mgr *ImageManager) loadImage(ctx context.Context, imageName string, tarstream io.Reader, stream *jsonstream.JSONStream, opt *ImageLoadOption) error {
+	if opt == nil {
+		opt = &ImageLoadOption{}
+	}
+
+	if err := validateImageArchiveFormat(opt.Format); err != nil {
+		return err
+	}
+
+	if err := mgr.loadLimiter.acquire(ctx); err != nil {
+		return err
+	}
+	defer mgr.loadLimiter.release()
+
 	var opts []containerd.ImportOpt
 
 	// NOTE: for the docker image, we should pass empty image name because
@@ -45,7 +99,43 @@ func (mgr *ImageManager) LoadImage(ctx context.Context, imageName string, tarstr
 		opts = append(opts, containerd.WithImageRefTranslator(archive.FilterRefPrefix(imageName)))
 	}
 
-	imgs, err := mgr.client.ImportImage(ctx, tarstream, opts...)
+	var (
+		reader   io.Reader = newLoadProgressReader(tarstream, stream)
+		guard    *guardedReader
+		detector *archiveFormatDetector
+	)
+
+	// NOTE: the guard rejects the abusive tarstream by failing the read
+	// before the rejected entry reaches the containerd, so that the import
+	// is aborted before any image is created or overwritten.
+	if mgr.loadLimits.enabled() {
+		guard = newGuardedReader(reader, mgr.loadLimits)
+		reader = guard
+	}
+
+	// NOTE: the containerd detects the format by itself. The detector is
+	// only used to check the format if it's required by caller, and it
+	// rejects the archive in other format before the import completes.
+	if opt.Format != "" {
+		detector = newArchiveFormatDetector(reader, opt.Format)
+		reader = detector
+	}
+
+	// NOTE: the layers omitted by the delta archive are supplied by the
+	// base image during the import.
+	rebased := mgr.rebaseDeltaArchive(ctx, reader)
+	imgs, err := mgr.client.ImportImage(ctx, rebased, opts...)
+	rebased.Close()
+	if guard != nil {
+		if gerr := guard.err(); gerr != nil {
+			return gerr
+		}
+	}
+	if detector != nil {
+		if derr := detector.err(); derr != nil {
+			return derr
+		}
+	}
 	if err != nil {
 		return pkgerrors.Wrap(err, "failed to import image into containerd by tarstream")
 	}
@@ -53,10 +143,37 @@ func (mgr *ImageManager) LoadImage(ctx context.Context, imageName string, tarstr
 	// FIXME(fuwei): if the store fails to update reference cache, the daemon
 	// may fail to load after restart.
 	merrs := new(multierror.Multierrors)
+	var loaded []string
 	for _, img := range imgs {
 		if err := mgr.StoreImageReference(ctx, img); err != nil {
 			merrs.Append(fmt.Errorf("fail to store reference: %s: %v", img.Name(), err))
+			stream.WriteObject(types.ImageLoadResult{
+				Name:   img.Name(),
+				Status: imageLoadStatusFailed,
+				Error:  err.Error(),
+			})
+			continue
 		}
+
+		// NOTE: the layers have been extracted during import.
+		writeLayersStatus(stream, mgr.imageLayers(ctx, img), jsonstream.LoadStatusComplete)
+
+		result := types.ImageLoadResult{
+			Name:   img.Name(),
+			Status: imageLoadStatusLoaded,
+		}
+		if cfg, _, _, err := mgr.imageConfig(ctx, img); err == nil {
+			result.ID = cfg.Digest.String()
+		}
+		stream.WriteObject(result)
+		mgr.LogImageEvent(ctx, result.ID, img.Name(), "load")
+		loaded = append(loaded, img.Name())
+	}
+
+	for _, name := range loaded {
+		stream.WriteObject(jsonstream.JSONMessage{
+			Status: fmt.Sprintf("Loaded image: %s", name),
+		})
 	}
 
 	if merrs.Size() != 0 {
@@ -64,3 +181,116 @@ func (mgr *ImageManager) LoadImage(ctx context.Context, imageName string, tarstr
 	}
 	return nil
 }
+
+// loadProgressInterval is the interval to report the read bytes of tarstream.
+const loadProgressInterval = time.Second
+
+// loadProgressReader reports the read bytes of tarstream periodically.
+type loadProgressReader struct {
+	r      io.Reader
+	stream *jsonstream.JSONStream
+
+	current  int64
+	reported time.Time
+}
+
+func newLoadProgressReader(r io.Reader, stream *jsonstream.JSONStream) *loadProgressReader {
+	return &loadProgressReader{
+		r:        r,
+		stream:   stream,
+		reported: time.Now(),
+	}
+}
+
+// Read implements io.Reader.
+func (r *loadProgressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.current += int64(n)
+
+	if err == io.EOF || time.Since(r.reported) >= loadProgressInterval {
+		r.reported = time.Now()
+		r.stream.WriteObject(jsonstream.JSONMessage{
+			ID:     "tarstream",
+			Status: jsonstream.LoadStatusReading,
+			Detail: &jsonstream.ProgressDetail{
+				Current: r.current,
+			},
+		})
+	}
+	return n, err
+}
+
+// ndjsonFormat writes each object in one line.
+type ndjsonFormat struct{}
+
+func (f *ndjsonFormat) BeginWrite() ([]byte, error) {
+	return nil, nil
+}
+
+func (f *ndjsonFormat) EndWrite() ([]byte, error) {
+	return nil, nil
+}
+
+func (f *ndjsonFormat) Write(o interface{}) ([]byte, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// archiveFormatDetector detects the format of archive by the top-level
+// entries while the tarstream is being read, and fails the read if it isn't
+// the required one. Like the containerd, the oci format is preferred if there
+// are both oci-layout and manifest.json, so the archive is rejected once
+// oci-layout is found if the docker format is required. Otherwise, the
+// archive is checked before its end of archive is returned, so that the
+// import is aborted before any image is created.
+type archiveFormatDetector struct {
+	*tarChecker
+
+	required     string
+	hasOCILayout bool
+	hasManifest  bool
+}
+
+func newArchiveFormatDetector(r io.Reader, required string) *archiveFormatDetector {
+	d := &archiveFormatDetector{required: required}
+	d.tarChecker = newTarChecker(r, func(hdr *tar.Header, r io.Reader) error {
+		switch path.Clean(hdr.Name) {
+		case ocispec.ImageLayoutFile:
+			d.hasOCILayout = true
+			return d.check()
+		case "manifest.json":
+			d.hasManifest = true
+		}
+		return nil
+	}, d.check)
+	return d
+}
+
+// check returns error if the format detected isn't the required one.
+func (d *archiveFormatDetector) check() error {
+	format := d.format()
+	if format == d.required {
+		return nil
+	}
+
+	if format == "" {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the format of tarstream is unknown, but %q is required", d.required)
+	}
+	return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the tarstream is in %q format, but %q is required", format, d.required)
+}
+
+// format returns the format detected so far. It returns empty string if the
+// format is unknown.
+func (d *archiveFormatDetector) format() string {
+	switch {
+	case d.hasOCILayout:
+		return ImageArchiveFormatOCI
+	case d.hasManifest:
+		return ImageArchiveFormatDocker
+	default:
+		return ""
+	}
+}
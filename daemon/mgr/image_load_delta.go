@@ -0,0 +1,292 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// rebaseDeltaArchive returns the tarstream in which the layers omitted by the
+// delta archive are supplied by the base image, so that the importer of
+// containerd can load it like the full archive. The other tarstream is passed
+// through as it is.
+//
+// The returned reader should be closed after the import, which stops the
+// rewriting if the import fails.
+func (mgr *ImageManager) rebaseDeltaArchive(ctx context.Context, r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(mgr.rebaseDelta(ctx, r, pw))
+	}()
+	return pr
+}
+
+// rebaseDelta copies the tarstream from r to w, and writes the layers of base
+// image before manifest.json if manifest.json refers to the base image. The
+// other bytes are copied as they are, so the tarstream which isn't the delta
+// archive is not rewritten.
+//
+// NOTE: the delta archive is exported by pouch, in which manifest.json is
+// written after all the layers because the entries are sorted by name. So
+// the missing layers are known when manifest.json is reached.
+func (mgr *ImageManager) rebaseDelta(ctx context.Context, r io.Reader, w io.Writer) error {
+	var (
+		fw   = &tarForwarder{r: r, w: w}
+		tr   = tar.NewReader(fw)
+		seen = make(map[string]struct{})
+
+		// padding is the size of padding of the last entry, which is
+		// read by the tar reader before the next header.
+		padding int64
+	)
+
+	for {
+		// NOTE: the header is held until it's known whether the entry
+		// should be rewritten.
+		fw.hold()
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if err := fw.release(); err != nil {
+				return err
+			}
+
+			// copy the rest of the tarstream, like the trailing zero
+			// blocks of the record.
+			_, err := io.Copy(ioutil.Discard, fw)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		if name != "manifest.json" {
+			seen[name] = struct{}{}
+			if err := fw.release(); err != nil {
+				return err
+			}
+			if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+				return err
+			}
+			padding = tarPadding(hdr.Size)
+			continue
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+
+		// NOTE: the invalid manifest.json is left to the importer.
+		var (
+			items   []dockerArchiveManifestItem
+			records map[string]tarRecord
+		)
+		if err := json.Unmarshal(b, &items); err == nil {
+			if records, err = mgr.deltaBaseRecords(ctx, items, seen); err != nil {
+				return err
+			}
+		}
+
+		if len(records) == 0 {
+			if err := fw.release(); err != nil {
+				return err
+			}
+			padding = tarPadding(hdr.Size)
+			continue
+		}
+
+		// keep the padding of the last entry, and replace manifest.json
+		// with the records followed by manifest.json.
+		held := fw.drop()
+		if _, err := w.Write(held[:padding]); err != nil {
+			return err
+		}
+
+		tw := tar.NewWriter(w)
+		if err := writeTarRecords(ctx, tw, records); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+
+		// NOTE: Flush writes the padding of manifest.json, so that the
+		// padding read from the tarstream is skipped.
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fw.skip = tarPadding(hdr.Size)
+		padding = 0
+	}
+}
+
+const tarBlockSize = 512
+
+// tarPadding returns the size of padding after the entry content.
+func tarPadding(size int64) int64 {
+	return (tarBlockSize - size%tarBlockSize) % tarBlockSize
+}
+
+// tarForwarder is read by the tar reader, and writes the bytes read into w,
+// which makes a copy of the tarstream.
+type tarForwarder struct {
+	r io.Reader
+	w io.Writer
+
+	// held keeps the bytes read instead of writing them if it isn't nil.
+	held *bytes.Buffer
+
+	// skip is the size of bytes to be dropped.
+	skip int64
+}
+
+// Read implements io.Reader.
+func (f *tarForwarder) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 {
+		if werr := f.forward(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (f *tarForwarder) forward(b []byte) error {
+	if f.skip > 0 {
+		k := f.skip
+		if k > int64(len(b)) {
+			k = int64(len(b))
+		}
+		b, f.skip = b[k:], f.skip-k
+	}
+
+	if f.held != nil {
+		f.held.Write(b)
+		return nil
+	}
+	_, err := f.w.Write(b)
+	return err
+}
+
+// hold starts to hold the bytes read.
+func (f *tarForwarder) hold() {
+	f.held = new(bytes.Buffer)
+}
+
+// release writes the bytes held, and stops holding.
+func (f *tarForwarder) release() error {
+	held := f.drop()
+	if len(held) == 0 {
+		return nil
+	}
+	_, err := f.w.Write(held)
+	return err
+}
+
+// drop returns the bytes held, and stops holding without writing them.
+func (f *tarForwarder) drop() []byte {
+	if f.held == nil {
+		return nil
+	}
+	held := f.held.Bytes()
+	f.held = nil
+	return held
+}
+
+// deltaBaseRecords returns the records of layers which are listed by the
+// images of delta archive but not in the tarstream. The layers are read from
+// the base image, which should be present.
+func (mgr *ImageManager) deltaBaseRecords(ctx context.Context, items []dockerArchiveManifestItem, seen map[string]struct{}) (map[string]tarRecord, error) {
+	records := make(map[string]tarRecord)
+	for _, item := range items {
+		if item.BaseImage == "" {
+			continue
+		}
+
+		var missing []string
+		for _, name := range item.Layers {
+			if _, ok := seen[path.Clean(name)]; !ok {
+				missing = append(missing, path.Clean(name))
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		if err := mgr.addBaseLayerRecords(ctx, item.BaseImage, missing, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// addBaseLayerRecords adds the records of the layers from the base image.
+func (mgr *ImageManager) addBaseLayerRecords(ctx context.Context, baseImage string, names []string, records map[string]tarRecord) error {
+	id, err := digest.Parse(baseImage)
+	if err != nil {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid base image %s of delta archive", baseImage)
+	}
+
+	primaryRefs := mgr.localStore.GetPrimaryReferences(id)
+	if len(primaryRefs) == 0 {
+		return pkgerrors.Wrapf(errtypes.ErrNotfound, "base image %s of delta archive should be loaded first", baseImage)
+	}
+
+	img, err := mgr.client.GetImage(ctx, primaryRefs[0].String())
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to get base image %s of delta archive", baseImage)
+	}
+
+	_, platform, _, err := mgr.imageConfig(ctx, img)
+	if err != nil {
+		return err
+	}
+
+	store := img.ContentStore()
+	manifest, err := ctrdmetaimages.Manifest(ctx, store, img.Target(), platform)
+	if err != nil {
+		return err
+	}
+
+	ociImage, err := readOciImage(ctx, store, manifest.Config)
+	if err != nil {
+		return err
+	}
+
+	diffIDs := ociImage.RootFS.DiffIDs
+	if len(diffIDs) != len(manifest.Layers) {
+		return pkgerrors.Errorf("mismatched number of layers and diffIDs for image %s", manifest.Config.Digest)
+	}
+
+	layers := make(map[string]int, len(diffIDs))
+	for i, diffID := range diffIDs {
+		layers[diffID.Hex()+"/layer.tar"] = i
+	}
+
+	for _, name := range names {
+		i, ok := layers[name]
+		if !ok {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "layer %s is neither in delta archive nor in base image %s", name, baseImage)
+		}
+
+		dirRecord := directoryRecord(path.Dir(name) + "/")
+		records[dirRecord.header.Name] = dirRecord
+		records[name] = contentRecord(store, name, 0644, manifest.Layers[i])
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/platforms"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func readTarFiles(t *testing.T, r io.Reader) map[string][]byte {
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+
+		data := new(bytes.Buffer)
+		if _, err := io.Copy(data, tr); err != nil {
+			t.Fatalf("failed to read %s: %v", hdr.Name, err)
+		}
+		files[hdr.Name] = data.Bytes()
+	}
+}
+
+func TestDeltaArchive(t *testing.T) {
+	provider := memProvider{}
+
+	newImage := func(layers ...string) (digest.Digest, ocispec.Descriptor) {
+		var (
+			descs   []ocispec.Descriptor
+			diffIDs []digest.Digest
+		)
+		for _, layer := range layers {
+			descs = append(descs, provider.add(ocispec.MediaTypeImageLayer, []byte(layer)))
+			diffIDs = append(diffIDs, digest.FromBytes([]byte(layer)))
+		}
+
+		config, err := json.Marshal(ocispec.Image{
+			Architecture: "amd64",
+			OS:           "linux",
+			RootFS: ocispec.RootFS{
+				Type:    "layers",
+				DiffIDs: diffIDs,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal config: %v", err)
+		}
+
+		configDesc := provider.add(ocispec.MediaTypeImageConfig, config)
+		manifest, err := json.Marshal(ocispec.Manifest{
+			Versioned: ocispecs.Versioned{SchemaVersion: 2},
+			Config:    configDesc,
+			Layers:    descs,
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal manifest: %v", err)
+		}
+		return configDesc.Digest, provider.add(ocispec.MediaTypeImageManifest, manifest)
+	}
+
+	baseID, base := newImage("base")
+	_, app := newImage("base", "app")
+
+	exporter := &dockerArchiveExporter{}
+	exporter.setBase(baseID, base, platforms.Default())
+	exporter.add(app, platforms.Default(), mustParseReference(t, "reg.abc.com/app:1.0"))
+
+	buf := new(bytes.Buffer)
+	if err := exporter.Export(context.TODO(), provider, buf); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	delta := buf.Bytes()
+
+	baseLayer := digest.FromBytes([]byte("base")).Hex() + "/layer.tar"
+	appLayer := digest.FromBytes([]byte("app")).Hex() + "/layer.tar"
+
+	// the layer of base image is omitted, but it's still listed
+	files := readTarFiles(t, bytes.NewReader(delta))
+	assert.NotContains(t, files, baseLayer)
+	assert.Equal(t, []byte("app"), files[appLayer])
+
+	var items []dockerArchiveManifestItem
+	assert.NoError(t, json.Unmarshal(files["manifest.json"], &items))
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, baseID.String(), items[0].BaseImage)
+	assert.Equal(t, []string{baseLayer, appLayer}, items[0].Layers)
+
+	store, err := newImageStore()
+	assert.NoError(t, err)
+	mgr := &ImageManager{
+		client: newFakeImageClient(&fakeImage{
+			name:   "reg.abc.com/base:1.0",
+			target: base,
+			store:  memContentStore{memProvider: provider},
+		}),
+		localStore: store,
+	}
+
+	// the base image should be present
+	err = mgr.rebaseDelta(context.TODO(), bytes.NewReader(delta), new(bytes.Buffer))
+	assert.True(t, errtypes.IsNotfound(err))
+
+	assert.NoError(t, mgr.addReferenceIntoStore(baseID, mustParseReference(t, "reg.abc.com/base:1.0"), base.Digest))
+
+	// the layer of base image is supplied before manifest.json
+	rebased := new(bytes.Buffer)
+	assert.NoError(t, mgr.rebaseDelta(context.TODO(), bytes.NewReader(delta), rebased))
+
+	files = readTarFiles(t, rebased)
+	assert.Equal(t, []byte("base"), files[baseLayer])
+	assert.Equal(t, []byte("app"), files[appLayer])
+	assert.Contains(t, files, "manifest.json")
+	assert.Contains(t, files, "repositories")
+
+	// the tarstream is rewritten only for the delta archive
+	assert.NotEqual(t, delta, rebased.Bytes())
+
+	// the archive without base image is passed through as it is, including
+	// the zero blocks after the trailer
+	buf = new(bytes.Buffer)
+	full := &dockerArchiveExporter{}
+	full.add(base, platforms.Default(), mustParseReference(t, "reg.abc.com/base:1.0"))
+	assert.NoError(t, full.Export(context.TODO(), provider, buf))
+	buf.Write(make([]byte, 4*tarBlockSize))
+
+	copied := new(bytes.Buffer)
+	assert.NoError(t, mgr.rebaseDelta(context.TODO(), bytes.NewReader(buf.Bytes()), copied))
+	assert.Equal(t, buf.Bytes(), copied.Bytes())
+}
@@ -0,0 +1,261 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// loadLimits limits the tarstream so that the crafted tarstream cannot
+// exhaust the resource during loading. The manifests are limited by the layer
+// count and size, and the whole tarstream is limited by the entry count and
+// size while streaming, since the docker archive manifest.json is the last
+// entry. The non-positive value means no limitation.
+type loadLimits struct {
+	maxLayers       int
+	maxManifestSize int64
+	maxEntries      int
+	maxSize         int64
+}
+
+// enabled returns true if there is any limitation.
+func (l loadLimits) enabled() bool {
+	return l.maxLayers > 0 || l.maxManifestSize > 0 || l.maxEntries > 0 || l.maxSize > 0
+}
+
+// checker returns the function to check each entry of one tarstream, which
+// counts the entries and their sizes before checking the manifests.
+func (l loadLimits) checker() func(hdr *tar.Header, r io.Reader) error {
+	count := l.counter()
+	return func(hdr *tar.Header, r io.Reader) error {
+		if err := count(hdr); err != nil {
+			return err
+		}
+		return l.checkEntry(hdr, r)
+	}
+}
+
+// counter returns the function to count the entries of one tarstream and
+// their sizes, which only checks the entry count and size. It's used alone
+// for the tarstream which isn't the image archive, like the rootfs tarball.
+func (l loadLimits) counter() func(hdr *tar.Header) error {
+	var (
+		entries int
+		size    int64
+	)
+	return func(hdr *tar.Header) error {
+		entries++
+		if l.maxEntries > 0 && entries > l.maxEntries {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the tarstream contains more than %d entries", l.maxEntries)
+		}
+
+		size += hdr.Size
+		if l.maxSize > 0 && size > l.maxSize {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the size of tarstream is larger than limit %d", l.maxSize)
+		}
+		return nil
+	}
+}
+
+// manifestLike contains the fields to count the layers in docker archive
+// manifest.json or oci manifest blob.
+type manifestLike struct {
+	Layers []json.RawMessage `json:"layers"`
+}
+
+// checkEntry checks one entry of tarstream. The docker archive manifest.json
+// and the json blobs, like oci index, manifest and config, are limited by the
+// manifest size. The layers declared by the manifests are limited by the layer
+// count.
+func (l loadLimits) checkEntry(hdr *tar.Header, r io.Reader) error {
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return nil
+	}
+
+	name := path.Clean(hdr.Name)
+	isDockerManifest := name == "manifest.json"
+	isMetadata := isDockerManifest || name == "index.json" || name == "repositories"
+
+	// NOTE: the blobs in oci layout are named by digest so that the json
+	// blob is identified by the first byte.
+	if !isMetadata {
+		if !strings.HasPrefix(name, "blobs/") {
+			return nil
+		}
+
+		first := make([]byte, 1)
+		if n, _ := io.ReadFull(r, first); n == 0 || first[0] != '{' {
+			return nil
+		}
+		r = io.MultiReader(bytes.NewReader(first), r)
+	}
+
+	if l.maxManifestSize > 0 && hdr.Size > l.maxManifestSize {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the size of %s is %d, larger than limit %d", name, hdr.Size, l.maxManifestSize)
+	}
+
+	if l.maxLayers <= 0 || name == "repositories" || name == "index.json" {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var manifests []manifestLike
+	if isDockerManifest {
+		if err := json.Unmarshal(data, &manifests); err != nil {
+			return nil
+		}
+	} else {
+		var m manifestLike
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil
+		}
+		manifests = append(manifests, m)
+	}
+
+	for _, m := range manifests {
+		if len(m.Layers) > l.maxLayers {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "%s declares %d layers, more than limit %d", name, len(m.Layers), l.maxLayers)
+		}
+	}
+	return nil
+}
+
+// guardedReader checks the tarstream while it's being read, and fails the
+// read once the tarstream is found abusive. The entry is checked before its
+// bytes are returned, so the containerd never imports the rejected tarstream.
+type guardedReader struct {
+	*tarChecker
+}
+
+func newGuardedReader(r io.Reader, limits loadLimits) *guardedReader {
+	return &guardedReader{
+		tarChecker: newTarChecker(r, limits.checker(), nil),
+	}
+}
+
+// tarCheckerChunkSize is the size of bytes read at most by one step of the
+// tarChecker within the entry.
+const tarCheckerChunkSize = 32 * 1024
+
+// tarChecker parses the tarstream in the read, and calls onEntry for each
+// entry and onEnd at the end of archive before the bytes of them are
+// returned. The error returned by them fails the read and is kept by err.
+// The tarstream which cannot be parsed is passed through once onEnd is
+// passed, since the containerd may accept the compressed archive.
+type tarChecker struct {
+	src     *sourceReader
+	tr      *tar.Reader
+	onEntry func(hdr *tar.Header, r io.Reader) error
+	onEnd   func() error
+
+	// pending keeps the bytes parsed but not returned yet.
+	pending bytes.Buffer
+	discard []byte
+	inEntry bool
+	parsed  bool
+	lastErr error
+}
+
+// sourceReader records the error of the source other than io.EOF, so that
+// it's not taken as the malformed tarstream.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read implements io.Reader.
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+func newTarChecker(r io.Reader, onEntry func(hdr *tar.Header, r io.Reader) error, onEnd func() error) *tarChecker {
+	c := &tarChecker{
+		src:     &sourceReader{r: r},
+		onEntry: onEntry,
+		onEnd:   onEnd,
+	}
+	c.tr = tar.NewReader(io.TeeReader(c.src, &c.pending))
+	return c
+}
+
+// Read implements io.Reader.
+func (c *tarChecker) Read(p []byte) (int, error) {
+	for c.pending.Len() == 0 && c.lastErr == nil {
+		c.lastErr = c.step()
+	}
+
+	if c.pending.Len() > 0 {
+		return c.pending.Read(p)
+	}
+	return 0, c.lastErr
+}
+
+// err returns the error returned by onEntry or onEnd.
+func (c *tarChecker) err() error {
+	if c.lastErr == io.EOF {
+		return nil
+	}
+	return c.lastErr
+}
+
+// step parses the next part of tarstream, and the bytes parsed are kept in
+// pending. The pending bytes are dropped if the check fails.
+func (c *tarChecker) step() error {
+	if c.parsed {
+		_, err := io.CopyN(&c.pending, c.src, tarCheckerChunkSize)
+		return err
+	}
+
+	if c.inEntry {
+		if c.discard == nil {
+			c.discard = make([]byte, tarCheckerChunkSize)
+		}
+
+		// NOTE: the content is kept in pending by the tee reader.
+		_, err := c.tr.Read(c.discard)
+		if err == io.EOF {
+			c.inEntry = false
+			return nil
+		}
+		return err
+	}
+
+	hdr, err := c.tr.Next()
+	if err != nil {
+		if c.src.err != nil {
+			return c.src.err
+		}
+
+		c.parsed = true
+		if c.onEnd != nil {
+			if err := c.onEnd(); err != nil {
+				c.pending.Reset()
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := c.onEntry(hdr, c.tr); err != nil {
+		c.pending.Reset()
+		return err
+	}
+	c.inEntry = true
+	return nil
+}
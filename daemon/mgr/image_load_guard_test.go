@@ -0,0 +1,168 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTarstream(t *testing.T, records ...tarRecord) []byte {
+	m := make(map[string]tarRecord, len(records))
+	for _, record := range records {
+		m[record.header.Name] = record
+	}
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if err := writeTarRecords(context.TODO(), tw, m); err != nil {
+		t.Fatalf("failed to write tarstream: %v", err)
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestGuardedReader(t *testing.T) {
+	limits := loadLimits{maxLayers: 10, maxManifestSize: 4096}
+
+	newManifest := func(layers int) ocispec.Manifest {
+		m := ocispec.Manifest{Versioned: ocispecs.Versioned{SchemaVersion: 2}}
+		for i := 0; i < layers; i++ {
+			m.Layers = append(m.Layers, ocispec.Descriptor{
+				MediaType: ocispec.MediaTypeImageLayerGzip,
+				Digest:    digest.FromBytes([]byte{byte(i)}),
+				Size:      1,
+			})
+		}
+		return m
+	}
+
+	layer := tarRecord{
+		header: normalizedHeader("blobs/sha256/"+digest.FromString("layer").Hex(), 0444, 5, tar.TypeReg),
+		copyTo: func(ctx context.Context, w io.Writer) (int64, error) {
+			n, err := w.Write([]byte("layer"))
+			return int64(n), err
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name: "oci manifest within limits",
+			data: newTestTarstream(t, layer, mustJSONRecord(t, "blobs/sha256/manifest", newManifest(10))),
+		}, {
+			name:    "oci manifest declaring excessive layers",
+			data:    newTestTarstream(t, layer, mustJSONRecord(t, "blobs/sha256/manifest", newManifest(11))),
+			wantErr: true,
+		}, {
+			name:    "oversized oci manifest",
+			data:    newTestTarstream(t, mustJSONRecord(t, "blobs/sha256/manifest", newManifest(50))),
+			wantErr: true,
+		}, {
+			name: "docker manifest within limits",
+			data: newTestTarstream(t, mustJSONRecord(t, "manifest.json", []dockerArchiveManifestItem{
+				{Config: "config.json", Layers: make([]string, 10)},
+			})),
+		}, {
+			name: "docker manifest declaring excessive layers",
+			data: newTestTarstream(t, mustJSONRecord(t, "manifest.json", []dockerArchiveManifestItem{
+				{Config: "config.json", Layers: make([]string, 1)},
+				{Config: "config.json", Layers: make([]string, 1000)},
+			})),
+			wantErr: true,
+		},
+	} {
+		out := new(bytes.Buffer)
+		_, err := io.Copy(out, newGuardedReader(bytes.NewReader(tc.data), limits))
+
+		assert.Equal(t, tc.wantErr, err != nil, "%s: %v", tc.name, err)
+		if tc.wantErr {
+			assert.True(t, errtypes.IsInvalidParam(pkgerrors.Cause(err)), "%s: %v", tc.name, err)
+
+			// the rejected entry is never returned by the read
+			assert.False(t, bytes.Contains(out.Bytes(), []byte("manifest")), tc.name)
+		} else {
+			assert.Equal(t, tc.data, out.Bytes(), tc.name)
+		}
+	}
+}
+
+func TestGuardedReaderStreamingLimits(t *testing.T) {
+	records := make([]tarRecord, 0, 20)
+	for i := 0; i < 20; i++ {
+		records = append(records, tarRecord{
+			header: normalizedHeader(fmt.Sprintf("layer%d/layer.tar", i), 0444, 5, tar.TypeReg),
+			copyTo: func(ctx context.Context, w io.Writer) (int64, error) {
+				n, err := w.Write([]byte("layer"))
+				return int64(n), err
+			},
+		})
+	}
+	data := newTestTarstream(t, records...)
+
+	for _, tc := range []struct {
+		name    string
+		limits  loadLimits
+		wantErr bool
+	}{
+		{name: "within limits", limits: loadLimits{maxEntries: 20, maxSize: 100}},
+		{name: "excessive entries", limits: loadLimits{maxEntries: 10}, wantErr: true},
+		{name: "oversized tarstream", limits: loadLimits{maxSize: 50}, wantErr: true},
+	} {
+		// the tarstream is rejected without manifest.json
+		_, err := io.Copy(ioutil.Discard, newGuardedReader(bytes.NewReader(data), tc.limits))
+
+		assert.Equal(t, tc.wantErr, err != nil, "%s: %v", tc.name, err)
+		if tc.wantErr {
+			assert.True(t, errtypes.IsInvalidParam(pkgerrors.Cause(err)), "%s: %v", tc.name, err)
+		}
+	}
+}
+
+func TestLoadImageRejectionKeepsExistingImages(t *testing.T) {
+	var (
+		provider = memProvider{}
+		existing = newFakeImage(t, provider, "docker.io/library/foo:latest", ocispec.Image{OS: "linux"})
+		imported = newFakeImage(t, provider, "docker.io/library/foo:latest", ocispec.Image{OS: "windows"})
+	)
+
+	data := newTestTarstream(t, mustJSONRecord(t, "manifest.json", []dockerArchiveManifestItem{
+		{Config: "config.json", RepoTags: []string{"foo:latest"}, Layers: make([]string, 2)},
+	}))
+
+	for _, tc := range []struct {
+		name   string
+		limits loadLimits
+		opt    *ImageLoadOption
+	}{
+		{name: "abusive tarstream", limits: loadLimits{maxLayers: 1}},
+		{name: "unexpected format", opt: &ImageLoadOption{Format: ImageArchiveFormatOCI}},
+	} {
+		mgr, client := newFakeImageManager(t, existing)
+		mgr.loadLimiter = newIOLimiter("image load", 0)
+		mgr.loadLimits = tc.limits
+		client.imports = []*fakeImage{imported}
+
+		err := mgr.LoadImage(context.TODO(), "", ioutil.NopCloser(bytes.NewReader(data)), nil, tc.opt)
+		assert.True(t, errtypes.IsInvalidParam(pkgerrors.Cause(err)), "%s: %v", tc.name, err)
+
+		// the import is aborted before the existing image is overwritten,
+		// and nothing is removed.
+		assert.Equal(t, existing.target, client.images[existing.name].target, tc.name)
+		assert.Empty(t, client.removed, tc.name)
+	}
+}
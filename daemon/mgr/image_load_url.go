@@ -0,0 +1,102 @@
+package mgr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// maxLoadURLRedirects is the max number of redirects to follow when
+// downloading the tarstream.
+const maxLoadURLRedirects = 10
+
+// allowedLoadURLSchemes is the schemes allowed to download the tarstream,
+// which rejects the local file and the other protocols.
+var allowedLoadURLSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+}
+
+// LoadImageFromURL downloads the tarstream from the url and loads it like
+// LoadImage. The username and password of authConfig are sent as basic auth,
+// and they're only sent over https.
+func (mgr *ImageManager) LoadImageFromURL(ctx context.Context, imageName, rawURL string, authConfig *types.AuthConfig, out io.Writer, opt *ImageLoadOption) error {
+	body, err := openLoadURL(ctx, rawURL, authConfig)
+	if err != nil {
+		return err
+	}
+	return mgr.LoadImage(ctx, imageName, body, out, opt)
+}
+
+// openLoadURL requests the url and returns the body of response.
+func openLoadURL(ctx context.Context, rawURL string, authConfig *types.AuthConfig) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid url: %v", err)
+	}
+
+	if u.User != nil {
+		return nil, pkgerrors.Wrap(errtypes.ErrInvalidParam, "the credential should not be in the url")
+	}
+
+	withAuth := authConfig != nil && (authConfig.Username != "" || authConfig.Password != "")
+	if err := validateLoadURL(u, withAuth); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid url: %v", err)
+	}
+	req = req.WithContext(ctx)
+	if withAuth {
+		req.SetBasicAuth(authConfig.Username, authConfig.Password)
+	}
+
+	client := &http.Client{
+		// NOTE: the Authorization header is dropped by the client if
+		// the request is redirected to another host.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxLoadURLRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxLoadURLRedirects)
+			}
+			return validateLoadURL(req.URL, withAuth)
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(err, "failed to download %s", u)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
+		err := fmt.Errorf("failed to download %s: %s", u, resp.Status)
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, pkgerrors.Wrap(errtypes.ErrNotfound, err.Error())
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// validateLoadURL checks the scheme of url against the allowlist, and the
+// credential is never sent in plain text.
+func validateLoadURL(u *url.URL, withAuth bool) error {
+	if !allowedLoadURLSchemes[u.Scheme] {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the scheme %q of url is not allowed", u.Scheme)
+	}
+
+	if withAuth && u.Scheme != "https" {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the credential can only be sent over https, but got %q", u.Scheme)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package mgr
+
+import (
+	"sort"
+	"sync"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// imageLocker provides the read/write lock per image ID. The inspect of image
+// holds the read lock so that it sees the consistent references and cache,
+// while the removal mutates them under the write lock. The locks of different
+// images are independent.
+type imageLocker struct {
+	sync.Mutex
+	locks map[digest.Digest]*imageLock
+}
+
+// imageLock is released from the locker when there is no holder or waiter.
+type imageLock struct {
+	sync.RWMutex
+	refs int
+}
+
+func newImageLocker() *imageLocker {
+	return &imageLocker{
+		locks: make(map[digest.Digest]*imageLock),
+	}
+}
+
+// rlock acquires the read lock of image and returns the unlock function.
+func (l *imageLocker) rlock(id digest.Digest) func() {
+	if l == nil {
+		return func() {}
+	}
+
+	lock := l.get(id)
+	lock.RLock()
+	return func() {
+		lock.RUnlock()
+		l.put(id)
+	}
+}
+
+// lock acquires the write lock of image and returns the unlock function.
+func (l *imageLocker) lock(id digest.Digest) func() {
+	if l == nil {
+		return func() {}
+	}
+
+	lock := l.get(id)
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.put(id)
+	}
+}
+
+// lockAll acquires the write locks of images in the order of ID, so that the
+// operations across images, like moving the tag, don't deadlock each other.
+func (l *imageLocker) lockAll(ids ...digest.Digest) func() {
+	sorted := make([]string, 0, len(ids))
+	seen := make(map[digest.Digest]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			sorted = append(sorted, id.String())
+		}
+	}
+	sort.Strings(sorted)
+
+	unlocks := make([]func(), 0, len(sorted))
+	for _, id := range sorted {
+		unlocks = append(unlocks, l.lock(digest.Digest(id)))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+func (l *imageLocker) get(id digest.Digest) *imageLock {
+	l.Lock()
+	defer l.Unlock()
+
+	lock, ok := l.locks[id]
+	if !ok {
+		lock = &imageLock{}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (l *imageLocker) put(id digest.Digest) {
+	l.Lock()
+	defer l.Unlock()
+
+	lock := l.locks[id]
+	if lock.refs--; lock.refs == 0 {
+		delete(l.locks, id)
+	}
+}
@@ -0,0 +1,146 @@
+package mgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/daemon/events"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetImageDuringRemoval(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{
+		localStore: store,
+		imageLocks: newImageLocker(),
+	}
+
+	addImage := func(id digest.Digest, name string) reference.Named {
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+		mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id, Size: 1024})
+		return ref
+	}
+
+	removedID, otherID := digest.FromString("removed"), digest.FromString("other")
+	removedRef := addImage(removedID, "reg.abc.com/library/busybox:latest")
+	addImage(otherID, "reg.abc.com/library/redis:latest")
+
+	// the removal holds the write lock
+	unlock := mgr.imageLocks.lock(removedID)
+
+	var (
+		info   *types.ImageInfo
+		getErr error
+		done   = make(chan struct{})
+	)
+	go func() {
+		info, getErr = mgr.GetImage(context.TODO(), removedID.String())
+		close(done)
+	}()
+
+	// the inspect of other image should not be blocked
+	otherInfo, err := mgr.GetImage(context.TODO(), otherID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, otherID.String(), otherInfo.ID)
+
+	select {
+	case <-done:
+		t.Fatal("GetImage should wait for the removal")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// half-removed state is invisible to the inspect
+	assert.NoError(t, mgr.localStore.RemoveReference(removedID, removedRef))
+	time.Sleep(10 * time.Millisecond)
+	mgr.localStore.ClearCtrdImageInfo(removedID)
+	unlock()
+
+	<-done
+	assert.Nil(t, info)
+	assert.True(t, errtypes.IsNotfound(getErr))
+
+	// the locks should be released
+	assert.Len(t, mgr.imageLocks.locks, 0)
+}
+
+func TestLockAll(t *testing.T) {
+	locker := newImageLocker()
+	a, b := digest.FromString("a"), digest.FromString("b")
+
+	// the locks taken in any order don't deadlock each other
+	done := make(chan struct{})
+	for _, ids := range [][]digest.Digest{{a, b}, {b, a}} {
+		go func(ids []digest.Digest) {
+			for i := 0; i < 1000; i++ {
+				locker.lockAll(ids...)()
+			}
+			done <- struct{}{}
+		}(ids)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("lockAll should not deadlock")
+		}
+	}
+
+	// the duplicated ID is locked once
+	locker.lockAll(a, a)()
+	assert.Len(t, locker.locks, 0)
+}
+
+func TestAddTagDuringRemoval(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+	}
+
+	id := digest.FromString("app")
+	client.images["reg.abc.com/app:v1"] = newIndexOnlyImage("reg.abc.com/app:v1", ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: id})
+	ref, err := reference.Parse("reg.abc.com/app:v1")
+	assert.NoError(t, err)
+	assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+	mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id, IndexOnly: true})
+
+	// the removal holds the write lock
+	unlock := mgr.imageLocks.lock(id)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:v2", false, nil)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("AddTag should wait for the removal")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, _, _, err = mgr.CheckReference(context.TODO(), "reg.abc.com/app:v2")
+	assert.True(t, errtypes.IsNotfound(err))
+
+	unlock()
+	assert.NoError(t, <-done)
+
+	_, _, _, err = mgr.CheckReference(context.TODO(), "reg.abc.com/app:v2")
+	assert.NoError(t, err)
+	assert.Len(t, mgr.imageLocks.locks, 0)
+}
@@ -0,0 +1,34 @@
+package mgr
+
+import (
+	"context"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// GetImageManifest returns the raw manifest of the image and its media type.
+// If the image is stored by manifest list, the index with the descriptors of
+// all the platforms will be returned.
+//
+// NOTE: the raw bytes are returned instead of the decoded manifest so that
+// the digest of the content is kept and the index is supported.
+func (mgr *ImageManager) GetImageManifest(ctx context.Context, idOrRef string) ([]byte, string, error) {
+	img, err := mgr.fetchContainerdImage(ctx, idOrRef)
+	if err != nil {
+		return nil, "", err
+	}
+
+	target := img.Target()
+	data, err := content.ReadBlob(ctx, img.ContentStore(), target)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, "", pkgerrors.Wrapf(errtypes.ErrNotfound, "manifest %s of image %s: %v", target.Digest, idOrRef, err)
+		}
+		return nil, "", err
+	}
+	return data, target.MediaType, nil
+}
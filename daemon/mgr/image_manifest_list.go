@@ -0,0 +1,139 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// manifestList is the manifest list of docker or the index of OCI, which
+// tells the media type in the content.
+type manifestList struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Manifests     []ocispec.Descriptor `json:"manifests"`
+}
+
+// PushManifestList assembles the manifest list from the local images of
+// platformRefs, and pushes it to registry as listRef. Each image must be
+// single-platform, and the platforms of images must be different.
+func (mgr *ImageManager) PushManifestList(ctx context.Context, listRef string, platformRefs []string, authConfig *types.AuthConfig, out io.Writer) error {
+	if len(platformRefs) == 0 {
+		return pkgerrors.Wrap(errtypes.ErrInvalidParam, "no image to be added into manifest list")
+	}
+
+	ref, err := mgr.normalizeTagReference(listRef)
+	if err != nil {
+		return err
+	}
+	if _, ok := ref.(reference.Digested); ok {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "manifest list reference %s cannot contain digest", listRef)
+	}
+
+	var (
+		manifests = make([]ocispec.Descriptor, 0, len(platformRefs))
+		seen      = make(map[string]string, len(platformRefs))
+	)
+	for _, platformRef := range platformRefs {
+		desc, err := mgr.manifestListEntry(ctx, platformRef)
+		if err != nil {
+			return err
+		}
+
+		platform := platforms.Format(*desc.Platform)
+		if other, ok := seen[platform]; ok {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "images %s and %s have the same platform %s", other, platformRef, platform)
+		}
+		seen[platform] = platformRef
+		manifests = append(manifests, desc)
+	}
+
+	desc, data, err := newManifestList(manifests)
+	if err != nil {
+		return err
+	}
+
+	authConfig, err = mgr.resolveAuthConfig(ctx, ref.String(), authConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.client.PushManifestList(ctx, ref.String(), desc, data, authConfig, out); err != nil {
+		return err
+	}
+
+	mgr.LogImageEvent(ctx, desc.Digest.String(), ref.String(), "push")
+	return nil
+}
+
+// manifestListEntry returns the descriptor of the manifest of local image
+// with the platform from its config.
+func (mgr *ImageManager) manifestListEntry(ctx context.Context, idOrRef string) (ocispec.Descriptor, error) {
+	img, err := mgr.fetchContainerdImage(ctx, idOrRef)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	target := img.Target()
+	switch target.MediaType {
+	case ocispec.MediaTypeImageManifest, ctrdmetaimages.MediaTypeDockerSchema2Manifest:
+	default:
+		return ocispec.Descriptor{}, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "image %s is not single-platform image with %s", idOrRef, target.MediaType)
+	}
+
+	ociImage, err := containerdImageToOciImage(ctx, img)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if ociImage.OS == "" || ociImage.Architecture == "" {
+		return ocispec.Descriptor{}, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "platform of image %s is unknown", idOrRef)
+	}
+
+	return ocispec.Descriptor{
+		MediaType: target.MediaType,
+		Digest:    target.Digest,
+		Size:      target.Size,
+		Platform: &ocispec.Platform{
+			OS:           ociImage.OS,
+			Architecture: ociImage.Architecture,
+		},
+	}, nil
+}
+
+// newManifestList returns the content of manifest list and its descriptor.
+// The docker manifest list is used if all the manifests are docker's, or
+// the OCI index is used.
+func newManifestList(manifests []ocispec.Descriptor) (ocispec.Descriptor, []byte, error) {
+	mediaType := ctrdmetaimages.MediaTypeDockerSchema2ManifestList
+	for _, m := range manifests {
+		if m.MediaType != ctrdmetaimages.MediaTypeDockerSchema2Manifest {
+			mediaType = ocispec.MediaTypeImageIndex
+			break
+		}
+	}
+
+	data, err := json.Marshal(manifestList{
+		SchemaVersion: 2,
+		MediaType:     mediaType,
+		Manifests:     manifests,
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+
+	return ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}, data, nil
+}
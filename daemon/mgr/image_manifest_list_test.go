@@ -0,0 +1,61 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewManifestList(t *testing.T) {
+	amd64 := ocispec.Descriptor{
+		MediaType: ctrdmetaimages.MediaTypeDockerSchema2Manifest,
+		Digest:    digest.FromString("amd64"),
+		Size:      100,
+		Platform:  &ocispec.Platform{OS: "linux", Architecture: "amd64"},
+	}
+	arm64 := ocispec.Descriptor{
+		MediaType: ctrdmetaimages.MediaTypeDockerSchema2Manifest,
+		Digest:    digest.FromString("arm64"),
+		Size:      200,
+		Platform:  &ocispec.Platform{OS: "linux", Architecture: "arm64"},
+	}
+
+	desc, data, err := newManifestList([]ocispec.Descriptor{amd64, arm64})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrdmetaimages.MediaTypeDockerSchema2ManifestList, desc.MediaType)
+	assert.Equal(t, digest.FromBytes(data), desc.Digest)
+	assert.Equal(t, int64(len(data)), desc.Size)
+
+	var list manifestList
+	assert.NoError(t, json.Unmarshal(data, &list))
+	assert.Equal(t, 2, list.SchemaVersion)
+	assert.Equal(t, desc.MediaType, list.MediaType)
+	assert.Equal(t, []ocispec.Descriptor{amd64, arm64}, list.Manifests)
+
+	// the OCI index is used if any of manifests is OCI's
+	arm64.MediaType = ocispec.MediaTypeImageManifest
+	desc, _, err = newManifestList([]ocispec.Descriptor{amd64, arm64})
+	assert.NoError(t, err)
+	assert.Equal(t, ocispec.MediaTypeImageIndex, desc.MediaType)
+}
+
+func TestPushManifestListInvalidParam(t *testing.T) {
+	mgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+	}
+
+	err := mgr.PushManifestList(context.TODO(), "busybox:multi", nil, nil, ioutil.Discard)
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	err = mgr.PushManifestList(context.TODO(), "busybox@"+digest.FromString("list").String(), []string{"busybox:amd64"}, nil, ioutil.Discard)
+	assert.True(t, errtypes.IsInvalidParam(err))
+}
@@ -0,0 +1,58 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd/platforms"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetImageManifest(t *testing.T) {
+	provider := memProvider{}
+	img := newFakeImage(t, provider, "reg.abc.com/app:1.0", ocispec.Image{Architecture: "amd64", OS: "linux"})
+
+	// the manifest list keeps the descriptors of all the platforms
+	local, foreign := platforms.DefaultSpec(), ocispec.Platform{OS: "windows", Architecture: "amd64"}
+	localManifest := addTestManifest(t, provider, ocispec.Image{Architecture: local.Architecture, OS: local.OS})
+	localManifest.Platform = &local
+	foreignManifest := addTestManifest(t, provider, ocispec.Image{Architecture: foreign.Architecture, OS: foreign.OS})
+	foreignManifest.Platform = &foreign
+
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Manifests: []ocispec.Descriptor{localManifest, foreignManifest},
+	})
+	assert.NoError(t, err)
+	multiArch := &fakeImage{
+		name:   "reg.abc.com/multi-arch:1.0",
+		target: provider.add(ocispec.MediaTypeImageIndex, index),
+		store:  memContentStore{memProvider: provider},
+	}
+	mgr, _ := newFakeImageManager(t, img, multiArch)
+
+	// the raw bytes are returned so that the digest is kept
+	data, mediaType, err := mgr.GetImageManifest(context.TODO(), img.name)
+	assert.NoError(t, err)
+	assert.Equal(t, ocispec.MediaTypeImageManifest, mediaType)
+	assert.Equal(t, provider[img.target.Digest], data)
+
+	data, mediaType, err = mgr.GetImageManifest(context.TODO(), multiArch.name)
+	assert.NoError(t, err)
+	assert.Equal(t, ocispec.MediaTypeImageIndex, mediaType)
+	assert.Equal(t, index, data)
+
+	var got ocispec.Index
+	assert.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, []ocispec.Descriptor{localManifest, foreignManifest}, got.Manifests)
+
+	// the manifest missing in the content store is not found
+	delete(provider, img.target.Digest)
+	_, _, err = mgr.GetImageManifest(context.TODO(), img.name)
+	assert.True(t, errtypes.IsNotfound(err), "%v", err)
+}
@@ -0,0 +1,163 @@
+package mgr
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/utils"
+)
+
+const (
+	// mirrorFailureThreshold is the number of consecutive failures to open
+	// the circuit of mirror.
+	mirrorFailureThreshold = 3
+
+	// mirrorCooldown is the period the mirror with open circuit will be
+	// tried last, after which it will be tried in order again.
+	mirrorCooldown = time.Minute
+)
+
+type mirrorState struct {
+	failures      int64
+	lastFailure   time.Time
+	cooldownUntil time.Time
+}
+
+// mirrorHealth is the in-memory circuit breaker of mirrors. The mirror fails
+// consecutively for mirrorFailureThreshold times will be moved to the end of
+// candidates until the cooldown expires. One success resets the failures.
+type mirrorHealth struct {
+	sync.Mutex
+
+	threshold int64
+	cooldown  time.Duration
+	mirrors   map[string]*mirrorState
+
+	// now is used to mock the time in test.
+	now func() time.Time
+}
+
+func newMirrorHealth(threshold int64, cooldown time.Duration) *mirrorHealth {
+	return &mirrorHealth{
+		threshold: threshold,
+		cooldown:  cooldown,
+		mirrors:   make(map[string]*mirrorState),
+		now:       time.Now,
+	}
+}
+
+// mirrorOfReference returns the registry domain of the candidate reference,
+// like mirror.com for mirror.com/library/busybox.
+func mirrorOfReference(ref string) string {
+	return strings.SplitN(ref, "/", 2)[0]
+}
+
+// isOpen returns true if the circuit of mirror is open.
+func (h *mirrorHealth) isOpen(mirror string) bool {
+	state, ok := h.mirrors[mirror]
+	return ok && h.now().Before(state.cooldownUntil)
+}
+
+// order moves the mirror candidates with open circuit to the end and keeps
+// the relative order of others. The last one of refs is the registry itself
+// which is never skipped.
+func (h *mirrorHealth) order(refs []string) []string {
+	if h == nil || len(refs) <= 1 {
+		return refs
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	var (
+		mirrors = refs[:len(refs)-1]
+		healthy = make([]string, 0, len(refs))
+		skipped []string
+	)
+
+	for _, ref := range mirrors {
+		if h.isOpen(mirrorOfReference(ref)) {
+			skipped = append(skipped, ref)
+			continue
+		}
+		healthy = append(healthy, ref)
+	}
+	healthy = append(healthy, refs[len(refs)-1])
+	return append(healthy, skipped...)
+}
+
+// observe updates the mirrors by the resolved result of candidates. The
+// candidates before the one of availableRef are failed. Nothing is recorded
+// if all the candidates fail, since the image may not exist at all.
+func (h *mirrorHealth) observe(refs []string, availableRef string) {
+	if h == nil || availableRef == "" {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	var (
+		now       = h.now()
+		available = mirrorOfReference(availableRef)
+	)
+	for _, ref := range refs {
+		mirror := mirrorOfReference(ref)
+		if mirror == available {
+			delete(h.mirrors, mirror)
+			return
+		}
+
+		state, ok := h.mirrors[mirror]
+		if !ok {
+			state = &mirrorState{}
+			h.mirrors[mirror] = state
+		}
+		state.failures++
+		state.lastFailure = now
+		if state.failures >= h.threshold {
+			state.cooldownUntil = now.Add(h.cooldown)
+		}
+	}
+}
+
+// list returns the health of the mirrors which failed recently.
+func (h *mirrorHealth) list() []types.MirrorHealth {
+	res := []types.MirrorHealth{}
+	if h == nil {
+		return res
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	names := make([]string, 0, len(h.mirrors))
+	for name := range h.mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		state := h.mirrors[name]
+		health := types.MirrorHealth{
+			Mirror:      name,
+			Failures:    state.failures,
+			LastFailure: state.lastFailure.UTC().Format(utils.TimeLayout),
+			Skipped:     h.isOpen(name),
+		}
+		if health.Skipped {
+			health.CooldownUntil = state.cooldownUntil.UTC().Format(utils.TimeLayout)
+		}
+		res = append(res, health)
+	}
+	return res
+}
+
+// MirrorHealth returns the health of mirrors which failed recently. The
+// skipped mirrors are tried after the registry itself.
+func (mgr *ImageManager) MirrorHealth() []types.MirrorHealth {
+	return mgr.mirrorHealth.list()
+}
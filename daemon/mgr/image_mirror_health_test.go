@@ -0,0 +1,55 @@
+package mgr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorHealth(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	health := newMirrorHealth(2, time.Minute)
+	health.now = func() time.Time { return now }
+
+	refs := []string{
+		"m1.com/library/busybox:latest",
+		"m2.com/library/busybox:latest",
+		"registry.hub.docker.com/library/busybox:latest",
+	}
+
+	// m1 fails once, the order is not changed
+	health.observe(refs, "m2.com/library/busybox:latest")
+	assert.Equal(t, refs, health.order(refs))
+
+	// m1 fails twice, it should be tried last
+	health.observe(refs, "m2.com/library/busybox:latest")
+	assert.Equal(t, []string{
+		"m2.com/library/busybox:latest",
+		"registry.hub.docker.com/library/busybox:latest",
+		"m1.com/library/busybox:latest",
+	}, health.order(refs))
+
+	list := health.list()
+	assert.Len(t, list, 1)
+	assert.Equal(t, "m1.com", list[0].Mirror)
+	assert.Equal(t, int64(2), list[0].Failures)
+	assert.True(t, list[0].Skipped)
+
+	// nothing is recorded if all the candidates fail
+	health.observe(refs, "")
+	assert.Equal(t, int64(2), health.mirrors["m1.com"].failures)
+
+	// m1 is tried in order after cooldown
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, refs, health.order(refs))
+
+	// one success resets the failures
+	health.observe(refs, "m1.com/library/busybox:latest")
+	assert.Len(t, health.list(), 0)
+
+	// the nil health keeps the order
+	var nilHealth *mirrorHealth
+	assert.Equal(t, refs, nilHealth.order(refs))
+}
@@ -0,0 +1,121 @@
+package mgr
+
+import (
+	"context"
+	"strings"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	digest "github.com/opencontainers/go-digest"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// MoveReference renames the source reference to the target one, like
+// `pouch tag --move`. The target is created before the source is removed,
+// and the target will be removed if the source fails to be removed, so that
+// there is always exactly one of them.
+//
+// The searchable references attached to the source, like Name@Digest, are
+// moved to the target too.
+func (mgr *ImageManager) MoveReference(ctx context.Context, source, target string) error {
+	id, sourceRef, primaryRef, err := mgr.CheckReference(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	if reference.IsNamedOnly(sourceRef) || strings.HasPrefix(id.String(), sourceRef.String()) {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "source %s must be tag or digest reference", source)
+	}
+	sourceRef = reference.TrimTagForDigest(sourceRef)
+
+	targetRef, err := mgr.normalizeTagReference(target)
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.moveReference(ctx, id, sourceRef, primaryRef, targetRef); err != nil {
+		return err
+	}
+
+	mgr.LogImageEvent(ctx, id.String(), targetRef.String(), "tag")
+	return nil
+}
+
+// moveReference creates the target reference and removes the source one
+// while holding the write lock of the image. The target is checked under the
+// lock, so that it's not taken by the concurrent move of the same image.
+func (mgr *ImageManager) moveReference(ctx context.Context, id digest.Digest, sourceRef, primaryRef, targetRef reference.Named) error {
+	unlock := mgr.imageLocks.lock(id)
+	defer unlock()
+
+	if err := mgr.validateTagReference(targetRef); err != nil {
+		return err
+	}
+
+	if _, _, _, err := mgr.CheckReference(ctx, targetRef.String()); err == nil {
+		return pkgerrors.Wrapf(errtypes.ErrAlreadyExisted, "reference %s", targetRef)
+	} else if !errtypes.IsNotfound(err) {
+		return err
+	}
+
+	ctrdImg, err := mgr.client.GetImage(ctx, primaryRef.String())
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.createReference(ctx, ctrdImg, targetRef); err != nil {
+		// NOTE: createReference adds the reference into local store
+		// before containerd meta db.
+		if err := mgr.localStore.RemoveReference(id, targetRef); err != nil {
+			logrus.Warnf("failed to rollback reference %s in local store: %v", targetRef, err)
+		}
+		return err
+	}
+
+	// the source is searchable reference which only exists in local store
+	if sourceRef.String() != primaryRef.String() {
+		if err := mgr.localStore.RemoveReference(id, sourceRef); err != nil {
+			mgr.rollbackMovedReference(ctx, id, targetRef)
+			return err
+		}
+		return nil
+	}
+
+	aliases := mgr.localStore.GetReferencesByPrimary(primaryRef)
+	if err := mgr.localStore.RemoveReference(id, primaryRef); err != nil {
+		mgr.rollbackMovedReference(ctx, id, targetRef)
+		return err
+	}
+	for _, alias := range aliases {
+		if err := mgr.localStore.AddReference(id, targetRef, alias); err != nil {
+			logrus.Warnf("failed to move reference %s to %s: %v", alias, targetRef, err)
+		}
+	}
+
+	// NOTE: the content of image is kept because the target reference has
+	// been created in containerd meta db.
+	if err := mgr.client.RemoveImage(ctx, primaryRef.String()); err != nil {
+		for _, ref := range append([]reference.Named{primaryRef}, aliases...) {
+			if err := mgr.localStore.AddReference(id, primaryRef, ref); err != nil {
+				logrus.Warnf("failed to rollback reference %s in local store: %v", ref, err)
+			}
+		}
+		mgr.rollbackMovedReference(ctx, id, targetRef)
+		return err
+	}
+	return nil
+}
+
+// rollbackMovedReference removes the created target reference from both
+// local store and containerd meta db.
+func (mgr *ImageManager) rollbackMovedReference(ctx context.Context, id digest.Digest, targetRef reference.Named) {
+	if err := mgr.localStore.RemoveReference(id, targetRef); err != nil {
+		logrus.Warnf("failed to rollback reference %s in local store: %v", targetRef, err)
+	}
+
+	if err := mgr.client.RemoveImage(ctx, targetRef.String()); err != nil {
+		logrus.Warnf("failed to rollback reference %s in containerd: %v", targetRef, err)
+	}
+}
@@ -0,0 +1,73 @@
+package mgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alibaba/pouch/daemon/events"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveReference(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+	}
+
+	addImage := func(name string) digest.Digest {
+		target := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: digest.FromString(name)}
+		client.images[name] = newIndexOnlyImage(name, target)
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(target.Digest, ref, target.Digest))
+		mgr.localStore.CacheCtrdImageInfo(target.Digest, CtrdImageInfo{ID: target.Digest, IndexOnly: true})
+		return target.Digest
+	}
+	appID := addImage("reg.abc.com/app:v1")
+	otherID := addImage("reg.abc.com/app:v2")
+
+	checkRef := func(ref string, expected digest.Digest) {
+		id, _, _, err := mgr.CheckReference(context.TODO(), ref)
+		if expected == "" {
+			assert.True(t, errtypes.IsNotfound(err), "%s: %v", ref, err)
+			_, ok := client.images[ref]
+			assert.False(t, ok, ref)
+			return
+		}
+		assert.NoError(t, err, ref)
+		assert.Equal(t, expected, id, ref)
+		_, ok := client.images[ref]
+		assert.True(t, ok, ref)
+	}
+
+	// the existing target is not overridden
+	err = mgr.MoveReference(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:v2")
+	assert.Error(t, err)
+	checkRef("reg.abc.com/app:v1", appID)
+	checkRef("reg.abc.com/app:v2", otherID)
+
+	// the target is rolled back if the source fails to be removed
+	client.removeErrs = map[string]error{"reg.abc.com/app:v1": errors.New("boom")}
+	err = mgr.MoveReference(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:v3")
+	assert.Error(t, err)
+	client.removeErrs = nil
+	checkRef("reg.abc.com/app:v1", appID)
+	checkRef("reg.abc.com/app:v3", "")
+
+	assert.NoError(t, mgr.MoveReference(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:v3"))
+	checkRef("reg.abc.com/app:v1", "")
+	checkRef("reg.abc.com/app:v3", appID)
+}
@@ -0,0 +1,172 @@
+package mgr
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/utils"
+
+	"github.com/containerd/containerd"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// provenanceLogMaxSize is the max size of provenance log before rotation.
+	provenanceLogMaxSize = 10 * 1024 * 1024
+
+	// provenanceLogMaxFiles is the max number of rotated provenance logs.
+	provenanceLogMaxFiles = 3
+)
+
+// provenanceRecorder persists the provenance of pulled images into the
+// append-only log. The log is rotated as x.log.1, x.log.2 ... when the size
+// reaches the maxSize, and the oldest one will be dropped.
+type provenanceRecorder struct {
+	sync.Mutex
+
+	path     string
+	maxSize  int64
+	maxFiles int
+}
+
+func newProvenanceRecorder(path string, maxSize int64, maxFiles int) *provenanceRecorder {
+	return &provenanceRecorder{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+}
+
+// Record appends the provenance into the log.
+func (r *provenanceRecorder) Record(p *types.ImageProvenance) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	r.Lock()
+	defer r.Unlock()
+
+	if err := r.checkRotate(int64(len(data))); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	return err
+}
+
+// List returns all the provenance records from the oldest to the latest.
+func (r *provenanceRecorder) List() ([]types.ImageProvenance, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	res := []types.ImageProvenance{}
+	for i := r.maxFiles; i >= 0; i-- {
+		records, err := readProvenanceLog(r.rotatedPath(i))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, records...)
+	}
+	return res, nil
+}
+
+func (r *provenanceRecorder) rotatedPath(i int) string {
+	if i == 0 {
+		return r.path
+	}
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// checkRotate rotates the logs if the size will exceed the maxSize after
+// writing n bytes.
+func (r *provenanceRecorder) checkRotate(n int64) error {
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.Size()+n <= r.maxSize {
+		return nil
+	}
+
+	if r.maxFiles == 0 {
+		return os.Remove(r.path)
+	}
+
+	// move x.log.(n-1) to x.log.n, and x.log to x.log.1
+	for i := r.maxFiles - 1; i >= 0; i-- {
+		if err := os.Rename(r.rotatedPath(i), r.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func readProvenanceLog(path string) ([]types.ImageProvenance, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []types.ImageProvenance
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var p types.ImageProvenance
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			logrus.Warnf("failed to decode provenance record in %s: %v", path, err)
+			continue
+		}
+		res = append(res, p)
+	}
+	return res, scanner.Err()
+}
+
+// recordProvenance records the provenance of the pulled image. The failure
+// of recording will not fail the pull.
+func (mgr *ImageManager) recordProvenance(ctx context.Context, ref, availableRef string, img containerd.Image) {
+	if mgr.provenance == nil {
+		return
+	}
+
+	err := mgr.provenance.Record(&types.ImageProvenance{
+		RequestedReference: ref,
+		ResolvedReference:  availableRef,
+		Registry:           strings.SplitN(availableRef, "/", 2)[0],
+		ManifestDigest:     img.Target().Digest.String(),
+		Timestamp:          time.Now().UTC().Format(utils.TimeLayout),
+		Actor:              utils.GetTLSCommonName(ctx),
+	})
+	if err != nil {
+		logrus.Warnf("failed to record provenance of image %s: %v", availableRef, err)
+	}
+}
+
+// ListProvenance returns the provenance records of image pulls.
+func (mgr *ImageManager) ListProvenance(ctx context.Context) ([]types.ImageProvenance, error) {
+	if mgr.provenance == nil {
+		return []types.ImageProvenance{}, nil
+	}
+	return mgr.provenance.List()
+}
@@ -0,0 +1,47 @@
+package mgr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvenanceRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "provenance.log")
+
+	// each record takes 35 bytes and the log keeps three records.
+	r := newProvenanceRecorder(path, 120, 2)
+	for i := 0; i < 10; i++ {
+		if err := r.Record(&types.ImageProvenance{
+			RequestedReference: fmt.Sprintf("busybox:%d", i),
+		}); err != nil {
+			t.Fatalf("failed to record: %v", err)
+		}
+	}
+
+	records, err := r.List()
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+
+	// x.log.2 has 3-5, x.log.1 has 6-8 and x.log has 9.
+	assert.Equal(t, 7, len(records))
+	for i, record := range records {
+		assert.Equal(t, fmt.Sprintf("busybox:%d", i+3), record.RequestedReference)
+	}
+
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,42 @@
+package mgr
+
+import (
+	"net/url"
+
+	"github.com/alibaba/pouch/ctrd"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/utils"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// parseRegistryProxies parses the proxies keyed by registry domain.
+func parseRegistryProxies(proxies map[string]string) (map[string]*url.URL, error) {
+	res := make(map[string]*url.URL, len(proxies))
+	for registry, proxy := range proxies {
+		u, err := utils.ParseProxyURL(proxy)
+		if err != nil {
+			return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid proxy of registry %s: %v", registry, err)
+		}
+		res[registry] = u
+	}
+	return res, nil
+}
+
+// registryProxyFunc returns the proxy function used by PullImage. The proxy
+// of request is used for all the registries and mirrors, otherwise the proxy
+// of registry in config is used. It returns nil if there is no proxy.
+func (mgr *ImageManager) registryProxyFunc(requestProxy string) (ctrd.RegistryProxyFunc, error) {
+	if requestProxy != "" {
+		u, err := utils.ParseProxyURL(requestProxy)
+		if err != nil {
+			return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid proxy of request: %v", err)
+		}
+		return func(string) *url.URL { return u }, nil
+	}
+
+	if len(mgr.registryProxies) == 0 {
+		return nil, nil
+	}
+	return func(host string) *url.URL { return mgr.registryProxies[host] }, nil
+}
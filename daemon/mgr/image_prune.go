@@ -0,0 +1,111 @@
+package mgr
+
+import (
+	"context"
+
+	"github.com/alibaba/pouch/apis/filters"
+	"github.com/alibaba/pouch/apis/types"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// the filter tags set allowed when pouch image prune -f
+var acceptedPruneFilterTags = map[string]bool{
+	"dangling": true,
+}
+
+// PruneImages removes the images which are not used by any container.
+//
+// By default, only the dangling images, which have no tag reference, will
+// be removed. If the filter has dangling=false, the tagged images will be
+// removed too.
+func (mgr *ImageManager) PruneImages(ctx context.Context, filter filters.Args, isUsed ImageUsedFunc) (*types.ImagePruneResult, error) {
+	if err := filter.Validate(acceptedPruneFilterTags); err != nil {
+		return nil, err
+	}
+
+	danglingOnly, ok, err := getDanglingFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		danglingOnly = true
+	}
+
+	result := &types.ImagePruneResult{
+		ImagesDeleted: []*types.ImageDeleteResponseItem{},
+	}
+
+	for _, img := range mgr.localStore.ListCtrdImageInfo() {
+		refs := mgr.localStore.GetReferences(img.ID)
+		if danglingOnly && !isDanglingImage(refs) {
+			continue
+		}
+
+		if isUsed != nil {
+			used, err := isUsed(img.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			if used {
+				continue
+			}
+		}
+
+		attributes := mgr.imageEventAttributes(ctx, img.ID.String())
+
+		unlock := mgr.imageLocks.lock(img.ID)
+		err := mgr.removePrimaryReferences(ctx, img.ID)
+		if len(mgr.localStore.GetPrimaryReferences(img.ID)) == 0 {
+			mgr.clearImageInfo(img.ID)
+		}
+		unlock()
+
+		mgr.logRemovalEvents(ctx, img.ID, refs, attributes)
+		if err != nil {
+			logrus.Warnf("failed to prune image %s: %v", img.ID, err)
+			continue
+		}
+
+		for _, ref := range refs {
+			result.ImagesDeleted = append(result.ImagesDeleted, &types.ImageDeleteResponseItem{
+				Untagged: ref.String(),
+			})
+		}
+		result.ImagesDeleted = append(result.ImagesDeleted, &types.ImageDeleteResponseItem{
+			Deleted: img.ID.String(),
+		})
+		result.SpaceReclaimed += img.Size
+	}
+	return result, nil
+}
+
+// GarbageCollect triggers the garbage collection of containerd, which
+// removes the blobs not referenced by any image, like the ones left by the
+// interrupted pulls. Unlike PruneImages, no image is removed.
+func (mgr *ImageManager) GarbageCollect(ctx context.Context) (*types.GCResult, error) {
+	result, err := mgr.client.GarbageCollect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("garbage collected %d blobs, reclaimed %d bytes", result.BlobsDeleted, result.SpaceReclaimed)
+	return result, nil
+}
+
+// removePrimaryReferences removes all the primary references of the image,
+// which will remove the image from containerd.
+func (mgr *ImageManager) removePrimaryReferences(ctx context.Context, id digest.Digest) error {
+	for _, ref := range mgr.localStore.GetPrimaryReferences(id) {
+		if err := mgr.client.RemoveImage(ctx, ref.String()); err != nil {
+			return err
+		}
+
+		if err := mgr.localStore.RemoveReference(id, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package mgr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/ctrd"
+)
+
+// pullGroup deduplicates the concurrent pulls with the same key. The callers
+// share one underlying pull, and the progress and the rate limit of the pull
+// are sent to all the callers.
+//
+// The shared pull isn't canceled if one of the callers is gone, and it's
+// canceled only if all the callers are gone. The canceled pull is forgotten
+// at once, so that the caller coming later starts a new one instead of
+// joining it. The nil pullGroup means no deduplication.
+type pullGroup struct {
+	mu    sync.Mutex
+	calls map[string]*pullCall
+}
+
+// pullCall is the in-flight pull shared by the waiters.
+type pullCall struct {
+	done    chan struct{}
+	err     error
+	out     *broadcastWriter
+	limits  *broadcastNotifier
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newPullGroup() *pullGroup {
+	return &pullGroup{
+		calls: make(map[string]*pullCall),
+	}
+}
+
+// do runs fn once for the concurrent callers with the same key and returns
+// the same result to all of them. The caller joining the in-flight pull only
+// receives the progress and the rate limit reported after it joins.
+func (g *pullGroup) do(ctx context.Context, key string, out io.Writer, notify ctrd.RateLimitNotifier, fn func(context.Context, io.Writer, ctrd.RateLimitNotifier) error) error {
+	if g == nil {
+		return fn(ctx, out, notify)
+	}
+
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		// NOTE: the shared pull keeps the values of the first caller's
+		// context, but it's not canceled with the caller.
+		pctx, cancel := context.WithCancel(detachedContext{ctx})
+		call = &pullCall{
+			done:   make(chan struct{}),
+			out:    &broadcastWriter{},
+			limits: &broadcastNotifier{},
+			cancel: cancel,
+		}
+		g.calls[key] = call
+
+		go func() {
+			err := fn(pctx, call.out, call.limits.notify)
+
+			g.mu.Lock()
+			g.forget(key, call)
+			call.err = err
+			g.mu.Unlock()
+
+			cancel()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	call.out.add(out)
+	detach := call.limits.add(notify)
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		call.out.remove(out)
+		detach()
+
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			g.forget(key, call)
+			call.cancel()
+		}
+		g.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// forget removes the call of key if it's still the in-flight one, which may
+// have been replaced by the new call after it's canceled. It should be
+// called with g.mu held.
+func (g *pullGroup) forget(key string, call *pullCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// pullKey identifies the pull by the normalized reference, the options and
+// the credential. The pulls with different credentials are not shared since
+// one of them may be denied.
+func pullKey(ref string, authConfig *types.AuthConfig, opt *ImagePullOption) string {
+	h := sha256.New()
+	h.Write([]byte(ref))
+	if authConfig != nil {
+		for _, v := range []string{authConfig.ServerAddress, authConfig.Auth, authConfig.Username, authConfig.Password, authConfig.IdentityToken, authConfig.RegistryToken} {
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+		}
+	}
+	if opt != nil {
+		for _, v := range []string{strconv.FormatBool(opt.IndexOnly), strconv.FormatBool(opt.BestEffort), strconv.FormatBool(opt.Lazy), strconv.FormatInt(opt.MaxImageSize, 10), strings.Join(opt.AcceptMediaTypes, ","), opt.Proxy, opt.Snapshotter} {
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+		}
+	}
+	return ref + "@" + hex.EncodeToString(h.Sum(nil))
+}
+
+// broadcastWriter writes to all the attached writers. The writer failing to
+// write, like the gone client, is detached without failing the others.
+//
+// NOTE: each Write of jsonstream is one whole message, so that the writer
+// attached between two Writes receives the complete messages.
+type broadcastWriter struct {
+	mu      sync.Mutex
+	writers []io.Writer
+}
+
+func (b *broadcastWriter) add(w io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.writers = append(b.writers, w)
+}
+
+func (b *broadcastWriter) remove(w io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, writer := range b.writers {
+		if writer == w {
+			b.writers = append(b.writers[:i], b.writers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Write implements io.Writer.
+func (b *broadcastWriter) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	writers := b.writers[:0]
+	for _, w := range b.writers {
+		if _, err := w.Write(p); err != nil {
+			continue
+		}
+		writers = append(writers, w)
+	}
+	b.writers = writers
+	return len(p), nil
+}
+
+// broadcastNotifier notifies the rate limit to all the attached notifiers.
+type broadcastNotifier struct {
+	mu        sync.Mutex
+	next      int
+	notifiers []attachedNotifier
+}
+
+// attachedNotifier is the notifier identified by the order of attachment,
+// since the function cannot be compared.
+type attachedNotifier struct {
+	id     int
+	notify ctrd.RateLimitNotifier
+}
+
+// add attaches the notifier, and returns the function to detach it. The nil
+// notifier is ignored.
+func (b *broadcastNotifier) add(notify ctrd.RateLimitNotifier) func() {
+	if notify == nil {
+		return func() {}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.notifiers = append(b.notifiers, attachedNotifier{id: id, notify: notify})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		for i, n := range b.notifiers {
+			if n.id == id {
+				b.notifiers = append(b.notifiers[:i], b.notifiers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify implements ctrd.RateLimitNotifier.
+func (b *broadcastNotifier) notify(host string, limit ctrd.RegistryRateLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, n := range b.notifiers {
+		n.notify(host, limit)
+	}
+}
+
+// detachedContext keeps the values of the parent context, but it's never
+// canceled with the parent.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
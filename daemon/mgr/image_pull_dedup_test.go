@@ -0,0 +1,308 @@
+package mgr
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/ctrd"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestPullGroupShared(t *testing.T) {
+	g := newPullGroup()
+
+	var (
+		calls   int
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	fn := func(ctx context.Context, out io.Writer, notify ctrd.RateLimitNotifier) error {
+		calls++
+		close(started)
+		<-release
+		out.Write([]byte("done"))
+		return nil
+	}
+
+	var (
+		wg   sync.WaitGroup
+		out1 = &syncBuffer{}
+		out2 = &syncBuffer{}
+		err1 error
+		err2 error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err1 = g.do(context.TODO(), "key", out1, nil, fn)
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		err2 = g.do(context.TODO(), "key", out2, nil, fn)
+	}()
+
+	// wait for the second caller to join the in-flight pull
+	for {
+		g.mu.Lock()
+		waiters := g.calls["key"].waiters
+		g.mu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "done", out1.String())
+	assert.Equal(t, "done", out2.String())
+	assert.Empty(t, g.calls)
+}
+
+func TestPullGroupCancel(t *testing.T) {
+	g := newPullGroup()
+
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	fn := func(ctx context.Context, out io.Writer, notify ctrd.RateLimitNotifier) error {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.TODO())
+	ctx2, cancel2 := context.WithCancel(context.TODO())
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- g.do(ctx1, "key", &syncBuffer{}, nil, fn)
+	}()
+	<-started
+	go func() {
+		errCh <- g.do(ctx2, "key", &syncBuffer{}, nil, fn)
+	}()
+
+	for {
+		g.mu.Lock()
+		waiters := g.calls["key"].waiters
+		g.mu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the shared pull goes on if one of callers is gone
+	cancel1()
+	assert.Equal(t, context.Canceled, <-errCh)
+	select {
+	case <-canceled:
+		t.Fatal("the shared pull should not be canceled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the shared pull is canceled if all the callers are gone
+	cancel2()
+	assert.Equal(t, context.Canceled, <-errCh)
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shared pull should be canceled")
+	}
+}
+
+func TestPullGroupRestartAfterCancel(t *testing.T) {
+	g := newPullGroup()
+
+	var (
+		started  = make(chan struct{}, 2)
+		release1 = make(chan struct{})
+		release2 = make(chan struct{})
+	)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- g.do(ctx, "key", &syncBuffer{}, nil, func(ctx context.Context, out io.Writer, notify ctrd.RateLimitNotifier) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			// the canceled pull may take a while to return
+			<-release1
+			return ctx.Err()
+		})
+	}()
+	<-started
+
+	g.mu.Lock()
+	canceledCall := g.calls["key"]
+	g.mu.Unlock()
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-errCh)
+
+	// the caller coming later starts a new pull instead of joining the
+	// canceled one
+	g.mu.Lock()
+	assert.Empty(t, g.calls)
+	g.mu.Unlock()
+
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- g.do(context.TODO(), "key", out, nil, func(ctx context.Context, out io.Writer, notify ctrd.RateLimitNotifier) error {
+			started <- struct{}{}
+			<-release2
+			out.Write([]byte("done"))
+			return ctx.Err()
+		})
+	}()
+	<-started
+
+	// the canceled pull doesn't forget the new one when it returns
+	close(release1)
+	<-canceledCall.done
+	g.mu.Lock()
+	assert.NotNil(t, g.calls["key"])
+	assert.NotEqual(t, canceledCall, g.calls["key"])
+	g.mu.Unlock()
+
+	close(release2)
+	assert.NoError(t, <-done)
+	assert.Equal(t, "done", out.String())
+}
+
+func TestPullGroupRateLimit(t *testing.T) {
+	g := newPullGroup()
+
+	var (
+		started  = make(chan struct{})
+		report   = make(chan struct{})
+		reported = make(chan struct{})
+		release  = make(chan struct{})
+	)
+	fn := func(ctx context.Context, out io.Writer, notify ctrd.RateLimitNotifier) error {
+		close(started)
+		for range report {
+			notify("registry-1.docker.io", ctrd.RegistryRateLimit{Limit: 100, Remaining: 10})
+			reported <- struct{}{}
+		}
+		<-release
+		return nil
+	}
+
+	var (
+		mu            sync.Mutex
+		notifications = map[string]int{}
+	)
+	notifier := func(name string) ctrd.RateLimitNotifier {
+		return func(host string, limit ctrd.RegistryRateLimit) {
+			mu.Lock()
+			defer mu.Unlock()
+			notifications[name]++
+		}
+	}
+	notified := func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		res := map[string]int{}
+		for k, v := range notifications {
+			res[k] = v
+		}
+		return res
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.TODO())
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- g.do(ctx1, "key", &syncBuffer{}, notifier("first"), fn)
+	}()
+	<-started
+	go func() {
+		errCh <- g.do(context.TODO(), "key", &syncBuffer{}, notifier("second"), fn)
+	}()
+
+	for {
+		g.mu.Lock()
+		waiters := g.calls["key"].waiters
+		g.mu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the rate limit is notified to all the callers
+	report <- struct{}{}
+	<-reported
+	assert.Equal(t, map[string]int{"first": 1, "second": 1}, notified())
+
+	// the gone caller isn't notified any more
+	cancel1()
+	assert.Equal(t, context.Canceled, <-errCh)
+	report <- struct{}{}
+	<-reported
+	close(report)
+	assert.Equal(t, map[string]int{"first": 1, "second": 2}, notified())
+
+	close(release)
+	assert.NoError(t, <-errCh)
+}
+
+func TestPullGroupNil(t *testing.T) {
+	var g *pullGroup
+
+	out := &syncBuffer{}
+	err := g.do(context.TODO(), "key", out, nil, func(ctx context.Context, w io.Writer, notify ctrd.RateLimitNotifier) error {
+		assert.Equal(t, out, w)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestPullKey(t *testing.T) {
+	ref := "docker.io/library/busybox:latest"
+
+	assert.Equal(t, pullKey(ref, nil, nil), pullKey(ref, nil, nil))
+	assert.NotEqual(t, pullKey(ref, nil, nil), pullKey("docker.io/library/busybox:1.28", nil, nil))
+	assert.NotEqual(t,
+		pullKey(ref, &types.AuthConfig{Username: "a", Password: "b"}, nil),
+		pullKey(ref, &types.AuthConfig{Username: "a", Password: "c"}, nil),
+	)
+	assert.NotEqual(t,
+		pullKey(ref, nil, &ImagePullOption{}),
+		pullKey(ref, nil, &ImagePullOption{IndexOnly: true}),
+	)
+	assert.NotEqual(t,
+		pullKey(ref, nil, &ImagePullOption{}),
+		pullKey(ref, nil, &ImagePullOption{Snapshotter: "overlaybd"}),
+	)
+}
@@ -0,0 +1,125 @@
+package mgr
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// fetchImageWithIdleTimeout fetches the image content, and fails it if there
+// is no data received within pullIdleTimeout. The timer is reset on each
+// received chunk so that it's independent of the total elapsed time.
+func (mgr *ImageManager) fetchImageWithIdleTimeout(ctx context.Context, resolver remotes.Resolver, availableRef string, authConfig *types.AuthConfig, stream *jsonstream.JSONStream) (containerd.Image, error) {
+	if mgr.pullIdleTimeout <= 0 {
+		return mgr.client.FetchImage(ctx, resolver, availableRef, authConfig, stream)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	watcher := newIdleWatcher(mgr.pullIdleTimeout, cancel)
+	defer watcher.stop()
+
+	img, err := mgr.client.FetchImage(ctx, &progressResolver{
+		Resolver:   resolver,
+		onProgress: watcher.touch,
+	}, availableRef, authConfig, stream)
+	if err != nil && watcher.expired() {
+		return nil, pkgerrors.Wrapf(errtypes.ErrTimeout, "no data received in %v when pulling image %s", mgr.pullIdleTimeout, availableRef)
+	}
+	return img, err
+}
+
+// idleWatcher calls the onExpired if there is no touch within the timeout.
+type idleWatcher struct {
+	sync.Mutex
+
+	timeout   time.Duration
+	timer     *time.Timer
+	isExpired bool
+}
+
+func newIdleWatcher(timeout time.Duration, onExpired func()) *idleWatcher {
+	w := &idleWatcher{timeout: timeout}
+	w.timer = time.AfterFunc(timeout, func() {
+		w.Lock()
+		w.isExpired = true
+		w.Unlock()
+
+		onExpired()
+	})
+	return w
+}
+
+// touch resets the timer if it's not expired.
+func (w *idleWatcher) touch() {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.isExpired {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *idleWatcher) expired() bool {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.isExpired
+}
+
+func (w *idleWatcher) stop() {
+	w.timer.Stop()
+}
+
+// progressResolver calls onProgress on each chunk read from the fetcher.
+type progressResolver struct {
+	remotes.Resolver
+	onProgress func()
+}
+
+// Fetcher implements remotes.Resolver.
+func (r *progressResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	fetcher, err := r.Resolver.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &progressFetcher{Fetcher: fetcher, onProgress: r.onProgress}, nil
+}
+
+type progressFetcher struct {
+	remotes.Fetcher
+	onProgress func()
+}
+
+// Fetch implements remotes.Fetcher.
+func (f *progressFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	rc, err := f.Fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &progressReader{ReadCloser: rc, onProgress: f.onProgress}, nil
+}
+
+type progressReader struct {
+	io.ReadCloser
+	onProgress func()
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.onProgress()
+	}
+	return n, err
+}
@@ -0,0 +1,43 @@
+package mgr
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleWatcher(t *testing.T) {
+	expiredCh := make(chan struct{})
+	w := newIdleWatcher(100*time.Millisecond, func() {
+		close(expiredCh)
+	})
+	defer w.stop()
+
+	// keep progressing longer than the timeout
+	r := &progressReader{
+		ReadCloser: ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 10))),
+		onProgress: w.touch,
+	}
+	buf := make([]byte, 1)
+	for i := 0; i < 5; i++ {
+		if _, err := r.Read(buf); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.False(t, w.expired())
+
+	select {
+	case <-expiredCh:
+	case <-time.After(time.Second):
+		t.Fatalf("expected to expire after idle timeout")
+	}
+	assert.True(t, w.expired())
+
+	// touch doesn't take effect after expired
+	w.touch()
+	assert.True(t, w.expired())
+}
@@ -0,0 +1,140 @@
+package mgr
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+	"github.com/alibaba/pouch/pkg/utils"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// pullPolicy restricts the references which can be pulled by the patterns of
+// allowlist and denylist. The pattern is matched against the normalized
+// reference with or without the tag, like reg.abc.com/library/busybox:latest,
+// and the wildcard * matches any sequence including /, like docker.io/* and
+// */internal-secret/*. The aliases of Docker Hub are canonicalized on both
+// the pattern and the reference, so that index.docker.io/busybox matches
+// docker.io/library/busybox.
+//
+// The reference matching any pattern of denylist is denied, and the one not
+// matching any pattern of allowlist is denied if allowlist isn't empty.
+type pullPolicy struct {
+	allow []pullPattern
+	deny  []pullPattern
+}
+
+type pullPattern struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// newPullPolicy returns nil if there is no pattern.
+func newPullPolicy(allowlist, denylist []string) (*pullPolicy, error) {
+	if len(allowlist) == 0 && len(denylist) == 0 {
+		return nil, nil
+	}
+
+	var (
+		policy = &pullPolicy{}
+		err    error
+	)
+	if policy.allow, err = compilePullPatterns(allowlist); err != nil {
+		return nil, err
+	}
+	if policy.deny, err = compilePullPatterns(denylist); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func compilePullPatterns(patterns []string) ([]pullPattern, error) {
+	res := make([]pullPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, pkgerrors.Wrap(errtypes.ErrInvalidParam, "pull policy pattern cannot be empty")
+		}
+
+		expr := strings.Replace(regexp.QuoteMeta(canonicalDockerHub(pattern)), `\*`, ".*", -1)
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid pull policy pattern %s: %v", pattern, err)
+		}
+		res = append(res, pullPattern{pattern: pattern, re: re})
+	}
+	return res, nil
+}
+
+// check returns ErrForbidden if the reference is denied.
+func (p *pullPolicy) check(ref string) error {
+	if p == nil {
+		return nil
+	}
+
+	canonical := canonicalDockerHub(ref)
+	candidates := []string{canonical}
+	if namedRef, err := reference.Parse(canonical); err == nil && namedRef.Name() != canonical {
+		candidates = append(candidates, namedRef.Name())
+	}
+
+	if pattern, ok := matchPullPatterns(p.deny, candidates); ok {
+		return pkgerrors.Wrapf(errtypes.ErrForbidden, "pulling %s is denied by pull policy: matches denylist pattern %s", ref, pattern)
+	}
+
+	if _, ok := matchPullPatterns(p.allow, candidates); len(p.allow) > 0 && !ok {
+		return pkgerrors.Wrapf(errtypes.ErrForbidden, "pulling %s is denied by pull policy: matches no allowlist pattern", ref)
+	}
+	return nil
+}
+
+// filter returns the references which are allowed.
+func (p *pullPolicy) filter(refs []string) []string {
+	if p == nil {
+		return refs
+	}
+
+	var res []string
+	for _, ref := range refs {
+		if err := p.check(ref); err != nil {
+			logrus.Debugf("skip %s: %v", ref, err)
+			continue
+		}
+		res = append(res, ref)
+	}
+	return res
+}
+
+// matchPullPatterns returns the first pattern which matches any candidate.
+func matchPullPatterns(patterns []pullPattern, candidates []string) (string, bool) {
+	for _, p := range patterns {
+		for _, candidate := range candidates {
+			if p.re.MatchString(candidate) {
+				return p.pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// dockerHubDomains are the domain aliases of Docker Hub.
+var dockerHubDomains = []string{"docker.io", "index.docker.io", "registry.hub.docker.com", "registry-1.docker.io"}
+
+// canonicalDockerHub canonicalizes the domain alias of Docker Hub into
+// docker.io, and the official image is prefixed with library, like
+// index.docker.io/busybox:latest into docker.io/library/busybox:latest. The
+// reference or pattern of other registry is returned as it is.
+func canonicalDockerHub(ref string) string {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || !utils.StringInSlice(dockerHubDomains, parts[0]) {
+		return ref
+	}
+
+	remainder := parts[1]
+	if !strings.Contains(remainder, "/") && !strings.HasPrefix(remainder, "*") {
+		remainder = "library/" + remainder
+	}
+	return "docker.io/" + remainder
+}
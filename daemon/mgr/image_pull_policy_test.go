@@ -0,0 +1,110 @@
+package mgr
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullPolicy(t *testing.T) {
+	policy, err := newPullPolicy(nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+	assert.NoError(t, policy.check("reg.abc.com/library/busybox:latest"))
+
+	_, err = newPullPolicy([]string{""}, nil)
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	policy, err = newPullPolicy(
+		[]string{"docker.io/*", "reg.abc.com/library/*"},
+		[]string{"*/internal-secret/*", "docker.io/library/busybox:1.*"},
+	)
+	assert.NoError(t, err)
+
+	for ref, allowed := range map[string]bool{
+		"docker.io/library/busybox:latest":    true,
+		"docker.io/library/busybox:1.30":      false,
+		"reg.abc.com/library/app:1.0":         true,
+		"reg.abc.com/internal-secret/app:1.0": false,
+		"docker.io/internal-secret/app:1.0":   false,
+		"reg.abc.com/others/app:1.0":          false,
+		"quay.io/coreos/etcd:latest":          false,
+		// the dot is not a wildcard
+		"reg-abc.com/library/app:1.0": false,
+	} {
+		err := policy.check(ref)
+		if allowed {
+			assert.NoError(t, err, ref)
+		} else {
+			assert.True(t, errtypes.IsForbidden(err), ref)
+		}
+	}
+
+	// the aliases of Docker Hub are canonicalized on both sides
+	policy, err = newPullPolicy(nil, []string{"index.docker.io/busybox*", "registry.hub.docker.com/internal/*"})
+	assert.NoError(t, err)
+	for ref, allowed := range map[string]bool{
+		"docker.io/library/busybox:latest":            false,
+		"index.docker.io/library/busybox:latest":      false,
+		"registry.hub.docker.com/busybox:latest":      false,
+		"registry-1.docker.io/library/busybox:1.0":    false,
+		"docker.io/internal/app:1.0":                  false,
+		"docker.io/library/alpine:latest":             true,
+		"reg.abc.com/library/busybox:latest":          true,
+		"registry.hub.docker.com/library/alpine:3.12": true,
+	} {
+		err := policy.check(ref)
+		if allowed {
+			assert.NoError(t, err, ref)
+		} else {
+			assert.True(t, errtypes.IsForbidden(err), ref)
+		}
+	}
+
+	policy, err = newPullPolicy([]string{"docker.io/*", "reg.abc.com/library/*"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docker.io/library/busybox:latest"}, policy.filter([]string{
+		"mirror.abc.com/library/busybox:latest",
+		"docker.io/library/busybox:latest",
+	}))
+}
+
+func TestPullImageDeniedByPolicy(t *testing.T) {
+	policy, err := newPullPolicy(nil, []string{"*/internal-secret/*"})
+	assert.NoError(t, err)
+
+	// the denied image is rejected before resolving it by the client
+	mgr := &ImageManager{
+		DefaultRegistry:  "reg.abc.com",
+		DefaultNamespace: "library",
+		pullPolicy:       policy,
+	}
+	err = mgr.PullImage(context.TODO(), "internal-secret/app:1.0", nil, ioutil.Discard, nil)
+	assert.True(t, errtypes.IsForbidden(err))
+
+	// the mirrors denied by policy are skipped
+	mgr.RegistryMirrors = []string{"mirror.abc.com/internal-secret"}
+	policy, err = newPullPolicy(nil, []string{"mirror.abc.com/*"})
+	assert.NoError(t, err)
+	mgr.pullPolicy = policy
+	mgr.MirrorOnly = true
+	err = mgr.PullImage(context.TODO(), "app:1.0", nil, ioutil.Discard, nil)
+	assert.True(t, errtypes.IsForbidden(err))
+}
+
+func TestCanonicalDockerHub(t *testing.T) {
+	for ref, expected := range map[string]string{
+		"index.docker.io/busybox:latest":      "docker.io/library/busybox:latest",
+		"registry.hub.docker.com/foo/bar:1.0": "docker.io/foo/bar:1.0",
+		"docker.io/*":                         "docker.io/*",
+		"docker.io/busybox*":                  "docker.io/library/busybox*",
+		"reg.abc.com/busybox:latest":          "reg.abc.com/busybox:latest",
+		"busybox":                             "busybox",
+	} {
+		assert.Equal(t, expected, canonicalDockerHub(ref), ref)
+	}
+}
@@ -0,0 +1,168 @@
+package mgr
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/containerd/containerd"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// pullStatsRetention is the max window of pull statistics. The pulls older
+// than it will be dropped.
+const pullStatsRetention = 24 * time.Hour
+
+// defaultPullStatsWindows is used if no window is required.
+var defaultPullStatsWindows = []time.Duration{5 * time.Minute, time.Hour, pullStatsRetention}
+
+// pullRecord is the result of one PullImage.
+type pullRecord struct {
+	registry string
+	finished time.Time
+	duration time.Duration
+	bytes    int64
+	failed   bool
+}
+
+// pullStats keeps the pulls within the retention in memory, which is used to
+// aggregate the statistics over rolling windows.
+type pullStats struct {
+	sync.Mutex
+
+	retention time.Duration
+	records   []pullRecord
+
+	// now is used to mock the time in test.
+	now func() time.Time
+}
+
+func newPullStats(retention time.Duration) *pullStats {
+	return &pullStats{
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// add adds the record and drops the expired ones.
+func (s *pullStats) add(r pullRecord) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.records = append(s.records, r)
+	s.expire()
+}
+
+// expire drops the records older than retention. The records are in the
+// order of finished time.
+func (s *pullStats) expire() {
+	deadline := s.now().Add(-s.retention)
+	i := sort.Search(len(s.records), func(i int) bool {
+		return s.records[i].finished.After(deadline)
+	})
+	if i > 0 {
+		s.records = append(s.records[:0], s.records[i:]...)
+	}
+}
+
+// aggregate returns the statistics of each registry in the windows.
+func (s *pullStats) aggregate(windows []time.Duration) []types.RegistryPullStats {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expire()
+
+	now := s.now()
+	res := []types.RegistryPullStats{}
+	for _, window := range windows {
+		var (
+			deadline  = now.Add(-window)
+			byReg     = map[string]*types.RegistryPullStats{}
+			durations = map[string]time.Duration{}
+		)
+
+		for _, r := range s.records {
+			if !r.finished.After(deadline) {
+				continue
+			}
+
+			stat, ok := byReg[r.registry]
+			if !ok {
+				stat = &types.RegistryPullStats{
+					Registry: r.registry,
+					Window:   window.String(),
+				}
+				byReg[r.registry] = stat
+			}
+
+			stat.Pulls++
+			stat.Bytes += r.bytes
+			if r.failed {
+				stat.Failures++
+			}
+			durations[r.registry] += r.duration
+		}
+
+		registries := make([]string, 0, len(byReg))
+		for registry := range byReg {
+			registries = append(registries, registry)
+		}
+		sort.Strings(registries)
+
+		for _, registry := range registries {
+			stat := byReg[registry]
+			stat.AverageDuration = durations[registry].Seconds() / float64(stat.Pulls)
+			stat.FailureRate = float64(stat.Failures) / float64(stat.Pulls)
+			res = append(res, *stat)
+		}
+	}
+	return res
+}
+
+// recordPullStats records the result of PullImage. The bytes is the size of
+// image content if the pull succeeds.
+func (mgr *ImageManager) recordPullStats(ctx context.Context, registry string, img containerd.Image, start time.Time, pullErr error) {
+	if mgr.pullStats == nil {
+		return
+	}
+
+	r := pullRecord{
+		registry: registry,
+		finished: time.Now(),
+		duration: time.Since(start),
+		failed:   pullErr != nil,
+	}
+
+	if pullErr == nil && img != nil {
+		size, err := img.Size(ctx)
+		if err != nil {
+			logrus.Warnf("failed to get size of image %s for pull statistics: %v", img.Name(), err)
+		}
+		r.bytes = size
+	}
+	mgr.pullStats.add(r)
+}
+
+// PullStats returns the pull statistics of each registry over the windows.
+// The default windows are 5m, 1h and 24h.
+func (mgr *ImageManager) PullStats(ctx context.Context, windows []time.Duration) ([]types.RegistryPullStats, error) {
+	if len(windows) == 0 {
+		windows = defaultPullStatsWindows
+	}
+
+	for _, window := range windows {
+		if window <= 0 || window > pullStatsRetention {
+			return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "window %v should be in (0, %v]", window, pullStatsRetention)
+		}
+	}
+
+	if mgr.pullStats == nil {
+		return []types.RegistryPullStats{}, nil
+	}
+	return mgr.pullStats.aggregate(windows), nil
+}
@@ -0,0 +1,42 @@
+package mgr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullStatsAggregate(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	stats := newPullStats(time.Hour)
+	stats.now = func() time.Time { return now }
+
+	for _, r := range []pullRecord{
+		{registry: "reg.abc.com", finished: now.Add(-2 * time.Hour), duration: time.Second, bytes: 100},
+		{registry: "reg.abc.com", finished: now.Add(-30 * time.Minute), duration: 4 * time.Second, bytes: 100},
+		{registry: "reg.abc.com", finished: now.Add(-time.Minute), duration: 2 * time.Second, bytes: 200},
+		{registry: "reg.abc.com", finished: now.Add(-time.Minute), duration: time.Second, failed: true},
+		{registry: "docker.io", finished: now.Add(-time.Minute), duration: time.Second, bytes: 300},
+	} {
+		stats.add(r)
+	}
+
+	// the record older than retention should be dropped
+	assert.Len(t, stats.records, 4)
+
+	res := stats.aggregate([]time.Duration{5 * time.Minute, time.Hour})
+	assert.Equal(t, []types.RegistryPullStats{
+		{Registry: "docker.io", Window: "5m0s", Pulls: 1, Bytes: 300, AverageDuration: 1},
+		{Registry: "reg.abc.com", Window: "5m0s", Pulls: 2, Failures: 1, FailureRate: 0.5, Bytes: 200, AverageDuration: 1.5},
+		{Registry: "docker.io", Window: "1h0m0s", Pulls: 1, Bytes: 300, AverageDuration: 1},
+		{Registry: "reg.abc.com", Window: "1h0m0s", Pulls: 3, Failures: 1, FailureRate: 1.0 / 3, Bytes: 300, AverageDuration: 7.0 / 3},
+	}, res)
+
+	// all the records expire
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, []types.RegistryPullStats{}, stats.aggregate([]time.Duration{time.Hour}))
+}
@@ -0,0 +1,207 @@
+package mgr
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// mountSources returns the repositories on the same registry as ref which
+// have the blobs of img, like reg.abc.com/app-v1 for the layers shared with
+// reg.abc.com/app-v2, so that the push can mount the blobs from them instead
+// of uploading.
+//
+// The sources are learned from the local images of sibling repositories,
+// which are assumed to be pulled from or pushed to the registry. The mount
+// from a wrong source just falls back to the upload.
+func (mgr *ImageManager) mountSources(ctx context.Context, ref reference.Named, img containerd.Image) map[digest.Digest][]string {
+	domain, path := splitRepository(ref.Name())
+	if domain == "" || img == nil {
+		return nil
+	}
+
+	pushed, err := walkImageBlobs(ctx, img.ContentStore(), img.Target())
+	if err != nil {
+		logrus.Warnf("failed to collect the blobs of %s to be mounted: %v", ref, err)
+		return nil
+	}
+
+	wanted := make(map[digest.Digest]struct{}, len(pushed))
+	for _, dgst := range pushed {
+		wanted[dgst] = struct{}{}
+	}
+
+	// NOTE: the references are visited in order so that the same image of
+	// repository is used as source, whose blobs are cached.
+	primaryRefs := mgr.localStore.ListPrimaryReferences()
+	names := make([]string, 0, len(primaryRefs))
+	for primaryRef := range primaryRefs {
+		names = append(names, primaryRef)
+	}
+	sort.Strings(names)
+
+	var (
+		sources = make(map[digest.Digest][]string)
+		visited = make(map[string]struct{})
+		blobs   = make(map[digest.Digest][]digest.Digest)
+	)
+	for _, primaryRef := range names {
+		id := primaryRefs[primaryRef]
+		namedRef, err := reference.Parse(primaryRef)
+		if err != nil {
+			continue
+		}
+
+		d, p := splitRepository(namedRef.Name())
+		if d != domain || p == path {
+			continue
+		}
+		if _, ok := visited[p]; ok {
+			continue
+		}
+
+		target, ok := mgr.siblingBlobs(ctx, id, primaryRef, blobs)
+		if !ok {
+			continue
+		}
+		visited[p] = struct{}{}
+
+		for _, dgst := range blobs[target] {
+			if _, ok := wanted[dgst]; ok {
+				sources[dgst] = append(sources[dgst], p)
+			}
+		}
+	}
+
+	// NOTE: only the blobs of existing images are kept in the cache.
+	live := make(map[digest.Digest]struct{})
+	for _, info := range mgr.localStore.ListCtrdImageInfo() {
+		live[info.TargetDigest] = struct{}{}
+	}
+	mgr.mountBlobs.update(blobs, live)
+	return sources
+}
+
+// siblingBlobs collects the blobs of the sibling image into blobs keyed by its
+// target, and returns the target. The blobs cached by the previous push are
+// reused, so that the image isn't read from containerd again.
+func (mgr *ImageManager) siblingBlobs(ctx context.Context, id digest.Digest, primaryRef string, blobs map[digest.Digest][]digest.Digest) (digest.Digest, bool) {
+	if info, err := mgr.localStore.GetCtrdImageInfo(id); err == nil && info.TargetDigest != "" {
+		if _, ok := blobs[info.TargetDigest]; ok {
+			return info.TargetDigest, true
+		}
+		if cached, ok := mgr.mountBlobs.get(info.TargetDigest); ok {
+			blobs[info.TargetDigest] = cached
+			return info.TargetDigest, true
+		}
+	}
+
+	img, err := mgr.client.GetImage(ctx, primaryRef)
+	if err != nil {
+		return "", false
+	}
+
+	target := img.Target().Digest
+	if _, ok := blobs[target]; ok {
+		return target, true
+	}
+
+	walked, err := walkImageBlobs(ctx, img.ContentStore(), img.Target())
+	if err != nil {
+		logrus.Warnf("failed to collect the blobs of %s as mount source: %v", primaryRef, err)
+		return "", false
+	}
+	blobs[target] = walked
+	return target, true
+}
+
+// mountBlobCache caches the blobs of the images used as mount sources, keyed
+// by the image target. The blobs of target never change since the target is
+// content addressed.
+type mountBlobCache struct {
+	sync.Mutex
+	blobs map[digest.Digest][]digest.Digest
+}
+
+func newMountBlobCache() *mountBlobCache {
+	return &mountBlobCache{blobs: make(map[digest.Digest][]digest.Digest)}
+}
+
+func (c *mountBlobCache) get(target digest.Digest) ([]digest.Digest, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	blobs, ok := c.blobs[target]
+	return blobs, ok
+}
+
+// update adds the blobs into the cache, and removes the targets not in live.
+func (c *mountBlobCache) update(blobs map[digest.Digest][]digest.Digest, live map[digest.Digest]struct{}) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for target, b := range blobs {
+		c.blobs[target] = b
+	}
+	for target := range c.blobs {
+		if _, ok := live[target]; !ok {
+			delete(c.blobs, target)
+		}
+	}
+}
+
+// walkImageBlobs returns the digests of the layers and configs of the image
+// target, and the platforms whose content is missing are skipped.
+func walkImageBlobs(ctx context.Context, provider content.Provider, target ocispec.Descriptor) ([]digest.Digest, error) {
+	var (
+		blobs    []digest.Digest
+		children = ctrdmetaimages.ChildrenHandler(provider)
+	)
+
+	handler := ctrdmetaimages.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		switch desc.MediaType {
+		case ctrdmetaimages.MediaTypeDockerSchema2Manifest, ctrdmetaimages.MediaTypeDockerSchema2ManifestList,
+			ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex:
+		default:
+			blobs = append(blobs, desc.Digest)
+		}
+
+		descs, err := children.Handle(ctx, desc)
+		if err != nil && errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return descs, err
+	})
+
+	if err := ctrdmetaimages.Walk(ctx, handler, target); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// splitRepository splits the repository name into the registry domain and
+// the path, like reg.abc.com and library/busybox.
+func splitRepository(name string) (string, string) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return "", name
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,89 @@
+package mgr
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/reference"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountSources(t *testing.T) {
+	provider := memProvider{}
+	layer := func(name string) ocispec.Descriptor {
+		return provider.add(ocispec.MediaTypeImageLayerGzip, []byte(name))
+	}
+	base, lib, app := layer("base"), layer("lib"), layer("app")
+
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:     client,
+		localStore: store,
+		mountBlobs: newMountBlobCache(),
+	}
+
+	newImage := func(name string, layers ...ocispec.Descriptor) *fakeImage {
+		img := newFakeImage(t, provider, name, ocispec.Image{
+			Config: ocispec.ImageConfig{Labels: map[string]string{"name": name}},
+		}, layers...)
+		client.images[name] = img
+		return img
+	}
+	addImage := func(name string, layers ...ocispec.Descriptor) {
+		img := newImage(name, layers...)
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+
+		id := digest.FromString(name)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, img.Target().Digest))
+		store.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id, TargetDigest: img.Target().Digest})
+	}
+
+	addImage("reg.abc.com/base:v1", base)
+	addImage("reg.abc.com/lib:v1", base, lib)
+	addImage("reg.abc.com/lib:v2", base, lib)
+	addImage("other.com/lib:v1", base, lib)
+	pushed := newImage("reg.abc.com/app:v1", base, lib, app)
+
+	ref, err := reference.Parse("reg.abc.com/app:v1")
+	assert.NoError(t, err)
+
+	mountSources := func() map[digest.Digest][]string {
+		sources := mgr.mountSources(context.TODO(), ref, pushed)
+		for _, repos := range sources {
+			sort.Strings(repos)
+		}
+		return sources
+	}
+
+	// only the blobs of pushed image are mounted from the sibling
+	// repositories on the same registry
+	expected := map[digest.Digest][]string{
+		base.Digest: {"base", "lib"},
+		lib.Digest:  {"lib"},
+	}
+	assert.Equal(t, expected, mountSources())
+	assert.Equal(t, 2, client.gets)
+
+	// the blobs of sibling images are cached for the next push
+	assert.Equal(t, expected, mountSources())
+	assert.Equal(t, 2, client.gets)
+
+	// the blobs of removed images are not kept
+	for _, info := range store.ListCtrdImageInfo() {
+		store.ClearCtrdImageInfo(info.ID)
+	}
+	mountSources()
+	assert.Empty(t, mgr.mountBlobs.blobs)
+
+	// nothing is mounted without the local image
+	assert.Nil(t, mgr.mountSources(context.TODO(), ref, nil))
+}
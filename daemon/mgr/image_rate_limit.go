@@ -0,0 +1,46 @@
+package mgr
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/alibaba/pouch/ctrd"
+	"github.com/alibaba/pouch/pkg/jsonstream"
+)
+
+// rateLimitReporter writes the rate limit of each registry into the progress
+// of pull. Since each request of the pull may tell the rate limit, the one
+// unchanged since the last report is skipped.
+type rateLimitReporter struct {
+	mu     sync.Mutex
+	last   map[string]ctrd.RegistryRateLimit
+	stream *jsonstream.JSONStream
+	notify ctrd.RateLimitNotifier
+}
+
+func newRateLimitReporter(stream *jsonstream.JSONStream, notify ctrd.RateLimitNotifier) *rateLimitReporter {
+	return &rateLimitReporter{
+		last:   make(map[string]ctrd.RegistryRateLimit),
+		stream: stream,
+		notify: notify,
+	}
+}
+
+// report implements ctrd.RateLimitNotifier.
+func (r *rateLimitReporter) report(host string, limit ctrd.RegistryRateLimit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.last[host]; ok && last == limit {
+		return
+	}
+	r.last[host] = limit
+
+	r.stream.WriteObject(jsonstream.JSONMessage{
+		ID:     host,
+		Status: fmt.Sprintf("Registry rate limit: %s", limit),
+	})
+	if r.notify != nil {
+		r.notify(host, limit)
+	}
+}
@@ -0,0 +1,39 @@
+package mgr
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alibaba/pouch/ctrd"
+	"github.com/alibaba/pouch/pkg/jsonstream"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitReporter(t *testing.T) {
+	var (
+		buf      = new(bytes.Buffer)
+		stream   = jsonstream.New(buf, nil)
+		notified []ctrd.RegistryRateLimit
+	)
+
+	reporter := newRateLimitReporter(stream, func(host string, limit ctrd.RegistryRateLimit) {
+		notified = append(notified, limit)
+	})
+
+	first := ctrd.RegistryRateLimit{Limit: 100, Remaining: 76}
+	second := ctrd.RegistryRateLimit{Limit: 100, Remaining: 75}
+
+	// the unchanged rate limit is reported once per registry
+	reporter.report("registry-1.docker.io", first)
+	reporter.report("registry-1.docker.io", first)
+	reporter.report("registry-1.docker.io", second)
+	reporter.report("mirror.abc.com", second)
+
+	stream.Close()
+	stream.Wait()
+
+	assert.Equal(t, []ctrd.RegistryRateLimit{first, second, second}, notified)
+	assert.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("Registry rate limit: ")))
+	assert.Contains(t, buf.String(), `"id":"mirror.abc.com","status":"Registry rate limit: 75 of 100 pulls remaining"`)
+}
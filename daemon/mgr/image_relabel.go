@@ -0,0 +1,246 @@
+package mgr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RelabelNamespace moves the local images from oldNS to newNS, like moving
+// reg.abc.com/team-a/busybox:latest to reg.abc.com/team-b/busybox:latest.
+//
+// For each image, all the references under oldNS are created under newNS
+// before the old ones are removed, which is atomic: if any reference fails to
+// be created or removed, the image is rolled back to the old references.
+//
+// The namespace without registry, like team-a, is in the default registry.
+func (mgr *ImageManager) RelabelNamespace(ctx context.Context, oldNS, newNS string) ([]types.ImageDeleteResponseItem, error) {
+	oldNS, err := mgr.normalizeNamespace(oldNS)
+	if err != nil {
+		return nil, err
+	}
+
+	newNS, err = mgr.normalizeNamespace(newNS)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldNS == newNS {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "the new namespace should be different from %s", oldNS)
+	}
+
+	refsByID := make(map[digest.Digest][]reference.Named)
+	for _, ref := range mgr.localStore.ListAllReferences() {
+		if !strings.HasPrefix(ref.Name(), oldNS+"/") {
+			continue
+		}
+
+		id, _, primaryRef, err := mgr.CheckReference(ctx, ref.String())
+		if err != nil {
+			return nil, err
+		}
+
+		// NOTE: the searchable digest reference will be created with its
+		// primary tag reference.
+		if primaryRef.String() != ref.String() {
+			continue
+		}
+		refsByID[id] = append(refsByID[id], ref)
+	}
+
+	if len(refsByID) == 0 {
+		return nil, pkgerrors.Wrapf(errtypes.ErrNotfound, "no image under namespace %s", oldNS)
+	}
+
+	ids := make([]string, 0, len(refsByID))
+	for id := range refsByID {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+
+	var res []types.ImageDeleteResponseItem
+	for _, id := range ids {
+		items, err := mgr.relabelImage(ctx, digest.Digest(id), refsByID[digest.Digest(id)], oldNS, newNS)
+		if err != nil {
+			res = append(res, types.ImageDeleteResponseItem{
+				Error: fmt.Sprintf("failed to relabel image %q: %v", id, err),
+			})
+			continue
+		}
+		res = append(res, items...)
+	}
+	return res, nil
+}
+
+// relabelImage moves the primary references of one image into newNS.
+func (mgr *ImageManager) relabelImage(ctx context.Context, id digest.Digest, refs []reference.Named, oldNS, newNS string) ([]types.ImageDeleteResponseItem, error) {
+	created, removed, err := mgr.relabelLockedImage(ctx, id, refs, oldNS, newNS)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: the events are logged after the image is unlocked, because
+	// LogImageEvent reads the image.
+	items := make([]types.ImageDeleteResponseItem, 0, len(removed))
+	for _, ref := range created {
+		mgr.LogImageEvent(ctx, id.String(), ref.String(), "tag")
+	}
+	for _, ref := range removed {
+		items = append(items, types.ImageDeleteResponseItem{Untagged: ref.String()})
+		mgr.LogImageEvent(ctx, id.String(), ref.String(), "untag")
+	}
+	return items, nil
+}
+
+// relabelLockedImage creates the new references and removes the old ones
+// while holding the write lock of the image, and returns the created and the
+// removed references. Nothing is changed if it fails.
+func (mgr *ImageManager) relabelLockedImage(ctx context.Context, id digest.Digest, refs []reference.Named, oldNS, newNS string) (created, removed []reference.Named, err error) {
+	unlock := mgr.imageLocks.lock(id)
+	defer unlock()
+
+	var (
+		ctrdImgs = make([]containerd.Image, 0, len(refs))
+		newRefs  = make([]reference.Named, 0, len(refs))
+	)
+	for _, ref := range refs {
+		ctrdImg, err := mgr.client.GetImage(ctx, ref.String())
+		if err != nil {
+			return nil, nil, err
+		}
+		ctrdImgs = append(ctrdImgs, ctrdImg)
+
+		newRef, err := reference.Parse(newNS + strings.TrimPrefix(ref.String(), oldNS))
+		if err != nil {
+			return nil, nil, pkgerrors.Wrap(errtypes.ErrInvalidParam, err.Error())
+		}
+
+		// the new reference cannot be used by other image
+		existingID, _, _, err := mgr.CheckReference(ctx, newRef.String())
+		if err == nil {
+			if existingID != id {
+				return nil, nil, pkgerrors.Wrapf(errtypes.ErrAlreadyExisted, "reference %s is used by image %s", newRef, existingID)
+			}
+			newRef = nil
+		} else if !errtypes.IsNotfound(err) {
+			return nil, nil, err
+		}
+		newRefs = append(newRefs, newRef)
+	}
+
+	rollbackCreated := func() {
+		for _, ref := range created {
+			mgr.rollbackMovedReference(ctx, id, ref)
+		}
+	}
+
+	for i, newRef := range newRefs {
+		if newRef == nil {
+			continue
+		}
+
+		if err := mgr.createReference(ctx, ctrdImgs[i], newRef); err != nil {
+			// NOTE: createReference adds the reference into local
+			// store before containerd meta db.
+			if err := mgr.localStore.RemoveReference(id, newRef); err != nil {
+				logrus.Warnf("failed to rollback reference %s in local store: %v", newRef, err)
+			}
+			rollbackCreated()
+			return nil, nil, err
+		}
+		created = append(created, newRef)
+	}
+
+	// NOTE: the content of image is kept because the new references have
+	// been created in containerd meta db.
+	var restores []func()
+	for i, ref := range refs {
+		aliases := mgr.localStore.GetReferencesByPrimary(ref)
+		restore := mgr.restoreReferenceFunc(ctx, id, ref, aliases, ctrdImgs[i])
+
+		removeErr := mgr.localStore.RemoveReference(id, ref)
+		if removeErr == nil {
+			removeErr = mgr.client.RemoveImage(ctx, ref.String())
+		}
+		if removeErr != nil {
+			restore(false)
+			for j := len(restores) - 1; j >= 0; j-- {
+				restores[j]()
+			}
+			rollbackCreated()
+			return nil, nil, pkgerrors.Wrapf(removeErr, "failed to remove reference %s", ref)
+		}
+
+		restores = append(restores, func() { restore(true) })
+		removed = append(removed, append([]reference.Named{ref}, aliases...)...)
+	}
+	return created, removed, nil
+}
+
+// restoreReferenceFunc returns the function which adds the removed primary
+// reference and its aliases back into local store, and into containerd meta
+// db if inContainerd is true.
+func (mgr *ImageManager) restoreReferenceFunc(ctx context.Context, id digest.Digest, ref reference.Named, aliases []reference.Named, ctrdImg containerd.Image) func(inContainerd bool) {
+	return func(inContainerd bool) {
+		for _, alias := range append([]reference.Named{ref}, aliases...) {
+			if err := mgr.localStore.AddReference(id, ref, alias); err != nil {
+				logrus.Warnf("failed to rollback reference %s in local store: %v", alias, err)
+			}
+		}
+
+		if !inContainerd {
+			return
+		}
+		if _, err := mgr.client.CreateImageReference(ctx, ctrdmetaimages.Image{
+			Name:   ref.String(),
+			Target: ctrdImg.Target(),
+			Labels: ctrdImg.Labels(),
+		}); err != nil {
+			logrus.Warnf("failed to rollback reference %s in containerd: %v", ref, err)
+		}
+	}
+}
+
+// normalizeNamespace validates the namespace, and adds the default registry
+// if the namespace doesn't contain the registry, like team-a.
+func (mgr *ImageManager) normalizeNamespace(ns string) (string, error) {
+	ns = strings.TrimSuffix(ns, "/")
+	if err := validateNamespace(ns); err != nil {
+		return "", err
+	}
+
+	domain := strings.SplitN(ns, "/", 2)[0]
+	if domain != "localhost" && !strings.ContainsAny(domain, ".:") {
+		ns = mgr.DefaultRegistry + "/" + ns
+	}
+	return ns, nil
+}
+
+// validateNamespace checks the namespace which is the name of reference
+// without tag or digest, like reg.abc.com/team.
+func validateNamespace(ns string) error {
+	if ns == "" {
+		return pkgerrors.Wrap(errtypes.ErrInvalidParam, "namespace cannot be empty")
+	}
+
+	ref, err := reference.Parse(ns)
+	if err != nil {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid namespace %s: %v", ns, err)
+	}
+
+	if !reference.IsNamedOnly(ref) {
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "namespace %s cannot contain tag or digest", ns)
+	}
+	return nil
+}
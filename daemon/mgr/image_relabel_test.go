@@ -0,0 +1,94 @@
+package mgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alibaba/pouch/daemon/events"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		ns      string
+		wantErr bool
+	}{
+		{ns: "reg.abc.com/team", wantErr: false},
+		{ns: "reg.abc.com:5000/team/sub", wantErr: false},
+		{ns: "", wantErr: true},
+		{ns: "reg.abc.com/team:latest", wantErr: true},
+		{ns: "reg.abc.com/team@sha256:" + "a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4", wantErr: true},
+	} {
+		err := validateNamespace(tc.ns)
+		assert.Equal(t, tc.wantErr, err != nil, "%s: %v", tc.ns, err)
+	}
+}
+
+func TestRelabelNamespace(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+	}
+	mgr.DefaultRegistry = "reg.abc.com"
+
+	target := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: digest.FromString("app")}
+	for _, name := range []string{"reg.abc.com/team-a/app:v1", "reg.abc.com/team-a/app:v2"} {
+		client.images[name] = newIndexOnlyImage(name, target)
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(target.Digest, ref, target.Digest))
+	}
+	mgr.localStore.CacheCtrdImageInfo(target.Digest, CtrdImageInfo{ID: target.Digest, IndexOnly: true})
+
+	checkRefs := func(ns string, exist bool) {
+		for _, tag := range []string{"v1", "v2"} {
+			name := "reg.abc.com/" + ns + "/app:" + tag
+			_, _, _, err := mgr.CheckReference(context.TODO(), name)
+			_, ok := client.images[name]
+			if exist {
+				assert.NoError(t, err, name)
+				assert.True(t, ok, name)
+			} else {
+				assert.True(t, errtypes.IsNotfound(err), "%s: %v", name, err)
+				assert.False(t, ok, name)
+			}
+		}
+	}
+
+	// the namespace without registry is in the default registry
+	items, err := mgr.RelabelNamespace(context.TODO(), "team-a", "team-b/")
+	assert.NoError(t, err)
+	checkRefs("team-a", false)
+	checkRefs("team-b", true)
+
+	untagged := map[string]bool{}
+	for _, item := range items {
+		assert.Empty(t, item.Error)
+		untagged[item.Untagged] = true
+	}
+	assert.True(t, untagged["reg.abc.com/team-a/app:v1"])
+	assert.True(t, untagged["reg.abc.com/team-a/app:v2"])
+
+	// nothing is changed if any old reference fails to be removed
+	client.removeErrs = map[string]error{"reg.abc.com/team-b/app:v2": errors.New("boom")}
+	items, err = mgr.RelabelNamespace(context.TODO(), "reg.abc.com/team-b", "reg.abc.com/team-c")
+	assert.NoError(t, err)
+	if assert.Len(t, items, 1) {
+		assert.Contains(t, items[0].Error, "boom")
+	}
+	checkRefs("team-b", true)
+	checkRefs("team-c", false)
+}
@@ -0,0 +1,42 @@
+package mgr
+
+import (
+	"context"
+	"sort"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// ListRemoteTags lists the tags of the repository in the registry, which
+// helps to choose the tag before pull. Unlike SearchImages, which searches
+// the repositories by name, it lists the tags within one repository.
+//
+// The repository is normalized like the one of pull, and the credential is
+// resolved from the credential helper if auth is empty.
+func (mgr *ImageManager) ListRemoteTags(ctx context.Context, repo string, auth *types.AuthConfig) ([]string, error) {
+	namedRef, err := reference.Parse(addDefaultRegistryIfMissing(repo, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces))
+	if err != nil {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid repository %s: %v", repo, err)
+	}
+
+	if !reference.IsNamedOnly(namedRef) {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "repository %s should not contain tag or digest", repo)
+	}
+
+	auth, err = mgr.resolveAuthConfig(ctx, namedRef.Name(), auth)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := mgr.client.ListRemoteTags(ctx, namedRef.Name(), auth)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
@@ -1,23 +1,434 @@
 package mgr
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"io"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
 	ociimage "github.com/containerd/containerd/images/oci"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
 )
 
-// SaveImage saves image to the oci.v1 format tarstream.
-func (mgr *ImageManager) SaveImage(ctx context.Context, idOrRef string) (io.ReadCloser, error) {
-	_, _, ref, err := mgr.CheckReference(ctx, idOrRef)
+// SaveImage saves image to the docker or oci.v1 format tarstream.
+func (mgr *ImageManager) SaveImage(ctx context.Context, idOrRef string, opt *ImageSaveOption) (io.ReadCloser, error) {
+	if opt == nil {
+		opt = &ImageSaveOption{}
+	}
+
+	if err := validateImageArchiveFormat(opt.Format); err != nil {
+		return nil, err
+	}
+
+	// NOTE: the docker archive is always reproducible.
+	if opt.Format == "" || opt.Format == ImageArchiveFormatDocker {
+		return mgr.SaveImages(ctx, []string{idOrRef}, opt)
+	}
+
+	if opt.From != "" {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "delta archive can only be saved in %s format", ImageArchiveFormatDocker)
+	}
+
+	id, actualRef, ref, err := mgr.CheckReference(ctx, idOrRef)
 	if err != nil {
 		return nil, err
 	}
 
-	exportedStream, err := mgr.client.SaveImage(ctx, &ociimage.V1Exporter{}, ref.String())
+	img, err := mgr.client.GetImage(ctx, ref.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLocalLayers(img, "save"); err != nil {
+		return nil, err
+	}
+
+	var exporter images.Exporter = &ociimage.V1Exporter{}
+	if opt.Reproducible {
+		exporter = &reproducibleExporter{}
+	}
+
+	// NOTE: the ref name annotation is the tag of primary reference, which
+	// is bogus for the image required by digest.
+	if isDigestReference(id, actualRef) {
+		exporter = &digestExporter{Exporter: exporter}
+	}
+
+	if err := mgr.saveLimiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	exportedStream, err := mgr.client.SaveImage(ctx, exporter, ref.String())
 	if err != nil {
+		mgr.saveLimiter.release()
+		return nil, err
+	}
+	mgr.LogImageEvent(ctx, id.String(), ref.String(), "save")
+
+	// NOTE: the slot will be released after the caller closes the stream.
+	return mgr.compressSaveStream(&releaseOnCloseReader{
+		ReadCloser: exportedStream,
+		release:    mgr.saveLimiter.release,
+	}, opt.Compress), nil
+}
+
+// SaveImages saves the images to one docker-compatible tarstream, which
+// contains the combined manifest.json and repositories for all the images.
+func (mgr *ImageManager) SaveImages(ctx context.Context, idOrRefs []string, opt *ImageSaveOption) (io.ReadCloser, error) {
+	if len(idOrRefs) == 0 {
+		return nil, pkgerrors.Wrap(errtypes.ErrInvalidParam, "no image to save")
+	}
+
+	if opt == nil {
+		opt = &ImageSaveOption{}
+	}
+
+	if opt.Format != "" && opt.Format != ImageArchiveFormatDocker {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "several images can only be saved in %s format", ImageArchiveFormatDocker)
+	}
+
+	var (
+		exporter = &dockerArchiveExporter{}
+		store    content.Provider
+		events   = make(map[digest.Digest]string)
+	)
+
+	for _, idOrRef := range idOrRefs {
+		actualID, actualRef, primaryRef, err := mgr.CheckReference(ctx, idOrRef)
+		if err != nil {
+			return nil, err
+		}
+
+		img, err := mgr.client.GetImage(ctx, primaryRef.String())
+		if err != nil {
+			return nil, err
+		}
+		if err := checkLocalLayers(img, "save"); err != nil {
+			return nil, err
+		}
+		store = img.ContentStore()
+
+		_, platform, _, err := mgr.imageConfig(ctx, img)
+		if err != nil {
+			return nil, err
+		}
+
+		refs := mgr.archiveReferences(actualID, actualRef)
+		if len(refs) == 0 {
+			exporter.add(img.Target(), platform, nil)
+		}
+		for _, ref := range refs {
+			exporter.add(img.Target(), platform, ref)
+		}
+		events[actualID] = primaryRef.String()
+	}
+
+	if opt.From != "" {
+		baseID, _, basePrimaryRef, err := mgr.CheckReference(ctx, opt.From)
+		if err != nil {
+			return nil, pkgerrors.Wrapf(err, "failed to get base image %s", opt.From)
+		}
+
+		baseImg, err := mgr.client.GetImage(ctx, basePrimaryRef.String())
+		if err != nil {
+			return nil, err
+		}
+
+		_, basePlatform, _, err := mgr.imageConfig(ctx, baseImg)
+		if err != nil {
+			return nil, err
+		}
+		exporter.setBase(baseID, baseImg.Target(), basePlatform)
+	}
+
+	if err := mgr.saveLimiter.acquire(ctx); err != nil {
 		return nil, err
 	}
 
-	return exportedStream, nil
+	for id, ref := range events {
+		mgr.LogImageEvent(ctx, id.String(), ref, "save")
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(exporter.Export(ctx, store, pw))
+	}()
+
+	// NOTE: the slot will be released after the caller closes the stream.
+	return mgr.compressSaveStream(&releaseOnCloseReader{
+		ReadCloser: pr,
+		release:    mgr.saveLimiter.release,
+	}, opt.Compress), nil
+}
+
+// archiveReferences returns the references of image recorded in the archive.
+// The image required by ID is recorded with all the tags of it, and the one
+// required by digest is recorded with the digest only.
+func (mgr *ImageManager) archiveReferences(id digest.Digest, actualRef reference.Named) []reference.Named {
+	if reference.IsNamedOnly(actualRef) || strings.HasPrefix(id.String(), actualRef.String()) {
+		var tags []reference.Named
+		for _, ref := range mgr.localStore.GetPrimaryReferences(id) {
+			if reference.IsNameTagged(ref) {
+				tags = append(tags, ref)
+			}
+		}
+
+		sort.Slice(tags, func(i, j int) bool {
+			return tags[i].String() < tags[j].String()
+		})
+		return tags
+	}
+
+	if isDigestReference(id, actualRef) {
+		return []reference.Named{reference.TrimTagForDigest(actualRef)}
+	}
+	return []reference.Named{actualRef}
+}
+
+// isDigestReference returns true if the image is required by Name@Digest.
+func isDigestReference(id digest.Digest, actualRef reference.Named) bool {
+	_, ok := actualRef.(reference.Digested)
+	return ok && !strings.HasPrefix(id.String(), actualRef.String())
+}
+
+// digestExporter exports the image without the ref name annotation, so that
+// the image required by digest isn't recorded with the tag of its primary
+// reference. The digest is recorded by the descriptor in index.json.
+type digestExporter struct {
+	images.Exporter
+}
+
+// Export implements images.Exporter.
+func (de *digestExporter) Export(ctx context.Context, store content.Provider, desc ocispec.Descriptor, writer io.Writer) error {
+	var annotations map[string]string
+	for k, v := range desc.Annotations {
+		if k == ocispec.AnnotationRefName {
+			continue
+		}
+
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[k] = v
+	}
+	desc.Annotations = annotations
+
+	return de.Exporter.Export(ctx, store, desc, writer)
+}
+
+// compressSaveStream compresses the tarstream by gzip with the configured
+// level if compress is true.
+func (mgr *ImageManager) compressSaveStream(rc io.ReadCloser, compress bool) io.ReadCloser {
+	if !compress {
+		return rc
+	}
+
+	level := mgr.saveCompressionLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return newGzipReadCloser(rc, level)
+}
+
+// gzipReadCloser reads the gzip-compressed content of the source, and closes
+// the source when it's closed.
+type gzipReadCloser struct {
+	*io.PipeReader
+	src io.ReadCloser
+}
+
+func newGzipReadCloser(src io.ReadCloser, level int) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		gw, err := gzip.NewWriterLevel(pw, level)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := io.Copy(gw, src); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(gw.Close())
+	}()
+	return &gzipReadCloser{PipeReader: pr, src: src}
+}
+
+// Close closes both the pipe and the source.
+func (r *gzipReadCloser) Close() error {
+	r.PipeReader.Close()
+	return r.src.Close()
+}
+
+// reproducibleEpoch is the timestamp used for all the entries in the
+// reproducible tarstream.
+var reproducibleEpoch = time.Unix(0, 0).UTC()
+
+// reproducibleExporter exports the image in the oci.v1 format like the
+// containerd's V1Exporter, but it normalizes the tar entries so that the
+// same image always yields byte-identical tarstream. The normalized fields:
+//
+//	1. entries are sorted by name and each blob is written only once;
+//	2. ModTime is set to unix epoch and there is no AccessTime/ChangeTime;
+//	3. Uid/Gid are set to 0 and Uname/Gname are left empty;
+//	4. Mode is 0444 for blob and oci-layout, 0644 for index.json and 0755
+//	   for directory;
+//	5. headers are written in USTAR format without any PAX records.
+type reproducibleExporter struct{}
+
+type tarRecord struct {
+	header *tar.Header
+	copyTo func(context.Context, io.Writer) (int64, error)
+}
+
+// Export implements images.Exporter.
+func (re *reproducibleExporter) Export(ctx context.Context, store content.Provider, desc ocispec.Descriptor, writer io.Writer) error {
+	tw := tar.NewWriter(writer)
+	defer tw.Close()
+
+	layout, err := jsonRecord(ocispec.ImageLayoutFile, 0444, ocispec.ImageLayout{
+		Version: ocispec.ImageLayoutVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	index, err := jsonRecord("index.json", 0644, ocispec.Index{
+		Versioned: ocispecs.Versioned{
+			SchemaVersion: 2,
+		},
+		Manifests: []ocispec.Descriptor{desc},
+	})
+	if err != nil {
+		return err
+	}
+
+	records := map[string]tarRecord{
+		layout.header.Name: layout,
+		index.header.Name:  index,
+	}
+
+	exportHandler := func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		dirRecord := directoryRecord("blobs/" + desc.Digest.Algorithm().String() + "/")
+		records[dirRecord.header.Name] = dirRecord
+
+		record := blobRecord(store, desc)
+		records[record.header.Name] = record
+		return nil, nil
+	}
+
+	handlers := images.Handlers(
+		images.ChildrenHandler(store),
+		images.HandlerFunc(exportHandler),
+	)
+
+	if err := images.Walk(ctx, handlers, desc); err != nil {
+		return err
+	}
+
+	dirRecord := directoryRecord("blobs/")
+	records[dirRecord.header.Name] = dirRecord
+
+	return writeTarRecords(ctx, tw, records)
+}
+
+// writeTarRecords writes the records into tar stream in the order of name.
+func writeTarRecords(ctx context.Context, tw *tar.Writer, records map[string]tarRecord) error {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		record := records[name]
+		if err := tw.WriteHeader(record.header); err != nil {
+			return err
+		}
+
+		if record.copyTo == nil {
+			continue
+		}
+
+		n, err := record.copyTo(ctx, tw)
+		if err != nil {
+			return err
+		}
+		if n != record.header.Size {
+			return pkgerrors.Errorf("unexpected copy size for %s", name)
+		}
+	}
+	return nil
+}
+
+func normalizedHeader(name string, mode int64, size int64, typeflag byte) *tar.Header {
+	return &tar.Header{
+		Name:     name,
+		Mode:     mode,
+		Size:     size,
+		Typeflag: typeflag,
+		ModTime:  reproducibleEpoch,
+		Format:   tar.FormatUSTAR,
+	}
+}
+
+func directoryRecord(name string) tarRecord {
+	return tarRecord{
+		header: normalizedHeader(name, 0755, 0, tar.TypeDir),
+	}
+}
+
+func jsonRecord(name string, mode int64, obj interface{}) (tarRecord, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return tarRecord{}, err
+	}
+
+	return tarRecord{
+		header: normalizedHeader(name, mode, int64(len(b)), tar.TypeReg),
+		copyTo: func(ctx context.Context, w io.Writer) (int64, error) {
+			n, err := w.Write(b)
+			return int64(n), err
+		},
+	}, nil
+}
+
+func blobRecord(cs content.Provider, desc ocispec.Descriptor) tarRecord {
+	name := "blobs/" + desc.Digest.Algorithm().String() + "/" + desc.Digest.Hex()
+	return contentRecord(cs, name, 0444, desc)
+}
+
+func contentRecord(cs content.Provider, name string, mode int64, desc ocispec.Descriptor) tarRecord {
+	return tarRecord{
+		header: normalizedHeader(name, mode, desc.Size, tar.TypeReg),
+		copyTo: func(ctx context.Context, w io.Writer) (int64, error) {
+			r, err := cs.ReaderAt(ctx, desc)
+			if err != nil {
+				return 0, pkgerrors.Wrap(err, "failed to get reader")
+			}
+			defer r.Close()
+
+			verifier := desc.Digest.Verifier()
+			n, err := io.Copy(io.MultiWriter(w, verifier), content.NewReader(r))
+			if err != nil {
+				return 0, pkgerrors.Wrap(err, "failed to copy to tar")
+			}
+			if !verifier.Verified() {
+				return 0, pkgerrors.Errorf("unexpected digest copied for %s", desc.Digest)
+			}
+			return n, nil
+		},
+	}
 }
@@ -0,0 +1,218 @@
+package mgr
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+
+	"github.com/alibaba/pouch/pkg/reference"
+	"github.com/alibaba/pouch/pkg/utils"
+
+	"github.com/containerd/containerd/content"
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// dockerArchiveManifestItem is the entry of manifest.json in the docker
+// archive.
+type dockerArchiveManifestItem struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+
+	// RepoDigests records the digest references which the image is
+	// required by. It's ignored by docker load.
+	RepoDigests []string `json:",omitempty"`
+
+	// BaseImage is the ID of base image if the layers shared with it are
+	// omitted, and the image can only be loaded when the base image is
+	// present. It's ignored by docker load.
+	BaseImage string `json:",omitempty"`
+}
+
+// dockerArchiveExporter exports several images into one tarstream which can
+// be loaded by docker load. The tarstream contains:
+//
+//	1. <config hex>.json for the config of each image;
+//	2. <diffID hex>/layer.tar for each layer, the layer shared by images is
+//	   written only once;
+//	3. manifest.json lists the config, layers, tags and digests of each image;
+//	4. repositories maps the tag to the top layer of image.
+//
+// If the base image is set, the layers of base image are omitted from the
+// tarstream, and the images sharing them are recorded with the base image
+// in manifest.json, which makes a delta archive.
+//
+// NOTE: the layer.tar keeps the compressed blob in content store, which is
+// acceptable for docker load since it detects the compression of layer.
+type dockerArchiveExporter struct {
+	images []dockerArchiveImage
+
+	baseID       digest.Digest
+	baseTarget   *ocispec.Descriptor
+	basePlatform platforms.MatchComparer
+}
+
+type dockerArchiveImage struct {
+	target   ocispec.Descriptor
+	platform platforms.MatchComparer
+	ref      reference.Named
+}
+
+// add adds the image into the archive, which is read by the platform. The ref
+// can be the tag or digest reference, or nil if the image is required by ID
+// without any tag.
+func (de *dockerArchiveExporter) add(target ocispec.Descriptor, platform platforms.MatchComparer, ref reference.Named) {
+	de.images = append(de.images, dockerArchiveImage{
+		target:   target,
+		platform: platform,
+		ref:      ref,
+	})
+}
+
+// setBase sets the base image whose layers are omitted.
+func (de *dockerArchiveExporter) setBase(id digest.Digest, target ocispec.Descriptor, platform platforms.MatchComparer) {
+	de.baseID = id
+	de.baseTarget = &target
+	de.basePlatform = platform
+}
+
+// baseDiffIDs returns the diffIDs of the layers of base image.
+func (de *dockerArchiveExporter) baseDiffIDs(ctx context.Context, store content.Provider) (map[digest.Digest]struct{}, error) {
+	diffIDs := make(map[digest.Digest]struct{})
+	if de.baseTarget == nil {
+		return diffIDs, nil
+	}
+
+	manifest, err := ctrdmetaimages.Manifest(ctx, store, *de.baseTarget, de.basePlatform)
+	if err != nil {
+		return nil, err
+	}
+
+	ociImage, err := readOciImage(ctx, store, manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, diffID := range ociImage.RootFS.DiffIDs {
+		diffIDs[diffID] = struct{}{}
+	}
+	return diffIDs, nil
+}
+
+// Export writes the images into writer.
+func (de *dockerArchiveExporter) Export(ctx context.Context, store content.Provider, writer io.Writer) error {
+	tw := tar.NewWriter(writer)
+	defer tw.Close()
+
+	var (
+		records      = map[string]tarRecord{}
+		items        []*dockerArchiveManifestItem
+		itemByConfig = map[digest.Digest]*dockerArchiveManifestItem{}
+		repositories = map[string]map[string]string{}
+	)
+
+	baseDiffIDs, err := de.baseDiffIDs(ctx, store)
+	if err != nil {
+		return pkgerrors.Wrap(err, "failed to get layers of base image")
+	}
+
+	for _, img := range de.images {
+		manifest, err := ctrdmetaimages.Manifest(ctx, store, img.target, img.platform)
+		if err != nil {
+			return err
+		}
+
+		item, ok := itemByConfig[manifest.Config.Digest]
+		if !ok {
+			ociImage, err := readOciImage(ctx, store, manifest.Config)
+			if err != nil {
+				return err
+			}
+
+			diffIDs := ociImage.RootFS.DiffIDs
+			if len(diffIDs) != len(manifest.Layers) {
+				return pkgerrors.Errorf("mismatched number of layers and diffIDs for image %s", manifest.Config.Digest)
+			}
+
+			item = &dockerArchiveManifestItem{
+				Config:   manifest.Config.Digest.Hex() + ".json",
+				RepoTags: []string{},
+			}
+			records[item.Config] = contentRecord(store, item.Config, 0644, manifest.Config)
+
+			for i, layer := range manifest.Layers {
+				name := diffIDs[i].Hex() + "/layer.tar"
+				item.Layers = append(item.Layers, name)
+
+				// NOTE: the layer of base image is still listed in
+				// manifest.json, and it's supplied by the base image
+				// during loading.
+				if _, ok := baseDiffIDs[diffIDs[i]]; ok {
+					item.BaseImage = de.baseID.String()
+					continue
+				}
+
+				dirRecord := directoryRecord(path.Dir(name) + "/")
+				records[dirRecord.header.Name] = dirRecord
+				records[name] = contentRecord(store, name, 0644, layer)
+			}
+
+			items = append(items, item)
+			itemByConfig[manifest.Config.Digest] = item
+		}
+
+		if img.ref == nil {
+			continue
+		}
+
+		// NOTE: the digest reference may be Tagged too, but the tag
+		// should not be recorded for it.
+		if _, ok := img.ref.(reference.Digested); ok {
+			repoDigest := img.ref.String()
+			if !utils.StringInSlice(item.RepoDigests, repoDigest) {
+				item.RepoDigests = append(item.RepoDigests, repoDigest)
+			}
+			continue
+		}
+
+		tagged, ok := img.ref.(reference.Tagged)
+		if !ok {
+			continue
+		}
+
+		repoTag := img.ref.String()
+		if !utils.StringInSlice(item.RepoTags, repoTag) {
+			item.RepoTags = append(item.RepoTags, repoTag)
+		}
+
+		if len(item.Layers) == 0 {
+			continue
+		}
+
+		if _, ok := repositories[img.ref.Name()]; !ok {
+			repositories[img.ref.Name()] = map[string]string{}
+		}
+		repositories[img.ref.Name()][tagged.Tag()] = path.Dir(item.Layers[len(item.Layers)-1])
+	}
+
+	manifestRecord, err := jsonRecord("manifest.json", 0644, items)
+	if err != nil {
+		return err
+	}
+	records[manifestRecord.header.Name] = manifestRecord
+
+	if len(repositories) > 0 {
+		repoRecord, err := jsonRecord("repositories", 0644, repositories)
+		if err != nil {
+			return err
+		}
+		records[repoRecord.header.Name] = repoRecord
+	}
+
+	return writeTarRecords(ctx, tw, records)
+}
@@ -0,0 +1,351 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd/platforms"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestImageProvider(t *testing.T) (memProvider, ocispec.Descriptor) {
+	provider := memProvider{}
+
+	layer := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+	config := provider.add(ocispec.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Config:    config,
+		// NOTE: the duplicate layer should be written only once.
+		Layers: []ocispec.Descriptor{layer, layer},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %v", err)
+	}
+	return provider, provider.add(ocispec.MediaTypeImageManifest, manifest)
+}
+
+func TestReproducibleExporter(t *testing.T) {
+	provider, desc := newTestImageProvider(t)
+
+	export := func() []byte {
+		buf := new(bytes.Buffer)
+		if err := (&reproducibleExporter{}).Export(context.TODO(), provider, desc, buf); err != nil {
+			t.Fatalf("failed to export: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	first, second := export(), export()
+	assert.Equal(t, first, second)
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(first))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+
+		assert.Equal(t, reproducibleEpoch.Unix(), hdr.ModTime.Unix())
+		assert.Equal(t, 0, hdr.Uid)
+		assert.Equal(t, 0, hdr.Gid)
+		assert.Equal(t, "", hdr.Uname)
+		names = append(names, hdr.Name)
+	}
+
+	assert.True(t, sort.StringsAreSorted(names))
+	assert.Equal(t, 7, len(names))
+	for _, name := range []string{
+		"blobs/",
+		"blobs/sha256/",
+		"blobs/sha256/" + desc.Digest.Hex(),
+		"blobs/sha256/" + digest.FromBytes([]byte("layer")).Hex(),
+		"index.json",
+		"oci-layout",
+	} {
+		assert.Contains(t, names, name)
+	}
+}
+
+func TestDockerArchiveExporter(t *testing.T) {
+	provider := memProvider{}
+
+	newImage := func(layers ...string) ocispec.Descriptor {
+		var (
+			descs   []ocispec.Descriptor
+			diffIDs []digest.Digest
+		)
+		for _, layer := range layers {
+			descs = append(descs, provider.add(ocispec.MediaTypeImageLayer, []byte(layer)))
+			diffIDs = append(diffIDs, digest.FromBytes([]byte(layer)))
+		}
+
+		config, err := json.Marshal(ocispec.Image{
+			Architecture: "amd64",
+			OS:           "linux",
+			RootFS: ocispec.RootFS{
+				Type:    "layers",
+				DiffIDs: diffIDs,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal config: %v", err)
+		}
+
+		manifest, err := json.Marshal(ocispec.Manifest{
+			Versioned: ocispecs.Versioned{SchemaVersion: 2},
+			Config:    provider.add(ocispec.MediaTypeImageConfig, config),
+			Layers:    descs,
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal manifest: %v", err)
+		}
+		return provider.add(ocispec.MediaTypeImageManifest, manifest)
+	}
+
+	base, app := newImage("base"), newImage("base", "app")
+
+	exporter := &dockerArchiveExporter{}
+	exporter.add(base, platforms.Default(), mustParseReference(t, "reg.abc.com/base:1.0"))
+	exporter.add(app, platforms.Default(), mustParseReference(t, "reg.abc.com/app:1.0"))
+	// NOTE: the same image should be listed only once.
+	exporter.add(base, platforms.Default(), mustParseReference(t, "reg.abc.com/base:latest"))
+	exporter.add(app, platforms.Default(), nil)
+	// NOTE: the tag of digest reference should not be recorded.
+	exporter.add(app, platforms.Default(), reference.WithDigest(mustParseReference(t, "reg.abc.com/app:1.0"), app.Digest))
+
+	buf := new(bytes.Buffer)
+	if err := exporter.Export(context.TODO(), provider, buf); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+
+		data := new(bytes.Buffer)
+		if _, err := io.Copy(data, tr); err != nil {
+			t.Fatalf("failed to read %s: %v", hdr.Name, err)
+		}
+
+		_, exist := files[hdr.Name]
+		assert.False(t, exist, "duplicate entry %s", hdr.Name)
+		files[hdr.Name] = data.Bytes()
+	}
+
+	baseLayer := digest.FromBytes([]byte("base")).Hex()
+	appLayer := digest.FromBytes([]byte("app")).Hex()
+	assert.Equal(t, []byte("base"), files[baseLayer+"/layer.tar"])
+	assert.Equal(t, []byte("app"), files[appLayer+"/layer.tar"])
+
+	var items []dockerArchiveManifestItem
+	if err := json.Unmarshal(files["manifest.json"], &items); err != nil {
+		t.Fatalf("failed to unmarshal manifest.json: %v", err)
+	}
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, []string{"reg.abc.com/base:1.0", "reg.abc.com/base:latest"}, items[0].RepoTags)
+	assert.Equal(t, []string{baseLayer + "/layer.tar"}, items[0].Layers)
+	assert.Equal(t, []string{"reg.abc.com/app:1.0"}, items[1].RepoTags)
+	assert.Empty(t, items[0].RepoDigests)
+	assert.Equal(t, []string{"reg.abc.com/app@" + app.Digest.String()}, items[1].RepoDigests)
+	assert.Equal(t, []string{baseLayer + "/layer.tar", appLayer + "/layer.tar"}, items[1].Layers)
+	for _, item := range items {
+		assert.Contains(t, files, item.Config)
+	}
+
+	var repositories map[string]map[string]string
+	if err := json.Unmarshal(files["repositories"], &repositories); err != nil {
+		t.Fatalf("failed to unmarshal repositories: %v", err)
+	}
+	assert.Equal(t, map[string]map[string]string{
+		"reg.abc.com/base": {"1.0": baseLayer, "latest": baseLayer},
+		"reg.abc.com/app":  {"1.0": appLayer},
+	}, repositories)
+}
+
+func TestArchiveReferences(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{localStore: store}
+
+	id := digest.FromString("config")
+	manifest := digest.FromString("manifest")
+	for _, ref := range []string{"reg.abc.com/app:2.0", "reg.abc.com/app:1.0"} {
+		assert.NoError(t, mgr.addReferenceIntoStore(id, mustParseReference(t, ref), manifest))
+	}
+
+	refStrings := func(idOrRef string) []string {
+		actualID, actualRef, _, err := mgr.CheckReference(context.TODO(), idOrRef)
+		assert.NoError(t, err)
+
+		var res []string
+		for _, ref := range mgr.archiveReferences(actualID, actualRef) {
+			res = append(res, ref.String())
+		}
+		return res
+	}
+
+	// the image required by ID is recorded with all the tags
+	assert.Equal(t, []string{"reg.abc.com/app:1.0", "reg.abc.com/app:2.0"}, refStrings(id.String()))
+	assert.Equal(t, []string{"reg.abc.com/app:1.0", "reg.abc.com/app:2.0"}, refStrings(id.Hex()[:12]))
+	assert.Equal(t, []string{"reg.abc.com/app:2.0"}, refStrings("reg.abc.com/app:2.0"))
+	assert.Equal(t, []string{"reg.abc.com/app@" + manifest.String()}, refStrings("reg.abc.com/app@"+manifest.String()))
+}
+
+func TestDigestExporter(t *testing.T) {
+	provider, desc := newTestImageProvider(t)
+	desc.Annotations = map[string]string{
+		ocispec.AnnotationRefName: "1.0",
+		"foo":                     "bar",
+	}
+
+	buf := new(bytes.Buffer)
+	exporter := &digestExporter{Exporter: &reproducibleExporter{}}
+	if err := exporter.Export(context.TODO(), provider, desc, buf); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("failed to find index.json: %v", err)
+		}
+		if hdr.Name != "index.json" {
+			continue
+		}
+
+		var index ocispec.Index
+		if err := json.NewDecoder(tr).Decode(&index); err != nil {
+			t.Fatalf("failed to decode index.json: %v", err)
+		}
+		assert.Equal(t, desc.Digest, index.Manifests[0].Digest)
+		assert.Equal(t, map[string]string{"foo": "bar"}, index.Manifests[0].Annotations)
+		break
+	}
+
+	// the annotations of caller are untouched
+	assert.Equal(t, "1.0", desc.Annotations[ocispec.AnnotationRefName])
+}
+
+func mustParseReference(t *testing.T, ref string) reference.Named {
+	namedRef, err := reference.Parse(ref)
+	if err != nil {
+		t.Fatalf("failed to parse reference %s: %v", ref, err)
+	}
+	return namedRef
+}
+
+func TestArchiveFormatDetector(t *testing.T) {
+	provider, desc := newTestImageProvider(t)
+
+	ociArchive := new(bytes.Buffer)
+	if err := (&reproducibleExporter{}).Export(context.TODO(), provider, desc, ociArchive); err != nil {
+		t.Fatalf("failed to export oci archive: %v", err)
+	}
+
+	dockerArchive := new(bytes.Buffer)
+	tw := tar.NewWriter(dockerArchive)
+	if err := writeTarRecords(context.TODO(), tw, map[string]tarRecord{
+		"manifest.json": mustJSONRecord(t, "manifest.json", []dockerArchiveManifestItem{}),
+	}); err != nil {
+		t.Fatalf("failed to write docker archive: %v", err)
+	}
+	tw.Close()
+
+	for _, tc := range []struct {
+		data   []byte
+		expect string
+	}{
+		{data: ociArchive.Bytes(), expect: ImageArchiveFormatOCI},
+		{data: dockerArchive.Bytes(), expect: ImageArchiveFormatDocker},
+		{data: []byte("not a tar stream"), expect: ""},
+	} {
+		for _, required := range []string{ImageArchiveFormatOCI, ImageArchiveFormatDocker} {
+			out := new(bytes.Buffer)
+			detector := newArchiveFormatDetector(bytes.NewReader(tc.data), required)
+			_, err := io.Copy(out, detector)
+			assert.Equal(t, tc.expect, detector.format())
+
+			if tc.expect == required {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.data, out.Bytes())
+				continue
+			}
+
+			// the archive is rejected before its end is returned
+			assert.True(t, errtypes.IsInvalidParam(pkgerrors.Cause(err)), "%v", err)
+			assert.True(t, out.Len() < len(tc.data), "%s archive required as %s", tc.expect, required)
+		}
+	}
+}
+
+func mustJSONRecord(t *testing.T, name string, obj interface{}) tarRecord {
+	record, err := jsonRecord(name, 0644, obj)
+	if err != nil {
+		t.Fatalf("failed to create record %s: %v", name, err)
+	}
+	return record
+}
+
+// closeRecorder records whether the reader is closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestCompressSaveStream(t *testing.T) {
+	mgr := &ImageManager{}
+	data := bytes.Repeat([]byte("layer"), 1024)
+
+	src := &closeRecorder{Reader: bytes.NewReader(data)}
+	assert.Equal(t, io.ReadCloser(src), mgr.compressSaveStream(src, false))
+
+	for _, level := range []int{0, gzip.BestSpeed, gzip.BestCompression} {
+		mgr.saveCompressionLevel = level
+		src := &closeRecorder{Reader: bytes.NewReader(data)}
+
+		rc := mgr.compressSaveStream(src, true)
+		gr, err := gzip.NewReader(rc)
+		assert.NoError(t, err)
+
+		got, err := ioutil.ReadAll(gr)
+		assert.NoError(t, err)
+		assert.Equal(t, data, got)
+
+		assert.NoError(t, rc.Close())
+		assert.True(t, src.closed)
+	}
+}
@@ -0,0 +1,241 @@
+package mgr
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/alibaba/pouch/apis/types"
+	searchtypes "github.com/alibaba/pouch/registry/types"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SearchAllRegistries is the registry which means searching the images from
+// the default registry and all the registry mirrors.
+const SearchAllRegistries = "all"
+
+// SearchImages searches imaged from specified registry. The results are sorted
+// by the count of stars and pulls, and truncated to limit if limit is positive.
+//
+// If the registry is SearchAllRegistries, the results of the default registry
+// and all the registry mirrors will be merged.
+func (mgr *ImageManager) SearchImages(ctx context.Context, name, registry string, limit int, auth *types.AuthConfig) ([]types.SearchResultItem, error) {
+	var (
+		result []types.SearchResultItem
+		err    error
+	)
+
+	if registry == SearchAllRegistries {
+		result, err = mgr.searchAllRegistries(ctx, name, auth)
+	} else {
+		result, err = mgr.searchRegistry(ctx, name, registry, auth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sortSearchResults(result)
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// searchAllRegistries searches the images from the default registry and all
+// the registry mirrors concurrently. The results with the same name are merged
+// into the one with the highest star count. It fails only if all the
+// registries fail.
+func (mgr *ImageManager) searchAllRegistries(ctx context.Context, name string, auth *types.AuthConfig) ([]types.SearchResultItem, error) {
+	registries := []string{mgr.DefaultRegistry}
+	for _, mirror := range mgr.RegistryMirrors {
+		// the search API is served at the root of the mirror template.
+		if isMirrorTemplate(mirror) {
+			mirror = mirrorOfReference(mirror)
+		}
+		registries = append(registries, mirror)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([][]types.SearchResultItem, len(registries))
+		errs    = make([]error, len(registries))
+	)
+
+	for i, reg := range registries {
+		wg.Add(1)
+		go func(i int, reg string) {
+			defer wg.Done()
+
+			results[i], errs[i] = mgr.searchRegistry(ctx, name, mgr.searchEndpoint(reg), mgr.searchAuthOfRegistry(auth, reg))
+			if errs[i] != nil {
+				logrus.Warnf("failed to search images from registry %s: %v", reg, errs[i])
+			}
+		}(i, reg)
+	}
+	wg.Wait()
+
+	var (
+		merged  []types.SearchResultItem
+		indexes = make(map[string]int)
+		failed  int
+	)
+
+	for i := range registries {
+		if errs[i] != nil {
+			failed++
+			continue
+		}
+
+		for _, item := range results[i] {
+			item.Registry = registries[i]
+
+			idx, ok := indexes[item.Name]
+			if !ok {
+				indexes[item.Name] = len(merged)
+				merged = append(merged, item)
+				continue
+			}
+
+			if item.StarCount > merged[idx].StarCount {
+				merged[idx] = item
+			}
+		}
+	}
+
+	if failed == len(registries) {
+		return nil, errs[0]
+	}
+	return merged, nil
+}
+
+// searchRegistry searches the images from the registry by the v1 search API.
+func (mgr *ImageManager) searchRegistry(ctx context.Context, name, registry string, auth *types.AuthConfig) ([]types.SearchResultItem, error) {
+	// Directly send API calls towards specified registry
+	if len(registry) == 0 {
+		registry = mgr.searchEndpoint(mgr.DefaultRegistry)
+	}
+
+	u := registry + "search?q=" + url.QueryEscape(name)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if mgr.registryUserAgent != "" {
+		req.Header.Set("User-Agent", mgr.registryUserAgent)
+	}
+
+	if auth != nil && auth.Username != "" && auth.Password != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	client := &http.Client{Timeout: mgr.searchTimeout}
+	if mgr.isInsecureRegistry(req.URL.Host) {
+		client.Transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			DisableKeepAlives: true,
+		}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		// NOTE: return the cancellation of request instead of the
+		// url.Error so that the caller can check it by pkgerrors.Cause.
+		if ctx.Err() != nil {
+			return nil, pkgerrors.Wrapf(ctx.Err(), "failed to search images from %s", registry)
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unexepected status code %d", res.StatusCode)
+	}
+
+	rawData, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var searchResultResp searchtypes.SearchResultResp
+	var result []types.SearchResultItem
+	err = json.Unmarshal(rawData, &searchResultResp)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, searchResultItem := range searchResultResp.Results {
+		result = append(result, *searchResultItem)
+	}
+	return result, err
+}
+
+// searchEndpoint returns the v1 search endpoint of the registry. Like the
+// resolver for pulls, the insecure registry is accessed by HTTP.
+func (mgr *ImageManager) searchEndpoint(registry string) string {
+	if mgr.isInsecureRegistry(registry) {
+		return "http://" + registry + "/v1/"
+	}
+	return "https://" + registry + "/v1/"
+}
+
+// searchAuthOfRegistry returns the auth if it's issued for the registry, so
+// that the credentials are never sent to other registries. The auth without
+// server address is issued for the default registry.
+func (mgr *ImageManager) searchAuthOfRegistry(auth *types.AuthConfig, registry string) *types.AuthConfig {
+	if auth == nil {
+		return nil
+	}
+
+	server := auth.ServerAddress
+	if server == "" {
+		server = mgr.DefaultRegistry
+	}
+
+	// the server address maybe the URL, like https://reg.abc.com/v1/.
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		server = u.Host
+	}
+
+	if server != registry {
+		return nil
+	}
+	return auth
+}
+
+// isInsecureRegistry returns true if the registry domain is in the insecure
+// registries.
+func (mgr *ImageManager) isInsecureRegistry(registry string) bool {
+	for _, r := range mgr.insecureRegistries {
+		if r == registry {
+			return true
+		}
+	}
+	return false
+}
+
+// sortSearchResults sorts the results by star count and pull count in
+// descending order. The name is used if the registry doesn't return counts.
+func sortSearchResults(results []types.SearchResultItem) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].StarCount != results[j].StarCount {
+			return results[i].StarCount > results[j].StarCount
+		}
+		if results[i].PullCount != results[j].PullCount {
+			return results[i].PullCount > results[j].PullCount
+		}
+		return results[i].Name < results[j].Name
+	})
+}
@@ -0,0 +1,171 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alibaba/pouch/apis/types"
+	searchtypes "github.com/alibaba/pouch/registry/types"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortSearchResults(t *testing.T) {
+	results := []types.SearchResultItem{
+		{Name: "b", StarCount: 10},
+		{Name: "a", StarCount: 10, PullCount: 5},
+		{Name: "c", StarCount: 20},
+		{Name: "e"},
+		{Name: "d"},
+	}
+	sortSearchResults(results)
+
+	names := make([]string, 0, len(results))
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"c", "a", "b", "d", "e"}, names)
+}
+
+func TestSearchImagesWithLimit(t *testing.T) {
+	server := newSearchServer(
+		&types.SearchResultItem{Name: "a", StarCount: 1},
+		&types.SearchResultItem{Name: "b", StarCount: 3},
+		&types.SearchResultItem{Name: "c", StarCount: 2},
+	)
+	defer server.Close()
+
+	mgr := &ImageManager{}
+	results, err := mgr.SearchImages(context.TODO(), "busybox", server.URL+"/v1/", 2, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "b", results[0].Name)
+	assert.Equal(t, "c", results[1].Name)
+}
+
+func TestSearchImagesCanceled(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// hang until the test finishes
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	mgr := &ImageManager{}
+	_, err := mgr.SearchImages(ctx, "busybox", server.URL+"/v1/", 0, nil)
+	assert.Equal(t, context.Canceled, pkgerrors.Cause(err))
+}
+
+func newSearchServer(results ...*types.SearchResultItem) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(searchtypes.SearchResultResp{Results: results})
+	}))
+}
+
+func TestSearchAllRegistries(t *testing.T) {
+	origin := newSearchServer(
+		&types.SearchResultItem{Name: "busybox", StarCount: 10},
+		&types.SearchResultItem{Name: "nginx", StarCount: 5},
+	)
+	defer origin.Close()
+
+	mirror := newSearchServer(
+		&types.SearchResultItem{Name: "nginx", StarCount: 7},
+		&types.SearchResultItem{Name: "redis", StarCount: 1},
+	)
+	defer mirror.Close()
+
+	originHost, mirrorHost := origin.Listener.Addr().String(), mirror.Listener.Addr().String()
+
+	// the failure of mirror should be ignored
+	mgr := &ImageManager{
+		DefaultRegistry:    originHost,
+		RegistryMirrors:    []string{mirrorHost, "127.0.0.1:0"},
+		insecureRegistries: []string{originHost, mirrorHost, "127.0.0.1:0"},
+	}
+
+	results, err := mgr.SearchImages(context.TODO(), "busybox", SearchAllRegistries, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.SearchResultItem{
+		{Name: "busybox", StarCount: 10, Registry: originHost},
+		{Name: "nginx", StarCount: 7, Registry: mirrorHost},
+		{Name: "redis", StarCount: 1, Registry: mirrorHost},
+	}, results)
+}
+
+func TestSearchInsecureRegistry(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(searchtypes.SearchResultResp{
+			Results: []*types.SearchResultItem{{Name: "busybox"}},
+		})
+	}))
+	defer server.Close()
+
+	// the certificate of test server is from unknown CA
+	mgr := &ImageManager{}
+	_, err := mgr.SearchImages(context.TODO(), "busybox", server.URL+"/v1/", 0, nil)
+	assert.Error(t, err)
+
+	mgr.insecureRegistries = []string{server.Listener.Addr().String()}
+	results, err := mgr.SearchImages(context.TODO(), "busybox", server.URL+"/v1/", 0, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestSearchUserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		userAgent = req.Header.Get("User-Agent")
+		json.NewEncoder(rw).Encode(searchtypes.SearchResultResp{})
+	}))
+	defer server.Close()
+
+	mgr := &ImageManager{registryUserAgent: "pouch/1.3.0"}
+	_, err := mgr.SearchImages(context.TODO(), "busybox", server.URL+"/v1/", 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "pouch/1.3.0", userAgent)
+}
+
+func TestSearchAllRegistriesAuth(t *testing.T) {
+	newAuthServer := func(authorized *bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, _, *authorized = req.BasicAuth()
+			json.NewEncoder(rw).Encode(searchtypes.SearchResultResp{})
+		}))
+	}
+
+	var originAuthorized, mirrorAuthorized bool
+	origin := newAuthServer(&originAuthorized)
+	defer origin.Close()
+	mirror := newAuthServer(&mirrorAuthorized)
+	defer mirror.Close()
+
+	originHost, mirrorHost := origin.Listener.Addr().String(), mirror.Listener.Addr().String()
+	mgr := &ImageManager{
+		DefaultRegistry:    originHost,
+		RegistryMirrors:    []string{mirrorHost},
+		insecureRegistries: []string{originHost, mirrorHost},
+	}
+
+	// the credentials are only sent to the registry they're issued for
+	auth := &types.AuthConfig{Username: "user", Password: "password"}
+	_, err := mgr.SearchImages(context.TODO(), "busybox", SearchAllRegistries, 0, auth)
+	assert.NoError(t, err)
+	assert.True(t, originAuthorized)
+	assert.False(t, mirrorAuthorized)
+
+	auth.ServerAddress = "http://" + mirrorHost + "/v1/"
+	_, err = mgr.SearchImages(context.TODO(), "busybox", SearchAllRegistries, 0, auth)
+	assert.NoError(t, err)
+	assert.False(t, originAuthorized)
+	assert.True(t, mirrorAuthorized)
+}
@@ -0,0 +1,218 @@
+package mgr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd/remotes"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+)
+
+const (
+	// cosignSignatureAnnotation is the annotation of layer which contains
+	// the base64-encoded signature of the layer blob.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// cosignSignatureMaxSize limits the size of the manifest and payload of
+	// signature image.
+	cosignSignatureMaxSize = 4 << 20
+)
+
+// cosignPayload is the simple signing payload signed by cosign.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// signatureVerifier verifies the cosign-style signature of image, which is
+// stored as the image tagged by sha256-<hex>.sig in the same repository.
+// The signature is valid if it's signed by one of the public keys and the
+// signed payload refers to the digest of image.
+type signatureVerifier struct {
+	keys []*ecdsa.PublicKey
+}
+
+func newSignatureVerifier(keyFiles []string) (*signatureVerifier, error) {
+	v := &signatureVerifier{}
+	for _, file := range keyFiles {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "failed to read signature key %s: %v", file, err)
+		}
+
+		key, err := parseSignaturePublicKey(data)
+		if err != nil {
+			return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid signature key %s: %v", file, err)
+		}
+		v.keys = append(v.keys, key)
+	}
+	return v, nil
+}
+
+// parseSignaturePublicKey parses the PEM-encoded ecdsa public key.
+func parseSignaturePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not ecdsa public key")
+	}
+	return key, nil
+}
+
+// verify fetches the signature image of target from the repository of ref by
+// resolver, and checks that one of the signatures is valid.
+func (v *signatureVerifier) verify(ctx context.Context, resolver remotes.Resolver, ref string, target digest.Digest) error {
+	namedRef, err := reference.Parse(ref)
+	if err != nil {
+		return err
+	}
+
+	sigRef := fmt.Sprintf("%s:%s-%s.sig", namedRef.Name(), target.Algorithm(), target.Hex())
+	name, desc, err := resolver.Resolve(ctx, sigRef)
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to resolve signature %s", sigRef)
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	data, err := fetchSignatureBlob(ctx, fetcher, desc)
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to fetch signature %s", sigRef)
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return pkgerrors.Wrapf(err, "failed to decode signature %s", sigRef)
+	}
+
+	for _, layer := range manifest.Layers {
+		sig, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		payload, err := fetchSignatureBlob(ctx, fetcher, layer)
+		if err != nil {
+			return pkgerrors.Wrapf(err, "failed to fetch signature payload %s", layer.Digest)
+		}
+
+		if v.verifyPayload(payload, sig, target) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no valid signature of %s signed by trusted keys in %s", target, sigRef)
+}
+
+// verifyPayload checks that the payload refers to the target, and the sig is
+// the signature of payload signed by one of the keys.
+func (v *signatureVerifier) verifyPayload(payload []byte, sig string, target digest.Digest) error {
+	var p cosignPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	if p.Critical.Image.DockerManifestDigest != target.String() {
+		return fmt.Errorf("signed digest %s doesn't match %s", p.Critical.Image.DockerManifestDigest, target)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+
+	var rs struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(raw, &rs); err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256(payload)
+	for _, key := range v.keys {
+		if ecdsa.Verify(key, hashed[:], rs.R, rs.S) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid signature")
+}
+
+// fetchSignatureBlob reads the blob and verifies its digest.
+func fetchSignatureBlob(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) ([]byte, error) {
+	if desc.Size > cosignSignatureMaxSize {
+		return nil, fmt.Errorf("blob %s is too large", desc.Digest)
+	}
+
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, cosignSignatureMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) != desc.Size || digest.FromBytes(data) != desc.Digest {
+		return nil, fmt.Errorf("blob %s doesn't match the descriptor", desc.Digest)
+	}
+	return data, nil
+}
+
+// verifySignatureIfRequired verifies the signature of the image to pull if
+// the signature keys are configured for the registry of the requested
+// reference, which is checked before fetching so that the unverified content
+// is never unpacked. The signature is fetched by sigResolver from the
+// available reference, and the returned resolver is pinned to the verified
+// digest. It returns false if the verification is not required.
+func (mgr *ImageManager) verifySignatureIfRequired(ctx context.Context, resolver, sigResolver remotes.Resolver, ref, availableRef string) (remotes.Resolver, bool, error) {
+	verifier, ok := mgr.signatureVerifiers[mgr.registryOfReference(ref)]
+	if !ok {
+		return resolver, false, nil
+	}
+
+	_, desc, err := resolver.Resolve(ctx, availableRef)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if err := verifier.verify(ctx, sigResolver, availableRef, desc.Digest); err != nil {
+		return nil, true, pkgerrors.Wrapf(err, "failed to verify signature of %s", ref)
+	}
+
+	// the resolver of content trust has been pinned
+	if _, ok := resolver.(*trustedResolver); ok {
+		return resolver, true, nil
+	}
+	return &trustedResolver{Resolver: resolver, digest: desc.Digest}, true, nil
+}
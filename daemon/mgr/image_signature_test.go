@@ -0,0 +1,151 @@
+package mgr
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryResolver resolves the tags and fetches the blobs in memory.
+type memoryResolver struct {
+	tags  map[string]ocispec.Descriptor
+	blobs map[digest.Digest][]byte
+}
+
+func (r *memoryResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	desc, ok := r.tags[ref]
+	if !ok {
+		return "", ocispec.Descriptor{}, errdefs.ErrNotFound
+	}
+	return ref, desc, nil
+}
+
+func (r *memoryResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		data, ok := r.blobs[desc.Digest]
+		if !ok {
+			return nil, errdefs.ErrNotFound
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}), nil
+}
+
+func (r *memoryResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+func (r *memoryResolver) add(data []byte, mediaType string) ocispec.Descriptor {
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	r.blobs[desc.Digest] = data
+	return desc
+}
+
+// sign pushes the signature image of target signed by key.
+func (r *memoryResolver) sign(t *testing.T, repo string, target digest.Digest, key *ecdsa.PrivateKey) {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, repo, target))
+
+	hashed := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hashed[:])
+	assert.NoError(t, err)
+
+	layer := r.add(payload, "application/vnd.dev.cosign.simplesigning.v1+json")
+	layer.Annotations = map[string]string{
+		cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+	}
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Config: r.add([]byte("{}"), ocispec.MediaTypeImageConfig),
+		Layers: []ocispec.Descriptor{layer},
+	})
+	assert.NoError(t, err)
+
+	r.tags[fmt.Sprintf("%s:%s-%s.sig", repo, target.Algorithm(), target.Hex())] = r.add(manifest, ocispec.MediaTypeImageManifest)
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	trusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	untrusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	var (
+		repo     = "reg.abc.com/library/busybox"
+		signed   = digest.FromString("signed")
+		forged   = digest.FromString("forged")
+		unsigned = digest.FromString("unsigned")
+		verifier = &signatureVerifier{keys: []*ecdsa.PublicKey{&trusted.PublicKey}}
+		resolver = &memoryResolver{
+			tags:  map[string]ocispec.Descriptor{},
+			blobs: map[digest.Digest][]byte{},
+		}
+	)
+
+	resolver.sign(t, repo, signed, trusted)
+	resolver.sign(t, repo, forged, untrusted)
+
+	assert.NoError(t, verifier.verify(context.TODO(), resolver, repo+":latest", signed))
+	assert.Error(t, verifier.verify(context.TODO(), resolver, repo+":latest", forged))
+	assert.Error(t, verifier.verify(context.TODO(), resolver, repo+":latest", unsigned))
+
+	// the signature of other image cannot be used
+	resolver.tags[fmt.Sprintf("%s:%s-%s.sig", repo, unsigned.Algorithm(), unsigned.Hex())] = resolver.tags[fmt.Sprintf("%s:%s-%s.sig", repo, signed.Algorithm(), signed.Hex())]
+	assert.Error(t, verifier.verify(context.TODO(), resolver, repo+":latest", unsigned))
+}
+
+func TestVerifySignatureIfRequired(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	var (
+		mirrorRef = "mirror.abc.com/library/busybox:latest"
+		mgr       = &ImageManager{
+			DefaultRegistry:  "docker.io",
+			DefaultNamespace: "library",
+			signatureVerifiers: map[string]*signatureVerifier{
+				"docker.io": {keys: []*ecdsa.PublicKey{&key.PublicKey}},
+			},
+		}
+		resolver = &memoryResolver{
+			tags:  map[string]ocispec.Descriptor{},
+			blobs: map[digest.Digest][]byte{},
+		}
+	)
+	target := resolver.add([]byte("manifest"), ocispec.MediaTypeImageManifest)
+	resolver.tags[mirrorRef] = target
+
+	// the verifier of requested registry is used even if it's pulled from
+	// mirror, and the unsigned image is rejected before fetching
+	_, verified, err := mgr.verifySignatureIfRequired(context.TODO(), resolver, resolver, "busybox:latest", mirrorRef)
+	assert.True(t, verified)
+	assert.Error(t, err)
+
+	resolver.sign(t, "mirror.abc.com/library/busybox", target.Digest, key)
+	pinned, verified, err := mgr.verifySignatureIfRequired(context.TODO(), resolver, resolver, "busybox:latest", mirrorRef)
+	assert.True(t, verified)
+	assert.NoError(t, err)
+	assert.Equal(t, &trustedResolver{Resolver: resolver, digest: target.Digest}, pinned)
+
+	// the verification is not required for other registry
+	_, verified, err = mgr.verifySignatureIfRequired(context.TODO(), resolver, resolver, "reg.abc.com/library/busybox:latest", "reg.abc.com/library/busybox:latest")
+	assert.False(t, verified)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,276 @@
+package mgr
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/httputils"
+	"github.com/alibaba/pouch/pkg/jsonstream"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// cosignPayloadMediaType is the media type of layer which contains the
+// simple signing payload.
+const cosignPayloadMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+// imageSigner signs the pushed image in cosign style, whose signature is
+// pushed as the image tagged by sha256-<hex>.sig in the same repository,
+// so that it can be verified by signatureVerifier.
+type imageSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func newImageSigner(keyFile string) (*imageSigner, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "failed to read signing key %s: %v", keyFile, err)
+	}
+
+	key, err := parseSigningPrivateKey(data)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid signing key %s: %v", keyFile, err)
+	}
+	return &imageSigner{key: key}, nil
+}
+
+// parseSigningPrivateKey parses the PEM-encoded ecdsa private key in SEC 1
+// or PKCS #8 form.
+func parseSigningPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := priv.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not ecdsa private key")
+	}
+	return key, nil
+}
+
+// payload returns the simple signing payload of target in the repository.
+func (s *imageSigner) payload(repo string, target digest.Digest) ([]byte, error) {
+	var p struct {
+		Critical struct {
+			Identity struct {
+				DockerReference string `json:"docker-reference"`
+			} `json:"identity"`
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+			Type string `json:"type"`
+		} `json:"critical"`
+		Optional map[string]interface{} `json:"optional"`
+	}
+	p.Critical.Identity.DockerReference = repo
+	p.Critical.Image.DockerManifestDigest = target.String()
+	p.Critical.Type = "cosign container image signature"
+
+	return json.Marshal(p)
+}
+
+// sign pushes the signature image of target into the repository of ref by
+// resolver.
+func (s *imageSigner) sign(ctx context.Context, resolver remotes.Resolver, ref string, target digest.Digest) error {
+	namedRef, err := reference.Parse(ref)
+	if err != nil {
+		return err
+	}
+
+	payload, err := s.payload(namedRef.Name(), target)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	sigRef := fmt.Sprintf("%s:%s-%s.sig", namedRef.Name(), target.Algorithm(), target.Hex())
+
+	// NOTE: the signature is appended into the existing signature image,
+	// like cosign, so that the signatures by other keys are kept.
+	manifest, err := fetchSignatureManifest(ctx, resolver, sigRef)
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to fetch signature %s", sigRef)
+	}
+
+	type blob struct {
+		data []byte
+		desc ocispec.Descriptor
+	}
+
+	var blobs []blob
+	if manifest == nil {
+		config := []byte("{}")
+		manifest = &ocispec.Manifest{
+			Versioned: ocispecs.Versioned{
+				SchemaVersion: 2,
+			},
+			Config: signatureBlobDescriptor(config, ocispec.MediaTypeImageConfig),
+		}
+		blobs = append(blobs, blob{data: config, desc: manifest.Config})
+	}
+
+	layer := signatureBlobDescriptor(payload, cosignPayloadMediaType)
+	layer.Annotations = map[string]string{
+		cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+	}
+	manifest.Layers = append(manifest.Layers, layer)
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the manifest is pushed last, since the registry rejects the
+	// manifest whose blobs are unknown.
+	blobs = append(blobs,
+		blob{data: payload, desc: layer},
+		blob{data: data, desc: signatureBlobDescriptor(data, ocispec.MediaTypeImageManifest)},
+	)
+
+	pusher, err := resolver.Pusher(ctx, sigRef)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range blobs {
+		if err := pushSignatureBlob(ctx, pusher, b.desc, b.data); err != nil {
+			return pkgerrors.Wrapf(err, "failed to push signature %s", sigRef)
+		}
+	}
+	return nil
+}
+
+// fetchSignatureManifest returns the manifest of signature image, and nil if
+// the image isn't signed yet.
+func fetchSignatureManifest(ctx context.Context, resolver remotes.Resolver, sigRef string) (*ocispec.Manifest, error) {
+	name, desc, err := resolver.Resolve(ctx, sigRef)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fetchSignatureBlob(ctx, fetcher, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func signatureBlobDescriptor(data []byte, mediaType string) ocispec.Descriptor {
+	return ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+}
+
+// pushSignatureBlob pushes the blob, which is skipped if it exists.
+func pushSignatureBlob(ctx context.Context, pusher remotes.Pusher, desc ocispec.Descriptor, data []byte) error {
+	cw, err := pusher.Push(ctx, desc)
+	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+	defer cw.Close()
+
+	return content.Copy(ctx, cw, bytes.NewReader(data), desc.Size, desc.Digest)
+}
+
+// signImageIfRequired signs the pushed image if the signing key is configured
+// for the registry of reference, and reports the signed digest into out.
+func (mgr *ImageManager) signImageIfRequired(ctx context.Context, ref string, authConfig *types.AuthConfig, out io.Writer) error {
+	signer, ok := mgr.imageSigners[mgr.registryOfReference(ref)]
+	if !ok {
+		return nil
+	}
+
+	stream := jsonstream.New(out, nil)
+	defer func() {
+		stream.Close()
+		stream.Wait()
+	}()
+
+	err := mgr.signImage(ctx, signer, ref, authConfig, stream)
+	if err != nil {
+		stream.WriteObject(jsonstream.JSONMessage{
+			Error: &jsonstream.JSONError{
+				Code:    httputils.StatusCode(err),
+				Message: err.Error(),
+			},
+			ErrorMessage: err.Error(),
+		})
+	}
+	return err
+}
+
+func (mgr *ImageManager) signImage(ctx context.Context, signer *imageSigner, ref string, authConfig *types.AuthConfig, stream *jsonstream.JSONStream) error {
+	img, err := mgr.client.GetImage(ctx, ref)
+	if err != nil {
+		return err
+	}
+	target := img.Target().Digest
+
+	resolver, _, err := mgr.client.ResolveImage(ctx, ref, []string{ref}, authConfig, docker.ResolverOptions{})
+	if err != nil {
+		return err
+	}
+
+	if err := signer.sign(ctx, resolver, ref, target); err != nil {
+		return pkgerrors.Wrapf(err, "failed to sign %s", ref)
+	}
+
+	stream.WriteObject(jsonstream.JSONMessage{
+		ID:     ref,
+		Status: fmt.Sprintf("Signed %s", target),
+	})
+	return nil
+}
@@ -0,0 +1,122 @@
+package mgr
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// pushingResolver pushes the blobs into memoryResolver, and the manifest is
+// tagged by the reference of pusher.
+type pushingResolver struct {
+	*memoryResolver
+}
+
+func (r *pushingResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	return pusherFunc(func(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+		return &memoryWriter{resolver: r.memoryResolver, ref: ref, desc: desc}, nil
+	}), nil
+}
+
+type pusherFunc func(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error)
+
+func (fn pusherFunc) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	return fn(ctx, desc)
+}
+
+type memoryWriter struct {
+	bytes.Buffer
+
+	resolver *memoryResolver
+	ref      string
+	desc     ocispec.Descriptor
+}
+
+func (w *memoryWriter) Close() error { return nil }
+
+func (w *memoryWriter) Digest() digest.Digest { return digest.FromBytes(w.Bytes()) }
+
+func (w *memoryWriter) Status() (content.Status, error) {
+	return content.Status{Ref: w.ref, Offset: int64(w.Len()), Total: w.desc.Size}, nil
+}
+
+func (w *memoryWriter) Truncate(size int64) error {
+	w.Buffer.Truncate(int(size))
+	return nil
+}
+
+func (w *memoryWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...content.Opt) error {
+	w.resolver.blobs[w.desc.Digest] = w.Bytes()
+	if w.desc.MediaType == ocispec.MediaTypeImageManifest {
+		w.resolver.tags[w.ref] = w.desc
+	}
+	return nil
+}
+
+func TestImageSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	var (
+		repo     = "reg.abc.com/library/busybox"
+		target   = digest.FromString("pushed")
+		signer   = &imageSigner{key: key}
+		verifier = &signatureVerifier{keys: []*ecdsa.PublicKey{&key.PublicKey}}
+		resolver = &pushingResolver{&memoryResolver{
+			tags:  map[string]ocispec.Descriptor{},
+			blobs: map[digest.Digest][]byte{},
+		}}
+	)
+
+	assert.Error(t, verifier.verify(context.TODO(), resolver, repo+":latest", target))
+	assert.NoError(t, signer.sign(context.TODO(), resolver, repo+":latest", target))
+	assert.NoError(t, verifier.verify(context.TODO(), resolver, repo+":latest", target))
+
+	// the signature by other key is appended into the signature image
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	assert.NoError(t, (&imageSigner{key: other}).sign(context.TODO(), resolver, repo+":latest", target))
+
+	manifest, err := fetchSignatureManifest(context.TODO(), resolver, fmt.Sprintf("%s:%s-%s.sig", repo, target.Algorithm(), target.Hex()))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(manifest.Layers))
+	assert.NoError(t, verifier.verify(context.TODO(), resolver, repo+":latest", target))
+	assert.NoError(t, (&signatureVerifier{keys: []*ecdsa.PublicKey{&other.PublicKey}}).verify(context.TODO(), resolver, repo+":latest", target))
+
+	// the signature of target cannot be used for other image
+	assert.Error(t, verifier.verify(context.TODO(), resolver, repo+":latest", digest.FromString("other")))
+}
+
+func TestParseSigningPrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	sec1, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	for _, block := range []*pem.Block{
+		{Type: "EC PRIVATE KEY", Bytes: sec1},
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		parsed, err := parseSigningPrivateKey(pem.EncodeToMemory(block))
+		assert.NoError(t, err)
+		assert.True(t, key.Equal(parsed))
+	}
+
+	_, err = parseSigningPrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package mgr
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 
@@ -16,6 +17,10 @@ import (
 
 var errCtrdImageInfoNotExist = fmt.Errorf("ctrd image info does not exist")
 
+// shortIDPattern matches the ID or the hex prefix of ID, with or without the
+// algorithm header.
+var shortIDPattern = regexp.MustCompile(`^(` + digest.Canonical.String() + `:)?[a-f0-9]{1,64}$`)
+
 // imageStore stores the relationship between references.
 //
 // Primary reference is the reference used for pulling the image. For example,
@@ -77,6 +82,34 @@ type CtrdImageInfo struct {
 	ID      digest.Digest
 	Size    int64
 	OCISpec ocispec.Image
+
+	// PlatformMismatch is true if the image is inspected with the
+	// fallback platform instead of the default one.
+	PlatformMismatch bool
+
+	// IndexOnly is true if the image is pulled without platform selection.
+	IndexOnly bool
+
+	// MediaType is the media type of image's target, which tells whether
+	// the image is docker or oci manifest, or the manifest list.
+	MediaType string
+
+	// TargetDigest is the digest of image's target, which the digest
+	// references of the image are made of.
+	TargetDigest digest.Digest
+
+	// Platform is the platform selected from the manifest list, like
+	// linux/arm64/v8. It's empty if the target isn't manifest list.
+	Platform string
+
+	// Labels are the labels of containerd image set by SetImageLabels,
+	// which are mutable unlike the labels of image config.
+	Labels map[string]string
+
+	// ChainID is the parent of the snapshot prepared for the container,
+	// which is precomputed so that the container creation doesn't read the
+	// image from containerd again.
+	ChainID digest.Digest
 }
 
 // referenceMap represents reference string to corresponding reference.Named
@@ -110,6 +143,23 @@ func (store *imageStore) GetReferences(id digest.Digest) []reference.Named {
 	return res
 }
 
+// GetReferencesByPrimary returns the list of searchable references attached
+// to the given primary reference, excluding the primary reference itself.
+func (store *imageStore) GetReferencesByPrimary(primaryRef reference.Named) []reference.Named {
+	trimPrimaryRefStr := reference.TrimTagForDigest(primaryRef).String()
+
+	store.Lock()
+	defer store.Unlock()
+
+	res := make([]reference.Named, 0)
+	for refStr, ref := range store.refsIndexByPrimaryRef[trimPrimaryRefStr] {
+		if refStr != trimPrimaryRefStr {
+			res = append(res, ref)
+		}
+	}
+	return res
+}
+
 // GetPrimaryReferences returns the list of primary references by the given imageID.
 func (store *imageStore) GetPrimaryReferences(id digest.Digest) []reference.Named {
 	store.Lock()
@@ -169,9 +219,16 @@ func (store *imageStore) Search(ref reference.Named) (digest.Digest, reference.N
 	return id, ref, nil
 }
 
+// searchIDs returns the ID which has the prefix refID. The refID should be
+// the hex prefix of ID, like the first 12 characters. It fails with
+// ErrTooMany if the prefix is ambiguous.
 func (store *imageStore) searchIDs(refID string) (digest.Digest, error) {
 	var ids []digest.Digest
 
+	if !shortIDPattern.MatchString(refID) {
+		return "", pkgerrors.Wrapf(errtypes.ErrNotfound, "image %s", refID)
+	}
+
 	id := refID
 	if !strings.HasPrefix(refID, digest.Canonical.String()) {
 		id = fmt.Sprintf("%s:%s", digest.Canonical.String(), refID)
@@ -183,7 +240,7 @@ func (store *imageStore) searchIDs(refID string) (digest.Digest, error) {
 		}
 
 		if len(ids) > 1 {
-			return pkgerrors.Wrapf(errtypes.ErrTooMany, "image %s", refID)
+			return pkgerrors.Wrapf(errtypes.ErrTooMany, "ambiguous reference %s matches images %s and %s", refID, ids[0].Hex()[:12], ids[1].Hex()[:12])
 		}
 		return nil
 	}
@@ -292,6 +349,34 @@ func (store *imageStore) RemoveReference(id digest.Digest, ref reference.Named)
 	return nil
 }
 
+// ListPrimaryReferences returns all the primary references with image ID.
+func (store *imageStore) ListPrimaryReferences() map[string]digest.Digest {
+	store.Lock()
+	defer store.Unlock()
+
+	res := make(map[string]digest.Digest, len(store.idIndexByPrimaryRef))
+	for id, pRefs := range store.primaryRefsIndexByID {
+		for pRefStr := range pRefs {
+			res[pRefStr] = id
+		}
+	}
+	return res
+}
+
+// ListAllReferences returns all the searchable references.
+func (store *imageStore) ListAllReferences() []reference.Named {
+	store.Lock()
+	defer store.Unlock()
+
+	res := make([]reference.Named, 0, len(store.primaryRefIndexByRef))
+	for _, refs := range store.refsIndexByPrimaryRef {
+		for _, ref := range refs {
+			res = append(res, ref)
+		}
+	}
+	return res
+}
+
 // ListCtrdImageInfo returns all the CtrdImageInfo.
 func (store *imageStore) ListCtrdImageInfo() []CtrdImageInfo {
 	store.Lock()
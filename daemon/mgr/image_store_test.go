@@ -227,6 +227,7 @@ func TestSearch(t *testing.T) {
 
 			_, _, err = store.Search(namedRef)
 			assert.Equal(t, pkgerrors.Cause(err), errtypes.ErrTooMany)
+			assert.Contains(t, err.Error(), "ambiguous reference")
 		}
 	}
 
@@ -367,3 +368,118 @@ func TestAdd(t *testing.T) {
 		assert.Equal(t, errtypes.IsNotfound(err), true)
 	}
 }
+
+func TestListReferences(t *testing.T) {
+	store, err := newImageStore()
+	if err != nil {
+		t.Fatalf("unexpected error during creating store: %v", err)
+	}
+
+	var (
+		id        = digest.Digest("sha256:dc5f67a48da730d67bf4bfb8824ea8a51be26711de090d6d5a1ffff2723168a1")
+		primary   = "busybox:latest"
+		alias     = "localhost:5000/busybox:1.25"
+		namedRefs = make(map[string]reference.Named)
+	)
+
+	for _, ref := range []string{primary, alias} {
+		namedRef, err := reference.Parse(ref)
+		if err != nil {
+			t.Fatalf("unexpected error during parse reference %v: %v", ref, err)
+		}
+		namedRefs[ref] = namedRef
+	}
+
+	assert.NoError(t, store.AddReference(id, namedRefs[primary], namedRefs[primary]))
+	assert.NoError(t, store.AddReference(id, namedRefs[primary], namedRefs[alias]))
+
+	assert.Equal(t, map[string]digest.Digest{primary: id}, store.ListPrimaryReferences())
+	assert.Equal(t, 2, len(store.ListAllReferences()))
+
+	// the searchable references should be removed with primary reference
+	assert.NoError(t, store.RemoveReference(id, namedRefs[primary]))
+	assert.Equal(t, 0, len(store.ListPrimaryReferences()))
+	assert.Equal(t, 0, len(store.ListAllReferences()))
+}
+
+func TestGetReferencesByPrimary(t *testing.T) {
+	store, err := newImageStore()
+	if err != nil {
+		t.Fatalf("unexpected error during creating store: %v", err)
+	}
+
+	var (
+		id      = digest.Digest("sha256:dc5f67a48da730d67bf4bfb8824ea8a51be26711de090d6d5a1ffff2723168a1")
+		primary = reference.WithDefaultTagIfMissing(mustParseReference(t, "busybox:latest"))
+		alias   = mustParseReference(t, "busybox@"+id.String())
+		target  = mustParseReference(t, "busybox:1.25")
+	)
+
+	assert.NoError(t, store.AddReference(id, primary, primary))
+	assert.NoError(t, store.AddReference(id, primary, alias))
+	assert.NoError(t, store.AddReference(id, target, target))
+
+	refs := store.GetReferencesByPrimary(primary)
+	assert.Equal(t, 1, len(refs))
+	assert.Equal(t, alias.String(), refs[0].String())
+	assert.Equal(t, 0, len(store.GetReferencesByPrimary(target)))
+
+	// the alias can be moved to other primary reference
+	assert.NoError(t, store.RemoveReference(id, primary))
+	assert.NoError(t, store.AddReference(id, target, alias))
+	refs = store.GetReferencesByPrimary(target)
+	assert.Equal(t, 1, len(refs))
+	assert.Equal(t, alias.String(), refs[0].String())
+
+	pRef, err := store.GetPrimaryReference(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, target.String(), pRef.String())
+}
+
+func TestSearchShortID(t *testing.T) {
+	store, err := newImageStore()
+	if err != nil {
+		t.Fatalf("unexpected error during creating store: %v", err)
+	}
+
+	var (
+		id      = digest.Digest("sha256:dc5f67a48da730d67bf4bfb8824ea8a51be26711de090d6d5a1ffff2723168a1")
+		otherID = digest.Digest("sha256:dc5f67a48da7f0d67bf4bfb8824ea8a51be26711de090d6d5a1ffff2723168a1")
+	)
+
+	for i, dig := range []digest.Digest{id, otherID} {
+		ref, err := reference.Parse(fmt.Sprintf("busybox:%d", i))
+		if err != nil {
+			t.Fatalf("unexpected error during parsing reference: %v", err)
+		}
+
+		if err := store.AddReference(dig, ref, ref); err != nil {
+			t.Fatalf("unexpected error during add reference %v: %v", ref, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		ref      string
+		expected digest.Digest
+		err      error
+	}{
+		{ref: id.Hex()[:14], expected: id},
+		{ref: "sha256:" + otherID.Hex()[:14], expected: otherID},
+		{ref: id.Hex()[:12], err: errtypes.ErrTooMany},
+		{ref: "dc5f67a48dax", err: errtypes.ErrNotfound},
+		{ref: "abcdef", err: errtypes.ErrNotfound},
+	} {
+		namedRef, err := reference.Parse(tc.ref)
+		if err != nil {
+			t.Fatalf("unexpected error during parse reference %v: %v", tc.ref, err)
+		}
+
+		gotID, _, err := store.Search(namedRef)
+		if tc.err != nil {
+			assert.Equal(t, tc.err, pkgerrors.Cause(err), tc.ref)
+			continue
+		}
+		assert.NoError(t, err, tc.ref)
+		assert.Equal(t, tc.expected, gotID)
+	}
+}
@@ -0,0 +1,1246 @@
+package mgr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibaba/pouch/apis/filters"
+	"github.com/alibaba/pouch/ctrd"
+	"github.com/alibaba/pouch/daemon/events"
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd/platforms"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupImageReferences(t *testing.T) {
+	mgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		RegistryMirrors:  []string{"global.mirror.com"},
+	}
+
+	perRegistryMgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		RegistryMirrors:  []string{"global.mirror.com"},
+		PerRegistryMirrors: map[string][]string{
+			"registry.hub.docker.com": {"m1.com", "m2.com"},
+			"gcr.io":                  {"m3.com"},
+		},
+	}
+
+	namespaceMgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		RegistryNamespaces: map[string]string{
+			"myreg.internal": "library",
+		},
+		PerRegistryMirrors: map[string][]string{
+			"myreg.internal": {"m4.com"},
+		},
+	}
+
+	mirrorOnlyMgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		RegistryMirrors:  []string{"global.mirror.com"},
+		PerRegistryMirrors: map[string][]string{
+			"gcr.io": {"m3.com"},
+		},
+		MirrorOnly: true,
+	}
+
+	templateMgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		RegistryMirrors:  []string{"mirror.internal/dockerhub/{path}", "global.mirror.com"},
+		PerRegistryMirrors: map[string][]string{
+			"gcr.io": {"mirror.internal/gcr/{path}"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		mgr      *ImageManager
+		ref      string
+		expected []string
+	}{
+		{
+			name:     "global mirrors for partial reference",
+			mgr:      mgr,
+			ref:      "busybox:latest",
+			expected: []string{"global.mirror.com/busybox:latest", "registry.hub.docker.com/library/busybox:latest"},
+		},
+		{
+			name:     "no global mirrors for full reference",
+			mgr:      mgr,
+			ref:      "gcr.io/google/pause:3.1",
+			expected: []string{"gcr.io/google/pause:3.1"},
+		},
+		{
+			name:     "per registry mirrors override global mirrors",
+			mgr:      perRegistryMgr,
+			ref:      "busybox:latest",
+			expected: []string{"m1.com/library/busybox:latest", "m2.com/library/busybox:latest", "registry.hub.docker.com/library/busybox:latest"},
+		},
+		{
+			name:     "per registry mirrors for non-default registry",
+			mgr:      perRegistryMgr,
+			ref:      "gcr.io/google/pause:3.1",
+			expected: []string{"m3.com/google/pause:3.1", "gcr.io/google/pause:3.1"},
+		},
+		{
+			name:     "no mirrors for unknown registry",
+			mgr:      perRegistryMgr,
+			ref:      "quay.io/coreos/etcd:v3",
+			expected: []string{"quay.io/coreos/etcd:v3"},
+		},
+		{
+			name:     "namespace of non-default registry",
+			mgr:      namespaceMgr,
+			ref:      "myreg.internal/foo:v1",
+			expected: []string{"m4.com/library/foo:v1", "myreg.internal/library/foo:v1"},
+		},
+		{
+			name:     "no namespace for qualified name",
+			mgr:      namespaceMgr,
+			ref:      "myreg.internal/team/foo:v1",
+			expected: []string{"m4.com/team/foo:v1", "myreg.internal/team/foo:v1"},
+		},
+		{
+			name:     "no upstream in mirror-only mode",
+			mgr:      mirrorOnlyMgr,
+			ref:      "busybox:latest",
+			expected: []string{"global.mirror.com/busybox:latest"},
+		},
+		{
+			name:     "no upstream of non-default registry in mirror-only mode",
+			mgr:      mirrorOnlyMgr,
+			ref:      "gcr.io/google/pause:3.1",
+			expected: []string{"m3.com/google/pause:3.1"},
+		},
+		{
+			name:     "nothing to pull without mirrors in mirror-only mode",
+			mgr:      mirrorOnlyMgr,
+			ref:      "quay.io/coreos/etcd:v3",
+			expected: nil,
+		},
+		{
+			name:     "mirror itself in mirror-only mode",
+			mgr:      mirrorOnlyMgr,
+			ref:      "m3.com/google/pause:3.1",
+			expected: []string{"m3.com/google/pause:3.1"},
+		},
+		{
+			name:     "global mirror template with namespace",
+			mgr:      templateMgr,
+			ref:      "ubuntu:20.04",
+			expected: []string{"mirror.internal/dockerhub/library/ubuntu:20.04", "global.mirror.com/ubuntu:20.04", "registry.hub.docker.com/library/ubuntu:20.04"},
+		},
+		{
+			name:     "per registry mirror template",
+			mgr:      templateMgr,
+			ref:      "gcr.io/google/pause@sha256:59eec8837a4d942cc19a52b8c09ea75121acc38114a2c68b98983ce9356b8610",
+			expected: []string{"mirror.internal/gcr/google/pause@sha256:59eec8837a4d942cc19a52b8c09ea75121acc38114a2c68b98983ce9356b8610", "gcr.io/google/pause@sha256:59eec8837a4d942cc19a52b8c09ea75121acc38114a2c68b98983ce9356b8610"},
+		},
+	} {
+		assert.Equal(t, tc.expected, tc.mgr.LookupImageReferences(tc.ref), tc.name)
+	}
+}
+
+func TestPullImageMirrorOnly(t *testing.T) {
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		RegistryMirrors:  []string{"global.mirror.com"},
+		MirrorOnly:       true,
+		client:           client,
+	}
+
+	// the upstream is never contacted if all the mirrors miss
+	err := mgr.PullImage(context.TODO(), "busybox:latest", nil, ioutil.Discard, nil)
+	assert.True(t, errtypes.IsNotfound(err))
+	assert.Equal(t, []string{"global.mirror.com/busybox:latest"}, client.resolved)
+
+	// nothing is contacted without mirrors
+	client.resolved = nil
+	err = mgr.PullImage(context.TODO(), "quay.io/coreos/etcd:v3", nil, ioutil.Discard, nil)
+	assert.True(t, errtypes.IsNotfound(err))
+	assert.Empty(t, client.resolved)
+}
+
+func TestUpdateLocalStoreTimeout(t *testing.T) {
+	mgr := &ImageManager{
+		client:        &fakeImageClient{blockList: true},
+		bootupTimeout: 10 * time.Millisecond,
+	}
+
+	err := mgr.updateLocalStore()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "image-load-timeout 10ms")
+}
+
+func TestListIndexOnlyImages(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{localStore: store}
+
+	id := digest.FromString("index")
+	ref, err := reference.Parse("reg.abc.com/library/busybox:latest")
+	assert.NoError(t, err)
+
+	assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+	mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{
+		ID:        id,
+		Size:      1024,
+		IndexOnly: true,
+	})
+
+	infos, _, err := mgr.ListImages(context.TODO(), filters.NewArgs(), nil)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	assert.Equal(t, id.String(), infos[0].ID)
+	assert.True(t, infos[0].IndexOnly)
+	assert.Equal(t, "", infos[0].CreatedAt)
+	assert.Equal(t, []string{ref.String()}, infos[0].RepoTags)
+	assert.Equal(t, []string{reference.WithDigest(ref, id).String()}, infos[0].RepoDigests)
+}
+
+func TestListHiddenImages(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{localStore: store}
+
+	id, hiddenID := digest.FromString("image"), digest.FromString("intermediate")
+	ref, err := reference.Parse("reg.abc.com/library/busybox:latest")
+	assert.NoError(t, err)
+
+	assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+	mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id})
+	hiddenTarget := digest.FromString("intermediate manifest")
+	mgr.localStore.CacheCtrdImageInfo(hiddenID, CtrdImageInfo{ID: hiddenID, TargetDigest: hiddenTarget})
+
+	infos, _, err := mgr.ListImages(context.TODO(), filters.NewArgs(), nil)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	assert.Equal(t, id.String(), infos[0].ID)
+
+	infos, _, err = mgr.ListImages(context.TODO(), filters.NewArgs(), &ImageListOption{All: true})
+	assert.NoError(t, err)
+	assert.Len(t, infos, 2)
+	for _, info := range infos {
+		if info.ID == hiddenID.String() {
+			assert.Equal(t, []string{}, info.RepoTags)
+			assert.Equal(t, []string{}, info.RepoDigests)
+			// the target digest is still known without the references
+			assert.Equal(t, hiddenTarget.String(), info.TargetDigest)
+		}
+	}
+}
+
+func TestListImagesSortByCreated(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{localStore: store}
+
+	var (
+		now = time.Now().UTC()
+		ids []digest.Digest
+	)
+	for i, created := range []*time.Time{nil, &now, timePtr(now.Add(-time.Hour)), timePtr(now.Add(time.Hour))} {
+		id := digest.FromString(fmt.Sprintf("image-%d", i))
+		ref, err := reference.Parse(fmt.Sprintf("reg.abc.com/library/busybox:%d", i))
+		assert.NoError(t, err)
+
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+		info := CtrdImageInfo{ID: id}
+		info.OCISpec.Created = created
+		mgr.localStore.CacheCtrdImageInfo(id, info)
+		ids = append(ids, id)
+	}
+
+	listIDs := func(opt *ImageListOption) []string {
+		infos, _, err := mgr.ListImages(context.TODO(), filters.NewArgs(), opt)
+		assert.NoError(t, err)
+
+		res := make([]string, 0, len(infos))
+		for _, info := range infos {
+			res = append(res, info.ID)
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{ids[3].String(), ids[1].String(), ids[2].String(), ids[0].String()},
+		listIDs(&ImageListOption{Sort: ImageListSortCreated}))
+	assert.Equal(t, []string{ids[0].String(), ids[2].String(), ids[1].String(), ids[3].String()},
+		listIDs(&ImageListOption{Sort: ImageListSortCreated, Order: ImageListOrderAsc}))
+
+	_, _, err = mgr.ListImages(context.TODO(), filters.NewArgs(), &ImageListOption{Sort: "size"})
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	_, _, err = mgr.ListImages(context.TODO(), filters.NewArgs(), &ImageListOption{Sort: ImageListSortCreated, Order: "newest"})
+	assert.True(t, errtypes.IsInvalidParam(err))
+}
+
+func TestListImagesPagination(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{localStore: store}
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		id := digest.FromString(fmt.Sprintf("image-%d", i))
+		ref, err := reference.Parse(fmt.Sprintf("reg.abc.com/library/busybox:%d", i))
+		assert.NoError(t, err)
+
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+		mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id})
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+
+	var (
+		got   []string
+		since string
+		pages int
+	)
+	for {
+		infos, next, err := mgr.ListImages(context.TODO(), filters.NewArgs(), &ImageListOption{Limit: 2, Since: since})
+		assert.NoError(t, err)
+		assert.True(t, len(infos) <= 2)
+		for _, info := range infos {
+			got = append(got, info.ID)
+		}
+
+		pages++
+		if next == "" {
+			break
+		}
+		since = next
+	}
+	assert.Equal(t, ids, got)
+	assert.Equal(t, 3, pages)
+
+	// the cursor can be image ID without algorithm
+	infos, next, err := mgr.ListImages(context.TODO(), filters.NewArgs(), &ImageListOption{Since: strings.TrimPrefix(ids[3], "sha256:")})
+	assert.NoError(t, err)
+	assert.Equal(t, "", next)
+	assert.Len(t, infos, 1)
+	assert.Equal(t, ids[4], infos[0].ID)
+
+	for _, opt := range []*ImageListOption{
+		{Limit: -1},
+		{Since: "not-an-id"},
+		{Limit: 1, Sort: ImageListSortCreated},
+	} {
+		_, _, err := mgr.ListImages(context.TODO(), filters.NewArgs(), opt)
+		assert.True(t, errtypes.IsInvalidParam(err), "%+v", opt)
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestAddTagsValidateAllTargets(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		localStore:       store,
+	}
+
+	// the invalid tag fails the batch before touching containerd
+	err = mgr.AddTags(context.TODO(), "busybox:latest", []string{
+		"busybox:v1",
+		"busybox@" + digest.FromString("manifest").String(),
+	})
+	assert.True(t, errtypes.IsInvalidParam(err))
+	assert.Empty(t, store.ListAllReferences())
+
+	err = mgr.AddTags(context.TODO(), "busybox:latest", nil)
+	assert.True(t, errtypes.IsInvalidParam(err))
+}
+
+func TestAddTagCollision(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+	}
+
+	addImage := func(name string) digest.Digest {
+		target := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: digest.FromString(name)}
+		client.images[name] = newIndexOnlyImage(name, target)
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(target.Digest, ref, target.Digest))
+		mgr.localStore.CacheCtrdImageInfo(target.Digest, CtrdImageInfo{ID: target.Digest, IndexOnly: true})
+		return target.Digest
+	}
+	appID := addImage("reg.abc.com/app:v1")
+	otherID := addImage("reg.abc.com/app:v2")
+
+	// the tag of other image isn't overridden without force
+	err = mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:v2", false, nil)
+	assert.True(t, errtypes.IsAlreadyExisted(err))
+	assert.Contains(t, err.Error(), "use force")
+	err = mgr.AddTags(context.TODO(), "reg.abc.com/app:v1", []string{"reg.abc.com/app:stable", "reg.abc.com/app:v2"})
+	assert.True(t, errtypes.IsAlreadyExisted(err))
+	_, ok := client.images["reg.abc.com/app:stable"]
+	assert.False(t, ok)
+
+	id, _, _, err := mgr.CheckReference(context.TODO(), "reg.abc.com/app:v2")
+	assert.NoError(t, err)
+	assert.Equal(t, otherID, id)
+
+	// the tag which only exists in containerd isn't overridden either
+	client.images["reg.abc.com/app:unloaded"] = newIndexOnlyImage("reg.abc.com/app:unloaded", ocispec.Descriptor{Digest: digest.FromString("unloaded")})
+	err = mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:unloaded", false, nil)
+	assert.True(t, errtypes.IsAlreadyExisted(err))
+	_, _, _, err = mgr.CheckReference(context.TODO(), "reg.abc.com/app:unloaded")
+	assert.True(t, errtypes.IsNotfound(err))
+
+	// the force moves it
+	assert.NoError(t, mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:unloaded", true, nil))
+	id, _, _, err = mgr.CheckReference(context.TODO(), "reg.abc.com/app:unloaded")
+	assert.NoError(t, err)
+	assert.Equal(t, appID, id)
+	assert.Equal(t, appID, client.images["reg.abc.com/app:unloaded"].target.Digest)
+
+	// the new tag is created
+	assert.NoError(t, mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:stable", false, nil))
+	id, _, _, err = mgr.CheckReference(context.TODO(), "reg.abc.com/app:stable")
+	assert.NoError(t, err)
+	assert.Equal(t, appID, id)
+}
+
+func TestAddTagsSkipExistingTags(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+		unpacking:     newUnpackingLayers(),
+	}
+
+	appID := digest.FromString("app")
+	for _, name := range []string{"reg.abc.com/app:v1", "reg.abc.com/app:v2"} {
+		client.images[name] = newIndexOnlyImage(name, ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: appID})
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(appID, ref, appID))
+	}
+	mgr.localStore.CacheCtrdImageInfo(appID, CtrdImageInfo{ID: appID, IndexOnly: true})
+
+	parseRefs := func(names ...string) []reference.Named {
+		var refs []reference.Named
+		for _, name := range names {
+			ref, err := reference.Parse(name)
+			assert.NoError(t, err)
+			refs = append(refs, ref)
+		}
+		return refs
+	}
+
+	// NOTE: the existing tag is rejected by AddTags before the creation,
+	// unless it's created concurrently.
+	img, err := client.GetImage(context.TODO(), "reg.abc.com/app:v1")
+	assert.NoError(t, err)
+	created, err := mgr.createReferences(context.TODO(), appID, img, parseRefs("reg.abc.com/app:v2", "reg.abc.com/app:stable"))
+	assert.NoError(t, err)
+	assert.Equal(t, parseRefs("reg.abc.com/app:stable"), created)
+
+	// the tags created by the call are rolled back, but the existing ones
+	// are kept
+	client.createErrs = map[string]error{"reg.abc.com/app:broken": pkgerrors.New("broken")}
+	created, err = mgr.createReferences(context.TODO(), appID, img, parseRefs("reg.abc.com/app:v2", "reg.abc.com/app:latest", "reg.abc.com/app:broken"))
+	assert.Error(t, err)
+	assert.Equal(t, parseRefs("reg.abc.com/app:latest"), created)
+
+	err = mgr.AddTags(context.TODO(), "reg.abc.com/app:v1", []string{"reg.abc.com/app:v3", "reg.abc.com/app:broken"})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"reg.abc.com/app:v3"}, client.removed)
+	for _, name := range []string{"reg.abc.com/app:v3", "reg.abc.com/app:broken"} {
+		_, _, _, err := mgr.CheckReference(context.TODO(), name)
+		assert.True(t, errtypes.IsNotfound(err), name)
+	}
+	for _, name := range []string{"reg.abc.com/app:v2", "reg.abc.com/app:stable"} {
+		_, _, _, err := mgr.CheckReference(context.TODO(), name)
+		assert.NoError(t, err, name)
+		assert.Contains(t, client.images, name)
+	}
+}
+
+func TestAddTagForceMove(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+	}
+
+	addImage := func(id digest.Digest, name string) {
+		target := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: id}
+		client.images[name] = newIndexOnlyImage(name, target)
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+		mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id, IndexOnly: true})
+	}
+	checkTag := func(name string, expected digest.Digest) {
+		id, _, _, err := mgr.CheckReference(context.TODO(), name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, id, name)
+		assert.Equal(t, expected, client.images[name].target.Digest, name)
+	}
+
+	appID, usedID, otherID := digest.FromString("app"), digest.FromString("used"), digest.FromString("other")
+	addImage(appID, "reg.abc.com/app:v1")
+	addImage(usedID, "reg.abc.com/app:used")
+	addImage(otherID, "reg.abc.com/app:other")
+	addImage(otherID, "reg.abc.com/app:other-alias")
+
+	isUsed := func(id digest.Digest) (bool, error) {
+		return id == usedID || id == otherID, nil
+	}
+
+	// the last reference of image used by container cannot be moved
+	err = mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:used", true, isUsed)
+	assert.True(t, errtypes.IsInUse(err))
+	checkTag("reg.abc.com/app:used", usedID)
+
+	// the image keeps its other reference after the tag is moved
+	assert.NoError(t, mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:other", true, isUsed))
+	checkTag("reg.abc.com/app:other", appID)
+	checkTag("reg.abc.com/app:other-alias", otherID)
+
+	// the tag is kept by the other image if it fails to be moved
+	client.updateErr = fmt.Errorf("update failed")
+	err = mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:other-alias", true, nil)
+	assert.Error(t, err)
+	checkTag("reg.abc.com/app:other-alias", otherID)
+	client.updateErr = nil
+
+	// the image not used by container is released by the last reference
+	assert.NoError(t, mgr.AddTag(context.TODO(), "reg.abc.com/app:v1", "reg.abc.com/app:used", true, nil))
+	checkTag("reg.abc.com/app:used", appID)
+	assert.Empty(t, store.GetPrimaryReferences(usedID))
+}
+
+func TestRemoveImageUnpackingLayers(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+		unpacking:     newUnpackingLayers(),
+	}
+
+	layer1, layer2 := digest.FromString("layer1"), digest.FromString("layer2")
+	addImage := func(name string, diffIDs ...digest.Digest) {
+		id := digest.FromString(name)
+		client.images[name] = newIndexOnlyImage(name, ocispec.Descriptor{Digest: id})
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+
+		info := CtrdImageInfo{ID: id}
+		info.OCISpec.RootFS.DiffIDs = diffIDs
+		mgr.localStore.CacheCtrdImageInfo(id, info)
+	}
+	addImage("reg.abc.com/base:v1", layer1)
+	addImage("reg.abc.com/base:v2", layer1)
+	addImage("reg.abc.com/child:v1", layer1, layer2)
+
+	// the base shared by the local child image can be removed
+	assert.NoError(t, mgr.RemoveImage(context.TODO(), "reg.abc.com/base:v1", nil))
+
+	// but not the one whose layers are being unpacked by pull
+	release := mgr.unpacking.add([]digest.Digest{layer1, layer2})
+	err = mgr.RemoveImage(context.TODO(), "reg.abc.com/base:v2", nil)
+	assert.Equal(t, errtypes.ErrConflict, pkgerrors.Cause(err))
+	assert.NoError(t, mgr.RemoveImage(context.TODO(), "reg.abc.com/base:v2", &ImageRemoveOption{Force: true}))
+
+	release()
+	assert.NoError(t, mgr.RemoveImage(context.TODO(), "reg.abc.com/child:v1", nil))
+}
+
+func TestImageRemovalEvents(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+		unpacking:     newUnpackingLayers(),
+	}
+
+	addImage := func(id digest.Digest, name string) {
+		client.images[name] = newIndexOnlyImage(name, ocispec.Descriptor{Digest: id})
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+		mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id})
+	}
+
+	// imageEvents returns the events logged since the given time, like
+	// "untag reg.abc.com/app:v1".
+	imageEvents := func(since time.Time) []string {
+		buffered, _, _ := mgr.eventsService.Subscribe(context.TODO(), since, time.Now(), nil)
+
+		var res []string
+		for _, msg := range buffered {
+			res = append(res, msg.Action+" "+msg.Actor.Attributes["Name"])
+		}
+		return res
+	}
+
+	appID, oldID := digest.FromString("app"), digest.FromString("old")
+	addImage(appID, "reg.abc.com/app:v1")
+	addImage(appID, "reg.abc.com/app:v2")
+	addImage(appID, "reg.abc.com/app:v3")
+	addImage(oldID, "reg.abc.com/old:v1")
+
+	// the tag is untagged with the digest reference of its primary
+	// reference, but the image is kept by the other tags
+	since := time.Now()
+	assert.NoError(t, mgr.RemoveImage(context.TODO(), "reg.abc.com/app:v1", nil))
+	assert.Equal(t, []string{
+		"untag reg.abc.com/app:v1",
+		"untag reg.abc.com/app@" + appID.String(),
+	}, imageEvents(since))
+
+	// the removal by ID untags each reference before the delete
+	since = time.Now()
+	assert.NoError(t, mgr.RemoveImage(context.TODO(), appID.String(), &ImageRemoveOption{Force: true}))
+	assert.Equal(t, []string{
+		"untag reg.abc.com/app:v2",
+		"untag reg.abc.com/app:v3",
+		"delete " + appID.String(),
+	}, imageEvents(since))
+
+	// the failed removal logs nothing
+	since = time.Now()
+	client.removeErrs = map[string]error{"reg.abc.com/old:v1": fmt.Errorf("remove failed")}
+	assert.Error(t, mgr.RemoveImage(context.TODO(), oldID.String(), nil))
+	assert.Empty(t, imageEvents(since))
+	client.removeErrs = nil
+
+	// the pruned image is untagged and deleted like the removal
+	since = time.Now()
+	_, err = mgr.PruneImages(context.TODO(), filters.NewArgs(filters.Arg("dangling", "false")), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"untag reg.abc.com/old:v1",
+		"untag reg.abc.com/old@" + oldID.String(),
+		"delete " + oldID.String(),
+	}, imageEvents(since))
+}
+
+func TestPruneDigestRemovesImage(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	client := newFakeImageClient()
+	mgr := &ImageManager{
+		client:        client,
+		localStore:    store,
+		imageLocks:    newImageLocker(),
+		eventsService: events.NewEvents(),
+		unpacking:     newUnpackingLayers(),
+	}
+
+	id, manifest := digest.FromString("config"), digest.FromString("manifest")
+	addReference := func(name string) {
+		client.images[name] = newIndexOnlyImage(name, ocispec.Descriptor{Digest: manifest})
+
+		ref, err := reference.Parse(name)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, ref, manifest))
+		mgr.localStore.CacheCtrdImageInfo(id, CtrdImageInfo{ID: id})
+	}
+
+	// the image is pulled by digest before the tags
+	addReference("reg.abc.com/busybox@" + manifest.String())
+	addReference("reg.abc.com/busybox:latest")
+	addReference("reg.abc.com/busybox:1.25")
+
+	// the image is kept by the other tag
+	removes, err := mgr.PruneDigestRemovesImage(context.TODO(), "reg.abc.com/busybox:latest")
+	assert.NoError(t, err)
+	assert.False(t, removes)
+
+	// the digest reference isn't pruned by itself
+	removes, err = mgr.PruneDigestRemovesImage(context.TODO(), "reg.abc.com/busybox@"+manifest.String())
+	assert.NoError(t, err)
+	assert.False(t, removes)
+
+	opt := &ImageRemoveOption{PruneDigest: true}
+	assert.NoError(t, mgr.RemoveImage(context.TODO(), "reg.abc.com/busybox:latest", opt))
+	assert.Len(t, store.GetPrimaryReferences(id), 2)
+
+	// the last tag leaves the digest reference only
+	removes, err = mgr.PruneDigestRemovesImage(context.TODO(), "reg.abc.com/busybox:1.25")
+	assert.NoError(t, err)
+	assert.True(t, removes)
+
+	assert.NoError(t, mgr.RemoveImage(context.TODO(), "reg.abc.com/busybox:1.25", opt))
+	assert.Empty(t, store.GetPrimaryReferences(id))
+}
+
+func TestCachedImageConfig(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	// NOTE: the nil client fails the test if containerd is read.
+	mgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		localStore:       store,
+	}
+
+	id := digest.FromString("config")
+	ref, err := reference.Parse("registry.hub.docker.com/library/busybox:latest")
+	assert.NoError(t, err)
+	assert.NoError(t, mgr.addReferenceIntoStore(id, ref, digest.FromString("manifest")))
+
+	diffIDs := []digest.Digest{digest.FromString("layer1"), digest.FromString("layer2")}
+	store.CacheCtrdImageInfo(id, CtrdImageInfo{
+		ID: id,
+		OCISpec: ocispec.Image{
+			Config: ocispec.ImageConfig{Cmd: []string{"sh"}},
+			RootFS: ocispec.RootFS{Type: "layers", DiffIDs: diffIDs},
+		},
+		ChainID: identity.ChainID(diffIDs),
+	})
+
+	config, err := mgr.GetOCIImageConfig(context.TODO(), "busybox")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sh"}, config.Cmd)
+
+	chainID, err := mgr.GetImageChainID(context.TODO(), id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, identity.ChainID(diffIDs), chainID)
+
+	// the image inspected with the fallback platform isn't used
+	store.CacheCtrdImageInfo(id, CtrdImageInfo{
+		ID:               id,
+		ChainID:          identity.ChainID(diffIDs),
+		PlatformMismatch: true,
+	})
+	_, err = mgr.GetImageChainID(context.TODO(), "busybox")
+	assert.True(t, errtypes.IsNotfound(err))
+}
+
+// BenchmarkContainerImageMetadata measures the image metadata read by the
+// first container creation, which is the config and the chain ID of rootfs
+// used as the parent of snapshot, with and without the information cached
+// after pull.
+//
+// NOTE: the content is in memory, so the round trips to containerd saved by
+// the cache are not counted.
+func BenchmarkContainerImageMetadata(b *testing.B) {
+	provider := memProvider{}
+
+	var (
+		layers  []ocispec.Descriptor
+		diffIDs []digest.Digest
+	)
+	for i := 0; i < 10; i++ {
+		layer := []byte(fmt.Sprintf("layer%d", i))
+		layers = append(layers, provider.add(ocispec.MediaTypeImageLayer, layer))
+		diffIDs = append(diffIDs, digest.FromBytes(layer))
+	}
+
+	ociImage := ocispec.Image{
+		Architecture: runtime.GOARCH,
+		OS:           runtime.GOOS,
+		Config: ocispec.ImageConfig{
+			Env:        []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+			Entrypoint: []string{"/docker-entrypoint.sh"},
+			Cmd:        []string{"nginx", "-g", "daemon off;"},
+			Labels:     map[string]string{"maintainer": "pouch"},
+		},
+		RootFS: ocispec.RootFS{Type: "layers", DiffIDs: diffIDs},
+	}
+	config, err := json.Marshal(ociImage)
+	if err != nil {
+		b.Fatal(err)
+	}
+	configDesc := provider.add(ocispec.MediaTypeImageConfig, config)
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    layers,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	target := provider.add(ocispec.MediaTypeImageManifest, manifest)
+
+	const name = "reg.abc.com/library/nginx:latest"
+	ref, err := reference.Parse(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, cached := range []bool{false, true} {
+		store, err := newImageStore()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		mgr := &ImageManager{
+			client: newFakeImageClient(&fakeImage{
+				name:   name,
+				target: target,
+				store:  memContentStore{memProvider: provider},
+			}),
+			localStore: store,
+		}
+		if err := mgr.addReferenceIntoStore(configDesc.Digest, ref, target.Digest); err != nil {
+			b.Fatal(err)
+		}
+
+		info := CtrdImageInfo{ID: configDesc.Digest}
+		if cached {
+			info.OCISpec, info.ChainID = ociImage, identity.ChainID(diffIDs)
+		}
+		store.CacheCtrdImageInfo(configDesc.Digest, info)
+
+		b.Run(fmt.Sprintf("cached=%v", cached), func(b *testing.B) {
+			ctx := context.TODO()
+			for i := 0; i < b.N; i++ {
+				if _, err := mgr.GetOCIImageConfig(ctx, name); err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err := mgr.GetImageChainID(ctx, name); err == nil {
+					continue
+				}
+
+				// NOTE: it's the same as CreateSnapshot of containerd
+				// client without the cache.
+				img, err := mgr.client.GetImage(ctx, name)
+				if err != nil {
+					b.Fatal(err)
+				}
+				diffIDs, err := img.RootFS(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				identity.ChainID(diffIDs)
+			}
+		})
+	}
+}
+
+func TestGetImageConfig(t *testing.T) {
+	created := time.Unix(1500000000, 0).UTC()
+	config := ocispec.Image{
+		Created:      &created,
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: ocispec.ImageConfig{
+			User:         "nobody",
+			ExposedPorts: map[string]struct{}{"80/tcp": {}},
+			Env:          []string{"PATH=/usr/bin"},
+			Entrypoint:   []string{"/entrypoint.sh"},
+			Cmd:          []string{"serve"},
+			Volumes:      map[string]struct{}{"/data": {}},
+			WorkingDir:   "/app",
+			Labels:       map[string]string{"version": "1.0"},
+			StopSignal:   "SIGTERM",
+		},
+		RootFS:  ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromString("layer")}},
+		History: []ocispec.History{{Created: &created, CreatedBy: "ADD rootfs"}},
+	}
+
+	provider := memProvider{}
+	layer := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+	img := newFakeImage(t, provider, "reg.abc.com/app:1.0", config, layer)
+	mgr, _ := newFakeImageManager(t, img)
+
+	// the complete config is returned, not only the execution parameters
+	got, err := mgr.GetImageConfig(context.TODO(), img.name)
+	assert.NoError(t, err)
+	assert.Equal(t, config, got)
+
+	info, err := mgr.GetImage(context.TODO(), img.name)
+	assert.NoError(t, err)
+	got, err = mgr.GetImageConfig(context.TODO(), info.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, config, got)
+
+	_, err = mgr.GetImageConfig(context.TODO(), "reg.abc.com/none:1.0")
+	assert.True(t, errtypes.IsNotfound(err), "%v", err)
+}
+
+func TestPullImageRequireDigest(t *testing.T) {
+	mgr := &ImageManager{requireDigestPull: true}
+
+	for _, ref := range []string{"busybox", "busybox:latest", "reg.abc.com/library/busybox:1.25"} {
+		err := mgr.PullImage(context.TODO(), ref, nil, ioutil.Discard, nil)
+		assert.True(t, errtypes.IsInvalidParam(err), ref)
+	}
+}
+
+func TestHasImage(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{localStore: store}
+
+	id := digest.FromString("busybox")
+	ref, err := reference.Parse("reg.abc.com/library/busybox:latest")
+	assert.NoError(t, err)
+	assert.NoError(t, mgr.addReferenceIntoStore(id, ref, id))
+
+	for _, idOrRef := range []string{"reg.abc.com/library/busybox:latest", "reg.abc.com/library/busybox", id.String(), id.Hex()[:12]} {
+		exist, actualID, err := mgr.HasImage(context.TODO(), idOrRef)
+		assert.NoError(t, err)
+		assert.True(t, exist, idOrRef)
+		assert.Equal(t, id, actualID)
+	}
+
+	exist, actualID, err := mgr.HasImage(context.TODO(), "reg.abc.com/library/busybox:1.30")
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.Equal(t, digest.Digest(""), actualID)
+
+	_, _, err = mgr.HasImage(context.TODO(), "Invalid:Reference")
+	assert.Error(t, err)
+}
+
+func TestListAllReferences(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{localStore: store}
+
+	id, dig := digest.FromString("busybox"), digest.FromString("manifest")
+	for _, ref := range []string{"reg.abc.com/library/busybox:latest", "reg.abc.com/library/busybox:1.30"} {
+		namedRef, err := reference.Parse(ref)
+		assert.NoError(t, err)
+		assert.NoError(t, mgr.addReferenceIntoStore(id, namedRef, dig))
+	}
+
+	refs, err := mgr.ListReferences(context.TODO(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(refs))
+
+	// the alias Name@Digest is added with the first primary reference
+	refs, err = mgr.ListAllReferences(context.TODO(), id)
+	assert.NoError(t, err)
+
+	var res []string
+	for _, ref := range refs {
+		res = append(res, ref.String())
+	}
+	assert.Equal(t, []string{
+		"reg.abc.com/library/busybox:1.30",
+		"reg.abc.com/library/busybox:latest",
+		"reg.abc.com/library/busybox@" + dig.String(),
+	}, res)
+
+	refs, err = mgr.ListAllReferences(context.TODO(), digest.FromString("unknown"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(refs))
+}
+
+func TestValidatePullSnapshotter(t *testing.T) {
+	mgr := &ImageManager{pullSnapshotters: []string{"overlaybd"}}
+
+	assert.NoError(t, mgr.validatePullSnapshotter("overlaybd"))
+	assert.NoError(t, mgr.validatePullSnapshotter(ctrd.CurrentSnapshotterName(context.TODO())))
+
+	err := mgr.validatePullSnapshotter("nydus")
+	assert.True(t, errtypes.IsInvalidParam(err))
+
+	// the snapshotter is validated before pulling
+	err = mgr.PullImage(context.TODO(), "reg.abc.com/library/busybox:latest", nil, ioutil.Discard, &ImagePullOption{Snapshotter: "nydus"})
+	assert.True(t, errtypes.IsInvalidParam(err))
+}
+
+func TestStoreLazyImageReference(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{
+		localStore:         store,
+		infoCache:          newImageInfoCache(),
+		corruptImages:      newCorruptImages(),
+		remoteSnapshotters: []string{"stargz"},
+	}
+
+	// the layer is not in the content store
+	provider := memProvider{}
+	layer := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer"), Size: 1024}
+	config, err := json.Marshal(ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromString("diff")}},
+	})
+	assert.NoError(t, err)
+	configDesc := provider.add(ocispec.MediaTypeImageConfig, config)
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	assert.NoError(t, err)
+
+	img := &fakeImage{
+		name:   "reg.abc.com/library/app:1.0",
+		labels: map[string]string{ctrd.LazyLabel: "true"},
+		target: provider.add(ocispec.MediaTypeImageManifest, manifest),
+		store:  memContentStore{memProvider: provider},
+	}
+
+	assert.NoError(t, mgr.StoreImageReference(context.TODO(), img))
+	exist, id, err := mgr.HasImage(context.TODO(), "reg.abc.com/library/app:1.0")
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, configDesc.Digest, id)
+
+	info, err := mgr.localStore.GetCtrdImageInfo(id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(manifest))+configDesc.Size+layer.Size, info.Size)
+
+	// the missing layers of lazy image are not verified
+	assert.NoError(t, mgr.verifyPulledImage(context.TODO(), img))
+	img.labels = nil
+	assert.Error(t, mgr.verifyPulledImage(context.TODO(), img))
+
+	// the lazy pull requires the remote snapshotter
+	err = mgr.PullImage(context.TODO(), "reg.abc.com/library/app:1.0", nil, ioutil.Discard, &ImagePullOption{Lazy: true})
+	assert.True(t, errtypes.IsInvalidParam(err))
+}
+
+func TestLazyImageWithoutLayers(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	// the layer is not in the content store
+	created := time.Now()
+	provider := memProvider{}
+	layer := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer"), Size: 1024}
+	config, err := json.Marshal(ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromString("diff")}},
+		History:      []ocispec.History{{Created: &created, CreatedBy: "ADD rootfs"}},
+	})
+	assert.NoError(t, err)
+	configDesc := provider.add(ocispec.MediaTypeImageConfig, config)
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	assert.NoError(t, err)
+
+	img := &fakeImage{
+		name:   "reg.abc.com/library/app:1.0",
+		labels: map[string]string{ctrd.LazyLabel: "true"},
+		target: provider.add(ocispec.MediaTypeImageManifest, manifest),
+		store:  memContentStore{memProvider: provider},
+	}
+
+	mgr := &ImageManager{
+		localStore:    store,
+		infoCache:     newImageInfoCache(),
+		corruptImages: newCorruptImages(),
+		client:        newFakeImageClient(img),
+	}
+	assert.NoError(t, mgr.StoreImageReference(context.TODO(), img))
+
+	// the size of layer is from the manifest
+	history, err := mgr.ImageHistory(context.TODO(), img.name)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, layer.Size, history[0].Size)
+	}
+
+	// the actions reading the layer blobs are rejected
+	_, err = mgr.GetImageLayer(context.TODO(), img.name, layer.Digest)
+	assert.True(t, errtypes.IsInvalidParam(err), "%v", err)
+
+	_, err = mgr.SaveImages(context.TODO(), []string{img.name}, nil)
+	assert.True(t, errtypes.IsInvalidParam(err), "%v", err)
+
+	_, err = mgr.SaveImage(context.TODO(), img.name, &ImageSaveOption{Format: ImageArchiveFormatOCI})
+	assert.True(t, errtypes.IsInvalidParam(err), "%v", err)
+
+	dir, err := ioutil.TempDir("", "lazy-image")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = mgr.ExportBlobs(context.TODO(), img.name, dir)
+	assert.True(t, errtypes.IsInvalidParam(err), "%v", err)
+
+	err = mgr.PushImage(context.TODO(), img.name, "", nil, ioutil.Discard)
+	assert.True(t, errtypes.IsInvalidParam(err), "%v", err)
+}
+
+func TestImageOfFallbackPlatform(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	// the image only supports the platform other than the default one
+	foreign := ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	if runtime.GOARCH == "amd64" {
+		foreign.Architecture = "arm64"
+	}
+
+	created := time.Now()
+	provider := memProvider{}
+	layer := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+	config, err := json.Marshal(ocispec.Image{
+		Architecture: foreign.Architecture,
+		OS:           foreign.OS,
+		RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromString("diff")}},
+		History:      []ocispec.History{{Created: &created, CreatedBy: "ADD rootfs"}},
+	})
+	assert.NoError(t, err)
+	configDesc := provider.add(ocispec.MediaTypeImageConfig, config)
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	assert.NoError(t, err)
+	manifestDesc := provider.add(ocispec.MediaTypeImageManifest, manifest)
+	manifestDesc.Platform = &foreign
+
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		Manifests: []ocispec.Descriptor{manifestDesc},
+	})
+	assert.NoError(t, err)
+
+	img := &fakeImage{
+		name:   "reg.abc.com/library/app:1.0",
+		target: provider.add(ocispec.MediaTypeImageIndex, index),
+		store:  memContentStore{memProvider: provider},
+	}
+
+	mgr := &ImageManager{
+		localStore:       store,
+		infoCache:        newImageInfoCache(),
+		corruptImages:    newCorruptImages(),
+		client:           newFakeImageClient(img),
+		platformFallback: platforms.Only(foreign),
+	}
+	assert.NoError(t, mgr.StoreImageReference(context.TODO(), img))
+
+	// the image is read by the fallback platform
+	ociImage, err := mgr.GetImageConfig(context.TODO(), img.name)
+	assert.NoError(t, err)
+	assert.Equal(t, foreign.Architecture, ociImage.Architecture)
+
+	layers, err := mgr.InspectLayers(context.TODO(), img.name)
+	assert.NoError(t, err)
+	if assert.Len(t, layers, 1) {
+		assert.Equal(t, layer.Digest.String(), layers[0].Digest)
+	}
+
+	rc, err := mgr.GetImageLayer(context.TODO(), img.name, layer.Digest)
+	assert.NoError(t, err)
+	if err == nil {
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("layer"), b)
+	}
+
+	history, err := mgr.ImageHistory(context.TODO(), img.name)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	assert.Equal(t, []ocispec.Descriptor{layer}, mgr.imageLayers(context.TODO(), img))
+	assert.NoError(t, mgr.verifyPulledImage(context.TODO(), img))
+
+	diff, err := mgr.DiffImages(context.TODO(), img.name, img.name)
+	assert.NoError(t, err)
+	assert.Empty(t, diff.OnlyInA)
+
+	dir, err := ioutil.TempDir("", "fallback-image")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, mgr.ExportBlobs(context.TODO(), img.name, dir))
+	_, err = os.Stat(filepath.Join(dir, "blobs", "sha256", manifestDesc.Digest.Hex()))
+	assert.NoError(t, err)
+
+	diagnosis, err := mgr.DiagnoseImageStore(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, diagnosis.Mismatches)
+}
+
+func TestPullMaxImageSize(t *testing.T) {
+	for _, tc := range []struct {
+		config, request, expected int64
+	}{
+		{config: 0, request: 0, expected: 0},
+		{config: 100, request: 0, expected: 100},
+		{config: 0, request: 100, expected: 100},
+		{config: 100, request: 50, expected: 50},
+		// the request cannot exceed the limitation in config
+		{config: 100, request: 200, expected: 100},
+	} {
+		assert.Equal(t, tc.expected, pullMaxImageSize(tc.config, tc.request), "%+v", tc)
+	}
+}
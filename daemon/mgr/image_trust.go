@@ -0,0 +1,518 @@
+package mgr
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+	"github.com/alibaba/pouch/pkg/reference"
+	"github.com/alibaba/pouch/pkg/utils"
+
+	"github.com/containerd/containerd/remotes"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// trustRequestTimeout is the timeout of each request to trust server.
+	trustRequestTimeout = 30 * time.Second
+
+	// trustMetadataMaxSize limits the size of metadata from trust server.
+	trustMetadataMaxSize = 10 << 20
+
+	// trustReleasesRole is the delegation role used by docker content trust.
+	trustReleasesRole = "targets/releases"
+)
+
+// tufSigned is the signed metadata in trust server.
+type tufSigned struct {
+	Signed     json.RawMessage `json:"signed"`
+	Signatures []tufSignature  `json:"signatures"`
+}
+
+type tufSignature struct {
+	KeyID  string `json:"keyid"`
+	Method string `json:"method"`
+	Sig    []byte `json:"sig"`
+}
+
+type tufKey struct {
+	KeyType string `json:"keytype"`
+	KeyVal  struct {
+		Public []byte `json:"public"`
+	} `json:"keyval"`
+}
+
+type tufRole struct {
+	Name      string   `json:"name,omitempty"`
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+type tufRoot struct {
+	Type    string             `json:"_type"`
+	Expires time.Time          `json:"expires"`
+	Keys    map[string]tufKey  `json:"keys"`
+	Roles   map[string]tufRole `json:"roles"`
+}
+
+type tufTarget struct {
+	Hashes map[string][]byte `json:"hashes"`
+	Length int64             `json:"length"`
+}
+
+// tufFileMeta is the length and hashes of metadata file, which pins the
+// content of role in timestamp and snapshot metadata.
+type tufFileMeta struct {
+	Length int64             `json:"length"`
+	Hashes map[string][]byte `json:"hashes"`
+}
+
+// tufFiles is the signed part of timestamp and snapshot metadata, whose meta
+// is keyed by role name.
+type tufFiles struct {
+	Type    string                 `json:"_type"`
+	Expires time.Time              `json:"expires"`
+	Meta    map[string]tufFileMeta `json:"meta"`
+}
+
+type tufTargets struct {
+	Type        string               `json:"_type"`
+	Expires     time.Time            `json:"expires"`
+	Targets     map[string]tufTarget `json:"targets"`
+	Delegations struct {
+		Keys  map[string]tufKey `json:"keys"`
+		Roles []tufRole         `json:"roles"`
+	} `json:"delegations"`
+}
+
+// trustClient resolves the signed digest of tag from the notary v1 trust
+// server. The root metadata must be signed by one of the pinned root keys,
+// and the other metadata must be signed by the keys in root metadata. The
+// timestamp pins the snapshot, and the snapshot pins the targets, so that
+// the stale or mixed targets cannot be replayed.
+type trustClient struct {
+	server     string
+	rootKeyIDs []string
+	client     *http.Client
+}
+
+// newTrustClient creates the client of trust server, whose requests use the
+// TLS and proxy config of the registry.
+func newTrustClient(server string, rootKeyIDs []string, insecure bool, proxy *url.URL) *trustClient {
+	proxyFunc := http.ProxyFromEnvironment
+	if proxy != nil {
+		proxyFunc = http.ProxyURL(proxy)
+	}
+
+	return &trustClient{
+		server:     strings.TrimSuffix(server, "/"),
+		rootKeyIDs: rootKeyIDs,
+		client: &http.Client{
+			Timeout: trustRequestTimeout,
+			Transport: &http.Transport{
+				Proxy: proxyFunc,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: insecure,
+				},
+			},
+		},
+	}
+}
+
+// resolveDigest returns the signed manifest digest of the tagged reference.
+func (c *trustClient) resolveDigest(ctx context.Context, ref reference.Named) (digest.Digest, error) {
+	tagged, ok := ref.(reference.Tagged)
+	if !ok {
+		return "", pkgerrors.Wrapf(errtypes.ErrInvalidParam, "content trust requires tagged reference, but got %s", ref)
+	}
+	gun, tag := ref.Name(), tagged.Tag()
+
+	var root tufRoot
+	if err := c.fetchRole(ctx, gun, "root", nil, &root, func(s *tufSigned) error {
+		var unverified tufRoot
+		if err := json.Unmarshal(s.Signed, &unverified); err != nil {
+			return err
+		}
+
+		// only the pinned keys which are also listed in root role are
+		// trusted, and the key must match its ID so that the key cannot be
+		// replaced under the pinned ID.
+		pinned := tufRole{Threshold: 1}
+		keys := map[string]tufKey{}
+		for _, id := range unverified.Roles["root"].KeyIDs {
+			key, ok := unverified.Keys[id]
+			if !ok || !utils.StringInSlice(c.rootKeyIDs, id) {
+				continue
+			}
+
+			if keyID, err := tufKeyID(key); err != nil || keyID != id {
+				continue
+			}
+			pinned.KeyIDs = append(pinned.KeyIDs, id)
+			keys[id] = key
+		}
+		return verifyTUFSignatures(s, keys, pinned)
+	}); err != nil {
+		return "", err
+	}
+
+	var timestamp tufFiles
+	if err := c.fetchRole(ctx, gun, "timestamp", nil, &timestamp, func(s *tufSigned) error {
+		return verifyTUFSignatures(s, root.Keys, root.Roles["timestamp"])
+	}); err != nil {
+		return "", err
+	}
+
+	var snapshot tufFiles
+	if err := c.fetchRole(ctx, gun, "snapshot", fileMetaOf(timestamp, "snapshot"), &snapshot, func(s *tufSigned) error {
+		return verifyTUFSignatures(s, root.Keys, root.Roles["snapshot"])
+	}); err != nil {
+		return "", err
+	}
+
+	var targets tufTargets
+	if err := c.fetchRole(ctx, gun, "targets", fileMetaOf(snapshot, "targets"), &targets, func(s *tufSigned) error {
+		return verifyTUFSignatures(s, root.Keys, root.Roles["targets"])
+	}); err != nil {
+		return "", err
+	}
+
+	if target, ok := targets.Targets[tag]; ok {
+		return targetDigest(target)
+	}
+
+	// docker content trust signs the tag into the releases delegation
+	for _, role := range targets.Delegations.Roles {
+		if role.Name != trustReleasesRole {
+			continue
+		}
+
+		var releases tufTargets
+		if err := c.fetchRole(ctx, gun, trustReleasesRole, fileMetaOf(snapshot, trustReleasesRole), &releases, func(s *tufSigned) error {
+			return verifyTUFSignatures(s, targets.Delegations.Keys, role)
+		}); err != nil {
+			return "", err
+		}
+
+		if target, ok := releases.Targets[tag]; ok {
+			return targetDigest(target)
+		}
+	}
+	return "", pkgerrors.Wrapf(errtypes.ErrNotfound, "no trust data for %s", ref)
+}
+
+// fetchRole fetches the metadata of role, and decodes the signed part into
+// obj after it's verified. The metadata must match meta if it's not nil.
+func (c *trustClient) fetchRole(ctx context.Context, gun, role string, meta *tufFileMeta, obj interface{}, verify func(*tufSigned) error) error {
+	url := fmt.Sprintf("%s/v2/%s/_trust/tuf/%s.json", c.server, gun, role)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to fetch %s metadata of %s", role, gun)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return pkgerrors.Wrapf(errtypes.ErrNotfound, "no trust data for %s", gun)
+		}
+		return fmt.Errorf("failed to fetch %s metadata of %s: unexpected status %s", role, gun, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, trustMetadataMaxSize+1))
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to read %s metadata of %s", role, gun)
+	}
+	if len(data) > trustMetadataMaxSize {
+		return fmt.Errorf("%s metadata of %s is too large", role, gun)
+	}
+
+	if meta != nil {
+		if err := checkFileMeta(data, *meta); err != nil {
+			return pkgerrors.Wrapf(err, "failed to verify %s metadata of %s", role, gun)
+		}
+	}
+
+	var s tufSigned
+	if err := json.Unmarshal(data, &s); err != nil {
+		return pkgerrors.Wrapf(err, "failed to decode %s metadata of %s", role, gun)
+	}
+
+	if err := verify(&s); err != nil {
+		return pkgerrors.Wrapf(err, "failed to verify %s metadata of %s", role, gun)
+	}
+
+	if err := json.Unmarshal(s.Signed, obj); err != nil {
+		return pkgerrors.Wrapf(err, "failed to decode %s metadata of %s", role, gun)
+	}
+
+	var expires time.Time
+	switch m := obj.(type) {
+	case *tufRoot:
+		expires = m.Expires
+	case *tufFiles:
+		expires = m.Expires
+	case *tufTargets:
+		expires = m.Expires
+	}
+	if !expires.IsZero() && time.Now().After(expires) {
+		return fmt.Errorf("%s metadata of %s expired at %v", role, gun, expires)
+	}
+	return nil
+}
+
+// fileMetaOf returns the file meta of role pinned by the timestamp or
+// snapshot metadata. The empty meta is returned if the role is not pinned,
+// which never matches any metadata.
+func fileMetaOf(files tufFiles, role string) *tufFileMeta {
+	meta, ok := files.Meta[role]
+	if !ok {
+		return &tufFileMeta{}
+	}
+	return &meta
+}
+
+// checkFileMeta checks the length and sha256 hash of metadata.
+func checkFileMeta(data []byte, meta tufFileMeta) error {
+	if int64(len(data)) != meta.Length {
+		return fmt.Errorf("length %d doesn't match the pinned length %d", len(data), meta.Length)
+	}
+
+	hashed := sha256.Sum256(data)
+	if !bytes.Equal(meta.Hashes["sha256"], hashed[:]) {
+		return fmt.Errorf("sha256 hash doesn't match the pinned hash")
+	}
+	return nil
+}
+
+// tufKeyID returns the ID of key, which is the sha256 hash of the canonical
+// json of public key.
+func tufKeyID(key tufKey) (string, error) {
+	var pub struct {
+		KeyType string `json:"keytype"`
+		KeyVal  struct {
+			Private []byte `json:"private"`
+			Public  []byte `json:"public"`
+		} `json:"keyval"`
+	}
+	pub.KeyType = key.KeyType
+	pub.KeyVal.Public = key.KeyVal.Public
+
+	data, err := json.Marshal(pub)
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := canonicalJSON(data)
+	if err != nil {
+		return "", err
+	}
+
+	hashed := sha256.Sum256(canonical)
+	return hex.EncodeToString(hashed[:]), nil
+}
+
+// verifyTUFSignatures checks that the signed metadata has enough valid
+// signatures by the keys of role.
+func verifyTUFSignatures(s *tufSigned, keys map[string]tufKey, role tufRole) error {
+	threshold := role.Threshold
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	canonical, err := canonicalJSON(s.Signed)
+	if err != nil {
+		return err
+	}
+
+	verified := map[string]bool{}
+	for _, sig := range s.Signatures {
+		if verified[sig.KeyID] || !utils.StringInSlice(role.KeyIDs, sig.KeyID) {
+			continue
+		}
+
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			continue
+		}
+
+		if err := verifyTUFSignature(key, sig, canonical); err != nil {
+			continue
+		}
+		verified[sig.KeyID] = true
+	}
+
+	if len(verified) < threshold {
+		return fmt.Errorf("valid signatures %d less than threshold %d", len(verified), threshold)
+	}
+	return nil
+}
+
+// verifyTUFSignature verifies the signature by ecdsa or ed25519 key.
+func verifyTUFSignature(key tufKey, sig tufSignature, data []byte) error {
+	switch key.KeyType {
+	case "ed25519":
+		if len(key.KeyVal.Public) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid ed25519 public key")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key.KeyVal.Public), data, sig.Sig) {
+			return fmt.Errorf("invalid ed25519 signature")
+		}
+		return nil
+	case "ecdsa", "ecdsa-x509":
+		pub, err := parseECDSAPublicKey(key)
+		if err != nil {
+			return err
+		}
+
+		// the signature is the concatenation of r and s
+		size := len(sig.Sig) / 2
+		if size == 0 || len(sig.Sig)%2 != 0 {
+			return fmt.Errorf("invalid ecdsa signature")
+		}
+		r := new(big.Int).SetBytes(sig.Sig[:size])
+		s := new(big.Int).SetBytes(sig.Sig[size:])
+
+		hashed := sha256.Sum256(data)
+		if !ecdsa.Verify(pub, hashed[:], r, s) {
+			return fmt.Errorf("invalid ecdsa signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %s", key.KeyType)
+	}
+}
+
+func parseECDSAPublicKey(key tufKey) (*ecdsa.PublicKey, error) {
+	var pub interface{}
+
+	if key.KeyType == "ecdsa-x509" {
+		block, _ := pem.Decode(key.KeyVal.Public)
+		if block == nil {
+			return nil, fmt.Errorf("invalid ecdsa-x509 public key")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub = cert.PublicKey
+	} else {
+		var err error
+		if pub, err = x509.ParsePKIXPublicKey(key.KeyVal.Public); err != nil {
+			return nil, err
+		}
+	}
+
+	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not ecdsa public key")
+	}
+	return ecdsaPub, nil
+}
+
+// canonicalJSON re-encodes the json with sorted keys and without any
+// whitespace, which is the content signed by trust server.
+func canonicalJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var obj interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func targetDigest(target tufTarget) (digest.Digest, error) {
+	hash, ok := target.Hashes["sha256"]
+	if !ok || len(hash) != sha256.Size {
+		return "", fmt.Errorf("no valid sha256 hash in trust data")
+	}
+	return digest.NewDigestFromBytes(digest.SHA256, hash), nil
+}
+
+// trustedResolver resolves the tagged reference by the signed digest, so
+// that the image is named by tag but its content is pinned.
+type trustedResolver struct {
+	remotes.Resolver
+	digest digest.Digest
+}
+
+// Resolve implements remotes.Resolver.
+func (r *trustedResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	namedRef, err := reference.Parse(ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	_, desc, err := r.Resolver.Resolve(ctx, reference.WithDigest(namedRef, r.digest).String())
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	if desc.Digest != r.digest {
+		return "", ocispec.Descriptor{}, fmt.Errorf("resolved digest %s doesn't match the signed digest %s", desc.Digest, r.digest)
+	}
+	return ref, desc, nil
+}
+
+// trustedResolverIfRequired wraps the resolver with the signed digest if the
+// content trust is enabled for the registry of the requested reference. The
+// trust data is looked up by the requested reference even if the image is
+// pulled from mirror, since the mirror serves the same content.
+func (mgr *ImageManager) trustedResolverIfRequired(ctx context.Context, resolver remotes.Resolver, ref string) (remotes.Resolver, error) {
+	client, ok := mgr.trustClients[mgr.registryOfReference(ref)]
+	if !ok {
+		return resolver, nil
+	}
+
+	namedRef, err := reference.Parse(addDefaultRegistryIfMissing(ref, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces))
+	if err != nil {
+		return nil, err
+	}
+
+	// the digest reference has been pinned
+	if _, ok := namedRef.(reference.Digested); ok {
+		return resolver, nil
+	}
+
+	dgst, err := client.resolveDigest(ctx, namedRef)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(err, "failed to verify content trust of %s", ref)
+	}
+
+	return &trustedResolver{
+		Resolver: resolver,
+		digest:   dgst,
+	}, nil
+}
@@ -0,0 +1,296 @@
+package mgr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibaba/pouch/pkg/reference"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTUFKey(t *testing.T) (*ecdsa.PrivateKey, tufKey) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	key := tufKey{KeyType: "ecdsa"}
+	key.KeyVal.Public = pub
+	return priv, key
+}
+
+func signTUF(t *testing.T, priv *ecdsa.PrivateKey, keyID string, signed []byte) tufSignature {
+	canonical, err := canonicalJSON(signed)
+	if err != nil {
+		t.Fatalf("failed to get canonical json: %v", err)
+	}
+
+	hashed := sha256.Sum256(canonical)
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hashed[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	// r and s are padded to the size of curve
+	size := (priv.Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(sig[size-len(rb):size], rb)
+	copy(sig[2*size-len(sb):], sb)
+
+	return tufSignature{KeyID: keyID, Method: "ecdsa", Sig: sig}
+}
+
+func TestVerifyTUFSignatures(t *testing.T) {
+	priv1, key1 := newTestTUFKey(t)
+	priv2, key2 := newTestTUFKey(t)
+	keys := map[string]tufKey{"key1": key1, "key2": key2}
+
+	// the signed part is verified by its canonical form
+	signed := json.RawMessage(`{"_type": "Targets", "targets": {"latest": {"length": 1}}}`)
+	tampered := json.RawMessage(`{"_type": "Targets", "targets": {"latest": {"length": 2}}}`)
+
+	for _, tc := range []struct {
+		name    string
+		signed  json.RawMessage
+		sigs    []tufSignature
+		role    tufRole
+		wantErr bool
+	}{
+		{
+			name:   "signed by key in role",
+			signed: signed,
+			sigs:   []tufSignature{signTUF(t, priv1, "key1", signed)},
+			role:   tufRole{KeyIDs: []string{"key1"}, Threshold: 1},
+		}, {
+			name:    "signed by key not in role",
+			signed:  signed,
+			sigs:    []tufSignature{signTUF(t, priv2, "key2", signed)},
+			role:    tufRole{KeyIDs: []string{"key1"}, Threshold: 1},
+			wantErr: true,
+		}, {
+			name:    "tampered content",
+			signed:  tampered,
+			sigs:    []tufSignature{signTUF(t, priv1, "key1", signed)},
+			role:    tufRole{KeyIDs: []string{"key1"}, Threshold: 1},
+			wantErr: true,
+		}, {
+			name:    "signature by wrong key",
+			signed:  signed,
+			sigs:    []tufSignature{signTUF(t, priv2, "key1", signed)},
+			role:    tufRole{KeyIDs: []string{"key1"}, Threshold: 1},
+			wantErr: true,
+		}, {
+			name:    "duplicate signatures under threshold",
+			signed:  signed,
+			sigs:    []tufSignature{signTUF(t, priv1, "key1", signed), signTUF(t, priv1, "key1", signed)},
+			role:    tufRole{KeyIDs: []string{"key1", "key2"}, Threshold: 2},
+			wantErr: true,
+		}, {
+			name:   "meet threshold",
+			signed: signed,
+			sigs:   []tufSignature{signTUF(t, priv1, "key1", signed), signTUF(t, priv2, "key2", signed)},
+			role:   tufRole{KeyIDs: []string{"key1", "key2"}, Threshold: 2},
+		},
+	} {
+		err := verifyTUFSignatures(&tufSigned{Signed: tc.signed, Signatures: tc.sigs}, keys, tc.role)
+		assert.Equal(t, tc.wantErr, err != nil, "%s: %v", tc.name, err)
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	got, err := canonicalJSON([]byte(`{"b": 1, "a": {"d": "<x>", "c": [1, 2]}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":{"c":[1,2],"d":"<x>"},"b":1}`, string(got))
+}
+
+func TestTUFKeyID(t *testing.T) {
+	key := tufKey{KeyType: "ed25519"}
+	key.KeyVal.Public = []byte("pub")
+
+	id, err := tufKeyID(key)
+	assert.NoError(t, err)
+
+	// the ID is the sha256 of canonical json, whose private key is null
+	hashed := sha256.Sum256([]byte(`{"keytype":"ed25519","keyval":{"private":null,"public":"cHVi"}}`))
+	assert.Equal(t, hex.EncodeToString(hashed[:]), id)
+}
+
+// trustServer serves the signed metadata of busybox, whose roles are signed
+// by the same key.
+type trustServer struct {
+	t     *testing.T
+	priv  *ecdsa.PrivateKey
+	keyID string
+	files map[string][]byte
+}
+
+func newTrustServer(t *testing.T, target digest.Digest) *trustServer {
+	priv, key := newTestTUFKey(t)
+	keyID, err := tufKeyID(key)
+	assert.NoError(t, err)
+
+	s := &trustServer{t: t, priv: priv, keyID: keyID, files: map[string][]byte{}}
+	expires := time.Now().Add(time.Hour)
+
+	role := tufRole{KeyIDs: []string{keyID}, Threshold: 1}
+	s.sign("root", tufRoot{
+		Type:    "Root",
+		Expires: expires,
+		Keys:    map[string]tufKey{keyID: key},
+		Roles:   map[string]tufRole{"root": role, "targets": role, "snapshot": role, "timestamp": role},
+	})
+	s.sign("targets", tufTargets{
+		Type:    "Targets",
+		Expires: expires,
+		Targets: map[string]tufTarget{
+			"latest": {Hashes: map[string][]byte{"sha256": hexBytes(t, target.Hex())}, Length: 1},
+		},
+	})
+	s.sign("snapshot", tufFiles{Type: "Snapshot", Expires: expires, Meta: map[string]tufFileMeta{"targets": s.meta("targets")}})
+	s.sign("timestamp", tufFiles{Type: "Timestamp", Expires: expires, Meta: map[string]tufFileMeta{"snapshot": s.meta("snapshot")}})
+	return s
+}
+
+func (s *trustServer) sign(role string, obj interface{}) {
+	signed, err := json.Marshal(obj)
+	assert.NoError(s.t, err)
+
+	data, err := json.Marshal(tufSigned{
+		Signed:     signed,
+		Signatures: []tufSignature{signTUF(s.t, s.priv, s.keyID, signed)},
+	})
+	assert.NoError(s.t, err)
+	s.files[role] = data
+}
+
+func (s *trustServer) meta(role string) tufFileMeta {
+	hashed := sha256.Sum256(s.files[role])
+	return tufFileMeta{Length: int64(len(s.files[role])), Hashes: map[string][]byte{"sha256": hashed[:]}}
+}
+
+func (s *trustServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	role := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/docker.io/library/busybox/_trust/tuf/"), ".json")
+	data, ok := s.files[role]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func hexBytes(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestTrustClientResolveDigest(t *testing.T) {
+	target := digest.FromString("signed")
+	named, err := reference.Parse("docker.io/library/busybox:latest")
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		tamper  func(s *trustServer)
+		pinned  func(s *trustServer) []string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+		}, {
+			name:    "root key not pinned",
+			pinned:  func(s *trustServer) []string { return []string{"other"} },
+			wantErr: true,
+		}, {
+			name: "root key replaced under pinned ID",
+			tamper: func(s *trustServer) {
+				var key tufKey
+				s.priv, key = newTestTUFKey(t)
+				s.sign("root", tufRoot{
+					Type:    "Root",
+					Expires: time.Now().Add(time.Hour),
+					Keys:    map[string]tufKey{s.keyID: key},
+					Roles:   map[string]tufRole{"root": {KeyIDs: []string{s.keyID}, Threshold: 1}},
+				})
+			},
+			wantErr: true,
+		}, {
+			name: "targets not pinned by snapshot",
+			tamper: func(s *trustServer) {
+				s.sign("targets", tufTargets{Type: "Targets", Expires: time.Now().Add(time.Hour)})
+			},
+			wantErr: true,
+		}, {
+			name: "snapshot not pinned by timestamp",
+			tamper: func(s *trustServer) {
+				s.sign("snapshot", tufFiles{Type: "Snapshot", Expires: time.Now().Add(time.Hour)})
+			},
+			wantErr: true,
+		}, {
+			name: "expired timestamp",
+			tamper: func(s *trustServer) {
+				s.sign("timestamp", tufFiles{Type: "Timestamp", Expires: time.Now().Add(-time.Hour), Meta: map[string]tufFileMeta{"snapshot": s.meta("snapshot")}})
+			},
+			wantErr: true,
+		},
+	} {
+		s := newTrustServer(t, target)
+		pinned := []string{s.keyID}
+		if tc.pinned != nil {
+			pinned = tc.pinned(s)
+		}
+		if tc.tamper != nil {
+			tc.tamper(s)
+		}
+
+		server := httptest.NewServer(s)
+		dgst, err := newTrustClient(server.URL, pinned, false, nil).resolveDigest(context.TODO(), named)
+		server.Close()
+
+		assert.Equal(t, tc.wantErr, err != nil, "%s: %v", tc.name, err)
+		if !tc.wantErr {
+			assert.Equal(t, target, dgst, tc.name)
+		}
+	}
+}
+
+func TestTrustedResolverByRequestedRegistry(t *testing.T) {
+	mgr := &ImageManager{
+		DefaultRegistry:  "docker.io",
+		DefaultNamespace: "library",
+		trustClients: map[string]*trustClient{
+			"docker.io": newTrustClient("http://127.0.0.1:0", []string{"key"}, false, nil),
+		},
+	}
+
+	// the trust of docker.io is required even if it's pulled from mirror
+	_, err := mgr.trustedResolverIfRequired(context.TODO(), nil, "busybox:latest")
+	assert.Error(t, err)
+
+	// the pinned digest doesn't require trust data
+	_, err = mgr.trustedResolverIfRequired(context.TODO(), nil, "busybox@"+digest.FromString("x").String())
+	assert.NoError(t, err)
+
+	// the trust is not enabled for other registry
+	_, err = mgr.trustedResolverIfRequired(context.TODO(), nil, "reg.abc.com/library/busybox:latest")
+	assert.NoError(t, err)
+}
@@ -1,6 +1,136 @@
 package mgr
 
+import (
+	"github.com/alibaba/pouch/ctrd"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ImagePullOption wraps the image pull interface params.
+type ImagePullOption struct {
+	// AcceptMediaTypes is the preferred manifest media types, which is used
+	// as Accept header to negotiate the manifest format with the registry.
+	// The registry's default is used if it's empty.
+	AcceptMediaTypes []string
+
+	// IndexOnly fetches the index and the content of all the platforms
+	// without unpacking, and the image ID is the digest of index.
+	IndexOnly bool
+
+	// BestEffort skips the platforms unavailable in the registry instead of
+	// failing the index-only pull, like the mirror which is syncing. The
+	// skipped platforms are reported in the progress.
+	BestEffort bool
+
+	// MaxImageSize fails the pull before downloading any layer if the summed
+	// size of layers is larger than it. The smaller one of it and the
+	// limitation in config is used, and zero means only the limitation in
+	// config is used.
+	MaxImageSize int64
+
+	// Proxy is the HTTP/HTTPS proxy to access the registries and mirrors,
+	// which overrides the proxy of registry in config.
+	Proxy string
+
+	// Lazy fetches the manifest and config only, and the layers are
+	// fetched on demand by the remote snapshotter. The snapshotter should
+	// be one of remote-snapshotters in config.
+	Lazy bool
+
+	// Snapshotter is the snapshotter to unpack the image into instead of
+	// the default one, which should be allowed by pull-snapshotters in
+	// config. The default snapshotter is used if it's empty.
+	Snapshotter string
+
+	// RateLimitNotifier is called when the rate limit of registry changes
+	// during the pull, besides the progress message. It's not called for
+	// the caller joining the in-flight pull of the same image.
+	RateLimitNotifier ctrd.RateLimitNotifier
+}
+
+// ImageListOption wraps the image list interface params.
+type ImageListOption struct {
+	// All includes the images without any reference, like the intermediate
+	// ones.
+	All bool
+
+	// Sort is the field to sort the images by. Only created is supported,
+	// and the images are not sorted if it's empty.
+	Sort string
+
+	// Order is asc or desc, and desc is used if it's empty.
+	Order string
+
+	// Limit is the max number of images in one page. All the images are
+	// returned if it's zero.
+	Limit int
+
+	// Since is the cursor of page, which is the ID of the last image in
+	// the previous page.
+	Since string
+
+	// Warn is called with the ID of image which is skipped because it
+	// can't be converted into ImageInfo, like the one removed during the
+	// list. The failures are only logged if it's nil.
+	Warn func(id digest.Digest, err error)
+}
+
+const (
+	// ImageListSortCreated sorts the images by creation time.
+	ImageListSortCreated = "created"
+
+	// ImageListOrderAsc sorts the images in ascending order.
+	ImageListOrderAsc = "asc"
+
+	// ImageListOrderDesc sorts the images in descending order.
+	ImageListOrderDesc = "desc"
+)
+
 // ImageRemoveOption wraps the image remove interface params.
 type ImageRemoveOption struct {
 	Force bool
+
+	// PruneDigest removes the digest references with the same name as the
+	// removed tag if they are the only references left.
+	PruneDigest bool
+}
+
+const (
+	// ImageArchiveFormatDocker is the docker archive format which contains
+	// manifest.json and repositories.
+	ImageArchiveFormatDocker = "docker"
+
+	// ImageArchiveFormatOCI is the oci image layout format which contains
+	// oci-layout, index.json and blobs.
+	ImageArchiveFormatOCI = "oci"
+)
+
+// ImageSaveOption wraps the image save interface params.
+type ImageSaveOption struct {
+	// Reproducible normalizes the tar entries so that the same image
+	// always yields byte-identical tarstream.
+	Reproducible bool
+
+	// Format is the format of tarstream, docker or oci. The docker format
+	// is used if it's empty.
+	Format string
+
+	// Compress compresses the tarstream by gzip.
+	Compress bool
+
+	// From is the base image whose layers are omitted from the tarstream,
+	// which makes a delta archive. The delta archive can only be loaded
+	// when the base image is present. It's only supported by the docker
+	// format.
+	From string
+}
+
+// ImageLoadOption wraps the image load interface params.
+type ImageLoadOption struct {
+	// Format is the required format of tarstream, docker or oci. The format
+	// will be detected by the top-level entries if it's empty.
+	Format string
 }
+
+// ImageUsedFunc returns true if the image is used by any container.
+type ImageUsedFunc func(imageID digest.Digest) (bool, error)
@@ -0,0 +1,77 @@
+package mgr
+
+import (
+	"sync"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// unpackingLayers tracks the layer chains being unpacked by the pulls. The
+// unpack references the snapshots of local images as parents before the
+// pulled image is created, so that the removal of image whose layer chain is
+// the prefix of them races with the unpack. The nil unpackingLayers tracks
+// nothing.
+type unpackingLayers struct {
+	mu     sync.Mutex
+	next   int
+	chains map[int][]digest.Digest
+}
+
+func newUnpackingLayers() *unpackingLayers {
+	return &unpackingLayers{
+		chains: make(map[int][]digest.Digest),
+	}
+}
+
+// add tracks the layer chain until the returned release is called.
+func (u *unpackingLayers) add(diffIDs []digest.Digest) func() {
+	if u == nil || len(diffIDs) == 0 {
+		return func() {}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := u.next
+	u.next++
+	u.chains[key] = diffIDs
+
+	return func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		delete(u.chains, key)
+	}
+}
+
+// shares returns true if the layer chain is the prefix of any layer chain
+// being unpacked.
+func (u *unpackingLayers) shares(diffIDs []digest.Digest) bool {
+	if u == nil || len(diffIDs) == 0 {
+		return false
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, chain := range u.chains {
+		if isLayerChainPrefix(diffIDs, chain) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLayerChainPrefix returns true if the base layer chain is the prefix of
+// the layer chain.
+func isLayerChainPrefix(base, diffIDs []digest.Digest) bool {
+	if len(base) > len(diffIDs) {
+		return false
+	}
+
+	for i := range base {
+		if base[i] != diffIDs[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package mgr
+
+import (
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnpackingLayers(t *testing.T) {
+	layer1, layer2 := digest.FromString("layer1"), digest.FromString("layer2")
+
+	u := newUnpackingLayers()
+	release := u.add([]digest.Digest{layer1, layer2})
+
+	assert.True(t, u.shares([]digest.Digest{layer1}))
+	assert.True(t, u.shares([]digest.Digest{layer1, layer2}))
+	assert.False(t, u.shares([]digest.Digest{layer2}))
+	assert.False(t, u.shares([]digest.Digest{layer1, layer2, layer1}))
+	assert.False(t, u.shares(nil))
+
+	release()
+	assert.False(t, u.shares([]digest.Digest{layer1}))
+
+	// the nil tracker tracks nothing
+	var none *unpackingLayers
+	none.add([]digest.Digest{layer1})()
+	assert.False(t, none.shares([]digest.Digest{layer1}))
+}
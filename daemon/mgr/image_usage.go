@@ -0,0 +1,126 @@
+package mgr
+
+import (
+	"context"
+
+	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	ctrdmetaimages "github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// imageBlobUsage is the blobs of the image with their sizes.
+type imageBlobUsage struct {
+	id    digest.Digest
+	used  bool
+	blobs map[digest.Digest]int64
+}
+
+// Usage returns the disk usage of images. The blobs, like the base layers,
+// shared by several images are only counted once, otherwise the sum of image
+// sizes over-reports the usage.
+//
+// The reclaimable size is the size of blobs which are not referenced by any
+// image used by containers, which is what removing all the unused images
+// frees.
+func (mgr *ImageManager) Usage(ctx context.Context, isUsed ImageUsedFunc) (*types.ImageDiskUsage, error) {
+	infos := mgr.localStore.ListCtrdImageInfo()
+
+	images := make([]imageBlobUsage, 0, len(infos))
+	for _, info := range infos {
+		blobs, err := mgr.imageBlobs(ctx, info)
+		if err != nil {
+			// NOTE: the image may be removed in the meantime.
+			if errtypes.IsNotfound(err) {
+				logrus.Warnf("failed to get the blobs of image %s: %v", info.ID, err)
+				continue
+			}
+			return nil, err
+		}
+
+		used := false
+		if isUsed != nil {
+			if used, err = isUsed(info.ID); err != nil {
+				return nil, err
+			}
+		}
+
+		images = append(images, imageBlobUsage{
+			id:    info.ID,
+			used:  used,
+			blobs: blobs,
+		})
+	}
+	return sumImageDiskUsage(images), nil
+}
+
+// imageBlobs returns the blobs of image for the platform used to inspect it.
+func (mgr *ImageManager) imageBlobs(ctx context.Context, info CtrdImageInfo) (map[digest.Digest]int64, error) {
+	refs := mgr.localStore.GetPrimaryReferences(info.ID)
+	if len(refs) == 0 {
+		return nil, pkgerrors.Wrapf(errtypes.ErrNotfound, "primary reference of image %s", info.ID)
+	}
+
+	img, err := mgr.client.GetImage(ctx, refs[0].String())
+	if err != nil {
+		return nil, err
+	}
+
+	var matcher platforms.MatchComparer
+	switch {
+	case info.IndexOnly:
+		matcher = indexOnlyPlatforms(img)
+	case info.PlatformMismatch && mgr.platformFallback != nil:
+		matcher = mgr.platformFallback
+	default:
+		matcher = platforms.Default()
+	}
+
+	blobs := make(map[digest.Digest]int64)
+	record := ctrdmetaimages.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		blobs[desc.Digest] = desc.Size
+		return nil, nil
+	})
+
+	handler := ctrdmetaimages.Handlers(record, ctrdmetaimages.FilterPlatforms(ctrdmetaimages.ChildrenHandler(img.ContentStore()), matcher))
+	if err := ctrdmetaimages.Walk(ctx, handler, img.Target()); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// sumImageDiskUsage sums the sizes of the unique blobs of images.
+func sumImageDiskUsage(images []imageBlobUsage) *types.ImageDiskUsage {
+	usage := &types.ImageDiskUsage{}
+
+	var (
+		all    = make(map[digest.Digest]int64)
+		active = make(map[digest.Digest]struct{})
+	)
+	for _, img := range images {
+		usage.Images++
+		if img.used {
+			usage.ActiveImages++
+		}
+
+		for dgst, size := range img.blobs {
+			all[dgst] = size
+			if img.used {
+				active[dgst] = struct{}{}
+			}
+		}
+	}
+
+	for dgst, size := range all {
+		usage.TotalSize += size
+		if _, ok := active[dgst]; !ok {
+			usage.ReclaimableSize += size
+		}
+	}
+	return usage
+}
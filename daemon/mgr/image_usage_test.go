@@ -0,0 +1,48 @@
+package mgr
+
+import (
+	"testing"
+
+	"github.com/alibaba/pouch/apis/types"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSumImageDiskUsage(t *testing.T) {
+	var (
+		base   = digest.FromString("base")
+		layerA = digest.FromString("a")
+		layerB = digest.FromString("b")
+	)
+
+	images := []imageBlobUsage{
+		{
+			id:    digest.FromString("image-a"),
+			used:  true,
+			blobs: map[digest.Digest]int64{base: 100, layerA: 10},
+		},
+		{
+			id:    digest.FromString("image-b"),
+			blobs: map[digest.Digest]int64{base: 100, layerB: 20},
+		},
+	}
+
+	// the shared base layer is counted once, and it isn't reclaimable
+	// because the used image-a references it.
+	assert.Equal(t, &types.ImageDiskUsage{
+		Images:          2,
+		ActiveImages:    1,
+		TotalSize:       130,
+		ReclaimableSize: 20,
+	}, sumImageDiskUsage(images))
+
+	images[0].used = false
+	assert.Equal(t, &types.ImageDiskUsage{
+		Images:          2,
+		TotalSize:       130,
+		ReclaimableSize: 130,
+	}, sumImageDiskUsage(images))
+
+	assert.Equal(t, &types.ImageDiskUsage{}, sumImageDiskUsage(nil))
+}
@@ -4,28 +4,48 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/alibaba/pouch/apis/filters"
 	"github.com/alibaba/pouch/apis/types"
+	"github.com/alibaba/pouch/ctrd"
+	"github.com/alibaba/pouch/pkg/errtypes"
 	"github.com/alibaba/pouch/pkg/reference"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes/docker"
 	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
 )
 
 var legacyDockerConfigMediaType = "application/octet-stream"
 
 // containerdImageToOciImage returns the oci image spec.
 func containerdImageToOciImage(ctx context.Context, img containerd.Image) (ocispec.Image, error) {
-	var ociImage ocispec.Image
-
 	cfg, err := img.Config(ctx)
 	if err != nil {
 		return ocispec.Image{}, err
 	}
+	return readOciImage(ctx, img.ContentStore(), cfg)
+}
+
+// readOciImage reads the oci image spec from the config descriptor.
+func readOciImage(ctx context.Context, provider content.Provider, cfg ocispec.Descriptor) (ocispec.Image, error) {
+	var ociImage ocispec.Image
 
 	// NOTE(fuweid): There is config content with legacy media type in
 	// content storage. In order to compatible with existing image,
@@ -36,7 +56,7 @@ func containerdImageToOciImage(ctx context.Context, img containerd.Image) (ocisp
 	case ocispec.MediaTypeImageConfig, images.MediaTypeDockerSchema2Config,
 		legacyDockerConfigMediaType:
 
-		data, err := content.ReadBlob(ctx, img.ContentStore(), cfg)
+		data, err := content.ReadBlob(ctx, provider, cfg)
 		if err != nil {
 			return ocispec.Image{}, err
 		}
@@ -78,8 +98,18 @@ func digestSliceToStringSlice(from []digest.Digest) []string {
 	return to
 }
 
+// registryOfReference returns the registry domain of reference. The default
+// registry is used if the reference doesn't contain one.
+func (mgr *ImageManager) registryOfReference(ref string) string {
+	fullRef := addDefaultRegistryIfMissing(ref, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces)
+	return strings.SplitN(fullRef, "/", 2)[0]
+}
+
 // addDefaultRegistryIfMissing will add default registry and namespace if missing.
-func addDefaultRegistryIfMissing(ref string, defaultRegistry, defaultNamespace string) string {
+//
+// The namespace in registryNamespaces takes precedence over the
+// defaultNamespace of the default registry.
+func addDefaultRegistryIfMissing(ref string, defaultRegistry, defaultNamespace string, registryNamespaces map[string]string) string {
 	var (
 		registry  string
 		remainder string
@@ -92,12 +122,44 @@ func addDefaultRegistryIfMissing(ref string, defaultRegistry, defaultNamespace s
 		registry, remainder = ref[:idx], ref[idx+1:]
 	}
 
-	if registry == defaultRegistry && !strings.ContainsAny(remainder, "/") {
-		remainder = defaultNamespace + "/" + remainder
+	if ns := registryNamespace(registry, defaultRegistry, defaultNamespace, registryNamespaces); ns != "" && !strings.ContainsAny(remainder, "/") {
+		remainder = ns + "/" + remainder
 	}
 	return registry + "/" + remainder
 }
 
+// registryNamespace returns the namespace attached to the unqualified name
+// in the registry. The empty namespace means nothing to be attached.
+func registryNamespace(registry, defaultRegistry, defaultNamespace string, registryNamespaces map[string]string) string {
+	if ns, ok := registryNamespaces[registry]; ok {
+		return ns
+	}
+
+	if registry == defaultRegistry {
+		return defaultNamespace
+	}
+	return ""
+}
+
+// mirrorPathPlaceholder is replaced with the repository path of reference in
+// the mirror template, like mirror.internal/dockerhub/{path}.
+const mirrorPathPlaceholder = "{path}"
+
+// isMirrorTemplate returns true if the mirror is a rewrite template.
+func isMirrorTemplate(mirror string) bool {
+	return strings.Contains(mirror, mirrorPathPlaceholder)
+}
+
+// mirrorReference returns the candidate reference of mirror. The repository
+// path with tag or digest, like library/ubuntu:20.04, takes the place of
+// {path} if the mirror is a template, or it's joined to the mirror.
+func mirrorReference(mirror, repoPath string) string {
+	if isMirrorTemplate(mirror) {
+		return strings.Replace(mirror, mirrorPathPlaceholder, repoPath, 1)
+	}
+	return path.Join(mirror, repoPath)
+}
+
 // uniqueLocatorReference checks the references have the same locator.
 //
 // For example,
@@ -121,3 +183,374 @@ func uniqueLocatorReference(refs []reference.Named) bool {
 	}
 	return true
 }
+
+// uniqueRegistryReference checks the references are in the same registry.
+//
+// For example,
+//
+//	A. localhost:5000/busybox:latest
+//	B. localhost:5000/base:1.0
+//	C. docker.io/busybox:latest
+//
+// Both A and B are in the same registry, but the C isn't.
+func uniqueRegistryReference(refs []reference.Named) bool {
+	var registry string
+	for _, ref := range refs {
+		domain := strings.SplitN(ref.Name(), "/", 2)[0]
+		if registry == "" {
+			registry = domain
+			continue
+		}
+
+		if registry != domain {
+			return false
+		}
+	}
+	return true
+}
+
+// supportedManifestMediaTypes is the manifest media types which can be
+// consumed by the pull.
+var supportedManifestMediaTypes = map[string]bool{
+	images.MediaTypeDockerSchema1Manifest:     true,
+	images.MediaTypeDockerSchema2Manifest:     true,
+	images.MediaTypeDockerSchema2ManifestList: true,
+	ocispec.MediaTypeImageManifest:            true,
+	ocispec.MediaTypeImageIndex:               true,
+}
+
+// isIndexMediaType returns true if the media type is manifest list or index.
+func isIndexMediaType(mediaType string) bool {
+	return mediaType == images.MediaTypeDockerSchema2ManifestList || mediaType == ocispec.MediaTypeImageIndex
+}
+
+// indexOnlyPlatforms matches the platforms stored by the index-only image,
+// which are all the platforms except the ones skipped by best-effort pull.
+func indexOnlyPlatforms(img containerd.Image) platforms.MatchComparer {
+	return ctrd.ExcludePlatforms(platforms.All, ctrd.SkippedPlatforms(img))
+}
+
+// indexPlatform returns the platform selected from the manifest list by
+// the matcher, like linux/arm64/v8. It's empty if the target isn't manifest
+// list.
+func indexPlatform(ctx context.Context, provider content.Provider, target ocispec.Descriptor, matcher platforms.MatchComparer) (string, error) {
+	if !isIndexMediaType(target.MediaType) {
+		return "", nil
+	}
+
+	data, err := content.ReadBlob(ctx, provider, target)
+	if err != nil {
+		return "", err
+	}
+
+	var index ocispec.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", err
+	}
+	return selectPlatform(index.Manifests, matcher), nil
+}
+
+// selectPlatform selects the platform from the manifests of index like the
+// containerd does, which prefers the one ordered first by the matcher.
+func selectPlatform(manifests []ocispec.Descriptor, matcher platforms.MatchComparer) string {
+	var matched []ocispec.Platform
+	for _, desc := range manifests {
+		if desc.Platform != nil && matcher.Match(*desc.Platform) {
+			matched = append(matched, *desc.Platform)
+		}
+	}
+
+	if len(matched) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matcher.Less(matched[i], matched[j])
+	})
+	return platforms.Format(matched[0])
+}
+
+// validateManifestMediaTypes returns error if there is unsupported manifest
+// media type.
+func validateManifestMediaTypes(mediaTypes []string) error {
+	for _, mediaType := range mediaTypes {
+		if !supportedManifestMediaTypes[mediaType] {
+			return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "unsupported manifest media type %q", mediaType)
+		}
+	}
+	return nil
+}
+
+// matchDigestReference returns true if the canonical digest reference matches
+// the Name@Digest pattern. Both the full name and the familiar name, which
+// is the trailing components of the name like busybox or library/busybox,
+// can be used in the pattern.
+func matchDigestReference(pattern, ref string) (bool, error) {
+	i, j := strings.LastIndex(pattern, "@"), strings.LastIndex(ref, "@")
+	if i == -1 || j == -1 {
+		return false, nil
+	}
+
+	namePattern, digestPattern := pattern[:i], pattern[i+1:]
+	name, dig := ref[:j], ref[j+1:]
+
+	if ok, err := path.Match(digestPattern, dig); err != nil || !ok {
+		return false, err
+	}
+
+	components := strings.Split(name, "/")
+	for k := range components {
+		if ok, err := path.Match(namePattern, strings.Join(components[k:], "/")); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// getDanglingFilter returns the value of dangling filter and whether the
+// filter has been set.
+func getDanglingFilter(filter filters.Args) (bool, bool, error) {
+	values := filter.Get("dangling")
+	if len(values) == 0 {
+		return false, false, nil
+	}
+
+	// refuse undefined behavior
+	if len(values) > 1 {
+		return false, false, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "can't use dangling filter more than one")
+	}
+
+	dangling, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, false, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid filter 'dangling=%s'", values[0])
+	}
+	return dangling, true, nil
+}
+
+// isDanglingImage returns true if there is no tag reference for the image.
+// The image pulled by digest only is dangling too.
+func isDanglingImage(refs []reference.Named) bool {
+	for _, ref := range refs {
+		if reference.IsNameTagged(ref) {
+			return false
+		}
+	}
+	return true
+}
+
+// retryableStatusPattern matches the unexpected 5xx status code returned by
+// registry, like "unexpected status code https://...: 503 Service Unavailable".
+var retryableStatusPattern = regexp.MustCompile(`unexpected status.*: 5\d{2}\b`)
+
+// isRetryablePullError returns true if the pull failure is transient, like
+// network timeout, connection reset or 5xx from the registry. The auth
+// failures and not found errors are not retryable.
+func isRetryablePullError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	cause := pkgerrors.Cause(err)
+	switch {
+	case cause == context.Canceled, cause == context.DeadlineExceeded:
+		return false
+	case errdefs.IsNotFound(cause), errtypes.IsNotfound(cause):
+		return false
+	case cause == docker.ErrInvalidAuthorization, cause == docker.ErrNoToken:
+		return false
+	case cause == io.ErrUnexpectedEOF, cause == syscall.ECONNRESET:
+		return true
+	}
+
+	if netErr, ok := cause.(net.Error); ok && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "i/o timeout") ||
+		retryableStatusPattern.MatchString(msg)
+}
+
+var (
+	// unauthorizedStatusPattern and forbiddenStatusPattern match the
+	// unexpected 401 and 403 status code returned by registry.
+	unauthorizedStatusPattern = regexp.MustCompile(`unexpected status.*: 401\b`)
+	forbiddenStatusPattern    = regexp.MustCompile(`unexpected status.*: 403\b`)
+)
+
+// classifyPullError converts the pull failure into the typed error, so that
+// the client can tell the auth failure from the unreachable registry by the
+// status code. The error which cannot be classified is returned as it is.
+func classifyPullError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errtypes.IsNotfound(err), errtypes.IsInvalidParam(err), errtypes.IsUnauthorized(err),
+		errtypes.IsForbidden(err), errtypes.IsUnreachable(err):
+		return err
+	}
+
+	cause := pkgerrors.Cause(err)
+	msg := err.Error()
+	switch {
+	case cause == context.Canceled, cause == context.DeadlineExceeded:
+		return err
+	case errdefs.IsNotFound(cause):
+		return pkgerrors.Wrap(errtypes.ErrNotfound, msg)
+	case errdefs.IsInvalidArgument(cause), cause == reference.ErrInvalid:
+		return pkgerrors.Wrap(errtypes.ErrInvalidParam, msg)
+	case cause == docker.ErrInvalidAuthorization, cause == docker.ErrNoToken, unauthorizedStatusPattern.MatchString(msg):
+		return pkgerrors.Wrap(errtypes.ErrUnauthorized, msg)
+	case forbiddenStatusPattern.MatchString(msg):
+		return pkgerrors.Wrap(errtypes.ErrForbidden, msg)
+	case cause == syscall.ECONNREFUSED, isRetryablePullError(err):
+		return pkgerrors.Wrap(errtypes.ErrUnreachable, msg)
+	}
+
+	if _, ok := cause.(net.Error); ok {
+		return pkgerrors.Wrap(errtypes.ErrUnreachable, msg)
+	}
+	return err
+}
+
+// imageHistoryKey identifies the image by the chain ID of layers and the
+// number of history entries. The intermediate image has the same key with
+// the corresponding lower history entry of its child image.
+type imageHistoryKey struct {
+	chainID    digest.Digest
+	historyLen int
+}
+
+// indexImagesByHistory returns the image IDs indexed by imageHistoryKey.
+// If there are several images with the same key, the smallest ID wins so
+// that the result is stable.
+func indexImagesByHistory(infos []CtrdImageInfo) map[imageHistoryKey]digest.Digest {
+	index := make(map[imageHistoryKey]digest.Digest, len(infos))
+	for _, info := range infos {
+		key := imageHistoryKey{
+			chainID:    identity.ChainID(info.OCISpec.RootFS.DiffIDs),
+			historyLen: len(info.OCISpec.History),
+		}
+
+		if id, ok := index[key]; ok && id < info.ID {
+			continue
+		}
+		index[key] = info.ID
+	}
+	return index
+}
+
+// validateImageListOrder validates the sort and order of list option, and
+// returns true if the images should be sorted in descending order.
+func validateImageListOrder(opt *ImageListOption) (bool, error) {
+	switch opt.Sort {
+	case "", ImageListSortCreated:
+	default:
+		return false, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid sort %q, only %s is supported", opt.Sort, ImageListSortCreated)
+	}
+
+	switch opt.Order {
+	case "", ImageListOrderDesc:
+		return true, nil
+	case ImageListOrderAsc:
+		return false, nil
+	default:
+		return false, pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid order %q, should be %s or %s", opt.Order, ImageListOrderAsc, ImageListOrderDesc)
+	}
+}
+
+// validateImageListPage validates the pagination of list option, and returns
+// the cursor as image ID.
+func validateImageListPage(opt *ImageListOption) (digest.Digest, error) {
+	if opt.Limit < 0 {
+		return "", pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid limit %d", opt.Limit)
+	}
+
+	if opt.Sort != "" && (opt.Limit > 0 || opt.Since != "") {
+		return "", pkgerrors.Wrap(errtypes.ErrInvalidParam, "cannot use sort with limit or since, the pages are sorted by image ID")
+	}
+
+	if opt.Since == "" {
+		return "", nil
+	}
+
+	since := opt.Since
+	if !strings.HasPrefix(since, digest.Canonical.String()+":") {
+		since = digest.Canonical.String() + ":" + since
+	}
+
+	id, err := digest.Parse(since)
+	if err != nil {
+		return "", pkgerrors.Wrapf(errtypes.ErrInvalidParam, "invalid since %q: %v", opt.Since, err)
+	}
+	return id, nil
+}
+
+// sortImagesByCreated sorts the images by creation time. The image without
+// creation time, like the index-only image, is treated as the oldest one, and
+// the images created at the same time keep their original order.
+func sortImagesByCreated(infos []CtrdImageInfo, desc bool) {
+	created := func(i int) time.Time {
+		if infos[i].OCISpec.Created == nil {
+			return time.Time{}
+		}
+		return *infos[i].OCISpec.Created
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		if desc {
+			return created(i).After(created(j))
+		}
+		return created(i).Before(created(j))
+	})
+}
+
+// orphanDigestReferences returns the references if all of them are the digest
+// references with the same name as the tag, which are orphaned after the tag
+// is removed. Otherwise, it returns nil.
+func orphanDigestReferences(refs []reference.Named, tagRef reference.Named) []reference.Named {
+	for _, ref := range refs {
+		if !reference.IsCanonicalDigested(ref) || ref.Name() != tagRef.Name() {
+			return nil
+		}
+	}
+	return refs
+}
+
+// validateImageArchiveFormat checks whether the archive format is supported.
+// The empty format is valid, which means the default one.
+func validateImageArchiveFormat(format string) error {
+	switch format {
+	case "", ImageArchiveFormatDocker, ImageArchiveFormatOCI:
+		return nil
+	default:
+		return pkgerrors.Wrapf(errtypes.ErrInvalidParam, "unsupported archive format %q, should be %s or %s", format, ImageArchiveFormatDocker, ImageArchiveFormatOCI)
+	}
+}
+
+// verifyBlob reads the blob from content store and checks its size and
+// digest against the descriptor.
+func verifyBlob(ctx context.Context, provider content.Provider, desc ocispec.Descriptor) error {
+	ra, err := provider.ReaderAt(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	verifier := desc.Digest.Verifier()
+	n, err := io.Copy(verifier, content.NewReader(ra))
+	if err != nil {
+		return err
+	}
+
+	if n != desc.Size {
+		return fmt.Errorf("blob %s has size %d, but %d is expected", desc.Digest, n, desc.Size)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("blob %s is corrupt, the digest doesn't match", desc.Digest)
+	}
+	return nil
+}
@@ -1,9 +1,24 @@
 package mgr
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
 	"testing"
 
+	"github.com/alibaba/pouch/apis/filters"
+	"github.com/alibaba/pouch/pkg/errtypes"
 	"github.com/alibaba/pouch/pkg/reference"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -44,7 +59,37 @@ func TestAddDefaultRegistry(t *testing.T) {
 			expect: defaultRegistry + "/foo/bar@sha256:58ac43b2cc92c687a32c8be6278e50a063579655fe3090125dcb2af0ff9e1a64",
 		},
 	} {
-		assert.Equal(t, addDefaultRegistryIfMissing(tc.repo, defaultRegistry, defaultNamespace), tc.expect)
+		assert.Equal(t, addDefaultRegistryIfMissing(tc.repo, defaultRegistry, defaultNamespace, nil), tc.expect)
+	}
+}
+
+func TestAddRegistryNamespace(t *testing.T) {
+	defaultRegistry, defaultNamespace := "pouch.io", "library"
+	registryNamespaces := map[string]string{
+		"myreg.internal": "library",
+		"pouch.io":       "",
+	}
+
+	for _, tc := range []struct {
+		repo   string
+		expect string
+	}{
+		{
+			repo:   "myreg.internal/foo",
+			expect: "myreg.internal/library/foo",
+		}, {
+			repo:   "myreg.internal/team/foo",
+			expect: "myreg.internal/team/foo",
+		}, {
+			repo:   "other.internal/foo",
+			expect: "other.internal/foo",
+		}, {
+			// the empty namespace overrides the default namespace
+			repo:   "foo",
+			expect: "pouch.io/foo",
+		},
+	} {
+		assert.Equal(t, tc.expect, addDefaultRegistryIfMissing(tc.repo, defaultRegistry, defaultNamespace, registryNamespaces))
 	}
 }
 
@@ -85,3 +130,301 @@ func TestUniqueLocatorReference(t *testing.T) {
 		assert.Equal(t, uniqueLocatorReference(refs), tc.expect)
 	}
 }
+
+func TestUniqueRegistryReference(t *testing.T) {
+	for _, tc := range []struct {
+		refs   []string
+		expect bool
+	}{
+		{
+			refs: []string{
+				"localhost:5000/busybox:latest",
+				"localhost:5000/base:1.0",
+				"localhost:5000/busybox@sha256:58ac43b2cc92c687a32c8be6278e50a063579655fe3090125dcb2af0ff9e1a64",
+			},
+			expect: true,
+		}, {
+			refs: []string{
+				"docker.io/library/busybox:latest",
+				"localhost:5000/busybox:latest",
+			},
+			expect: false,
+		}, {
+			refs:   []string{},
+			expect: true,
+		},
+	} {
+		refs := make([]reference.Named, 0, len(tc.refs))
+		for _, ref := range tc.refs {
+			namedRef, err := reference.Parse(ref)
+			if err != nil {
+				t.Fatalf("unexpected error during parse reference %v: %v", ref, err)
+			}
+			refs = append(refs, namedRef)
+		}
+		assert.Equal(t, tc.expect, uniqueRegistryReference(refs))
+	}
+}
+
+func TestMatchDigestReference(t *testing.T) {
+	dig := "sha256:58ac43b2cc92c687a32c8be6278e50a063579655fe3090125dcb2af0ff9e1a64"
+	ref := "docker.io/library/busybox@" + dig
+
+	for _, tc := range []struct {
+		pattern string
+		expect  bool
+	}{
+		{pattern: ref, expect: true},
+		{pattern: "busybox@" + dig, expect: true},
+		{pattern: "library/busybox@" + dig, expect: true},
+		{pattern: "busy*@" + dig, expect: true},
+		{pattern: "busybox@sha256:*", expect: true},
+		{pattern: "box@" + dig, expect: false},
+		{pattern: "busybox@sha256:1234", expect: false},
+		{pattern: "ubuntu@" + dig, expect: false},
+	} {
+		got, err := matchDigestReference(tc.pattern, ref)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, got, "pattern %s", tc.pattern)
+	}
+
+	// tag reference never matches the digest pattern
+	got, err := matchDigestReference("busybox@"+dig, "docker.io/library/busybox:latest")
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestGetDanglingFilter(t *testing.T) {
+	for _, tc := range []struct {
+		values   []string
+		dangling bool
+		ok       bool
+		err      error
+	}{
+		{values: nil, dangling: false, ok: false, err: nil},
+		{values: []string{"true"}, dangling: true, ok: true, err: nil},
+		{values: []string{"0"}, dangling: false, ok: true, err: nil},
+		{values: []string{"true", "false"}, err: errtypes.ErrInvalidParam},
+		{values: []string{"foo"}, err: errtypes.ErrInvalidParam},
+	} {
+		filter := filters.NewArgs()
+		for _, v := range tc.values {
+			filter.Add("dangling", v)
+		}
+
+		dangling, ok, err := getDanglingFilter(filter)
+		if tc.err != nil {
+			assert.Equal(t, tc.err, pkgerrors.Cause(err))
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.dangling, dangling)
+		assert.Equal(t, tc.ok, ok)
+	}
+}
+
+func TestIsDanglingImage(t *testing.T) {
+	for _, tc := range []struct {
+		refs   []string
+		expect bool
+	}{
+		{
+			refs: []string{
+				"docker.io/busybox:1.28",
+				"docker.io/busybox@sha256:58ac43b2cc92c687a32c8be6278e50a063579655fe3090125dcb2af0ff9e1a64",
+			},
+			expect: false,
+		}, {
+			refs: []string{
+				"docker.io/busybox@sha256:58ac43b2cc92c687a32c8be6278e50a063579655fe3090125dcb2af0ff9e1a64",
+			},
+			expect: true,
+		}, {
+			refs:   []string{},
+			expect: true,
+		},
+	} {
+		refs := make([]reference.Named, 0, len(tc.refs))
+		for _, ref := range tc.refs {
+			namedRef, err := reference.Parse(ref)
+			if err != nil {
+				t.Fatalf("unexpected error during parse reference %v: %v", ref, err)
+			}
+			refs = append(refs, namedRef)
+		}
+		assert.Equal(t, isDanglingImage(refs), tc.expect)
+	}
+}
+
+func TestIsRetryablePullError(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		expect bool
+	}{
+		{
+			err:    nil,
+			expect: false,
+		}, {
+			err:    pkgerrors.Wrap(io.ErrUnexpectedEOF, "failed to copy"),
+			expect: true,
+		}, {
+			err:    fmt.Errorf("read tcp 10.0.0.1:4321->10.0.0.2:443: read: connection reset by peer"),
+			expect: true,
+		}, {
+			err:    pkgerrors.Errorf("unexpected status code https://reg.abc.com/v2/busybox/blobs/sha256:abc: 503 Service Unavailable"),
+			expect: true,
+		}, {
+			err:    pkgerrors.Errorf("unexpected status code https://reg.abc.com:5000/v2/busybox/blobs/sha256:abc: 401 Unauthorized"),
+			expect: false,
+		}, {
+			err:    pkgerrors.Wrap(docker.ErrInvalidAuthorization, "failed to authorize"),
+			expect: false,
+		}, {
+			err:    pkgerrors.Wrap(errdefs.ErrNotFound, "content not found"),
+			expect: false,
+		}, {
+			err:    pkgerrors.Wrap(context.Canceled, "failed to pull image"),
+			expect: false,
+		},
+	} {
+		assert.Equal(t, tc.expect, isRetryablePullError(tc.err), "%v", tc.err)
+	}
+}
+
+func TestClassifyPullError(t *testing.T) {
+	for _, tc := range []struct {
+		err   error
+		check func(error) bool
+	}{
+		{
+			err:   pkgerrors.Wrap(docker.ErrInvalidAuthorization, "failed to authorize"),
+			check: errtypes.IsUnauthorized,
+		}, {
+			err:   pkgerrors.Errorf("unexpected status code https://reg.abc.com/v2/busybox/manifests/latest: 401 Unauthorized"),
+			check: errtypes.IsUnauthorized,
+		}, {
+			err:   pkgerrors.Errorf("unexpected status code https://reg.abc.com/v2/busybox/manifests/latest: 403 Forbidden"),
+			check: errtypes.IsForbidden,
+		}, {
+			err:   pkgerrors.Errorf("unexpected status code https://reg.abc.com/v2/busybox/manifests/latest: 502 Bad Gateway"),
+			check: errtypes.IsUnreachable,
+		}, {
+			err:   &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+			check: errtypes.IsUnreachable,
+		}, {
+			err:   pkgerrors.Wrap(errdefs.ErrNotFound, "reg.abc.com/busybox:latest"),
+			check: errtypes.IsNotfound,
+		}, {
+			err:   errtypes.ErrNotfound,
+			check: errtypes.IsNotfound,
+		}, {
+			err:   pkgerrors.Wrap(reference.ErrInvalid, "failed to parse"),
+			check: errtypes.IsInvalidParam,
+		},
+	} {
+		err := classifyPullError(tc.err)
+		assert.True(t, tc.check(err), "%v", tc.err)
+		assert.Contains(t, err.Error(), tc.err.Error())
+	}
+
+	assert.Nil(t, classifyPullError(nil))
+
+	// the unknown error is not classified
+	err := fmt.Errorf("failed to unpack image")
+	assert.Equal(t, err, classifyPullError(err))
+}
+
+func TestIndexImagesByHistory(t *testing.T) {
+	layer1, layer2 := digest.FromString("layer1"), digest.FromString("layer2")
+	newImage := func(id string, diffIDs []digest.Digest, historyLen int) CtrdImageInfo {
+		info := CtrdImageInfo{ID: digest.FromString(id)}
+		info.OCISpec.RootFS.DiffIDs = diffIDs
+		info.OCISpec.History = make([]ocispec.History, historyLen)
+		return info
+	}
+
+	base := newImage("base", []digest.Digest{layer1}, 1)
+	withEnv := newImage("env", []digest.Digest{layer1}, 2)
+	child := newImage("child", []digest.Digest{layer1, layer2}, 3)
+
+	index := indexImagesByHistory([]CtrdImageInfo{child, withEnv, base})
+	assert.Equal(t, 3, len(index))
+
+	for _, tc := range []struct {
+		diffIDs    []digest.Digest
+		historyLen int
+		expect     digest.Digest
+	}{
+		{diffIDs: []digest.Digest{layer1}, historyLen: 1, expect: base.ID},
+		{diffIDs: []digest.Digest{layer1}, historyLen: 2, expect: withEnv.ID},
+		{diffIDs: []digest.Digest{layer1, layer2}, historyLen: 3, expect: child.ID},
+		{diffIDs: []digest.Digest{layer2}, historyLen: 1, expect: ""},
+	} {
+		key := imageHistoryKey{
+			chainID:    identity.ChainID(tc.diffIDs),
+			historyLen: tc.historyLen,
+		}
+		assert.Equal(t, tc.expect, index[key])
+	}
+}
+
+func TestOrphanDigestReferences(t *testing.T) {
+	dgst := digest.FromString("manifest")
+	parse := func(ref string) reference.Named {
+		namedRef, err := reference.Parse(ref)
+		assert.NoError(t, err)
+		return namedRef
+	}
+
+	var (
+		tagRef    = parse("reg.abc.com/library/busybox:latest")
+		digestRef = parse("reg.abc.com/library/busybox@" + dgst.String())
+		otherRef  = parse("reg.abc.com/library/alpine@" + dgst.String())
+		otherTag  = parse("reg.abc.com/library/busybox:1.25")
+	)
+
+	assert.Equal(t, []reference.Named{digestRef}, orphanDigestReferences([]reference.Named{digestRef}, tagRef))
+	assert.Nil(t, orphanDigestReferences([]reference.Named{digestRef, otherTag}, tagRef))
+	assert.Nil(t, orphanDigestReferences([]reference.Named{digestRef, otherRef}, tagRef))
+	assert.Nil(t, orphanDigestReferences(nil, tagRef))
+}
+
+func TestVerifyBlob(t *testing.T) {
+	provider := memProvider{}
+	good := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+
+	corrupt := provider.add(ocispec.MediaTypeImageLayerGzip, []byte("origin"))
+	provider[corrupt.Digest] = []byte("broken")
+
+	truncated := good
+	truncated.Size = good.Size + 1
+
+	missing := good
+	missing.Digest = digest.FromString("missing")
+
+	for _, tc := range []struct {
+		desc    ocispec.Descriptor
+		wantErr bool
+	}{
+		{desc: good, wantErr: false},
+		{desc: corrupt, wantErr: true},
+		{desc: truncated, wantErr: true},
+		{desc: missing, wantErr: true},
+	} {
+		err := verifyBlob(context.TODO(), provider, tc.desc)
+		assert.Equal(t, tc.wantErr, err != nil, "%v: %v", tc.desc.Digest, err)
+	}
+}
+
+func TestSelectPlatform(t *testing.T) {
+	manifests := []ocispec.Descriptor{
+		{Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		{Platform: &ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{Platform: &ocispec.Platform{OS: "windows", Architecture: "amd64"}},
+		{},
+	}
+
+	assert.Equal(t, "linux/arm64/v8", selectPlatform(manifests, platforms.Only(ocispec.Platform{OS: "linux", Architecture: "arm64"})))
+	assert.Equal(t, "windows/amd64", selectPlatform(manifests, platforms.Only(ocispec.Platform{OS: "windows", Architecture: "amd64"})))
+	assert.Equal(t, "", selectPlatform(manifests, platforms.Only(ocispec.Platform{OS: "linux", Architecture: "s390x"})))
+}
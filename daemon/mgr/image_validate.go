@@ -0,0 +1,33 @@
+package mgr
+
+import (
+	"github.com/alibaba/pouch/pkg/reference"
+)
+
+// ValidateReference validates the reference to be used as target tag, like
+// AddTag does, without tagging any image. The reference must be valid, must
+// not contain digest and must not override the existing primary reference.
+func (mgr *ImageManager) ValidateReference(ref string) error {
+	tagRef, err := mgr.normalizeTagReference(ref)
+	if err != nil {
+		return err
+	}
+	return mgr.validateTagReference(tagRef)
+}
+
+// NormalizeReference returns the normalized form of the reference, which has
+// the default registry, namespace and tag if missing.
+func (mgr *ImageManager) NormalizeReference(ref string) (string, error) {
+	tagRef, err := mgr.normalizeTagReference(ref)
+	if err != nil {
+		return "", err
+	}
+	return tagRef.String(), nil
+}
+
+// normalizeTagReference parses the target tag with the default registry and
+// namespace, like AddTag.
+func (mgr *ImageManager) normalizeTagReference(ref string) (reference.Named, error) {
+	ref = addDefaultRegistryIfMissing(ref, mgr.DefaultRegistry, mgr.DefaultNamespace, mgr.RegistryNamespaces)
+	return parseTagReference(ref)
+}
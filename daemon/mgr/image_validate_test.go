@@ -0,0 +1,52 @@
+package mgr
+
+import (
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateReference(t *testing.T) {
+	store, err := newImageStore()
+	assert.NoError(t, err)
+
+	mgr := &ImageManager{
+		DefaultRegistry:  "registry.hub.docker.com",
+		DefaultNamespace: "library",
+		localStore:       store,
+	}
+
+	id := digest.FromString("config")
+	assert.NoError(t, mgr.addReferenceIntoStore(id, mustParseReference(t, "registry.hub.docker.com/library/busybox:1.28"), id))
+
+	for _, tc := range []struct {
+		ref        string
+		normalized string
+		valid      bool
+	}{
+		{ref: "busybox", normalized: "registry.hub.docker.com/library/busybox:latest", valid: true},
+		{ref: "reg.abc.com/app:1.0", normalized: "reg.abc.com/app:1.0", valid: true},
+		{ref: "busybox@" + id.String(), normalized: "registry.hub.docker.com/library/busybox@" + id.String()},
+		// the existing primary reference cannot be overridden
+		{ref: "busybox:1.28", normalized: "registry.hub.docker.com/library/busybox:1.28"},
+		{ref: "busybox:in valid"},
+	} {
+		normalized, err := mgr.NormalizeReference(tc.ref)
+		if tc.normalized == "" {
+			assert.True(t, errtypes.IsInvalidParam(err), tc.ref)
+		} else {
+			assert.NoError(t, err, tc.ref)
+			assert.Equal(t, tc.normalized, normalized)
+		}
+
+		err = mgr.ValidateReference(tc.ref)
+		if tc.valid {
+			assert.NoError(t, err, tc.ref)
+		} else {
+			assert.True(t, errtypes.IsInvalidParam(err), tc.ref)
+		}
+	}
+}
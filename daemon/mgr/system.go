@@ -115,7 +115,7 @@ func (mgr *SystemManager) Info() (types.SystemInfo, error) {
 		OSName = osName
 	}
 
-	images, err := mgr.imageMgr.ListImages(context.Background(), filters.NewArgs())
+	images, _, err := mgr.imageMgr.ListImages(context.Background(), filters.NewArgs(), nil)
 	if err != nil {
 		logrus.Warnf("failed to get image info: %v", err)
 	}
@@ -105,6 +105,8 @@ func setupFlags(cmd *cobra.Command) {
 	flagSet.StringVar(&cfg.ConfigFile, "config-file", "/etc/pouch/config.json", "Configuration file of pouchd")
 	flagSet.StringVar(&cfg.Snapshotter, "snapshotter", "overlayfs", "Snapshotter driver of pouchd, it will be passed to containerd")
 	flagSet.BoolVar(&cfg.AllowMultiSnapshotter, "allow-multi-snapshotter", false, "If set true, pouchd will allow multi snapshotter")
+	flagSet.StringArrayVar(&cfg.PullSnapshotters, "pull-snapshotters", []string{}, "Snapshotters which can be chosen per image pull, it requires allow-multi-snapshotter")
+	flagSet.StringArrayVar(&cfg.RemoteSnapshotters, "remote-snapshotters", []string{}, "Snapshotters which support the remote snapshot and can be used by the lazy pull")
 
 	// volume config
 	flagSet.StringVar(&cfg.VolumeConfig.DriverAlias, "volume-driver-alias", "", "Set volume driver alias, <name=alias>[;name1=alias1]")
@@ -144,6 +146,36 @@ func setupFlags(cmd *cobra.Command) {
 	// registry
 	flagSet.StringArrayVar(&cfg.InsecureRegistries, "insecure-registries", []string{}, "enable insecure registry")
 	flagSet.StringArrayVar(&cfg.RegistryMirrors, "registry-mirrors", []string{}, "preferred mirror registry list")
+	flagSet.BoolVar(&cfg.MirrorOnly, "mirror-only", false, "Pull images only from the registry mirrors without falling back to the upstream registry")
+	flagSet.IntVar(&cfg.PullRetryCount, "pull-retry-count", 0, "Max times to retry pulling image on retryable errors")
+	flagSet.IntVar(&cfg.PullRetryBaseDelay, "pull-retry-base-delay", 1, "Base delay (in time.Second) between pull retries, doubled after each retry")
+	flagSet.IntVar(&cfg.PullIdleTimeout, "pull-idle-timeout", 0, "Period (in time.Second) to fail the image pull if no data is received, 0 means no limitation")
+	flagSet.Int64Var(&cfg.MaxImageSize, "max-image-size", 0, "Max summed size (in bytes) of layers of the pulled image, 0 means no limitation")
+	flagSet.StringArrayVar(&cfg.PullAllowlist, "pull-allowlist", []string{}, "Patterns of references which are allowed to pull, like docker.io/*")
+	flagSet.StringArrayVar(&cfg.PullDenylist, "pull-denylist", []string{}, "Patterns of references which are denied to pull, like */internal-secret/*")
+	flagSet.IntVar(&cfg.SearchTimeout, "search-timeout", 30, "Timeout (in time.Second) of searching images from each registry, 0 means no limitation")
+	flagSet.IntVar(&cfg.ImageBootupWorkers, "image-bootup-workers", 0, "Number of workers to load images at bootup, 0 means the number of CPUs")
+	flagSet.IntVar(&cfg.ImageLoadTimeout, "image-load-timeout", 600, "Deadline (in time.Second) to load images at bootup, 0 means the default 10 minutes")
+	flagSet.BoolVar(&cfg.RemoveCorruptImages, "remove-corrupt-images", false, "Remove the images whose content is missing at bootup")
+	flagSet.BoolVar(&cfg.AllowImplicitMultiTagRemove, "allow-implicit-multi-tag-remove", false, "Allow removing the image by ID without force if all its references are in the same registry")
+	flagSet.IntVar(&cfg.MaxConcurrentDownloads, "max-concurrent-downloads", 0, "Max number of concurrent layer downloads for each pull, 0 means no limitation")
+	flagSet.IntVar(&cfg.MaxConcurrentUploads, "max-concurrent-uploads", 0, "Max number of concurrent layer uploads for each push, 0 means no limitation")
+	flagSet.Int64Var(&cfg.PushRateLimit, "push-rate-limit", 0, "Max upload bandwidth (in bytes per second) of each push, 0 means no limitation")
+	flagSet.IntVar(&cfg.RegistryDialTimeout, "registry-dial-timeout", 30, "Timeout (in time.Second) of connecting to the registry, 0 means no limitation")
+	flagSet.IntVar(&cfg.RegistryTLSHandshakeTimeout, "registry-tls-handshake-timeout", 10, "Timeout (in time.Second) of TLS handshake with the registry, 0 means no limitation")
+	flagSet.IntVar(&cfg.RegistryResponseHeaderTimeout, "registry-response-header-timeout", 30, "Timeout (in time.Second) of waiting for the response headers of each registry request, 0 means no limitation")
+	flagSet.IntVar(&cfg.RegistryIdleTimeout, "registry-idle-timeout", 60, "Period (in time.Second) to close the registry connection if no data is transferred, 0 means no limitation")
+	flagSet.StringVar(&cfg.RegistryUserAgent, "registry-user-agent", "", "User-Agent of the requests to the registry, pouch/<version> by default")
+	flagSet.IntVar(&cfg.MaxConcurrentSaves, "max-concurrent-saves", 0, "Max number of concurrent image save operations, 0 means no limitation")
+	flagSet.IntVar(&cfg.MaxConcurrentLoads, "max-concurrent-loads", 0, "Max number of concurrent image load operations, 0 means no limitation")
+	flagSet.IntVar(&cfg.LoadMaxLayers, "load-max-layers", 0, "Max number of layers declared by each manifest in the loaded tarstream, 0 means no limitation")
+	flagSet.Int64Var(&cfg.LoadMaxManifestSize, "load-max-manifest-size", 0, "Max size (in bytes) of the manifests in the loaded tarstream, 0 means no limitation")
+	flagSet.IntVar(&cfg.LoadMaxEntries, "load-max-entries", 0, "Max number of entries in the loaded tarstream, 0 means no limitation")
+	flagSet.Int64Var(&cfg.LoadMaxSize, "load-max-size", 0, "Max total size (in bytes) of the entries in the loaded tarstream, 0 means no limitation")
+	flagSet.IntVar(&cfg.SaveCompressionLevel, "save-compression-level", 0, "Gzip level from 1 (best speed) to 9 (best compression) of the compressed image save, 0 means the default level")
+	flagSet.StringVar(&cfg.ImagePlatformFallback, "image-platform-fallback", "", "Platform like linux/amd64 used to inspect the image which doesn't match the host's platform")
+	flagSet.BoolVar(&cfg.RequireDigestPull, "require-digest-pull", false, "Only allow pulling the image by digest-pinned reference")
+	flagSet.BoolVar(&cfg.VerifyPulledContent, "verify-pulled-content", false, "Re-verify the digest of each pulled layer against the manifest before storing the image")
 
 	// buildkit
 	flagSet.BoolVar(&cfg.EnableBuilder, "enable-builder", false, "Enable buildkit functionality")
@@ -37,6 +37,16 @@ var (
 
 	// ErrPreCheckFailed represents that failed to pre check.
 	ErrPreCheckFailed = errorType{codePreCheckFailed, "pre check failed"}
+
+	// ErrUnauthorized represents that the credential is missing or wrong.
+	ErrUnauthorized = errorType{codeUnauthorized, "unauthorized"}
+
+	// ErrForbidden represents that the access is denied.
+	ErrForbidden = errorType{codeForbidden, "forbidden"}
+
+	// ErrUnreachable represents that the remote server, like registry, is
+	// unreachable or unavailable.
+	ErrUnreachable = errorType{codeUnreachable, "unreachable"}
 )
 
 const (
@@ -51,6 +61,9 @@ const (
 	codeInUse
 	codeNotModified
 	codePreCheckFailed
+	codeUnauthorized
+	codeForbidden
+	codeUnreachable
 
 	// volume error code
 	codeVolumeExisted
@@ -102,6 +115,21 @@ func IsPreCheckFailed(err error) bool {
 	return checkError(err, codePreCheckFailed)
 }
 
+// IsUnauthorized checks the error is unauthorized or not.
+func IsUnauthorized(err error) bool {
+	return checkError(err, codeUnauthorized)
+}
+
+// IsForbidden checks the error is forbidden or not.
+func IsForbidden(err error) bool {
+	return checkError(err, codeForbidden)
+}
+
+// IsUnreachable checks the error is unreachable remote server or not.
+func IsUnreachable(err error) bool {
+	return checkError(err, codeUnreachable)
+}
+
 func checkError(err error, code int) bool {
 	err = causeError(err)
 
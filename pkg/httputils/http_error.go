@@ -1,5 +1,11 @@
 package httputils
 
+import (
+	"net/http"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+)
+
 // HTTPError represents an HTTP error which contains potential status code.
 // For API layer, daemon side should return error message and using correct status code
 // to construct response when an error happens in handling requests.
@@ -25,3 +31,30 @@ func (err HTTPError) Error() string {
 func (err HTTPError) Code() int {
 	return err.statusCode
 }
+
+// StatusCode returns the status code of error. The HTTPError has its own
+// code, the typed errors in errtypes are mapped to the corresponding codes
+// and 500 is used by default.
+func StatusCode(err error) int {
+	if httpErr, ok := err.(HTTPError); ok {
+		return httpErr.Code()
+	}
+
+	switch {
+	case errtypes.IsNotfound(err):
+		return http.StatusNotFound
+	case errtypes.IsInvalidParam(err):
+		return http.StatusBadRequest
+	case errtypes.IsAlreadyExisted(err):
+		return http.StatusConflict
+	case errtypes.IsNotModified(err):
+		return http.StatusNotModified
+	case errtypes.IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case errtypes.IsForbidden(err):
+		return http.StatusForbidden
+	case errtypes.IsUnreachable(err):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
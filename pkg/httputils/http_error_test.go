@@ -0,0 +1,31 @@
+package httputils
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/alibaba/pouch/pkg/errtypes"
+
+	"github.com/pkg/errors"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{NewHTTPError(fmt.Errorf("bad"), http.StatusBadRequest), http.StatusBadRequest},
+		{errors.Wrap(errtypes.ErrNotfound, "image"), http.StatusNotFound},
+		{errors.Wrap(errtypes.ErrInvalidParam, "reference"), http.StatusBadRequest},
+		{errors.Wrap(errtypes.ErrUnauthorized, "registry"), http.StatusUnauthorized},
+		{errors.Wrap(errtypes.ErrForbidden, "registry"), http.StatusForbidden},
+		{errors.Wrap(errtypes.ErrUnreachable, "registry"), http.StatusBadGateway},
+		{fmt.Errorf("unknown"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := StatusCode(tt.err); got != tt.want {
+			t.Errorf("StatusCode(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
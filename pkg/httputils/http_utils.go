@@ -5,6 +5,31 @@ import (
 	"strings"
 )
 
+// AcceptsEncoding returns true if the Accept-Encoding header of request
+// accepts the content coding, like gzip. The coding with q=0 is refused.
+func AcceptsEncoding(r *http.Request, encoding string) bool {
+	for _, v := range r.Header["Accept-Encoding"] {
+		for _, coding := range strings.Split(v, ",") {
+			params := strings.Split(coding, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), encoding) {
+				continue
+			}
+
+			refused := false
+			for _, param := range params[1:] {
+				param = strings.Replace(param, " ", "", -1)
+				if param == "q=0" || strings.HasPrefix(param, "q=0.") && strings.Trim(param[len("q=0."):], "0") == "" {
+					refused = true
+				}
+			}
+			if !refused {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // BoolValue transforms a form value in different formats into a boolean type.
 func BoolValue(r *http.Request, k string) bool {
 	s := strings.ToLower(strings.TrimSpace(r.FormValue(k)))
@@ -48,3 +48,29 @@ func TestBoolValue(t *testing.T) {
 		})
 	}
 }
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip;q=0.8", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.000", false},
+		{"br", false},
+		{"x-gzip", false},
+	}
+	for _, tt := range tests {
+		request, _ := http.NewRequest("GET", "http://test", nil)
+		if tt.header != "" {
+			request.Header.Set("Accept-Encoding", tt.header)
+		}
+
+		if got := AcceptsEncoding(request, "gzip"); got != tt.want {
+			t.Errorf("AcceptsEncoding(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
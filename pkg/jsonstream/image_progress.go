@@ -19,9 +19,27 @@ const (
 	PullStatusExists = "exists"
 	// PullStatusDone represents done status.
 	PullStatusDone = "done"
+	// PullStatusExtracting represents extracting status.
+	PullStatusExtracting = "extracting"
+	// PullStatusComplete represents the layer has been downloaded and extracted.
+	PullStatusComplete = "pull complete"
 
 	// PushStatusUploading represents uploading status.
 	PushStatusUploading = "uploading"
+	// PushStatusPreparing represents the content waiting to be pushed.
+	PushStatusPreparing = "Preparing"
+	// PushStatusPushing represents the content being pushed.
+	PushStatusPushing = "Pushing"
+	// PushStatusExists represents the content already exists in registry,
+	// which is skipped.
+	PushStatusExists = "Layer already exists"
+	// PushStatusPushed represents the content has been pushed.
+	PushStatusPushed = "Pushed"
+
+	// LoadStatusReading represents reading tarstream status.
+	LoadStatusReading = "reading"
+	// LoadStatusComplete represents the layer has been loaded and extracted.
+	LoadStatusComplete = "load complete"
 )
 
 // ProcessStatus returns the status of download or upload image
@@ -34,9 +52,9 @@ func ProcessStatus(short bool, msg JSONMessage) string {
 	}
 
 	switch msg.Status {
-	case PullStatusResolving, PullStatusWaiting:
+	case PullStatusResolving, PullStatusWaiting, PushStatusPreparing:
 		return fmt.Sprintf("%s:\t%s\t%40r\t\n", msg.ID, msg.Status, progress.Bar(0.0))
-	case PullStatusDownloading, PushStatusUploading:
+	case PullStatusDownloading, PushStatusUploading, PushStatusPushing:
 		bar := progress.Bar(0)
 		current, total := progress.Bytes(msg.Detail.Current), progress.Bytes(msg.Detail.Total)
 
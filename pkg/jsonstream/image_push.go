@@ -36,7 +36,12 @@ func (j *PushJobs) Add(ref string) {
 	j.jobs[ref] = struct{}{}
 }
 
-// Status gets PushJobs statuses
+// Status gets PushJobs statuses, like docker push.
+//
+// The content which is waiting for the push is Preparing, and the one being
+// uploaded is Pushing with the progress. The content skipped because it
+// already exists in registry is told apart from the Pushed one, which helps
+// to understand why some pushes are instant.
 func (j *PushJobs) Status() []JSONMessage {
 	j.mu.Lock()
 	defer j.mu.Unlock()
@@ -48,23 +53,25 @@ func (j *PushJobs) Status() []JSONMessage {
 		}
 
 		status, err := j.tracker.GetStatus(name)
-		if err != nil {
-			si.Status = "waiting"
-		} else {
+		switch {
+		case err != nil:
+			si.Status = PushStatusPreparing
+		case status.StartedAt.IsZero():
+			// NOTE: the pusher records the existing content without
+			// starting the upload.
+			si.Status = PushStatusExists
+		default:
 			si.Detail = &ProgressDetail{
 				Current: status.Offset,
 				Total:   status.Total,
 			}
 			si.StartedAt = status.StartedAt
 			si.UpdatedAt = status.UpdatedAt
-			if status.Offset >= status.Total {
-				if status.UploadUUID == "" {
-					si.Status = "done"
-				} else {
-					si.Status = "committing"
-				}
+
+			if status.Offset >= status.Total && status.UploadUUID == "" {
+				si.Status = PushStatusPushed
 			} else {
-				si.Status = "uploading"
+				si.Status = PushStatusPushing
 			}
 		}
 		statuses = append(statuses, si)
@@ -0,0 +1,37 @@
+package jsonstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushJobsStatus(t *testing.T) {
+	tracker := docker.NewInMemoryTracker()
+	jobs := NewPushJobs(tracker)
+	for _, ref := range []string{"waiting", "existing", "pushing", "pushed"} {
+		jobs.Add(ref)
+	}
+	jobs.Add("pushing")
+
+	// the pusher records the existing content without starting the upload
+	tracker.SetStatus("existing", docker.Status{Status: content.Status{Ref: "existing"}})
+	tracker.SetStatus("pushing", docker.Status{Status: content.Status{Ref: "pushing", Offset: 10, Total: 100, StartedAt: time.Now()}})
+	tracker.SetStatus("pushed", docker.Status{Status: content.Status{Ref: "pushed", Offset: 100, Total: 100, StartedAt: time.Now()}})
+
+	statuses := jobs.Status()
+	assert.Len(t, statuses, 4)
+
+	var ids, status []string
+	for _, s := range statuses {
+		ids = append(ids, s.ID)
+		status = append(status, s.Status)
+	}
+	assert.Equal(t, []string{"waiting", "existing", "pushing", "pushed"}, ids)
+	assert.Equal(t, []string{PushStatusPreparing, PushStatusExists, PushStatusPushing, PushStatusPushed}, status)
+	assert.Equal(t, &ProgressDetail{Current: 10, Total: 100}, statuses[2].Detail)
+	assert.Nil(t, statuses[1].Detail)
+}